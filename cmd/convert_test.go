@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"goat/pkg/cmd/convert"
@@ -25,7 +26,7 @@ func TestConvertSimple(t *testing.T) {
 	}
 
 	dbsource := convert.NewDBSource("../samples/data/strategy_data.sqlite", "sqlite")
-	dboutput, err := db.NewSQLiteDataBase("../stategy_data.db", true)
+	dboutput, err := db.NewSQLiteDataBase(filepath.Join(t.TempDir(), "strategy_data.db"), true)
 	if err != nil {
 		t.Fatal("failed to create output db")
 	}
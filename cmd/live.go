@@ -10,6 +10,7 @@ import (
 
 	"goat/pkg/core"
 	"goat/pkg/feedgen"
+	"goat/pkg/fix"
 	"goat/pkg/js"
 	"goat/pkg/logger"
 	"goat/pkg/metrics"
@@ -23,6 +24,8 @@ import (
 var (
 	liveScriptFile     string
 	liveRecoveryDBFile string
+	liveBroker         string
+	liveParams         []string
 
 	feedProviders string
 	runWg         *sync.WaitGroup
@@ -54,6 +57,11 @@ func runLiveCmd(cmd *cobra.Command, args []string) {
 	logger.Logger.Debug("running script", zap.String("liveScriptFile", liveScriptFile))
 	logger.Logger.Debug("running with symbol", zap.String("symbol", cfg.Symbol))
 
+	if err := applyParamFlags(liveParams); err != nil {
+		logger.Logger.Error("failed to parse strategy parameters", zap.Error(err))
+		os.Exit(1)
+	}
+
 	ctx := util.NewTerminationContext()
 
 	// setup provider, data generator and feed
@@ -64,13 +72,45 @@ func runLiveCmd(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 	runWg = wg
-	feed := core.NewGenericDataFeed(ctx, &cfg, gen, nil, 250, liveRecoveryDBFile)
+	// the bars of the other frequencies are resampled from the live bars
+	hooks, err := core.NewResampleHooksControl(&cfg, core.LiveResampleFrequencies)
+	if err != nil {
+		logger.Logger.Error("failed to create resample hooks", zap.Error(err))
+		os.Exit(1)
+	}
+	feed := core.NewGenericDataFeed(ctx, &cfg, gen, hooks, 250, liveRecoveryDBFile)
 
 	// setup metrics server
 	metrics.StartMetricsServer()
 
+	var broker core.Broker
+	switch strings.ToLower(liveBroker) {
+	case "dummy":
+		broker = core.NewDummyBroker(feed)
+	case "paper":
+		paper, err := core.NewPaperBroker(&cfg, feed, liveRecoveryDBFile)
+		if err != nil {
+			logger.Logger.Error("failed to create paper broker", zap.Error(err))
+			os.Exit(1)
+		}
+		broker = paper
+	case "fix":
+		fixBroker, err := fix.NewBroker(ctx, &cfg)
+		if err != nil {
+			logger.Logger.Error("failed to create fix broker", zap.Error(err))
+			os.Exit(1)
+		}
+		broker = fixBroker
+	default:
+		logger.Logger.Error("unknown broker", zap.String("broker", liveBroker))
+		os.Exit(1)
+	}
+	portfolio := core.NewPortfolio(broker, feed, 0)
+	broker = core.NewRiskManager(&cfg, broker, portfolio, feed, notify.NewNotifiers(&cfg))
+	broker = core.NewAlgoBroker(broker, feed)
+
 	// setup js runtime
-	rt := js.NewStrategyRuntime(ctx, &cfg, feed, startLive)
+	rt := js.NewStrategyRuntime(ctx, &cfg, feed, broker, portfolio, startLive)
 	script, err := ioutil.ReadFile(liveScriptFile)
 	if err != nil {
 		logger.Logger.Error("failed to read script file", zap.Error(err))
@@ -85,10 +125,14 @@ func runLiveCmd(cmd *cobra.Command, args []string) {
 			fmt.Println(err)
 			os.Exit(1)
 		}
+		if err := rt.ValidateParams(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 
 		sel := js.NewJSStrategyEventListener(rt)
-		broker := core.NewDummyBroker(feed)
 		strategy := core.NewStrategyController(ctx, &cfg, sel, broker, feed)
+		strategy.SetClock(core.NewWallClock())
 
 		strategy.Run()
 	}
@@ -167,5 +211,13 @@ func init() {
 	liveCmd.PersistentFlags().StringVarP(&liveRecoveryDBFile, "recovery-db", "r", "",
 		"goat db file that will be replayed before go live")
 
+	liveCmd.PersistentFlags().StringVarP(&liveBroker, "broker", "", "dummy",
+		"broker executing the orders: dummy, paper or fix. the paper broker simulates the executions "+
+			"and saves its book to the bar dump db, it is restored from the recovery db. the fix broker "+
+			"routes the orders to the FIX 4.4 session of broker.fix in the config")
+
+	liveCmd.PersistentFlags().StringArrayVarP(&liveParams, "param", "P", nil,
+		"strategy parameter key=value available as system.params, it can be repeated")
+
 	rootCmd.AddCommand(liveCmd)
 }
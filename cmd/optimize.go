@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"goat/pkg/core"
+	"goat/pkg/feedgen"
+	"goat/pkg/js"
+	"goat/pkg/logger"
+	"goat/pkg/notify"
+	"goat/pkg/optimizer"
+	"goat/pkg/util"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	optimizeScriptFile string
+	optimizeDataSource string
+	optimizeGridFile   string
+	optimizeWorkers    int
+	optimizeMetric     string
+	optimizeMinimize   bool
+	optimizeOutputFile string
+	optimizeTop        int
+	optimizeVerbose    bool
+
+	optimizeCmd = &cobra.Command{
+		Use:   "optimize",
+		Short: "optimize command runs backtests over a grid of strategy parameters",
+		Long: `optimize command runs a backtest of the strategy script for every
+combination of the parameter grid and ranks them by an analyzer metric.
+
+The grid is a json or yaml file. Each key is a parameter, which is available
+to the script as system.params.<key>, and its value is a list of values or
+a range like {"start": 10, "stop": 50, "step": 10}.
+	`,
+		Run: OptimizeFunction,
+	}
+)
+
+func OptimizeFunction(cmd *cobra.Command, args []string) {
+	// handle panic
+	defer util.PanicHandler(notify.NewEmailNotifier(&cfg))
+
+	if !optimizeVerbose {
+		// backtests running in parallel produce too many logs
+		logger.Logger = logger.Logger.WithOptions(zap.IncreaseLevel(zap.WarnLevel))
+	}
+
+	grid, err := optimizer.LoadParamGrid(optimizeGridFile)
+	if err != nil {
+		logger.Logger.Error("failed to load parameter grid", zap.Error(err))
+		os.Exit(1)
+	}
+	combinations := grid.Combinations()
+	if len(combinations) == 0 {
+		logger.Logger.Error("parameter grid is empty")
+		os.Exit(1)
+	}
+	ctx := util.NewTerminationContext()
+	backtest, err := newParamsBacktest(optimizeScriptFile)
+	if err != nil {
+		logger.Logger.Error("failed to create backtest", zap.Error(err))
+		os.Exit(1)
+	}
+	defer backtest.Close()
+	values, err := loadFeedValues(ctx, optimizeDataSource)
+	if err != nil {
+		logger.Logger.Error("failed to load data source", zap.Error(err))
+		os.Exit(1)
+	}
+
+	fmt.Printf("running %d backtests with %d workers\n", len(combinations), optimizeWorkers)
+	results := optimizer.Run(ctx, combinations, optimizeWorkers,
+		func(ctx context.Context, worker int, params map[string]interface{}) (map[string]float64, error) {
+			metrics, _, err := backtest.run(ctx, worker, values, params)
+			return metrics, err
+		})
+	optimizer.Rank(results, optimizeMetric, optimizeMinimize)
+
+	printLeaderboard(results, grid.Names(), optimizeMetric, optimizeTop)
+	if optimizeOutputFile != "" {
+		if err := writeLeaderboard(optimizeOutputFile, results, grid.Names()); err != nil {
+			logger.Logger.Error("failed to write leaderboard", zap.Error(err))
+			os.Exit(1)
+		}
+	}
+}
+
+// loadFeedValues reads the whole data source once, so that every backtest
+// replays the same values instead of loading the source again
+func loadFeedValues(ctx context.Context, dataSource string) ([]feedgen.FeedValue, error) {
+	gen := NewFeedGenerator(dataSource)
+	if gen == nil {
+		return nil, fmt.Errorf("failed to create feed generator")
+	}
+	values, err := feedgen.ReadAllValues(ctx, gen)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("data source has no data")
+	}
+	return values, nil
+}
+
+// paramsBacktest runs the strategy script with different parameters. The
+// backtests may run in parallel, every worker has its own kvdb file since
+// bolt locks it.
+type paramsBacktest struct {
+	script  string
+	tmpDir  string
+	actions []core.CorporateAction
+}
+
+func newParamsBacktest(scriptFile string) (*paramsBacktest, error) {
+	script, err := ioutil.ReadFile(scriptFile)
+	if err != nil {
+		return nil, err
+	}
+	// the corporate actions are fetched once for all the backtests
+	actions, err := loadCorporateActions()
+	if err != nil {
+		return nil, err
+	}
+	tmpDir, err := ioutil.TempDir("", "goat-optimize")
+	if err != nil {
+		return nil, err
+	}
+	return &paramsBacktest{
+		script:  string(script),
+		tmpDir:  tmpDir,
+		actions: actions,
+	}, nil
+}
+
+func (p *paramsBacktest) Close() error {
+	return os.RemoveAll(p.tmpDir)
+}
+
+// run replays values to the strategy with params added to the strategy
+// parameters of the config, and returns the analyzer metrics keyed by
+// "analyzer.metric" together with the equity curve.
+func (p *paramsBacktest) run(ctx context.Context, worker int, values []feedgen.FeedValue,
+	params map[string]interface{},
+) (metrics map[string]float64, equity []optimizer.EquityPoint, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("backtest panic: %v", r)
+		}
+	}()
+
+	runCfg := cfg
+	runCfg.Params = make(map[string]interface{}, len(cfg.Params)+len(params))
+	for k, v := range cfg.Params {
+		runCfg.Params[k] = v
+	}
+	for k, v := range params {
+		runCfg.Params[k] = v
+	}
+	runCfg.Dump.BarDumpDB = ""
+	// the state of the strategy must not leak into the next backtest
+	runCfg.KVDB = filepath.Join(p.tmpDir, fmt.Sprintf("worker-%d.kvdb", worker))
+	defer os.Remove(runCfg.KVDB)
+
+	gen := feedgen.NewReplayFeedGenerator(values)
+	feed := core.NewGenericDataFeed(ctx, &runCfg, gen, nil, 100, "")
+	backtestBroker, err := core.NewBacktestBroker(&runCfg, feed)
+	if err != nil {
+		return nil, nil, err
+	}
+	backtestBroker.(core.CorporateActionHandler).AddCorporateActions(p.actions...)
+	portfolio := core.NewPortfolio(backtestBroker, feed, 0)
+	broker := core.NewAlgoBroker(core.NewRiskManager(&runCfg, backtestBroker, portfolio, feed, nil), feed)
+
+	rt := js.NewStrategyRuntime(ctx, &runCfg, feed, broker, portfolio, nil)
+	defer rt.Close()
+	compiledScript, err := rt.Compile(p.script)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := rt.Execute(compiledScript); err != nil {
+		return nil, nil, err
+	}
+	if err := rt.ValidateParams(); err != nil {
+		return nil, nil, err
+	}
+
+	sel := js.NewJSStrategyEventListener(rt)
+	strategy := core.NewStrategyController(ctx, &runCfg, sel, broker, feed)
+	for _, analyzer := range core.NewDefaultAnalyzers(portfolio) {
+		strategy.AttachAnalyzer(analyzer)
+	}
+	strategy.Run()
+
+	metrics = map[string]float64{}
+	for _, analyzer := range strategy.GetAnalyzers() {
+		for _, m := range analyzer.GetMetrics() {
+			metrics[analyzer.GetName()+"."+m.Name] = m.Value
+		}
+	}
+	ds := portfolio.GetEquityDataSeries()
+	for i := 0; i < ds.Len(); i++ {
+		if t, v, err := ds.At(i); err == nil {
+			equity = append(equity, optimizer.EquityPoint{DateTime: t, Equity: v.(float64)})
+		}
+	}
+	return metrics, equity, nil
+}
+
+func printLeaderboard(results []*optimizer.Result, paramNames []string, metric string, top int) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "RANK\t%s\t%s\n", strings.ToUpper(strings.Join(paramNames, "\t")),
+		strings.ToUpper(metric))
+	for i, r := range results {
+		if top > 0 && i >= top {
+			break
+		}
+		values := make([]string, 0, len(paramNames))
+		for _, name := range paramNames {
+			values = append(values, fmt.Sprint(r.Params[name]))
+		}
+		value := "-"
+		if r.Err != nil {
+			value = "error: " + r.Err.Error()
+		} else if v, ok := r.Metrics[metric]; ok {
+			value = core.AnalyzerMetric{Value: v}.String()
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", i+1, strings.Join(values, "\t"), value)
+	}
+	tw.Flush()
+}
+
+func writeLeaderboard(path string, results []*optimizer.Result, paramNames []string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return optimizer.WriteJSON(f, results)
+	case ".csv":
+		return optimizer.WriteCSV(f, results, paramNames)
+	default:
+		return fmt.Errorf("unsupported leaderboard file type %s", filepath.Ext(path))
+	}
+}
+
+func init() {
+	optimizeCmd.PersistentFlags().StringVarP(&optimizeScriptFile, "strategy", "f", "",
+		"strategy js script file")
+	optimizeCmd.MarkPersistentFlagRequired("strategy")
+
+	optimizeCmd.PersistentFlags().StringVarP(&optimizeDataSource, "datasource", "s", "",
+		"data source(support url scheme: csv, yahoo) e.g. csv:///path/to/file.csv or yahoo://")
+	optimizeCmd.MarkPersistentFlagRequired("datasource")
+
+	optimizeCmd.PersistentFlags().StringVarP(&optimizeGridFile, "grid", "g", "",
+		"parameter grid json or yaml file")
+	optimizeCmd.MarkPersistentFlagRequired("grid")
+
+	optimizeCmd.PersistentFlags().IntVarP(&optimizeWorkers, "workers", "w", runtime.NumCPU(),
+		"number of backtests running in parallel")
+	optimizeCmd.PersistentFlags().StringVarP(&optimizeMetric, "metric", "m", "sharpe.sharpeRatio",
+		"analyzer metric used to rank the results, e.g. returns.cumulativeReturn")
+	optimizeCmd.PersistentFlags().BoolVarP(&optimizeMinimize, "minimize", "", false,
+		"rank lower metric values first, e.g. for drawdown.maxDrawDown")
+	optimizeCmd.PersistentFlags().StringVarP(&optimizeOutputFile, "output", "o", "",
+		"write the leaderboard to this csv or json file")
+	optimizeCmd.PersistentFlags().IntVarP(&optimizeTop, "top", "", 10,
+		"number of results to print, 0 prints all")
+	optimizeCmd.PersistentFlags().BoolVarP(&optimizeVerbose, "verbose", "v", false,
+		"keep the logs of the backtests")
+
+	rootCmd.AddCommand(optimizeCmd)
+}
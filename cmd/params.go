@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// applyParamFlags adds the key=value strategy parameters of the command
+// line to the config. They override the parameters of the config file,
+// whose keys are lowercased by viper, so keys are compared case
+// insensitively. The values are strings, the parameter schema declared by
+// the script converts them.
+func applyParamFlags(params []string) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if cfg.Params == nil {
+		cfg.Params = map[string]interface{}{}
+	}
+	for _, p := range params {
+		kv := strings.SplitN(p, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || key == "" {
+			return fmt.Errorf("invalid strategy parameter %q, it should be key=value", p)
+		}
+		for k := range cfg.Params {
+			if strings.EqualFold(k, key) {
+				delete(cfg.Params, k)
+			}
+		}
+		cfg.Params[key] = kv[1]
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package cmd
+
+import "testing"
+
+func TestApplyParamFlags(t *testing.T) {
+	saved := cfg.Params
+	defer func() { cfg.Params = saved }()
+
+	cfg.Params = map[string]interface{}{"period": 20.0, "mode": "long"}
+	if err := applyParamFlags([]string{"Period=30", "url=http://a?b=c"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Params) != 3 || cfg.Params["Period"] != "30" || cfg.Params["mode"] != "long" ||
+		cfg.Params["url"] != "http://a?b=c" {
+		t.Errorf("unexpected params %v", cfg.Params)
+	}
+
+	for _, p := range []string{"period", "=30"} {
+		if err := applyParamFlags([]string{p}); err == nil {
+			t.Errorf("expected error for %q", p)
+		}
+	}
+}
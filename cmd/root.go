@@ -47,6 +47,9 @@ func init() {
 		"delete old bar dump file if it exists")
 	rootCmd.PersistentFlags().StringVarP(&cfg.Symbol, "symbol", "S", "",
 		"live feed data symbol name")
+	rootCmd.PersistentFlags().Float64P("cash", "", 0,
+		fmt.Sprintf("initial cash of the broker, it overrides broker.cash of the config file (default %d in backtests)",
+			config.DefaultBacktestCash))
 }
 
 var (
@@ -64,10 +67,11 @@ func initConfig() {
 	}
 	viper.AutomaticEnv()
 	viper.BindPFlag("symbol", rootCmd.PersistentFlags().Lookup("symbol"))
+	// the flag takes precedence over the config file when it is set
+	viper.BindPFlag("broker.cash", rootCmd.PersistentFlags().Lookup("cash"))
 
 	if err := viper.ReadInConfig(); err != nil {
 		fmt.Println("no config file found")
-		return
 	}
 
 	if err := viper.Unmarshal(&cfg); err != nil {
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestCashFlag(t *testing.T) {
+	savedCfg, savedFile := cfg, cfgFile
+	flag := rootCmd.PersistentFlags().Lookup("cash")
+	defer func() {
+		cfg, cfgFile = savedCfg, savedFile
+		flag.Value.Set("0")
+		flag.Changed = false
+		viper.Reset()
+	}()
+
+	cfgFile = filepath.Join(t.TempDir(), "goat.json")
+	if err := ioutil.WriteFile(cfgFile, []byte(`{"broker": {"cash": 5000}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	initConfig()
+	if cfg.Broker.Cash != 5000 {
+		t.Errorf("cash is %f, expected the cash of the config file", cfg.Broker.Cash)
+	}
+
+	if err := rootCmd.PersistentFlags().Set("cash", "2000"); err != nil {
+		t.Fatal(err)
+	}
+	initConfig()
+	if cfg.Broker.Cash != 2000 {
+		t.Errorf("cash is %f, expected the cash of the flag", cfg.Broker.Cash)
+	}
+
+	// no default cash outside of the backtests
+	viper.Reset()
+	cfg = savedCfg
+	flag.Value.Set("0")
+	flag.Changed = false
+	cfgFile = filepath.Join(t.TempDir(), "missing.json")
+	initConfig()
+	if cfg.Broker.Cash != 0 {
+		t.Errorf("cash is %f without the flag and the config file", cfg.Broker.Cash)
+	}
+}
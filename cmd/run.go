@@ -7,12 +7,12 @@ import (
 	"os"
 	"path/filepath"
 
-	"goat/pkg/config"
 	"goat/pkg/core"
 	"goat/pkg/feedgen"
 	"goat/pkg/js"
 	"goat/pkg/logger"
 	"goat/pkg/notify"
+	"goat/pkg/report"
 	"goat/pkg/util"
 
 	"github.com/spf13/cobra"
@@ -20,8 +20,11 @@ import (
 )
 
 var (
-	runScriptFile string
-	runDataSource string
+	runScriptFile   string
+	runDataSource   string
+	runAnalysisFile string
+	runReportFile   string
+	runParams       []string
 
 	runCmd = &cobra.Command{
 		Use:   "run",
@@ -38,6 +41,11 @@ func RunFunction(cmd *cobra.Command, args []string) {
 
 	logger.Logger.Debug("running script", zap.String("runScriptFile", runScriptFile))
 
+	if err := applyParamFlags(runParams); err != nil {
+		logger.Logger.Error("failed to parse strategy parameters", zap.Error(err))
+		os.Exit(1)
+	}
+
 	ctx := util.NewTerminationContext()
 
 	// setup provider, data generator and feed
@@ -47,10 +55,33 @@ func RunFunction(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	feed := core.NewGenericDataFeed(ctx, &config.Config{}, gen, nil, 100, "")
+	maxLen := 100
+	if runReportFile != "" {
+		// the report needs all the bars for its price chart
+		maxLen = 0
+	}
+	feed := core.NewGenericDataFeed(ctx, &cfg, gen, nil, maxLen, "")
+
+	backtestBroker, err := core.NewBacktestBroker(&cfg, feed)
+	if err != nil {
+		logger.Logger.Error("failed to create backtest broker", zap.Error(err))
+		os.Exit(1)
+	}
+	actions, err := loadCorporateActions()
+	if err != nil {
+		logger.Logger.Error("failed to load corporate actions", zap.Error(err))
+		os.Exit(1)
+	}
+	backtestBroker.(core.CorporateActionHandler).AddCorporateActions(actions...)
+	portfolio := core.NewPortfolio(backtestBroker, feed, 0)
+	var backtestReport report.Report
+	if runReportFile != "" {
+		backtestReport = report.NewReport(feed, backtestBroker, portfolio)
+	}
+	broker := core.NewAlgoBroker(core.NewRiskManager(&cfg, backtestBroker, portfolio, feed, nil), feed)
 
 	// setup js runtime
-	rt := js.NewStrategyRuntime(ctx, &cfg, feed, nil)
+	rt := js.NewStrategyRuntime(ctx, &cfg, feed, broker, portfolio, nil)
 	script, err := ioutil.ReadFile(runScriptFile)
 	if err != nil {
 		logger.Logger.Error("failed to read script file", zap.Error(err))
@@ -65,21 +96,65 @@ func RunFunction(cmd *cobra.Command, args []string) {
 			fmt.Println(err)
 			os.Exit(1)
 		}
+		if err := rt.ValidateParams(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 
 		sel := js.NewJSStrategyEventListener(rt)
-		broker := core.NewDummyBroker(feed)
 		strategy := core.NewStrategyController(ctx, &cfg, sel, broker, feed)
+		for _, analyzer := range core.NewDefaultAnalyzers(portfolio) {
+			strategy.AttachAnalyzer(analyzer)
+		}
 
 		strategy.Run()
+
+		fmt.Println()
+		core.WriteAnalyzerSummary(os.Stdout, strategy.GetAnalyzers())
+		if runAnalysisFile != "" {
+			writeAnalysisFile(runAnalysisFile, strategy.GetAnalyzers())
+		}
+		if backtestReport != nil {
+			if err := backtestReport.WriteFile(runReportFile, strategy.GetAnalyzers()); err != nil {
+				logger.Logger.Error("failed to write report", zap.Error(err))
+			}
+		}
+	}
+}
+
+// loadCorporateActions fetches the yahoo splits and dividends of the symbol
+// if they are enabled, the actions of the config file are loaded by the
+// backtest broker
+func loadCorporateActions() ([]core.CorporateAction, error) {
+	if !cfg.CorporateActions.Yahoo {
+		return nil, nil
+	}
+	return feedgen.LoadYahooCorporateActions(cfg.Symbol)
+}
+
+func writeAnalysisFile(path string, analyzers []core.Analyzer) {
+	data, err := core.MarshalAnalyzerResults(analyzers)
+	if err != nil {
+		logger.Logger.Error("failed to encode analyzer results", zap.Error(err))
+		return
+	}
+	if err := ioutil.WriteFile(path, data, 0o644); err != nil {
+		logger.Logger.Error("failed to write analyzer results", zap.Error(err))
 	}
 }
 
 func GetFeedGenerator() core.FeedGenerator {
-	if u, err := url.ParseRequestURI(runDataSource); err != nil {
-		ext := filepath.Ext(runDataSource)
+	return NewFeedGenerator(runDataSource)
+}
+
+// NewFeedGenerator creates the feed generator of a data source, it returns
+// nil if the data source is not supported.
+func NewFeedGenerator(dataSource string) core.FeedGenerator {
+	if u, err := url.ParseRequestURI(dataSource); err != nil {
+		ext := filepath.Ext(dataSource)
 		switch ext {
 		case ".csv":
-			return feedgen.NewCSVBarFeedGenerator(runDataSource, "symbol", core.UNKNOWN)
+			return feedgen.NewCSVBarFeedGenerator(dataSource, "symbol", core.UNKNOWN)
 		default:
 			logger.Logger.Error("unsupported file type", zap.String("fileType", ext))
 			return nil
@@ -105,7 +180,7 @@ func GetFeedGenerator() core.FeedGenerator {
 				return nil
 			}
 		default:
-			logger.Logger.Error("unknown data source", zap.String("runDataSource", runDataSource))
+			logger.Logger.Error("unknown data source", zap.String("runDataSource", dataSource))
 			return nil
 		}
 	}
@@ -120,5 +195,14 @@ func init() {
 		"data source(support url scheme: csv, yahoo) e.g. csv:///path/to/file.csv or yahoo://")
 	runCmd.MarkPersistentFlagRequired("datasource")
 
+	runCmd.PersistentFlags().StringVarP(&runAnalysisFile, "analysis", "", "",
+		"write the analyzer results to this json file")
+
+	runCmd.PersistentFlags().StringVarP(&runReportFile, "report", "", "",
+		"write a html report of the backtest to this file")
+
+	runCmd.PersistentFlags().StringArrayVarP(&runParams, "param", "P", nil,
+		"strategy parameter key=value available as system.params, it can be repeated")
+
 	rootCmd.AddCommand(runCmd)
 }
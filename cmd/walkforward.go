@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"goat/pkg/core"
+	"goat/pkg/feedgen"
+	"goat/pkg/logger"
+	"goat/pkg/notify"
+	"goat/pkg/optimizer"
+	"goat/pkg/util"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	walkForwardScriptFile string
+	walkForwardDataSource string
+	walkForwardGridFile   string
+	walkForwardWorkers    int
+	walkForwardMetric     string
+	walkForwardMinimize   bool
+	walkForwardInSample   int
+	walkForwardOutSample  int
+	walkForwardAnchored   bool
+	walkForwardOutputFile string
+	walkForwardVerbose    bool
+
+	walkForwardCmd = &cobra.Command{
+		Use:   "walkforward",
+		Short: "walkforward command runs a walk-forward analysis of the strategy parameters",
+		Long: `walkforward command splits the data source into rolling in-sample and
+out-of-sample windows. The parameter grid is optimized on each in-sample
+window and the best parameters are backtested on the following out-of-sample
+window. The out-of-sample equity curves are stitched together, which shows
+how the strategy would have done if it was re-optimized periodically.
+
+The window sizes are numbers of bars, e.g. --in-sample 500 --out-sample 100.
+Every backtest starts with no bars before its window, so the windows should
+be long enough for the indicators of the strategy to warm up.
+	`,
+		Run: WalkForwardFunction,
+	}
+)
+
+func WalkForwardFunction(cmd *cobra.Command, args []string) {
+	// handle panic
+	defer util.PanicHandler(notify.NewEmailNotifier(&cfg))
+
+	if !walkForwardVerbose {
+		// backtests running in parallel produce too many logs
+		logger.Logger = logger.Logger.WithOptions(zap.IncreaseLevel(zap.WarnLevel))
+	}
+
+	grid, err := optimizer.LoadParamGrid(walkForwardGridFile)
+	if err != nil {
+		logger.Logger.Error("failed to load parameter grid", zap.Error(err))
+		os.Exit(1)
+	}
+	combinations := grid.Combinations()
+	if len(combinations) == 0 {
+		logger.Logger.Error("parameter grid is empty")
+		os.Exit(1)
+	}
+	ctx := util.NewTerminationContext()
+	backtest, err := newParamsBacktest(walkForwardScriptFile)
+	if err != nil {
+		logger.Logger.Error("failed to create backtest", zap.Error(err))
+		os.Exit(1)
+	}
+	defer backtest.Close()
+	values, err := loadFeedValues(ctx, walkForwardDataSource)
+	if err != nil {
+		logger.Logger.Error("failed to load data source", zap.Error(err))
+		os.Exit(1)
+	}
+	windows, err := optimizer.SplitWindows(len(values), walkForwardInSample,
+		walkForwardOutSample, walkForwardAnchored)
+	if err != nil {
+		logger.Logger.Error("failed to split walk-forward windows", zap.Error(err))
+		os.Exit(1)
+	}
+
+	fmt.Printf("running %d walk-forward windows of %d backtests with %d workers\n",
+		len(windows), len(combinations), walkForwardWorkers)
+	steps := make([]*optimizer.WalkForwardStep, 0, len(windows))
+	curves := [][]optimizer.EquityPoint{}
+	for _, w := range windows {
+		if ctx.Err() != nil {
+			break
+		}
+		step := runWalkForwardStep(ctx, backtest, values, w, combinations)
+		steps = append(steps, step)
+		curves = append(curves, step.OutSampleCurve)
+	}
+	cash := core.BacktestCash(&cfg)
+	equity := optimizer.StitchEquity(curves, cash)
+
+	printWalkForwardSteps(steps, grid.Names(), walkForwardMetric)
+	if len(equity) > 0 {
+		last := equity[len(equity)-1].Equity
+		fmt.Printf("\nout-of-sample equity: %.2f, return: %.2f%%\n", last,
+			(last/cash-1)*100)
+	}
+	if walkForwardOutputFile != "" {
+		if err := writeWalkForward(walkForwardOutputFile, steps, equity); err != nil {
+			logger.Logger.Error("failed to write walk-forward results", zap.Error(err))
+			os.Exit(1)
+		}
+	}
+}
+
+// runWalkForwardStep optimizes the parameters on the in-sample values of w
+// and backtests the best ones on its out-of-sample values
+func runWalkForwardStep(ctx context.Context, backtest *paramsBacktest, values []feedgen.FeedValue,
+	w optimizer.Window, combinations []map[string]interface{},
+) *optimizer.WalkForwardStep {
+	step := &optimizer.WalkForwardStep{
+		Window:        w,
+		InSampleFrom:  values[w.InSampleStart].DateTime,
+		InSampleTo:    values[w.InSampleEnd-1].DateTime,
+		OutSampleFrom: values[w.OutSampleStart].DateTime,
+		OutSampleTo:   values[w.OutSampleEnd-1].DateTime,
+	}
+
+	inSample := values[w.InSampleStart:w.InSampleEnd]
+	results := optimizer.Run(ctx, combinations, walkForwardWorkers,
+		func(ctx context.Context, worker int, params map[string]interface{}) (map[string]float64, error) {
+			metrics, _, err := backtest.run(ctx, worker, inSample, params)
+			return metrics, err
+		})
+	optimizer.Rank(results, walkForwardMetric, walkForwardMinimize)
+	best := results[0]
+	if best.Err != nil {
+		step.Err = fmt.Errorf("in-sample optimization failed: %v", best.Err)
+		return step
+	}
+	step.Params = best.Params
+	step.InSample = best.Metrics
+
+	outSample := values[w.OutSampleStart:w.OutSampleEnd]
+	step.OutSample, step.OutSampleCurve, step.Err = backtest.run(ctx, 0, outSample, best.Params)
+	return step
+}
+
+func printWalkForwardSteps(steps []*optimizer.WalkForwardStep, paramNames []string, metric string) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "IN-SAMPLE\tOUT-OF-SAMPLE\t%s\tIN-SAMPLE %s\tOUT-OF-SAMPLE %s\n",
+		strings.ToUpper(strings.Join(paramNames, "\t")),
+		strings.ToUpper(metric), strings.ToUpper(metric))
+	for _, s := range steps {
+		values := make([]string, 0, len(paramNames))
+		for _, name := range paramNames {
+			if v, ok := s.Params[name]; ok {
+				values = append(values, fmt.Sprint(v))
+			} else {
+				values = append(values, "-")
+			}
+		}
+		inSample, outSample := "-", "-"
+		if v, ok := s.InSample[metric]; ok {
+			inSample = core.AnalyzerMetric{Value: v}.String()
+		}
+		if v, ok := s.OutSample[metric]; ok {
+			outSample = core.AnalyzerMetric{Value: v}.String()
+		}
+		if s.Err != nil {
+			outSample = "error: " + s.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s - %s\t%s - %s\t%s\t%s\t%s\n",
+			s.InSampleFrom.Format("2006-01-02"), s.InSampleTo.Format("2006-01-02"),
+			s.OutSampleFrom.Format("2006-01-02"), s.OutSampleTo.Format("2006-01-02"),
+			strings.Join(values, "\t"), inSample, outSample)
+	}
+	tw.Flush()
+}
+
+func writeWalkForward(path string, steps []*optimizer.WalkForwardStep,
+	equity []optimizer.EquityPoint,
+) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := optimizer.WriteWalkForwardJSON(f, steps, equity); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func init() {
+	walkForwardCmd.PersistentFlags().StringVarP(&walkForwardScriptFile, "strategy", "f", "",
+		"strategy js script file")
+	walkForwardCmd.MarkPersistentFlagRequired("strategy")
+
+	walkForwardCmd.PersistentFlags().StringVarP(&walkForwardDataSource, "datasource", "s", "",
+		"data source(support url scheme: csv, yahoo) e.g. csv:///path/to/file.csv or yahoo://")
+	walkForwardCmd.MarkPersistentFlagRequired("datasource")
+
+	walkForwardCmd.PersistentFlags().StringVarP(&walkForwardGridFile, "grid", "g", "",
+		"parameter grid json or yaml file")
+	walkForwardCmd.MarkPersistentFlagRequired("grid")
+
+	walkForwardCmd.PersistentFlags().IntVarP(&walkForwardInSample, "in-sample", "", 0,
+		"number of bars of each in-sample window")
+	walkForwardCmd.MarkPersistentFlagRequired("in-sample")
+	walkForwardCmd.PersistentFlags().IntVarP(&walkForwardOutSample, "out-sample", "", 0,
+		"number of bars of each out-of-sample window")
+	walkForwardCmd.MarkPersistentFlagRequired("out-sample")
+	walkForwardCmd.PersistentFlags().BoolVarP(&walkForwardAnchored, "anchored", "", false,
+		"start every in-sample window from the first bar instead of rolling it")
+
+	walkForwardCmd.PersistentFlags().IntVarP(&walkForwardWorkers, "workers", "w", runtime.NumCPU(),
+		"number of backtests running in parallel")
+	walkForwardCmd.PersistentFlags().StringVarP(&walkForwardMetric, "metric", "m", "sharpe.sharpeRatio",
+		"analyzer metric used to pick the best in-sample parameters")
+	walkForwardCmd.PersistentFlags().BoolVarP(&walkForwardMinimize, "minimize", "", false,
+		"pick the lowest metric value, e.g. for drawdown.maxDrawDown")
+	walkForwardCmd.PersistentFlags().StringVarP(&walkForwardOutputFile, "output", "o", "",
+		"write the walk-forward steps and the stitched equity curve to this json file")
+	walkForwardCmd.PersistentFlags().BoolVarP(&walkForwardVerbose, "verbose", "v", false,
+		"keep the logs of the backtests")
+
+	rootCmd.AddCommand(walkForwardCmd)
+}
@@ -14,13 +14,40 @@ const (
 
 const DataFeedMaxPendingBars = 10000
 
+// DefaultBacktestCash is the initial cash of the backtest broker if
+// broker.cash is not set
+const DefaultBacktestCash = 1000000
+
 type Config struct {
-	KVDB   string `mapstructure:"kvdb"`
-	Symbol string `mapstructure:"symbol"`
-	Dump   struct {
+	KVDB   string                 `mapstructure:"kvdb"`
+	Symbol string                 `mapstructure:"symbol"`
+	Params map[string]interface{} `mapstructure:"params"` // strategy parameters, available as system.params
+	// currency of the cash, equity and analyzer results. the values of the
+	// instruments quoted in other currencies are converted with the FX
+	// pairs of the data feed, e.g. EURUSD. no conversion is done if empty.
+	BaseCurrency string `mapstructure:"basecurrency"`
+	// instrument metadata by symbol, they override the instruments of
+	// InstrumentsFile
+	Instruments      map[string]InstrumentConfig `mapstructure:"instruments"`
+	InstrumentsFile  string                      `mapstructure:"instrumentsfile"` // json file of instrument metadata by symbol
+	CorporateActions CorporateActionsConfig      `mapstructure:"corporateactions"`
+	Calendar         CalendarConfig              `mapstructure:"calendar"`
+	// frequencies resampled from the finer bars of the feed, minute, hour,
+	// hour_4, day, week or month. the DAY bars in backtests and all of them
+	// in live mode if empty.
+	Resample []string `mapstructure:"resample"`
+	Dump     struct {
 		BarDumpDB     string `mapstructure:"bardumpdb"`       // name of db to dump live feed data, leave empty to disable
 		RemoveOldBars bool   `mapstructure:"delete_old_bars"` // delete db if exist
 	} `mapstructure:"dump"`
+	Broker struct {
+		Cash       float64          `mapstructure:"cash"` // initial cash of the broker, DefaultBacktestCash in backtests if 0
+		Commission CommissionConfig `mapstructure:"commission"`
+		Slippage   SlippageConfig   `mapstructure:"slippage"`
+		FIX        FIXConfig        `mapstructure:"fix"`
+		Margin     MarginConfig     `mapstructure:"margin"`
+	} `mapstructure:"broker"`
+	Risk RiskConfig `mapstructure:"risk"`
 	Live struct {
 		TradingView struct {
 			User string `mapstructure:"user"`
@@ -54,3 +81,98 @@ type Config struct {
 		} `mapstructure:"email"`
 	} `mapstructure:"notification"`
 }
+
+// CommissionConfig selects the commission model of the broker. Type is one
+// of "none", "fixed", "pershare", "percentage" or "tiered".
+type CommissionConfig struct {
+	Type        string                      `mapstructure:"type"`
+	Amount      float64                     `mapstructure:"amount"`  // per trade, per share or fraction of notional (0.001 is 0.1%)
+	Minimum     float64                     `mapstructure:"minimum"` // minimum commission per order, 0 to disable
+	Maximum     float64                     `mapstructure:"maximum"` // maximum commission per order, 0 to disable
+	Tiers       []CommissionTierConfig      `mapstructure:"tiers"`
+	Instruments map[string]CommissionConfig `mapstructure:"instruments"` // per instrument overrides
+}
+
+type CommissionTierConfig struct {
+	UpTo             float64 `mapstructure:"upto"` // upper bound of the fill notional, 0 means no bound
+	CommissionConfig `mapstructure:",squash"`
+}
+
+// SlippageConfig selects the slippage model of simulated fills. Type is one
+// of "none", "fixedbps", "volumeshare" or "halfspread".
+type SlippageConfig struct {
+	Type        string                    `mapstructure:"type"`
+	Amount      float64                   `mapstructure:"amount"`      // basis points, price impact or spread depending on type
+	VolumeLimit float64                   `mapstructure:"volumelimit"` // max fraction of the bar volume filled per bar, 0 to disable
+	Instruments map[string]SlippageConfig `mapstructure:"instruments"` // per instrument overrides
+}
+
+// CorporateActionsConfig selects how splits and dividends are handled. In
+// adjusted mode the bars return the prices adjusted with their adjusted
+// close, otherwise the backtest broker applies the splits and dividends of
+// File and Yahoo to the positions and the cash.
+type CorporateActionsConfig struct {
+	Adjusted bool   `mapstructure:"adjusted"`
+	File     string `mapstructure:"file"`  // csv file with symbol, date, type (split or dividend) and value columns
+	Yahoo    bool   `mapstructure:"yahoo"` // load the splits and dividends of the symbol from yahoo
+}
+
+// CalendarConfig selects the trading calendar of the sessions, e.g. the day
+// boundaries of the DAY bars. Name is one of "24/7" (default, days from
+// midnight UTC), "crypto", "nyse", "comex" or "fx", the other fields
+// override the calendar.
+type CalendarConfig struct {
+	Name     string            `mapstructure:"name"`
+	Timezone string            `mapstructure:"timezone"` // time zone of the hours
+	Hours    string            `mapstructure:"hours"`    // e.g. 09:30-16:00, a session closing before its open opens the day before, e.g. 17:00-16:00
+	Weekdays []int             `mapstructure:"weekdays"` // days of the session closes, 0 is sunday
+	Holidays []string          `mapstructure:"holidays"` // dates without session, e.g. 2023-01-02
+	HalfDays map[string]string `mapstructure:"halfdays"` // early closes by date, e.g. {"2023-11-24": "13:00"}
+}
+
+// InstrumentConfig describes a traded symbol. Prices and quantities are not
+// rounded if TickSize and LotSize are 0, Multiplier defaults to 1.
+type InstrumentConfig struct {
+	AssetClass   string  `mapstructure:"assetclass"`   // e.g. commodity, equity, future or fx
+	Currency     string  `mapstructure:"currency"`     // quote currency
+	TickSize     float64 `mapstructure:"ticksize"`     // prices are rounded to a multiple of it
+	LotSize      float64 `mapstructure:"lotsize"`      // quantities are rounded down to a multiple of it
+	Multiplier   float64 `mapstructure:"multiplier"`   // contract multiplier of values and PnL
+	TradingHours string  `mapstructure:"tradinghours"` // e.g. 09:30-16:00
+	Timezone     string  `mapstructure:"timezone"`     // time zone of the trading hours, default UTC
+}
+
+// MarginConfig enables short positions and borrowing in the backtest broker.
+// LiquidationPolicy is one of "all" or "largest".
+type MarginConfig struct {
+	Enabled           bool                    `mapstructure:"enabled"`
+	Initial           float64                 `mapstructure:"initial"`       // initial margin as a fraction of the position value, default 0.5
+	Maintenance       float64                 `mapstructure:"maintenance"`   // maintenance margin fraction, default 0.25
+	MaxLeverage       float64                 `mapstructure:"maxleverage"`   // max gross position value / equity, 0 to disable
+	LiquidationPolicy string                  `mapstructure:"liquidation"`   // "all" closes every position on a margin call, "largest" closes the largest positions until the margin is restored
+	FinancingRate     float64                 `mapstructure:"financingrate"` // annual rate charged on borrowed cash, 0.05 is 5%
+	BorrowRate        float64                 `mapstructure:"borrowrate"`    // annual rate charged on the value of short positions
+	DayCount          int                     `mapstructure:"daycount"`      // days per year of the rates, default 360
+	Instruments       map[string]MarginConfig `mapstructure:"instruments"`   // per instrument initial, maintenance and borrow rate overrides
+}
+
+// FIXConfig is the FIX 4.4 session of the fix broker
+type FIXConfig struct {
+	Addr         string `mapstructure:"addr"` // host:port of the counterparty
+	SenderCompID string `mapstructure:"sendercompid"`
+	TargetCompID string `mapstructure:"targetcompid"`
+	Account      string `mapstructure:"account"`      // optional Account(1) of the orders
+	HeartBtInt   int    `mapstructure:"heartbtint"`   // heartbeat interval in seconds, default 30
+	StoreDir     string `mapstructure:"storedir"`     // directory of the sequence numbers and sent messages, empty keeps them in memory
+	ResetOnLogon bool   `mapstructure:"resetonlogon"` // reset the sequence numbers on every logon
+}
+
+// RiskConfig sets the pre-trade limits of the risk manager, 0 disables a
+// limit
+type RiskConfig struct {
+	MaxPosition        float64 `mapstructure:"maxposition"` // max absolute position of an instrument
+	MaxNotional        float64 `mapstructure:"maxnotional"` // max price * quantity of an order
+	MaxOrdersPerMinute int     `mapstructure:"maxordersperminute"`
+	MaxDailyLoss       float64 `mapstructure:"maxdailyloss"` // loss from the equity at the start of the day, trips the kill switch
+	MaxDrawdown        float64 `mapstructure:"maxdrawdown"`  // fraction of the peak equity (0.2 is 20%), past it only orders reducing positions are accepted
+}
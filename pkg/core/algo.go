@@ -0,0 +1,648 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"goat/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// ExecutionAlgo is the way a parent order is split into child orders
+type ExecutionAlgo string
+
+const (
+	// AlgoTWAP slices the parent evenly over a time window
+	AlgoTWAP ExecutionAlgo = "TWAP"
+	// AlgoVWAP slices the parent over a time window following the
+	// historical intraday volume profile of the instrument
+	AlgoVWAP ExecutionAlgo = "VWAP"
+	// AlgoIceberg shows one child order of the display quantity at a time
+	AlgoIceberg ExecutionAlgo = "ICEBERG"
+)
+
+// algoOrderIDBase is the first id of the parent orders, the orders of the
+// wrapped broker are numbered below it
+const algoOrderIDBase uint64 = 1 << 32
+
+// AlgoParams configures the execution of a parent order
+type AlgoParams struct {
+	Algo ExecutionAlgo
+	// Start of the TWAP and VWAP window, zero starts with the next bar
+	Start    time.Time
+	Duration time.Duration
+	Slices   int
+	// DisplayQuantity is the size of the child orders of an iceberg
+	DisplayQuantity float64
+}
+
+func (p *AlgoParams) validate() error {
+	p.Algo = ExecutionAlgo(strings.ToUpper(string(p.Algo)))
+	switch p.Algo {
+	case AlgoTWAP, AlgoVWAP:
+		if p.Duration <= 0 || p.Slices <= 0 {
+			return fmt.Errorf("%s needs a positive duration and number of slices", p.Algo)
+		}
+	case AlgoIceberg:
+		if p.DisplayQuantity <= 0 || math.IsNaN(p.DisplayQuantity) || math.IsInf(p.DisplayQuantity, 0) {
+			return fmt.Errorf("iceberg needs a positive display quantity")
+		}
+	default:
+		return fmt.Errorf("unknown execution algo %s", p.Algo)
+	}
+	return nil
+}
+
+// AlgoBroker is a broker which works parent orders with execution algorithms.
+// The child orders are submitted to the wrapped broker, their fills roll up
+// into the events of the parent and the child orders are hidden from the
+// order events and the active orders. The slices are scheduled with the time
+// of the bars so that backtests and live runs behave the same.
+type AlgoBroker interface {
+	Broker
+	// SubmitAlgoOrder works a market or a limit parent order, the child
+	// orders are limit orders at the price of a limit parent
+	SubmitAlgoOrder(parent Order, params AlgoParams) error
+}
+
+type algoChild struct {
+	order     Order
+	remaining float64
+}
+
+type algoOrder struct {
+	parent   *BasicOrder
+	params   AlgoParams
+	schedule []float64 // cumulative fractions of the quantity after each slice
+	// nextSlice is the next slice of the schedule to submit
+	nextSlice int
+	children  map[uint64]*algoChild // active child orders
+	accepted  bool
+	canceling bool
+	reason    string // why the parent is canceled
+}
+
+func (ao *algoOrder) sliceTime(i int) time.Time {
+	return ao.params.Start.Add(ao.params.Duration * time.Duration(i) / time.Duration(ao.params.Slices))
+}
+
+// committed returns the filled quantity plus the unfilled quantity of the
+// active child orders
+func (ao *algoOrder) committed() float64 {
+	res := ao.parent.Filled
+	for _, child := range ao.children {
+		res += child.remaining
+	}
+	return res
+}
+
+type algoBroker struct {
+	Broker
+	mu                sync.Mutex
+	feed              DataFeed
+	orderUpdatedEvent Event
+	nextOrderID       uint64
+	orders            map[uint64]*algoOrder // parents by id
+	children          map[uint64]*algoOrder // parents by child id
+	// rejected are the child orders refused on submit, the rejected events
+	// of the risk manager are hidden too
+	rejected      map[Order]bool
+	barFrequency  map[string]Frequency
+	currentTime   time.Time
+	pendingEvents []OrderEvent
+}
+
+// NewAlgoBroker wraps broker with execution algorithms. It should be the
+// broker of the strategy, the portfolio follows the child orders of the
+// wrapped broker.
+func NewAlgoBroker(broker Broker, feed DataFeed) AlgoBroker {
+	a := &algoBroker{
+		Broker:            broker,
+		feed:              feed,
+		orderUpdatedEvent: NewEvent(),
+		nextOrderID:       algoOrderIDBase,
+		orders:            map[uint64]*algoOrder{},
+		children:          map[uint64]*algoOrder{},
+		rejected:          map[Order]bool{},
+		barFrequency:      map[string]Frequency{},
+	}
+	broker.GetOrderUpdatedEvent().Subscribe(a.onOrderEvent)
+	feed.GetNewValueEvent().Subscribe(a.onBars)
+	return a
+}
+
+// SetWakeupFunc implements Waker if the wrapped broker does
+func (a *algoBroker) SetWakeupFunc(wakeup func()) {
+	if waker, ok := a.Broker.(Waker); ok {
+		waker.SetWakeupFunc(wakeup)
+	}
+}
+
+// SetClock implements ClockUser if the wrapped broker does
+func (a *algoBroker) SetClock(clock Clock) {
+	if user, ok := a.Broker.(ClockUser); ok {
+		user.SetClock(clock)
+	}
+}
+
+// Eof implements Subject
+func (a *algoBroker) Eof() bool {
+	a.mu.Lock()
+	pending := len(a.pendingEvents)
+	a.mu.Unlock()
+	return pending == 0 && a.Broker.Eof()
+}
+
+// Dispatch implements Subject
+func (a *algoBroker) Dispatch() bool {
+	emitted := false
+	for {
+		a.mu.Lock()
+		if len(a.pendingEvents) == 0 {
+			a.mu.Unlock()
+			break
+		}
+		event := a.pendingEvents[0]
+		a.pendingEvents = a.pendingEvents[1:]
+		a.mu.Unlock()
+
+		a.orderUpdatedEvent.Emit(a, event)
+		emitted = true
+	}
+	return a.Broker.Dispatch() || emitted
+}
+
+// GetOrderUpdatedEvent implements Broker
+func (a *algoBroker) GetOrderUpdatedEvent() Event {
+	return a.orderUpdatedEvent
+}
+
+// GetOrder implements Broker
+func (a *algoBroker) GetOrder(id uint64) Order {
+	a.mu.Lock()
+	ao, ok := a.orders[id]
+	a.mu.Unlock()
+	if ok {
+		return ao.parent
+	}
+	return a.Broker.GetOrder(id)
+}
+
+// GetActiveOrders implements Broker, the active parents replace their child
+// orders
+func (a *algoBroker) GetActiveOrders(instrument string) []Order {
+	orders := a.Broker.GetActiveOrders(instrument)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	res := make([]Order, 0, len(orders))
+	for _, o := range orders {
+		if _, ok := a.children[o.GetID()]; !ok {
+			res = append(res, o)
+		}
+	}
+	for _, ao := range a.sortedActiveOrders() {
+		if instrument == "" || ao.parent.Instrument == instrument {
+			res = append(res, ao.parent)
+		}
+	}
+	return res
+}
+
+// CancelOrder implements Broker, canceling a parent cancels its child orders
+func (a *algoBroker) CancelOrder(order Order) error {
+	a.mu.Lock()
+	ao, ok := a.orders[order.GetID()]
+	if !ok {
+		a.mu.Unlock()
+		return a.Broker.CancelOrder(order)
+	}
+	if !ao.parent.IsActive() || ao.canceling {
+		a.mu.Unlock()
+		return fmt.Errorf("order %d is not active", order.GetID())
+	}
+	children := a.cancelLocked(ao, "canceled by user")
+	a.mu.Unlock()
+
+	a.cancelChildren(children)
+	return nil
+}
+
+// ReplaceOrder changes an active order if the wrapped broker supports it,
+// parent orders cannot be replaced
+func (a *algoBroker) ReplaceOrder(order Order, quantity, limitPrice, stopPrice float64) error {
+	a.mu.Lock()
+	_, ok := a.orders[order.GetID()]
+	a.mu.Unlock()
+	if ok {
+		return fmt.Errorf("algo order %d cannot be replaced", order.GetID())
+	}
+	replacer, ok := a.Broker.(interface {
+		ReplaceOrder(order Order, quantity, limitPrice, stopPrice float64) error
+	})
+	if !ok {
+		return fmt.Errorf("broker does not support replacing orders")
+	}
+	return replacer.ReplaceOrder(order, quantity, limitPrice, stopPrice)
+}
+
+// GetInstrument implements InstrumentProvider
+func (a *algoBroker) GetInstrument(symbol string) *Instrument {
+	if instruments, ok := a.Broker.(InstrumentProvider); ok {
+		return instruments.GetInstrument(symbol)
+	}
+	return defaultInstrument(symbol)
+}
+
+// EstimateCommission implements CommissionEstimator
+func (a *algoBroker) EstimateCommission(order Order, price float64) float64 {
+	if estimator, ok := a.Broker.(CommissionEstimator); ok {
+		return estimator.EstimateCommission(order, price)
+	}
+	return 0
+}
+
+// SubmitAlgoOrder implements AlgoBroker
+func (a *algoBroker) SubmitAlgoOrder(parent Order, params AlgoParams) error {
+	o, err := toSubmittableOrder(parent)
+	if err != nil {
+		return err
+	}
+	if o.Type != OrderTypeMarket && o.Type != OrderTypeLimit {
+		return fmt.Errorf("algo orders should be market or limit orders")
+	}
+	if err := params.validate(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	o.ID = a.nextOrderID
+	a.nextOrderID++
+	o.State = OrderStateSubmitted
+	o.SubmitDateTime = a.currentTime
+	a.orders[o.ID] = &algoOrder{
+		parent:   o,
+		params:   params,
+		children: map[uint64]*algoChild{},
+	}
+	a.queueEvent(o, OrderEventSubmitted, nil)
+	return nil
+}
+
+func (a *algoBroker) queueEvent(o *BasicOrder, eventType OrderEventType, eventInfo interface{}) {
+	a.pendingEvents = append(a.pendingEvents, NewOrderEvent(o.clone(), eventType, eventInfo))
+}
+
+func (a *algoBroker) sortedActiveOrders() []*algoOrder {
+	res := []*algoOrder{}
+	for _, ao := range a.orders {
+		if ao.parent.IsActive() {
+			res = append(res, ao)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].parent.ID < res[j].parent.ID
+	})
+	return res
+}
+
+// cancelLocked starts the cancellation of a parent and returns its active
+// child orders which should be canceled. The parent is canceled once they
+// are all inactive.
+func (a *algoBroker) cancelLocked(ao *algoOrder, reason string) []Order {
+	ao.canceling = true
+	ao.reason = reason
+	if len(ao.children) == 0 {
+		a.finishCanceled(ao)
+		return nil
+	}
+	res := []Order{}
+	for _, child := range ao.children {
+		res = append(res, child.order)
+	}
+	return res
+}
+
+func (a *algoBroker) finishCanceled(ao *algoOrder) {
+	ao.parent.State = OrderStateCanceled
+	a.queueEvent(ao.parent, OrderEventCanceled, ao.reason)
+	logger.Logger.Debug("algo order canceled", zap.String("order", ao.parent.String()),
+		zap.String("reason", ao.reason))
+}
+
+func (a *algoBroker) cancelChildren(children []Order) {
+	for _, child := range children {
+		if err := a.Broker.CancelOrder(child); err != nil {
+			logger.Logger.Debug("failed to cancel child order", zap.Uint64("id", child.GetID()),
+				zap.Error(err))
+		}
+	}
+}
+
+// roundQuantity rounds a child quantity down to the lot size
+func (a *algoBroker) roundQuantity(instrument string, quantity float64) float64 {
+	if quantity < positionEpsilon {
+		return 0
+	}
+	return a.GetInstrument(instrument).RoundQuantity(quantity)
+}
+
+// nextChildQuantity returns the quantity of the next child order of ao at t,
+// 0 if no child order is due
+func (a *algoBroker) nextChildQuantity(ao *algoOrder, t time.Time) float64 {
+	if ao.canceling || !ao.parent.IsActive() {
+		return 0
+	}
+	quantity := ao.parent.Quantity
+	if ao.params.Algo == AlgoIceberg {
+		if len(ao.children) > 0 {
+			return 0
+		}
+		return a.roundQuantity(ao.parent.Instrument, math.Min(ao.params.DisplayQuantity, ao.parent.GetRemaining()))
+	}
+
+	if ao.schedule == nil {
+		if ao.params.Start.IsZero() {
+			ao.params.Start = t
+		}
+		ao.schedule = a.schedule(ao)
+	}
+	due := -1
+	for ao.nextSlice < len(ao.schedule) && !t.Before(ao.sliceTime(ao.nextSlice)) {
+		due = ao.nextSlice
+		ao.nextSlice++
+	}
+	if due < 0 {
+		return 0
+	}
+	target := quantity * ao.schedule[due]
+	if due == len(ao.schedule)-1 {
+		target = quantity
+	}
+	return a.roundQuantity(ao.parent.Instrument, target-ao.committed())
+}
+
+// schedule returns the cumulative fractions of the slices of ao. The TWAP
+// slices are even, the VWAP slices follow the volume profile and fall back
+// to even slices without volume history.
+func (a *algoBroker) schedule(ao *algoOrder) []float64 {
+	n := ao.params.Slices
+	weights := make([]float64, n)
+	total := 0.0
+	if ao.params.Algo == AlgoVWAP {
+		profile := a.volumeProfile(ao.parent.Instrument, ao.params.Start)
+		for i := range weights {
+			weights[i] = profile.volume(ao.sliceTime(i), ao.sliceTime(i+1))
+			total += weights[i]
+		}
+	}
+	if total <= 0 {
+		for i := range weights {
+			weights[i] = 1
+		}
+		total = float64(n)
+	}
+	res := make([]float64, n)
+	sum := 0.0
+	for i, w := range weights {
+		sum += w
+		res[i] = sum / total
+	}
+	return res
+}
+
+// volumeProfile is the total volume of the bars of an instrument by time of
+// day, in seconds after midnight
+type volumeProfile map[int]float64
+
+// volumeProfile builds the profile of instrument from the volumes of its bars
+// before t
+func (a *algoBroker) volumeProfile(instrument string, t time.Time) volumeProfile {
+	res := volumeProfile{}
+	freq, ok := a.barFrequency[instrument]
+	if !ok {
+		return res
+	}
+	ds, err := a.feed.GetDataSeries(instrument, freq)
+	if err != nil {
+		return res
+	}
+	for i := 0; i < ds.Len(); i++ {
+		_, v, err := ds.At(i)
+		if err != nil {
+			return res
+		}
+		bar, ok := v.(Bar)
+		if !ok || !bar.DateTime().Before(t) {
+			continue
+		}
+		dt := bar.DateTime().UTC()
+		res[dt.Hour()*3600+dt.Minute()*60+dt.Second()] += float64(bar.Volume())
+	}
+	return res
+}
+
+// volume returns the profile volume of the times of day in [from, to)
+func (p volumeProfile) volume(from, to time.Time) float64 {
+	from, to = from.UTC(), to.UTC()
+	midnight := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	res := 0.0
+	for second, v := range p {
+		first := midnight.Add(time.Duration(second) * time.Second)
+		if first.Before(from) {
+			first = first.Add(24 * time.Hour)
+		}
+		if !first.Before(to) {
+			continue
+		}
+		// the time of day repeats every day until to
+		days := int((to.Sub(first)-1)/(24*time.Hour)) + 1
+		res += v * float64(days)
+	}
+	return res
+}
+
+// submitChild submits a child order of quantity for ao
+func (a *algoBroker) submitChild(ao *algoOrder, quantity float64) {
+	p := ao.parent
+	var child Order
+	if p.Type == OrderTypeLimit {
+		child = NewLimitOrder(p.Action, p.Instrument, p.LimitPrice, quantity)
+	} else {
+		child = NewMarketOrder(p.Action, p.Instrument, quantity, false)
+	}
+	err := a.Broker.SubmitOrder(child)
+
+	a.mu.Lock()
+	var cancel []Order
+	if err != nil {
+		if child.GetState() == OrderStateCanceled {
+			a.rejected[child] = true
+		}
+		logger.Logger.Warn("child order refused", zap.String("order", p.String()), zap.Error(err))
+		if p.IsActive() && !ao.canceling {
+			cancel = a.cancelLocked(ao, fmt.Sprintf("child order refused: %v", err))
+		}
+	} else {
+		a.children[child.GetID()] = ao
+		ao.children[child.GetID()] = &algoChild{order: child, remaining: quantity}
+		if !ao.accepted {
+			ao.accepted = true
+			p.State = OrderStateAccepted
+			a.queueEvent(p, OrderEventAccepted, nil)
+		}
+	}
+	a.mu.Unlock()
+
+	a.cancelChildren(cancel)
+}
+
+func (a *algoBroker) onBars(args ...interface{}) error {
+	if len(args) != 2 {
+		return fmt.Errorf("onBars args length should be 2")
+	}
+	currentTime := args[0].(time.Time)
+	bars := args[1].(map[string]interface{})
+
+	type childOrder struct {
+		ao       *algoOrder
+		quantity float64
+	}
+	a.mu.Lock()
+	// the bars generated by the feed hooks, e.g. the DAY bars, may be older
+	// than the last bar
+	if currentTime.After(a.currentTime) {
+		a.currentTime = currentTime
+	}
+	for instrument, v := range bars {
+		bar, ok := v.(Bar)
+		if !ok {
+			continue
+		}
+		if freq, ok := a.barFrequency[instrument]; !ok || bar.Frequency() < freq {
+			a.barFrequency[instrument] = bar.Frequency()
+		}
+	}
+	due := []childOrder{}
+	for _, ao := range a.sortedActiveOrders() {
+		if quantity := a.nextChildQuantity(ao, a.currentTime); quantity > 0 {
+			due = append(due, childOrder{ao: ao, quantity: quantity})
+		}
+	}
+	a.mu.Unlock()
+
+	for _, c := range due {
+		a.submitChild(c.ao, c.quantity)
+	}
+
+	a.mu.Lock()
+	for _, ao := range a.sortedActiveOrders() {
+		a.checkDoneLocked(ao)
+	}
+	a.mu.Unlock()
+	return nil
+}
+
+// checkDoneLocked cancels a parent which has no active child order and
+// nothing left to submit, i.e. the window of a TWAP or VWAP has ended or the
+// remaining quantity of an iceberg is below the lot size
+func (a *algoBroker) checkDoneLocked(ao *algoOrder) {
+	if !ao.parent.IsActive() || ao.canceling || len(ao.children) > 0 {
+		return
+	}
+	if ao.params.Algo == AlgoIceberg {
+		if a.roundQuantity(ao.parent.Instrument, ao.parent.GetRemaining()) > 0 {
+			return
+		}
+	} else if ao.schedule == nil || ao.nextSlice < len(ao.schedule) {
+		return
+	}
+	ao.canceling = true
+	if ao.reason == "" {
+		ao.reason = fmt.Sprintf("%s ended with %g remaining", ao.params.Algo, ao.parent.GetRemaining())
+	}
+	a.finishCanceled(ao)
+}
+
+// onOrderEvent hides the events of the child orders and rolls their fills up
+// into the events of the parents. The other events are forwarded.
+func (a *algoBroker) onOrderEvent(args ...interface{}) error {
+	if len(args) != 2 {
+		return fmt.Errorf("onOrderEvent args length should be 2")
+	}
+	event := args[1].(OrderEvent)
+	order := event.GetOrder()
+
+	a.mu.Lock()
+	if a.rejected[order] {
+		delete(a.rejected, order)
+		a.mu.Unlock()
+		return nil
+	}
+	ao, ok := a.children[order.GetID()]
+	if !ok {
+		a.mu.Unlock()
+		a.orderUpdatedEvent.Emit(a, event)
+		return nil
+	}
+	child, ok := ao.children[order.GetID()]
+	if !ok {
+		a.mu.Unlock()
+		return nil
+	}
+
+	events := []OrderEvent{}
+	done := false
+	switch event.GetEventType() {
+	case OrderEventPartiallyFilled, OrderEventFilled:
+		info, ok := event.GetEventInfo().(*OrderExecutionInfo)
+		if !ok {
+			break
+		}
+		fill := *info
+		child.remaining -= fill.Quantity
+		ao.parent.addExecution(&fill)
+		eventType := OrderEventPartiallyFilled
+		if ao.parent.IsFilled() {
+			eventType = OrderEventFilled
+		}
+		events = append(events, NewOrderEvent(ao.parent.clone(), eventType, &fill))
+		done = event.GetEventType() == OrderEventFilled
+	case OrderEventCanceled, OrderEventRejected:
+		done = true
+		reason, _ := event.GetEventInfo().(string)
+		if !ao.canceling {
+			ao.reason = reason
+			// the next iceberg child would be refused for the same reason
+			if ao.params.Algo == AlgoIceberg && ao.parent.IsActive() {
+				ao.canceling = true
+			}
+		}
+	}
+
+	quantity := 0.0
+	if done {
+		delete(ao.children, order.GetID())
+		delete(a.children, order.GetID())
+		if ao.parent.IsActive() && ao.canceling && len(ao.children) == 0 {
+			a.finishCanceled(ao)
+		} else if quantity = a.nextChildQuantity(ao, a.currentTime); quantity == 0 {
+			a.checkDoneLocked(ao)
+		}
+	}
+	a.mu.Unlock()
+
+	for _, e := range events {
+		a.orderUpdatedEvent.Emit(a, e)
+	}
+	if quantity > 0 {
+		a.submitChild(ao, quantity)
+	}
+	return nil
+}
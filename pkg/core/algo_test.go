@@ -0,0 +1,147 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+)
+
+type algoTest struct {
+	gen    FeedGenerator
+	feed   DataFeed
+	broker *backtestBroker
+	algo   AlgoBroker
+	events []OrderEvent
+}
+
+func newAlgoTest(freq Frequency) *algoTest {
+	cfg := &config.Config{}
+	cfg.Broker.Cash = 100000
+	gen := NewBarFeedGenerator([]Frequency{freq}, 100)
+	feed := NewGenericDataFeed(context.TODO(), cfg, gen, nil, 100, "")
+	broker := newTestBroker(cfg, feed)
+	res := &algoTest{gen: gen, feed: feed, broker: broker, algo: NewAlgoBroker(broker, feed)}
+	res.algo.GetOrderUpdatedEvent().Subscribe(func(args ...interface{}) error {
+		res.events = append(res.events, args[1].(OrderEvent))
+		return nil
+	})
+	return res
+}
+
+func (a *algoTest) dispatch(t time.Time, price float64, volume int64, freq Frequency) {
+	a.gen.AppendNewValueToBuffer(t, map[string]interface{}{
+		"GLD": NewBasicBar(t, price, price, price, price, price, volume, freq),
+	}, freq)
+	// the DAY bars of intraday bars are dispatched after them
+	for a.feed.Dispatch() {
+	}
+	a.algo.Dispatch()
+}
+
+func (a *algoTest) fills(parent Order) []float64 {
+	res := []float64{}
+	for _, e := range a.events {
+		if e.GetOrder().GetID() != parent.GetID() {
+			continue
+		}
+		if info, ok := e.GetEventInfo().(*OrderExecutionInfo); ok {
+			res = append(res, info.Quantity)
+		}
+	}
+	return res
+}
+
+func TestAlgoBrokerTWAP(t *testing.T) {
+	a := newAlgoTest(DAY)
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	parent := NewMarketOrder(OrderActionBuy, "GLD", 30, false)
+	if err := a.algo.SubmitAlgoOrder(parent, AlgoParams{Algo: "twap", Duration: 72 * time.Hour, Slices: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.algo.SubmitAlgoOrder(NewStopOrder(OrderActionBuy, "GLD", 100, 10), AlgoParams{Algo: AlgoTWAP}); err == nil {
+		t.Fatal("stop parent should fail")
+	}
+
+	a.dispatch(tm, 100, 1000, DAY)
+	if active := a.algo.GetActiveOrders("GLD"); len(active) != 1 || active[0].GetID() != parent.GetID() {
+		t.Fatal("only the parent should be active", active)
+	}
+	for i := 1; i <= 3; i++ {
+		a.dispatch(tm.AddDate(0, 0, i), 100+float64(i), 1000, DAY)
+	}
+	if !parent.IsFilled() || !almostEqual(parent.GetAvgFillPrice(), 102) || a.broker.GetPosition("GLD") != 30 {
+		t.Fatal("parent should be filled by the slices", parent, a.broker.GetPosition("GLD"))
+	}
+	if fills := a.fills(parent); len(fills) != 3 || fills[0] != 10 || fills[2] != 10 {
+		t.Fatal("unexpected fills", fills)
+	}
+	for _, e := range a.events {
+		if e.GetOrder().GetID() != parent.GetID() {
+			t.Fatal("child events should be hidden", e.GetOrder())
+		}
+	}
+	last := a.events[len(a.events)-1]
+	if a.events[0].GetEventType() != OrderEventSubmitted || last.GetEventType() != OrderEventFilled {
+		t.Fatal("unexpected events", a.events[0].GetEventType(), last.GetEventType())
+	}
+}
+
+func TestAlgoBrokerVWAP(t *testing.T) {
+	a := newAlgoTest(HOUR)
+	day := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	a.dispatch(day.Add(-12*time.Hour), 100, 0, HOUR)
+	for d := 0; d < 2; d++ {
+		a.dispatch(day.AddDate(0, 0, d).Add(9*time.Hour), 100, 300, HOUR)
+		a.dispatch(day.AddDate(0, 0, d).Add(10*time.Hour), 100, 100, HOUR)
+	}
+
+	start := day.AddDate(0, 0, 2).Add(9 * time.Hour)
+	parent := NewMarketOrder(OrderActionBuy, "GLD", 40, false)
+	params := AlgoParams{Algo: AlgoVWAP, Start: start, Duration: 2 * time.Hour, Slices: 2}
+	if err := a.algo.SubmitAlgoOrder(parent, params); err != nil {
+		t.Fatal(err)
+	}
+	for h := 0; h < 3; h++ {
+		a.dispatch(start.Add(time.Duration(h)*time.Hour), 100, 100, HOUR)
+	}
+	if fills := a.fills(parent); !parent.IsFilled() || len(fills) != 2 || fills[0] != 30 || fills[1] != 10 {
+		t.Fatal("slices should follow the volume profile", parent, fills)
+	}
+
+	profile := volumeProfile{9 * 3600: 300}
+	if v := profile.volume(start.Add(-time.Hour), start.AddDate(0, 0, 2)); v != 600 {
+		t.Error("unexpected profile volume", v)
+	}
+}
+
+func TestAlgoBrokerIceberg(t *testing.T) {
+	a := newAlgoTest(DAY)
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	parent := NewLimitOrder(OrderActionBuy, "GLD", 101, 25)
+	if err := a.algo.SubmitAlgoOrder(parent, AlgoParams{Algo: AlgoIceberg, DisplayQuantity: 10}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		a.dispatch(tm.AddDate(0, 0, i), 100, 1000, DAY)
+	}
+	if fills := a.fills(parent); !parent.IsFilled() || len(fills) != 3 || fills[2] != 5 {
+		t.Fatal("iceberg should show the display quantity", parent, fills)
+	}
+
+	parent = NewLimitOrder(OrderActionBuy, "GLD", 99, 25)
+	a.algo.SubmitAlgoOrder(parent, AlgoParams{Algo: AlgoIceberg, DisplayQuantity: 10})
+	a.dispatch(tm.AddDate(0, 0, 4), 100, 1000, DAY)
+	if len(a.broker.GetActiveOrders("GLD")) != 1 {
+		t.Fatal("one child should be shown")
+	}
+	if err := a.algo.CancelOrder(parent); err != nil {
+		t.Fatal(err)
+	}
+	a.broker.Dispatch()
+	a.algo.Dispatch()
+	if parent.GetState() != OrderStateCanceled || len(a.broker.GetActiveOrders("")) != 0 {
+		t.Fatal("canceling the parent should cancel its child", parent)
+	}
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+	"time"
+)
+
+// MetricFormat tells how a metric value should be displayed
+type MetricFormat int
+
+const (
+	MetricFormatNumber MetricFormat = iota
+	MetricFormatPercent
+	MetricFormatInteger
+	MetricFormatDays
+)
+
+// AnalyzerMetric is one value computed by an analyzer. Value is NaN when
+// the metric is undefined, e.g. the win rate of a strategy without trades.
+type AnalyzerMetric struct {
+	Name   string
+	Value  float64
+	Format MetricFormat
+}
+
+// String returns the formatted metric value
+func (m AnalyzerMetric) String() string {
+	if math.IsNaN(m.Value) || math.IsInf(m.Value, 0) {
+		return "-"
+	}
+	switch m.Format {
+	case MetricFormatPercent:
+		return fmt.Sprintf("%.2f%%", m.Value*100)
+	case MetricFormatInteger:
+		return fmt.Sprintf("%d", int64(m.Value))
+	case MetricFormatDays:
+		return fmt.Sprintf("%.1f days", m.Value)
+	default:
+		return fmt.Sprintf("%.4f", m.Value)
+	}
+}
+
+// Analyzer computes performance metrics of a strategy. Analyzers are
+// attached to a strategy controller and are called after the strategy
+// processed each bar and order event.
+type Analyzer interface {
+	GetName() string
+	OnBars(bars Bars) error
+	OnOrderEvent(orderEvent OrderEvent) error
+	GetMetrics() []AnalyzerMetric
+}
+
+// NewDefaultAnalyzers returns the built-in analyzers of portfolio
+func NewDefaultAnalyzers(portfolio Portfolio) []Analyzer {
+	return []Analyzer{
+		NewReturnsAnalyzer(portfolio),
+		NewSharpeRatioAnalyzer(portfolio, 0),
+		NewSortinoRatioAnalyzer(portfolio, 0),
+		NewDrawDownAnalyzer(portfolio),
+		newTradesAnalyzer(portfolio),
+	}
+}
+
+// WriteAnalyzerSummary writes the metrics of analyzers as a text table
+func WriteAnalyzerSummary(w io.Writer, analyzers []Analyzer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ANALYZER\tMETRIC\tVALUE")
+	for _, a := range analyzers {
+		for _, m := range a.GetMetrics() {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", a.GetName(), m.Name, m.String())
+		}
+	}
+	return tw.Flush()
+}
+
+// AnalyzerResults returns the metrics of analyzers keyed by analyzer and
+// metric name. Undefined metrics are nil so that the result can be encoded
+// as JSON.
+func AnalyzerResults(analyzers []Analyzer) map[string]map[string]interface{} {
+	res := make(map[string]map[string]interface{}, len(analyzers))
+	for _, a := range analyzers {
+		metrics := map[string]interface{}{}
+		for _, m := range a.GetMetrics() {
+			if math.IsNaN(m.Value) || math.IsInf(m.Value, 0) {
+				metrics[m.Name] = nil
+			} else {
+				metrics[m.Name] = m.Value
+			}
+		}
+		res[a.GetName()] = metrics
+	}
+	return res
+}
+
+// MarshalAnalyzerResults encodes the metrics of analyzers as a JSON document
+func MarshalAnalyzerResults(analyzers []Analyzer) ([]byte, error) {
+	return json.MarshalIndent(AnalyzerResults(analyzers), "", "  ")
+}
+
+type equitySample struct {
+	dateTime time.Time
+	equity   float64
+}
+
+// equityRecorder records the portfolio equity after each bar. It is
+// embedded by the analyzers working on the equity curve.
+type equityRecorder struct {
+	portfolio     Portfolio
+	initialEquity float64
+	samples       []equitySample
+}
+
+func newEquityRecorder(portfolio Portfolio) equityRecorder {
+	return equityRecorder{
+		portfolio:     portfolio,
+		initialEquity: portfolio.GetEquity(),
+	}
+}
+
+// OnBars implements Analyzer
+func (r *equityRecorder) OnBars(bars Bars) error {
+	var dateTime time.Time
+	for _, bar := range bars {
+		if bar.DateTime().After(dateTime) {
+			dateTime = bar.DateTime()
+		}
+	}
+	r.samples = append(r.samples, equitySample{
+		dateTime: dateTime,
+		equity:   r.portfolio.GetEquity(),
+	})
+	return nil
+}
+
+// OnOrderEvent implements Analyzer
+func (r *equityRecorder) OnOrderEvent(orderEvent OrderEvent) error {
+	return nil
+}
+
+// dailyReturns returns the returns between the last equity of each day
+func (r *equityRecorder) dailyReturns() []float64 {
+	res := []float64{}
+	prev := r.initialEquity
+	for i, s := range r.samples {
+		if i+1 < len(r.samples) && sameDay(s.dateTime, r.samples[i+1].dateTime) {
+			continue
+		}
+		if prev != 0 {
+			res = append(res, s.equity/prev-1)
+		}
+		prev = s.equity
+	}
+	return res
+}
+
+func sameDay(a, b time.Time) bool {
+	ya, ma, da := a.Date()
+	yb, mb, db := b.Date()
+	return ya == yb && ma == mb && da == db
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"math"
+	"time"
+)
+
+type drawDownAnalyzer struct {
+	highWaterMark     float64
+	highWaterMarkTime time.Time
+	lastTime          time.Time
+	maxDrawDown       float64
+	longestDuration   time.Duration
+	portfolio         Portfolio
+}
+
+// NewDrawDownAnalyzer computes the maximum drawdown of the portfolio equity
+// and the longest time it took to recover from a drawdown.
+func NewDrawDownAnalyzer(portfolio Portfolio) Analyzer {
+	return &drawDownAnalyzer{
+		highWaterMark: portfolio.GetEquity(),
+		portfolio:     portfolio,
+	}
+}
+
+// GetName implements Analyzer
+func (a *drawDownAnalyzer) GetName() string {
+	return "drawdown"
+}
+
+// OnBars implements Analyzer
+func (a *drawDownAnalyzer) OnBars(bars Bars) error {
+	for _, bar := range bars {
+		if bar.DateTime().After(a.lastTime) {
+			a.lastTime = bar.DateTime()
+		}
+	}
+	if a.highWaterMarkTime.IsZero() {
+		a.highWaterMarkTime = a.lastTime
+	}
+
+	equity := a.portfolio.GetEquity()
+	if equity >= a.highWaterMark {
+		a.highWaterMark = equity
+		a.highWaterMarkTime = a.lastTime
+		return nil
+	}
+	if a.highWaterMark > 0 {
+		a.maxDrawDown = math.Max(a.maxDrawDown, 1-equity/a.highWaterMark)
+	}
+	if d := a.lastTime.Sub(a.highWaterMarkTime); d > a.longestDuration {
+		a.longestDuration = d
+	}
+	return nil
+}
+
+// OnOrderEvent implements Analyzer
+func (a *drawDownAnalyzer) OnOrderEvent(orderEvent OrderEvent) error {
+	return nil
+}
+
+// GetMetrics implements Analyzer
+func (a *drawDownAnalyzer) GetMetrics() []AnalyzerMetric {
+	return []AnalyzerMetric{
+		{Name: "maxDrawDown", Value: a.maxDrawDown, Format: MetricFormatPercent},
+		{Name: "longestDrawDownDuration", Value: a.longestDuration.Hours() / 24, Format: MetricFormatDays},
+	}
+}
@@ -0,0 +1,143 @@
+package core
+
+import "math"
+
+const daysPerYear = 365.25
+
+type returnsAnalyzer struct {
+	equityRecorder
+}
+
+// NewReturnsAnalyzer computes the cumulative and annualized returns of the
+// portfolio
+func NewReturnsAnalyzer(portfolio Portfolio) Analyzer {
+	return &returnsAnalyzer{
+		equityRecorder: newEquityRecorder(portfolio),
+	}
+}
+
+// GetName implements Analyzer
+func (a *returnsAnalyzer) GetName() string {
+	return "returns"
+}
+
+// GetMetrics implements Analyzer
+func (a *returnsAnalyzer) GetMetrics() []AnalyzerMetric {
+	cumulative := math.NaN()
+	annualized := math.NaN()
+	if len(a.samples) > 0 && a.initialEquity != 0 {
+		cumulative = a.samples[len(a.samples)-1].equity/a.initialEquity - 1
+		span := a.samples[len(a.samples)-1].dateTime.Sub(a.samples[0].dateTime)
+		if span > 0 && cumulative > -1 {
+			years := span.Hours() / 24 / daysPerYear
+			annualized = math.Pow(1+cumulative, 1/years) - 1
+		}
+	}
+	return []AnalyzerMetric{
+		{Name: "cumulativeReturn", Value: cumulative, Format: MetricFormatPercent},
+		{Name: "annualizedReturn", Value: annualized, Format: MetricFormatPercent},
+	}
+}
+
+// tradingDaysPerYear is used to annualize ratios computed from daily returns
+const tradingDaysPerYear = 252
+
+type sharpeRatioAnalyzer struct {
+	equityRecorder
+	riskFreeRate float64
+}
+
+// NewSharpeRatioAnalyzer computes the annualized Sharpe ratio from the daily
+// returns of the portfolio. riskFreeRate is the annual risk free rate.
+func NewSharpeRatioAnalyzer(portfolio Portfolio, riskFreeRate float64) Analyzer {
+	return &sharpeRatioAnalyzer{
+		equityRecorder: newEquityRecorder(portfolio),
+		riskFreeRate:   riskFreeRate,
+	}
+}
+
+// GetName implements Analyzer
+func (a *sharpeRatioAnalyzer) GetName() string {
+	return "sharpe"
+}
+
+// GetMetrics implements Analyzer
+func (a *sharpeRatioAnalyzer) GetMetrics() []AnalyzerMetric {
+	excess := excessReturns(a.dailyReturns(), a.riskFreeRate)
+	ratio := math.NaN()
+	if len(excess) > 1 {
+		if stdDev := stdDev(excess); stdDev != 0 {
+			ratio = mean(excess) / stdDev * math.Sqrt(tradingDaysPerYear)
+		}
+	}
+	return []AnalyzerMetric{
+		{Name: "sharpeRatio", Value: ratio, Format: MetricFormatNumber},
+	}
+}
+
+type sortinoRatioAnalyzer struct {
+	equityRecorder
+	riskFreeRate float64
+}
+
+// NewSortinoRatioAnalyzer computes the annualized Sortino ratio from the
+// daily returns of the portfolio. Only returns below the risk free rate
+// count as risk.
+func NewSortinoRatioAnalyzer(portfolio Portfolio, riskFreeRate float64) Analyzer {
+	return &sortinoRatioAnalyzer{
+		equityRecorder: newEquityRecorder(portfolio),
+		riskFreeRate:   riskFreeRate,
+	}
+}
+
+// GetName implements Analyzer
+func (a *sortinoRatioAnalyzer) GetName() string {
+	return "sortino"
+}
+
+// GetMetrics implements Analyzer
+func (a *sortinoRatioAnalyzer) GetMetrics() []AnalyzerMetric {
+	excess := excessReturns(a.dailyReturns(), a.riskFreeRate)
+	ratio := math.NaN()
+	if len(excess) > 1 {
+		downside := 0.0
+		for _, r := range excess {
+			if r < 0 {
+				downside += r * r
+			}
+		}
+		if downside != 0 {
+			downside = math.Sqrt(downside / float64(len(excess)))
+			ratio = mean(excess) / downside * math.Sqrt(tradingDaysPerYear)
+		}
+	}
+	return []AnalyzerMetric{
+		{Name: "sortinoRatio", Value: ratio, Format: MetricFormatNumber},
+	}
+}
+
+func excessReturns(returns []float64, riskFreeRate float64) []float64 {
+	res := make([]float64, len(returns))
+	for i, r := range returns {
+		res[i] = r - riskFreeRate/tradingDaysPerYear
+	}
+	return res
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// stdDev returns the sample standard deviation of values
+func stdDev(values []float64) float64 {
+	m := mean(values)
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
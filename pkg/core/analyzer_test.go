@@ -0,0 +1,131 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testPortfolio struct {
+	Portfolio
+	equity float64
+}
+
+func (p *testPortfolio) GetEquity() float64 {
+	return p.equity
+}
+
+func pushAnalyzerEquity(analyzers []Analyzer, p *testPortfolio, tm time.Time, equity float64) {
+	p.equity = equity
+	bars := Bars{"GLD": NewBasicBar(tm, 1, 1, 1, 1, 1, 0, DAY)}
+	for _, a := range analyzers {
+		a.OnBars(bars)
+	}
+}
+
+func metricValue(t *testing.T, a Analyzer, name string) float64 {
+	for _, m := range a.GetMetrics() {
+		if m.Name == name {
+			return m.Value
+		}
+	}
+	t.Fatal("metric not found", name)
+	return 0
+}
+
+func TestEquityAnalyzers(t *testing.T) {
+	p := &testPortfolio{equity: 1000}
+	returns := NewReturnsAnalyzer(p)
+	sharpe := NewSharpeRatioAnalyzer(p, 0)
+	sortino := NewSortinoRatioAnalyzer(p, 0)
+	drawDown := NewDrawDownAnalyzer(p)
+	analyzers := []Analyzer{returns, sharpe, sortino, drawDown}
+
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	for i, equity := range []float64{1000, 1100, 990, 1045, 1210} {
+		pushAnalyzerEquity(analyzers, p, tm.AddDate(0, 0, i), equity)
+	}
+
+	if v := metricValue(t, returns, "cumulativeReturn"); !almostEqual(v, 0.21) {
+		t.Error("unexpected cumulative return", v)
+	}
+	if v := metricValue(t, drawDown, "maxDrawDown"); !almostEqual(v, 0.1) {
+		t.Error("unexpected max drawdown", v)
+	}
+	if v := metricValue(t, drawDown, "longestDrawDownDuration"); !almostEqual(v, 2) {
+		t.Error("unexpected drawdown duration", v)
+	}
+
+	daily := []float64{0, 0.1, -0.1, 0.05556, 0.15789}
+	expected := mean(daily) / stdDev(daily) * math.Sqrt(tradingDaysPerYear)
+	if v := metricValue(t, sharpe, "sharpeRatio"); math.Abs(v-expected) > 1e-3 {
+		t.Error("unexpected sharpe ratio", v, expected)
+	}
+	if v := metricValue(t, sortino, "sortinoRatio"); !(v > expected) {
+		t.Error("sortino ratio should be higher than sharpe ratio", v, expected)
+	}
+}
+
+func TestTradesAnalyzer(t *testing.T) {
+	trades := NewTradesAnalyzer()
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	fill := func(action OrderAction, price, quantity float64) {
+		order := NewMarketOrder(action, "GLD", quantity, false)
+		trades.OnOrderEvent(NewOrderEvent(order, OrderEventFilled, &OrderExecutionInfo{
+			Price: price, Quantity: quantity, Commission: 1, DateTime: tm,
+		}))
+	}
+
+	if v := metricValue(t, trades, "winRate"); !math.IsNaN(v) {
+		t.Error("win rate should be undefined without trades", v)
+	}
+
+	fill(OrderActionBuy, 100, 10)
+	fill(OrderActionSell, 110, 10)
+	fill(OrderActionBuy, 100, 10)
+	fill(OrderActionSell, 95, 5)
+	fill(OrderActionSell, 95, 5)
+
+	if v := metricValue(t, trades, "totalTrades"); v != 2 {
+		t.Fatal("unexpected number of trades", v)
+	}
+	if v := metricValue(t, trades, "winRate"); !almostEqual(v, 0.5) {
+		t.Error("unexpected win rate", v)
+	}
+	if v := metricValue(t, trades, "profitFactor"); !almostEqual(v, 98.0/53) {
+		t.Error("unexpected profit factor", v)
+	}
+	if v := metricValue(t, trades, "expectancy"); !almostEqual(v, 22.5) {
+		t.Error("unexpected expectancy", v)
+	}
+}
+
+func TestAnalyzerResults(t *testing.T) {
+	analyzers := []Analyzer{NewTradesAnalyzer()}
+
+	buf := &bytes.Buffer{}
+	if err := WriteAnalyzerSummary(buf, analyzers); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "winRate") {
+		t.Error("summary should contain metrics", buf.String())
+	}
+
+	data, err := MarshalAnalyzerResults(analyzers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res map[string]map[string]interface{}
+	if err := json.Unmarshal(data, &res); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := res["trades"]["winRate"]; !ok || v != nil {
+		t.Error("undefined metrics should be null", res)
+	}
+	if res["trades"]["totalTrades"].(float64) != 0 {
+		t.Error("unexpected total trades", res)
+	}
+}
@@ -0,0 +1,118 @@
+package core
+
+import "math"
+
+type tradesAnalyzer struct {
+	positions map[string]*PortfolioPosition
+	// realized pnl of each position when its current trade was opened
+	tradeStart map[string]float64
+	trades     []float64
+	// positions are taken from portfolio if it is not nil
+	portfolio Portfolio
+}
+
+// NewTradesAnalyzer computes statistics of the round trip trades of the
+// strategy. A trade starts when a position is opened and ends when it is
+// closed or reversed. Trade profits are net of commissions.
+func NewTradesAnalyzer() Analyzer {
+	return newTradesAnalyzer(nil)
+}
+
+func newTradesAnalyzer(portfolio Portfolio) *tradesAnalyzer {
+	return &tradesAnalyzer{
+		positions:  map[string]*PortfolioPosition{},
+		tradeStart: map[string]float64{},
+		portfolio:  portfolio,
+	}
+}
+
+// GetName implements Analyzer
+func (a *tradesAnalyzer) GetName() string {
+	return "trades"
+}
+
+// OnBars implements Analyzer
+func (a *tradesAnalyzer) OnBars(bars Bars) error {
+	return nil
+}
+
+// OnOrderEvent implements Analyzer
+func (a *tradesAnalyzer) OnOrderEvent(orderEvent OrderEvent) error {
+	info, ok := orderEvent.GetEventInfo().(*OrderExecutionInfo)
+	if !ok {
+		return nil
+	}
+	order := orderEvent.GetOrder()
+	quantity := info.Quantity
+	if !order.GetAction().IsBuy() {
+		quantity = -quantity
+	}
+
+	instrument := order.GetInstrument()
+	before := 0.0
+	pos, ok := a.positions[instrument]
+	if ok {
+		before = pos.Quantity
+	}
+	if a.portfolio != nil {
+		// the portfolio has seen the fill before the analyzers, its
+		// positions also follow the splits and the dividends
+		if pos = a.portfolio.GetPosition(instrument); pos == nil {
+			return nil
+		}
+		a.positions[instrument] = pos
+	} else {
+		if !ok {
+			pos = &PortfolioPosition{Instrument: instrument}
+			a.positions[instrument] = pos
+		}
+		pos.addFill(quantity, info.basePrice(), info.Commission)
+	}
+	if before != 0 && (pos.Quantity == 0 || (before > 0) != (pos.Quantity > 0)) {
+		a.trades = append(a.trades, pos.RealizedPnL-a.tradeStart[instrument])
+		a.tradeStart[instrument] = pos.RealizedPnL
+	}
+	return nil
+}
+
+// GetMetrics implements Analyzer
+func (a *tradesAnalyzer) GetMetrics() []AnalyzerMetric {
+	var wins, losses int
+	var grossProfit, grossLoss float64
+	for _, pnl := range a.trades {
+		if pnl > 0 {
+			wins++
+			grossProfit += pnl
+		} else if pnl < 0 {
+			losses++
+			grossLoss -= pnl
+		}
+	}
+
+	winRate, profitFactor, expectancy := math.NaN(), math.NaN(), math.NaN()
+	avgWin, avgLoss := math.NaN(), math.NaN()
+	if len(a.trades) > 0 {
+		winRate = float64(wins) / float64(len(a.trades))
+		expectancy = (grossProfit - grossLoss) / float64(len(a.trades))
+	}
+	if grossLoss > 0 {
+		profitFactor = grossProfit / grossLoss
+	}
+	if wins > 0 {
+		avgWin = grossProfit / float64(wins)
+	}
+	if losses > 0 {
+		avgLoss = -grossLoss / float64(losses)
+	}
+	return []AnalyzerMetric{
+		{Name: "totalTrades", Value: float64(len(a.trades)), Format: MetricFormatInteger},
+		{Name: "winningTrades", Value: float64(wins), Format: MetricFormatInteger},
+		{Name: "losingTrades", Value: float64(losses), Format: MetricFormatInteger},
+		{Name: "winRate", Value: winRate, Format: MetricFormatPercent},
+		{Name: "profitFactor", Value: profitFactor, Format: MetricFormatNumber},
+		{Name: "expectancy", Value: expectancy, Format: MetricFormatNumber},
+		{Name: "averageWin", Value: avgWin, Format: MetricFormatNumber},
+		{Name: "averageLoss", Value: avgLoss, Format: MetricFormatNumber},
+		{Name: "netProfit", Value: grossProfit - grossLoss, Format: MetricFormatNumber},
+	}
+}
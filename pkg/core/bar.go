@@ -51,9 +51,18 @@ func (b *BasicBarData) AdjClose() float64 {
 	return b.AdjCloseV
 }
 
+// adjust scales a price by the adjusted close of the bar if adjusted values
+// are used
+func (b *BasicBarData) adjust(v float64) float64 {
+	if !b.UseAdjustedV || b.AdjCloseV <= 0 || b.CloseV == 0 {
+		return v
+	}
+	return v * b.AdjCloseV / b.CloseV
+}
+
 // Close implements Bar
 func (b *BasicBarData) Close() float64 {
-	return b.CloseV
+	return b.adjust(b.CloseV)
 }
 
 // DateTime implements Bar
@@ -68,17 +77,17 @@ func (b *BasicBarData) Frequency() Frequency {
 
 // High implements Bar
 func (b *BasicBarData) High() float64 {
-	return b.HighV
+	return b.adjust(b.HighV)
 }
 
 // Low implements Bar
 func (b *BasicBarData) Low() float64 {
-	return b.LowV
+	return b.adjust(b.LowV)
 }
 
 // Open implements Bar
 func (b *BasicBarData) Open() float64 {
-	return b.OpenV
+	return b.adjust(b.OpenV)
 }
 
 // SetUseAdjustedValue implements Bar
@@ -121,6 +130,7 @@ func NewBasicBar(t time.Time, open, high, low, close, adj_close float64, volume
 		LowV:       low,
 		CloseV:     close,
 		VolumeV:    volume,
+		AdjCloseV:  adj_close,
 		FrequencyV: frequency,
 		DateTimeV:  t,
 		Meta:       make(map[int]interface{}),
@@ -14,3 +14,20 @@ func TestSimpleBasicBar(t *testing.T) {
 		t.Error("failed")
 	}
 }
+
+func TestBasicBarAdjustedValues(t *testing.T) {
+	b := NewBasicBar(time.Now(), 20, 24, 16, 22, 11, 100, DAY)
+	if b.Open() != 20 || b.Close() != 22 || b.AdjClose() != 11 {
+		t.Fatal("raw values should be used by default", b)
+	}
+	b.SetUseAdjustedValue(true)
+	if b.Open() != 10 || b.High() != 12 || b.Low() != 8 || b.Close() != 11 || b.Volume() != 100 {
+		t.Fatal("unexpected adjusted values", b.Open(), b.High(), b.Low(), b.Close())
+	}
+	// bars without an adjusted close are not adjusted
+	b = NewBasicBar(time.Now(), 20, 24, 16, 22, 0, 100, DAY)
+	b.SetUseAdjustedValue(true)
+	if b.Open() != 20 || b.Close() != 22 {
+		t.Fatal("unexpected values", b.Open(), b.Close())
+	}
+}
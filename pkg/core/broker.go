@@ -8,11 +8,31 @@ import (
 type Broker interface {
 	Subject
 	GetOrderUpdatedEvent() Event
+	GetCash() float64
+	GetPositions() map[string]float64
+	GetPosition(instrument string) float64
+	GetOrder(id uint64) Order
+	GetActiveOrders(instrument string) []Order
+	SubmitOrder(order Order) error
+	// SubmitBracketOrder submits an entry order together with its take
+	// profit and stop loss legs, one of the legs may be nil. The legs are
+	// held until the entry order is filled and then cancel each other.
+	SubmitBracketOrder(entry Order, takeProfit Order, stopLoss Order) error
+	// SubmitOCOOrders submits orders which cancel each other, once one of
+	// them is filled or canceled the others are canceled.
+	SubmitOCOOrders(orders ...Order) error
+	CancelOrder(order Order) error
 }
 
 type dummyBroker struct {
 	orderUpdatedEvent Event
 	datafeed          DataFeed
+	clock             Clock
+}
+
+// SetClock implements ClockUser
+func (e *dummyBroker) SetClock(clock Clock) {
+	e.clock = clock
 }
 
 // Dispatch implements Broker
@@ -32,8 +52,7 @@ func (e *dummyBroker) Join() error {
 
 // PeekDateTime implements Broker
 func (e *dummyBroker) PeekDateTime() *time.Time {
-	// TODO: right now we don't deal with it.
-	t := time.Now().UTC()
+	t := clockNow(e.clock)
 	return &t
 }
 
@@ -52,6 +71,51 @@ func (e *dummyBroker) GetOrderUpdatedEvent() Event {
 	return e.orderUpdatedEvent
 }
 
+// GetCash implements Broker
+func (e *dummyBroker) GetCash() float64 {
+	return 0
+}
+
+// GetPositions implements Broker
+func (e *dummyBroker) GetPositions() map[string]float64 {
+	return map[string]float64{}
+}
+
+// GetPosition implements Broker
+func (e *dummyBroker) GetPosition(instrument string) float64 {
+	return 0
+}
+
+// GetOrder implements Broker
+func (e *dummyBroker) GetOrder(id uint64) Order {
+	return nil
+}
+
+// GetActiveOrders implements Broker
+func (e *dummyBroker) GetActiveOrders(instrument string) []Order {
+	return []Order{}
+}
+
+// SubmitOrder implements Broker
+func (e *dummyBroker) SubmitOrder(order Order) error {
+	return fmt.Errorf("dummy broker does not accept orders")
+}
+
+// SubmitBracketOrder implements Broker
+func (e *dummyBroker) SubmitBracketOrder(entry Order, takeProfit Order, stopLoss Order) error {
+	return fmt.Errorf("dummy broker does not accept orders")
+}
+
+// SubmitOCOOrders implements Broker
+func (e *dummyBroker) SubmitOCOOrders(orders ...Order) error {
+	return fmt.Errorf("dummy broker does not accept orders")
+}
+
+// CancelOrder implements Broker
+func (e *dummyBroker) CancelOrder(order Order) error {
+	return fmt.Errorf("dummy broker does not accept orders")
+}
+
 func (e *dummyBroker) onBars(args ...interface{}) error {
 	// logger.Logger.Debug("broker onBars")
 	if len(args) != 2 {
@@ -69,7 +133,7 @@ func (e *dummyBroker) onBars(args ...interface{}) error {
 	// 	zap.Time("time", currentTime),
 	// 	zap.Any("bars", bars))
 
-	// TODO: implement fill strategy
+	// dummy broker never fills anything, use NewBacktestBroker instead
 
 	return nil
 }
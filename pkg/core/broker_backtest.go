@@ -0,0 +1,815 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"goat/pkg/config"
+	"goat/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// positions smaller than this are considered closed
+const positionEpsilon = 1e-9
+
+type backtestBroker struct {
+	mu                sync.Mutex
+	cfg               *config.Config
+	orderUpdatedEvent Event
+	datafeed          DataFeed
+	fillStrategy      FillStrategy
+	commission        Commission
+	instruments       InstrumentRegistry
+	// fx is nil if the amounts are not converted to a base currency
+	fx *fxRates
+
+	cash         float64
+	positions    map[string]float64
+	orders       map[uint64]*BasicOrder
+	activeOrders map[uint64]*BasicOrder
+	nextOrderID  uint64
+
+	// finest bar frequency seen for each instrument. orders are only filled
+	// against bars of this frequency so that aggregated bars (e.g. DAY bars
+	// generated by hooks) do not fill orders a second time.
+	barFrequency map[string]Frequency
+	lastTime     time.Time
+	clock        Clock
+
+	// margin is nil for a cash account, which can not sell short or borrow
+	margin           *marginModel
+	lastPrices       map[string]float64
+	lastBars         map[string]Bar
+	lastFinancingDay time.Time
+	financingCost    float64
+
+	pendingEvents []OrderEvent
+
+	// corporate actions are nil in adjusted mode, the prices already
+	// include them
+	corporateActions     *corporateActions
+	corporateActionEvent Event
+	pendingActionEvents  []CorporateActionEvent
+
+	// onFill is called with the lock held after an order is executed
+	onFill func(o *BasicOrder, info *OrderExecutionInfo)
+}
+
+// NewBacktestBroker creates a simulated broker which fills orders against
+// the bars emitted by the data feed. It returns an error if the broker
+// config of cfg is invalid.
+func NewBacktestBroker(cfg *config.Config, feed DataFeed) (Broker, error) {
+	broker, err := newBacktestBroker(cfg, feed)
+	if err != nil {
+		return nil, err
+	}
+	broker.cash = BacktestCash(cfg)
+	feed.GetNewValueEvent().Subscribe(broker.onBars)
+	return broker, nil
+}
+
+// BacktestCash returns the initial cash of the backtest broker of cfg,
+// config.DefaultBacktestCash if it is not set
+func BacktestCash(cfg *config.Config) float64 {
+	if cfg.Broker.Cash == 0 {
+		return config.DefaultBacktestCash
+	}
+	return cfg.Broker.Cash
+}
+
+// newBacktestBroker creates a backtest broker which is not subscribed to
+// the data feed yet
+func newBacktestBroker(cfg *config.Config, feed DataFeed) (*backtestBroker, error) {
+	commission, err := NewCommissionFromConfig(&cfg.Broker.Commission)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commission config: %v", err)
+	}
+	fillStrategy, err := NewFillStrategyFromConfig(&cfg.Broker.Slippage)
+	if err != nil {
+		return nil, fmt.Errorf("invalid slippage config: %v", err)
+	}
+	margin, err := newMarginModel(&cfg.Broker.Margin)
+	if err != nil {
+		return nil, fmt.Errorf("invalid margin config: %v", err)
+	}
+	instruments, err := NewInstrumentRegistryFromConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid instruments config: %v", err)
+	}
+	broker := &backtestBroker{
+		cfg:               cfg,
+		orderUpdatedEvent: NewEvent(),
+		datafeed:          feed,
+		fillStrategy:      fillStrategy,
+		commission:        commission,
+		instruments:       instruments,
+		cash:              cfg.Broker.Cash,
+		positions:         map[string]float64{},
+		orders:            map[uint64]*BasicOrder{},
+		activeOrders:      map[uint64]*BasicOrder{},
+		nextOrderID:       1,
+		barFrequency:      map[string]Frequency{},
+		margin:            margin,
+		lastPrices:        map[string]float64{},
+		lastBars:          map[string]Bar{},
+	}
+	if cfg.BaseCurrency != "" {
+		broker.fx = newFXRates(cfg.BaseCurrency)
+	}
+	broker.corporateActionEvent = NewEvent()
+	if !cfg.CorporateActions.Adjusted {
+		broker.corporateActions = newCorporateActions()
+	}
+	if cfg.CorporateActions.File != "" {
+		actions, err := LoadCorporateActionsFile(cfg.CorporateActions.File)
+		if err != nil {
+			return nil, fmt.Errorf("invalid corporate actions file: %v", err)
+		}
+		broker.AddCorporateActions(actions...)
+	}
+	return broker, nil
+}
+
+// Dispatch implements Broker
+func (b *backtestBroker) Dispatch() bool {
+	return b.emitPendingEvents()
+}
+
+// Eof implements Broker
+func (b *backtestBroker) Eof() bool {
+	// the broker only needs to be dispatched when there are order events
+	// queued by SubmitOrder or CancelOrder.
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pendingEvents) == 0 && len(b.pendingActionEvents) == 0
+}
+
+// Join implements Broker
+func (b *backtestBroker) Join() error {
+	return nil
+}
+
+// PeekDateTime implements Broker
+func (b *backtestBroker) PeekDateTime() *time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.lastTime.IsZero() {
+		t := clockNow(b.clock)
+		return &t
+	}
+	t := b.lastTime
+	return &t
+}
+
+// SetClock implements ClockUser
+func (b *backtestBroker) SetClock(clock Clock) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clock = clock
+}
+
+// Start implements Broker
+func (b *backtestBroker) Start() error {
+	return nil
+}
+
+// Stop implements Broker
+func (b *backtestBroker) Stop() error {
+	return nil
+}
+
+// GetOrderUpdatedEvent implements Broker
+func (b *backtestBroker) GetOrderUpdatedEvent() Event {
+	return b.orderUpdatedEvent
+}
+
+// GetCash implements Broker
+func (b *backtestBroker) GetCash() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cash
+}
+
+// GetPositions implements Broker
+func (b *backtestBroker) GetPositions() map[string]float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	res := make(map[string]float64, len(b.positions))
+	for k, v := range b.positions {
+		res[k] = v
+	}
+	return res
+}
+
+// GetPosition implements Broker
+func (b *backtestBroker) GetPosition(instrument string) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.positions[instrument]
+}
+
+// GetOrder implements Broker
+func (b *backtestBroker) GetOrder(id uint64) Order {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if o, ok := b.orders[id]; ok {
+		return o
+	}
+	return nil
+}
+
+// GetActiveOrders implements Broker. all active orders are returned if
+// instrument is empty.
+func (b *backtestBroker) GetActiveOrders(instrument string) []Order {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	res := []Order{}
+	for _, o := range b.sortedActiveOrders() {
+		if instrument == "" || o.Instrument == instrument {
+			res = append(res, o)
+		}
+	}
+	return res
+}
+
+// SubmitOrder implements Broker
+func (b *backtestBroker) SubmitOrder(order Order) error {
+	o, err := toSubmittableOrder(order)
+	if err != nil {
+		return err
+	}
+	if err := b.roundOrder(o); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.submitOrder(o)
+	b.mu.Unlock()
+
+	return nil
+}
+
+// SubmitBracketOrder implements Broker. If both legs could be filled on the
+// same bar, the stop loss is filled first.
+func (b *backtestBroker) SubmitBracketOrder(entry Order, takeProfit Order, stopLoss Order) error {
+	e, err := toSubmittableOrder(entry)
+	if err != nil {
+		return err
+	}
+	if err := b.roundOrder(e); err != nil {
+		return err
+	}
+	legs := []*BasicOrder{}
+	if stopLoss != nil {
+		o, err := toSubmittableOrder(stopLoss)
+		if err == nil {
+			err = b.roundOrder(o)
+		}
+		if err != nil {
+			return fmt.Errorf("stop loss: %v", err)
+		}
+		if o.Type != OrderTypeStop && o.Type != OrderTypeStopLimit && o.Type != OrderTypeTrailingStop {
+			return fmt.Errorf("stop loss should be a stop order, got %s", o.Type)
+		}
+		legs = append(legs, o)
+	}
+	if takeProfit != nil {
+		o, err := toSubmittableOrder(takeProfit)
+		if err == nil {
+			err = b.roundOrder(o)
+		}
+		if err != nil {
+			return fmt.Errorf("take profit: %v", err)
+		}
+		if o.Type != OrderTypeLimit {
+			return fmt.Errorf("take profit should be a limit order, got %s", o.Type)
+		}
+		legs = append(legs, o)
+	}
+	if len(legs) == 0 {
+		return fmt.Errorf("bracket order needs a take profit or a stop loss")
+	}
+	for _, o := range legs {
+		if o == e {
+			return fmt.Errorf("bracket legs should be different orders")
+		}
+		if o.Action == e.Action {
+			return fmt.Errorf("bracket legs should be on the opposite side of the entry order")
+		}
+		if o.Instrument != e.Instrument {
+			return fmt.Errorf("bracket legs should be on the same instrument as the entry order")
+		}
+		if o.Quantity != e.Quantity {
+			return fmt.Errorf("bracket legs should have the same quantity as the entry order")
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.submitOrder(e)
+	// the group is named after the first leg, which gets the next id
+	group := b.nextOrderID
+	for _, o := range legs {
+		o.ParentID = e.ID
+		if len(legs) > 1 {
+			o.OCOGroup = group
+		}
+		b.submitOrder(o)
+	}
+	return nil
+}
+
+// SubmitOCOOrders implements Broker
+func (b *backtestBroker) SubmitOCOOrders(orders ...Order) error {
+	if len(orders) < 2 {
+		return fmt.Errorf("oco needs at least 2 orders")
+	}
+	group := make([]*BasicOrder, 0, len(orders))
+	for i, order := range orders {
+		o, err := toSubmittableOrder(order)
+		if err == nil {
+			err = b.roundOrder(o)
+		}
+		if err != nil {
+			return fmt.Errorf("order %d: %v", i, err)
+		}
+		for _, other := range group {
+			if other == o {
+				return fmt.Errorf("oco orders should be different orders")
+			}
+		}
+		group = append(group, o)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// the group is named after the first order, which gets the next id
+	groupID := b.nextOrderID
+	for _, o := range group {
+		o.OCOGroup = groupID
+		b.submitOrder(o)
+	}
+	return nil
+}
+
+// toSubmittableOrder checks that order can be submitted to the broker
+func toSubmittableOrder(order Order) (*BasicOrder, error) {
+	o, ok := order.(*BasicOrder)
+	if !ok {
+		return nil, fmt.Errorf("unsupported order type %T", order)
+	}
+	if o.State != OrderStateInitial {
+		return nil, fmt.Errorf("order %d has already been submitted", o.ID)
+	}
+	if o.Instrument == "" {
+		return nil, fmt.Errorf("order instrument is empty")
+	}
+	if o.Quantity <= 0 || math.IsNaN(o.Quantity) || math.IsInf(o.Quantity, 0) {
+		return nil, fmt.Errorf("invalid order quantity %f", o.Quantity)
+	}
+	if o.Type == OrderTypeTrailingStop {
+		if o.TrailAmount > 0 == (o.TrailATRMultiple > 0) {
+			return nil, fmt.Errorf("trailing stop needs either a trail amount or an atr multiple")
+		}
+		if o.TrailATRMultiple > 0 && o.TrailATRPeriod <= 0 {
+			return nil, fmt.Errorf("invalid trailing stop atr period %d", o.TrailATRPeriod)
+		}
+	}
+	return o, nil
+}
+
+// GetInstrument implements InstrumentProvider
+func (b *backtestBroker) GetInstrument(symbol string) *Instrument {
+	if i := b.instruments.GetInstrument(symbol); i != nil {
+		return i
+	}
+	return defaultInstrument(symbol)
+}
+
+// GetBaseCurrency implements CurrencyConverter
+func (b *backtestBroker) GetBaseCurrency() string {
+	return b.cfg.BaseCurrency
+}
+
+// GetFXRate implements CurrencyConverter
+func (b *backtestBroker) GetFXRate(currency string) (float64, bool) {
+	if b.fx == nil {
+		return 1, true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.fx.GetFXRate(currency)
+}
+
+// fxRate returns the rate converting the prices of instrument to the base
+// currency
+func (b *backtestBroker) fxRate(instrument string) (float64, bool) {
+	if b.fx == nil {
+		return 1, true
+	}
+	return b.fx.GetFXRate(b.GetInstrument(instrument).Currency)
+}
+
+// roundOrder rounds the quantity of o down to the lot size and its prices
+// to the tick size of its instrument
+func (b *backtestBroker) roundOrder(o *BasicOrder) error {
+	instrument := b.GetInstrument(o.Instrument)
+	quantity := instrument.RoundQuantity(o.Quantity)
+	if quantity <= 0 {
+		return fmt.Errorf("order quantity %g is below the lot size %g of %s", o.Quantity,
+			instrument.LotSize, o.Instrument)
+	}
+	o.Quantity = quantity
+	o.LimitPrice = instrument.RoundPrice(o.LimitPrice)
+	o.StopPrice = instrument.RoundPrice(o.StopPrice)
+	return nil
+}
+
+func (b *backtestBroker) submitOrder(o *BasicOrder) {
+	o.ID = b.nextOrderID
+	b.nextOrderID++
+	o.State = OrderStateSubmitted
+	o.SubmitDateTime = b.lastTime
+	b.orders[o.ID] = o
+	b.activeOrders[o.ID] = o
+	b.queueEvent(o, OrderEventSubmitted, nil)
+}
+
+// CancelOrder implements Broker
+func (b *backtestBroker) CancelOrder(order Order) error {
+	b.mu.Lock()
+	o, ok := b.activeOrders[order.GetID()]
+	if !ok {
+		b.mu.Unlock()
+		return fmt.Errorf("order %d is not active", order.GetID())
+	}
+	b.cancelOrder(o, "canceled by user")
+	b.mu.Unlock()
+
+	return nil
+}
+
+func (b *backtestBroker) cancelOrder(o *BasicOrder, reason string) {
+	o.State = OrderStateCanceled
+	delete(b.activeOrders, o.ID)
+	b.queueEvent(o, OrderEventCanceled, reason)
+
+	for _, other := range b.sortedActiveOrders() {
+		if !other.IsActive() {
+			// canceled by a previous iteration
+			continue
+		}
+		if o.OCOGroup != 0 && other.OCOGroup == o.OCOGroup {
+			b.cancelOrder(other, fmt.Sprintf("order %d of the oco group is canceled", o.ID))
+		} else if other.ParentID == o.ID && o.Filled == 0 {
+			// legs of a partially filled entry order protect the filled quantity
+			b.cancelOrder(other, fmt.Sprintf("parent order %d is canceled", o.ID))
+		}
+	}
+}
+
+// onOrderExecuted cancels the other orders of the oco group of o and
+// resizes its bracket legs to the filled quantity
+func (b *backtestBroker) onOrderExecuted(o *BasicOrder) {
+	for _, other := range b.sortedActiveOrders() {
+		if !other.IsActive() || other == o {
+			continue
+		}
+		if o.OCOGroup != 0 && other.OCOGroup == o.OCOGroup {
+			b.cancelOrder(other, fmt.Sprintf("order %d of the oco group is filled", o.ID))
+		} else if other.ParentID == o.ID {
+			other.Quantity = o.Filled
+		}
+	}
+}
+
+// heldOrders returns the bracket legs whose entry order is not filled yet.
+// legs are only processed from the bar after the entry order is filled.
+func (b *backtestBroker) heldOrders() map[uint64]bool {
+	res := map[uint64]bool{}
+	for id, o := range b.activeOrders {
+		if o.ParentID == 0 {
+			continue
+		}
+		if parent, ok := b.orders[o.ParentID]; !ok || parent.Filled == 0 {
+			res[id] = true
+		}
+	}
+	return res
+}
+
+// queueEvent queues an order event. the event keeps a copy of the order so
+// that handlers see the order as it was when the event happened.
+func (b *backtestBroker) queueEvent(o *BasicOrder, eventType OrderEventType, eventInfo interface{}) {
+	b.pendingEvents = append(b.pendingEvents, NewOrderEvent(o.clone(), eventType, eventInfo))
+}
+
+// emitPendingEvents emits the queued order events. it must be called
+// without holding the lock since the handlers may call back into the broker.
+//
+// NOTE: SubmitOrder and CancelOrder only queue their events. They are usually
+// called from inside a strategy event handler and emitting from there would
+// call the strategy again before the handler returns.
+func (b *backtestBroker) emitPendingEvents() bool {
+	emitted := false
+	// the corporate actions are applied before the orders of the same bar
+	for {
+		b.mu.Lock()
+		if len(b.pendingActionEvents) == 0 {
+			b.mu.Unlock()
+			break
+		}
+		event := b.pendingActionEvents[0]
+		b.pendingActionEvents = b.pendingActionEvents[1:]
+		b.mu.Unlock()
+
+		b.corporateActionEvent.Emit(b, event)
+		emitted = true
+	}
+	for {
+		b.mu.Lock()
+		if len(b.pendingEvents) == 0 {
+			b.mu.Unlock()
+			return emitted
+		}
+		event := b.pendingEvents[0]
+		b.pendingEvents = b.pendingEvents[1:]
+		b.mu.Unlock()
+
+		b.orderUpdatedEvent.Emit(b, event)
+		emitted = true
+	}
+}
+
+func (b *backtestBroker) sortedActiveOrders() []*BasicOrder {
+	res := make([]*BasicOrder, 0, len(b.activeOrders))
+	for _, o := range b.activeOrders {
+		res = append(res, o)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+func (b *backtestBroker) onBars(args ...interface{}) error {
+	if len(args) != 2 {
+		return fmt.Errorf("onBars args length should be 2")
+	}
+
+	currentTime := args[0].(time.Time)
+	data := args[1].(map[string]interface{})
+
+	b.mu.Lock()
+	bars := make(Bars, len(data))
+	dayBars := false
+	for k, v := range data {
+		bar := v.(Bar)
+		dayBars = dayBars || bar.Frequency() == DAY
+		if freq, ok := b.barFrequency[k]; ok && bar.Frequency() > freq {
+			continue
+		}
+		b.barFrequency[k] = bar.Frequency()
+		// the time of the resampled bars is the start of their period, the
+		// time of the broker only follows the finest bars
+		b.lastTime = currentTime
+		bars[k] = bar
+		b.lastPrices[k] = bar.Close()
+		b.lastBars[k] = bar
+		if b.fx != nil {
+			b.fx.update(k, bar.Close())
+		}
+		if b.corporateActions != nil {
+			for _, action := range b.corporateActions.pop(k, currentTime) {
+				b.applyCorporateAction(action)
+			}
+		}
+	}
+	b.fillStrategy.OnBars(bars)
+	if b.margin != nil && dayBars {
+		b.accrueFinancing(currentTime)
+	}
+
+	held := b.heldOrders()
+	for _, o := range b.sortedActiveOrders() {
+		if !o.IsActive() || held[o.ID] {
+			// orders may be canceled by an order processed before them
+			continue
+		}
+		bar, ok := bars[o.Instrument]
+		if !ok {
+			continue
+		}
+		if o.State == OrderStateSubmitted {
+			o.State = OrderStateAccepted
+			b.queueEvent(o, OrderEventAccepted, nil)
+		}
+		if o.Type == OrderTypeTrailingStop && o.TrailExtreme == 0 {
+			b.initTrailingStop(o, bar)
+		}
+		b.tryFillOrder(o, bar)
+		if o.Type == OrderTypeTrailingStop && o.IsActive() {
+			b.updateTrailingStop(o, bar)
+		}
+	}
+	if b.margin != nil && len(bars) > 0 {
+		b.checkMaintenanceMargin()
+	}
+	b.mu.Unlock()
+
+	b.emitPendingEvents()
+	return nil
+}
+
+func (b *backtestBroker) tryFillOrder(o *BasicOrder, bar Bar) {
+	var fill *FillInfo
+	switch o.Type {
+	case OrderTypeMarket:
+		fill = b.fillStrategy.FillMarketOrder(o, bar)
+	case OrderTypeLimit:
+		fill = b.fillStrategy.FillLimitOrder(o, bar)
+	case OrderTypeStop:
+		fill = b.fillStrategy.FillStopOrder(o, bar)
+	case OrderTypeStopLimit:
+		fill = b.fillStrategy.FillStopLimitOrder(o, bar)
+	case OrderTypeTrailingStop:
+		if o.StopPrice <= 0 {
+			// the average true range is not available yet
+			return
+		}
+		fill = b.fillStrategy.FillStopOrder(o, bar)
+	default:
+		b.cancelOrder(o, fmt.Sprintf("unsupported order type %s", o.Type))
+		return
+	}
+	if fill == nil || fill.Quantity <= 0 {
+		return
+	}
+
+	instrument := b.GetInstrument(o.Instrument)
+	fill.Price = instrument.RoundPrice(fill.Price)
+	rate, ok := b.fxRate(o.Instrument)
+	if !ok {
+		b.cancelOrder(o, fmt.Sprintf("no %s%s fx rate", instrument.Currency, b.fx.base))
+		return
+	}
+	// the cash and the commissions are in the base currency
+	basePrice := fill.Price * rate
+	cost := basePrice * fill.Quantity * instrument.GetMultiplier()
+	commission := b.commission.Calculate(o, basePrice, fill.Quantity)
+	if b.margin != nil {
+		// a margin account may borrow cash and sell short
+		if reason := b.checkMarginFill(o, basePrice, fill.Quantity, commission); reason != "" {
+			b.cancelOrder(o, reason)
+			return
+		}
+		if o.Action.IsBuy() {
+			b.cash -= cost
+			b.positions[o.Instrument] += fill.Quantity
+		} else {
+			b.cash += cost
+			b.positions[o.Instrument] -= fill.Quantity
+		}
+	} else if o.Action.IsBuy() {
+		if cost+commission > b.cash {
+			logger.Logger.Debug("not enough cash to fill order",
+				zap.Uint64("order", o.ID),
+				zap.Float64("cost", cost),
+				zap.Float64("commission", commission),
+				zap.Float64("cash", b.cash))
+			b.cancelOrder(o, "not enough cash")
+			return
+		}
+		b.cash -= cost
+		b.positions[o.Instrument] += fill.Quantity
+	} else {
+		if b.positions[o.Instrument]+positionEpsilon < fill.Quantity {
+			logger.Logger.Debug("not enough shares to fill order",
+				zap.Uint64("order", o.ID),
+				zap.Float64("quantity", fill.Quantity),
+				zap.Float64("position", b.positions[o.Instrument]))
+			b.cancelOrder(o, "not enough shares")
+			return
+		}
+		b.cash += cost
+		b.positions[o.Instrument] -= fill.Quantity
+	}
+	b.cash -= commission
+	if math.Abs(b.positions[o.Instrument]) < positionEpsilon {
+		delete(b.positions, o.Instrument)
+	}
+
+	info := &OrderExecutionInfo{
+		Price:      fill.Price,
+		Quantity:   fill.Quantity,
+		Commission: commission,
+		DateTime:   bar.DateTime(),
+	}
+	if b.fx != nil {
+		info.FXRate = rate
+	}
+	o.addExecution(info)
+	b.fillStrategy.OnOrderFilled(o, fill)
+	if b.onFill != nil {
+		b.onFill(o, info)
+	}
+	if o.IsFilled() {
+		delete(b.activeOrders, o.ID)
+		b.queueEvent(o, OrderEventFilled, info)
+	} else {
+		b.queueEvent(o, OrderEventPartiallyFilled, info)
+	}
+	b.onOrderExecuted(o)
+}
+
+// initTrailingStop sets the first stop price of a trailing stop order from
+// the open price of the first bar it sees
+func (b *backtestBroker) initTrailingStop(o *BasicOrder, bar Bar) {
+	o.TrailExtreme = bar.Open()
+	if trail, ok := b.trailDistance(o, bar.DateTime(), false); ok {
+		o.StopPrice = b.GetInstrument(o.Instrument).RoundPrice(trailingStopPrice(o, trail))
+	}
+}
+
+// updateTrailingStop moves the stop price of a trailing stop order after bar
+func (b *backtestBroker) updateTrailingStop(o *BasicOrder, bar Bar) {
+	if o.Action.IsBuy() {
+		o.TrailExtreme = math.Min(o.TrailExtreme, bar.Low())
+	} else {
+		o.TrailExtreme = math.Max(o.TrailExtreme, bar.High())
+	}
+	trail, ok := b.trailDistance(o, bar.DateTime(), true)
+	if !ok {
+		return
+	}
+	stopPrice := b.GetInstrument(o.Instrument).RoundPrice(trailingStopPrice(o, trail))
+	if o.StopPrice <= 0 {
+		o.StopPrice = stopPrice
+	} else if o.Action.IsBuy() {
+		o.StopPrice = math.Min(o.StopPrice, stopPrice)
+	} else {
+		o.StopPrice = math.Max(o.StopPrice, stopPrice)
+	}
+}
+
+func trailingStopPrice(o *BasicOrder, trail float64) float64 {
+	if o.Action.IsBuy() {
+		return o.TrailExtreme + trail
+	}
+	return o.TrailExtreme - trail
+}
+
+// trailDistance returns how far the stop of a trailing stop order is from
+// the extreme price, using the bars before t, or up to t if inclusive.
+func (b *backtestBroker) trailDistance(o *BasicOrder, t time.Time, inclusive bool) (float64, bool) {
+	if o.TrailAmount > 0 {
+		return o.TrailAmount, true
+	}
+	atr, ok := b.averageTrueRange(o.Instrument, o.TrailATRPeriod, t, inclusive)
+	if !ok {
+		return 0, false
+	}
+	return atr * o.TrailATRMultiple, true
+}
+
+// averageTrueRange returns the mean true range of the last period bars of
+// instrument kept by the data feed, using the bars before t, or up to t if
+// inclusive.
+func (b *backtestBroker) averageTrueRange(instrument string, period int, t time.Time,
+	inclusive bool,
+) (float64, bool) {
+	ds, err := b.datafeed.GetDataSeries(instrument, b.barFrequency[instrument])
+	if err != nil {
+		return 0, false
+	}
+	// the true range of a bar needs the close of the previous one
+	bars := make([]Bar, 0, period+1)
+	for i := ds.Len() - 1; i >= 0 && len(bars) <= period; i-- {
+		_, v, err := ds.At(i)
+		if err != nil {
+			return 0, false
+		}
+		bar, ok := v.(Bar)
+		if !ok {
+			return 0, false
+		}
+		if bar.DateTime().After(t) || (!inclusive && bar.DateTime().Equal(t)) {
+			continue
+		}
+		bars = append(bars, bar)
+	}
+	if len(bars) <= period {
+		return 0, false
+	}
+	sum := 0.0
+	for i := 0; i < period; i++ {
+		bar, prevClose := bars[i], bars[i+1].Close()
+		sum += math.Max(bar.High()-bar.Low(),
+			math.Max(math.Abs(bar.High()-prevClose), math.Abs(bar.Low()-prevClose)))
+	}
+	return sum / float64(period), true
+}
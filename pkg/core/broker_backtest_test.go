@@ -0,0 +1,219 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+)
+
+// newTestBroker panics if the broker config of cfg is invalid
+func newTestBroker(cfg *config.Config, feed DataFeed) *backtestBroker {
+	broker, err := NewBacktestBroker(cfg, feed)
+	if err != nil {
+		panic(err)
+	}
+	return broker.(*backtestBroker)
+}
+
+// newTestFeed creates the data feed of the test brokers, the bars are
+// pushed by pushTestBar and pushTestBars
+func newTestFeed(cfg *config.Config) DataFeed {
+	gen := NewBarFeedGenerator([]Frequency{REALTIME, DAY}, 100)
+	return NewGenericDataFeed(context.TODO(), cfg, gen, nil, 100, "")
+}
+
+func newTestBacktestBroker(cash float64) (*backtestBroker, *[]OrderEvent) {
+	cfg := &config.Config{}
+	cfg.Broker.Cash = cash
+	return newTestBacktestBrokerWithConfig(cfg)
+}
+
+// newTestBacktestBrokerWithConfig returns the broker of cfg and the order
+// events it emits
+func newTestBacktestBrokerWithConfig(cfg *config.Config) (*backtestBroker, *[]OrderEvent) {
+	broker := newTestBroker(cfg, newTestFeed(cfg))
+	events := &[]OrderEvent{}
+	broker.GetOrderUpdatedEvent().Subscribe(func(args ...interface{}) error {
+		*events = append(*events, args[1].(OrderEvent))
+		return nil
+	})
+	return broker, events
+}
+
+// pushTestBar pushes a DAY bar of GLD to target, a broker or a data feed
+func pushTestBar(target interface{}, tm time.Time, open, high, low, close float64) {
+	emitTestBars(target, tm, map[string]interface{}{
+		"GLD": NewBasicBar(tm, open, high, low, close, close, 1000, DAY),
+	})
+}
+
+// pushTestBars pushes the DAY bars of closes to target, a broker or a data
+// feed
+func pushTestBars(target interface{}, tm time.Time, closes map[string]float64) {
+	bars := map[string]interface{}{}
+	for instrument, c := range closes {
+		bars[instrument] = NewBasicBar(tm, c, c, c, c, c, 1000, DAY)
+	}
+	emitTestBars(target, tm, bars)
+}
+
+// testBarsReceiver is implemented by the brokers
+type testBarsReceiver interface {
+	onBars(args ...interface{}) error
+}
+
+func emitTestBars(target interface{}, tm time.Time, bars map[string]interface{}) {
+	switch t := target.(type) {
+	case DataFeed:
+		// the subscribers of the feed get the bars, e.g. the portfolio
+		t.GetNewValueEvent().Emit(tm, bars)
+	case testBarsReceiver:
+		t.onBars(tm, bars)
+	default:
+		panic(fmt.Sprintf("unexpected test bars target %T", target))
+	}
+}
+
+func TestBacktestBrokerInvalidConfig(t *testing.T) {
+	configs := []*config.Config{{}, {}, {}, {}, {}}
+	configs[0].Broker.Commission.Type = "unknown"
+	configs[1].Broker.Slippage.Type = "unknown"
+	configs[2].Broker.Margin = config.MarginConfig{Enabled: true, Initial: 2}
+	configs[3].Instruments = map[string]config.InstrumentConfig{"GLD": {TickSize: -1}}
+	configs[4].CorporateActions.File = filepath.Join(t.TempDir(), "missing.csv")
+	for _, cfg := range configs {
+		gen := NewBarFeedGenerator([]Frequency{DAY}, 100)
+		feed := NewGenericDataFeed(context.TODO(), cfg, gen, nil, 100, "")
+		if _, err := NewBacktestBroker(cfg, feed); err == nil {
+			t.Error("invalid broker config should be rejected", cfg.Broker)
+		}
+		cfg.Dump.BarDumpDB = filepath.Join(t.TempDir(), "paper.db")
+		if _, err := NewPaperBroker(cfg, feed, ""); err == nil {
+			t.Error("invalid paper broker config should be rejected", cfg.Broker)
+		}
+	}
+}
+
+func TestBacktestBrokerResampledBarsTime(t *testing.T) {
+	broker, _ := newTestBacktestBroker(1000)
+	day := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	push := func(tm time.Time, freq Frequency) {
+		broker.onBars(tm, map[string]interface{}{
+			"GLD": NewBasicBar(tm, 100, 100, 100, 100, 100, 1000, freq),
+		})
+	}
+	push(day.AddDate(0, 0, 1), MINUTE)
+	// the day bar of the previous day is generated at the start of the next
+	// one with the time of its period
+	push(day, DAY)
+	if tm := broker.PeekDateTime(); !tm.Equal(day.AddDate(0, 0, 1)) {
+		t.Fatal("the time of the broker should not go backwards", tm)
+	}
+	order := NewMarketOrder(OrderActionBuy, "GLD", 1, false)
+	broker.SubmitOrder(order)
+	if !order.GetSubmitDateTime().Equal(day.AddDate(0, 0, 1)) {
+		t.Error("unexpected submit time", order.GetSubmitDateTime())
+	}
+}
+
+func TestBacktestBrokerMarketOrder(t *testing.T) {
+	broker, events := newTestBacktestBroker(1000)
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	order := NewMarketOrder(OrderActionBuy, "GLD", 5, false)
+	if err := broker.SubmitOrder(order); err != nil {
+		t.Fatal(err)
+	}
+	if order.GetState() != OrderStateSubmitted {
+		t.Fatal("order should be submitted", order)
+	}
+	pushTestBar(broker, tm, 100, 110, 90, 105)
+
+	if !order.IsFilled() || !almostEqual(order.GetAvgFillPrice(), 100) {
+		t.Fatal("order should be filled at open", order)
+	}
+	if !almostEqual(broker.GetCash(), 500) || !almostEqual(broker.GetPosition("GLD"), 5) {
+		t.Fatal("unexpected cash or position", broker.GetCash(), broker.GetPosition("GLD"))
+	}
+	if len(*events) != 3 || (*events)[0].GetEventType() != OrderEventSubmitted ||
+		(*events)[1].GetEventType() != OrderEventAccepted ||
+		(*events)[2].GetEventType() != OrderEventFilled {
+		t.Fatal("unexpected order events", *events)
+	}
+
+	sell := NewMarketOrder(OrderActionSell, "GLD", 5, true)
+	broker.SubmitOrder(sell)
+	pushTestBar(broker, tm.AddDate(0, 0, 1), 100, 110, 90, 108)
+	if !sell.IsFilled() || !almostEqual(broker.GetCash(), 1040) {
+		t.Fatal("sell order should be filled at close", sell, broker.GetCash())
+	}
+	if len(broker.GetPositions()) != 0 {
+		t.Fatal("position should be closed", broker.GetPositions())
+	}
+}
+
+func TestBacktestBrokerLimitAndStopOrders(t *testing.T) {
+	broker, _ := newTestBacktestBroker(10000)
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	limit := NewLimitOrder(OrderActionBuy, "GLD", 95, 10)
+	stop := NewStopOrder(OrderActionBuy, "GLD", 120, 10)
+	stopLimit := NewStopLimitOrder(OrderActionBuy, "GLD", 108, 109, 10)
+	broker.SubmitOrder(limit)
+	broker.SubmitOrder(stop)
+	broker.SubmitOrder(stopLimit)
+
+	pushTestBar(broker, tm, 100, 110, 96, 105)
+	if limit.GetFilled() != 0 || stop.GetFilled() != 0 {
+		t.Fatal("orders should not be filled", limit, stop)
+	}
+	if !stopLimit.IsFilled() || !almostEqual(stopLimit.GetAvgFillPrice(), 108) {
+		t.Fatal("stop limit order should be filled at stop price", stopLimit)
+	}
+
+	pushTestBar(broker, tm.AddDate(0, 0, 1), 97, 125, 90, 121)
+	if !limit.IsFilled() || !almostEqual(limit.GetAvgFillPrice(), 95) {
+		t.Fatal("limit order should be filled at limit price", limit)
+	}
+	if !stop.IsFilled() || !almostEqual(stop.GetAvgFillPrice(), 120) {
+		t.Fatal("stop order should be filled at stop price", stop)
+	}
+	if len(broker.GetActiveOrders("")) != 0 {
+		t.Fatal("no order should be active")
+	}
+}
+
+func TestBacktestBrokerCancel(t *testing.T) {
+	broker, events := newTestBacktestBroker(100)
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	tooBig := NewMarketOrder(OrderActionBuy, "GLD", 5, false)
+	broker.SubmitOrder(tooBig)
+	pushTestBar(broker, tm, 100, 110, 90, 105)
+	if tooBig.GetState() != OrderStateCanceled {
+		t.Fatal("order should be canceled because of cash", tooBig)
+	}
+	if last := (*events)[len(*events)-1]; last.GetEventInfo().(string) != "not enough cash" {
+		t.Fatal("unexpected cancel reason", last.GetEventInfo())
+	}
+
+	limit := NewLimitOrder(OrderActionBuy, "GLD", 10, 1)
+	broker.SubmitOrder(limit)
+	if err := broker.CancelOrder(limit); err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.CancelOrder(limit); err == nil {
+		t.Fatal("canceling an inactive order should fail")
+	}
+	if broker.GetOrder(limit.GetID()) != limit {
+		t.Fatal("order should still be available")
+	}
+
+	if err := broker.SubmitOrder(NewMarketOrder(OrderActionSell, "GLD", 0, false)); err == nil {
+		t.Fatal("zero quantity should be rejected")
+	}
+}
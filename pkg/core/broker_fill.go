@@ -0,0 +1,256 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"goat/pkg/config"
+)
+
+// FillInfo is the result of a fill strategy
+type FillInfo struct {
+	Price    float64
+	Quantity float64
+}
+
+// FillStrategy decides if and at what price an order gets filled against
+// a bar. It is used by the backtest broker.
+type FillStrategy interface {
+	// OnBars is called with the new bars before any order is filled against them
+	OnBars(bars Bars)
+	// OnOrderFilled is called after the broker filled an order
+	OnOrderFilled(order *BasicOrder, fill *FillInfo)
+
+	FillMarketOrder(order *BasicOrder, bar Bar) *FillInfo
+	FillLimitOrder(order *BasicOrder, bar Bar) *FillInfo
+	FillStopOrder(order *BasicOrder, bar Bar) *FillInfo
+	FillStopLimitOrder(order *BasicOrder, bar Bar) *FillInfo
+}
+
+// InstrumentFillConfig overrides the fill settings of one instrument
+type InstrumentFillConfig struct {
+	Slippage    Slippage
+	VolumeLimit float64
+}
+
+type defaultFillStrategy struct {
+	slippage    Slippage
+	volumeLimit float64
+	instruments map[string]InstrumentFillConfig
+
+	// volume that can still be filled on the current bar of each
+	// instrument. instruments without an entry are not limited.
+	volumeLeft map[string]float64
+}
+
+// NewDefaultFillStrategy returns the fill strategy used by PyAlgoTrade:
+//
+//   - market orders are filled at the open price of the next bar, or at its
+//     close price if the order was created to fill on close.
+//   - limit and stop orders are filled at the open price if the bar opens
+//     beyond the order price, otherwise at the order price if the bar range
+//     reaches it.
+//   - stop limit orders become limit orders once the stop price is hit.
+//
+// Orders are filled without slippage and without volume limit.
+func NewDefaultFillStrategy() FillStrategy {
+	return NewFillStrategy(NewNoSlippage(), 0, nil)
+}
+
+// NewFillStrategy returns the default fill strategy with slippage applied to
+// the fill prices. volumeLimit is the fraction of the bar volume (0.25 is
+// 25%) that orders of an instrument can fill per bar, orders too large for
+// a bar are partially filled across several bars. Pass 0 to disable it.
+// instruments overrides the settings per instrument, instrument names are
+// case insensitive.
+func NewFillStrategy(slippage Slippage, volumeLimit float64,
+	instruments map[string]InstrumentFillConfig,
+) FillStrategy {
+	res := &defaultFillStrategy{
+		slippage:    slippage,
+		volumeLimit: volumeLimit,
+		instruments: make(map[string]InstrumentFillConfig, len(instruments)),
+		volumeLeft:  map[string]float64{},
+	}
+	for k, v := range instruments {
+		res.instruments[strings.ToLower(k)] = v
+	}
+	return res
+}
+
+// NewFillStrategyFromConfig creates the fill strategy described by the
+// broker slippage configuration.
+func NewFillStrategyFromConfig(cfg *config.SlippageConfig) (FillStrategy, error) {
+	slippage, err := newSlippage(cfg.Type, cfg.Amount)
+	if err != nil {
+		return nil, err
+	}
+	instruments := make(map[string]InstrumentFillConfig, len(cfg.Instruments))
+	for k, v := range cfg.Instruments {
+		s, err := newSlippage(v.Type, v.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("instrument %s: %v", k, err)
+		}
+		instruments[k] = InstrumentFillConfig{
+			Slippage:    s,
+			VolumeLimit: v.VolumeLimit,
+		}
+	}
+	return NewFillStrategy(slippage, cfg.VolumeLimit, instruments), nil
+}
+
+func (d *defaultFillStrategy) instrumentConfig(instrument string) (Slippage, float64) {
+	if v, ok := d.instruments[strings.ToLower(instrument)]; ok {
+		return v.Slippage, v.VolumeLimit
+	}
+	return d.slippage, d.volumeLimit
+}
+
+// OnBars implements FillStrategy
+func (d *defaultFillStrategy) OnBars(bars Bars) {
+	for k, bar := range bars {
+		_, volumeLimit := d.instrumentConfig(k)
+		if volumeLimit <= 0 || bar.Volume() <= 0 {
+			// bars without volume cannot be used to limit fills
+			delete(d.volumeLeft, k)
+			continue
+		}
+		d.volumeLeft[k] = float64(bar.Volume()) * volumeLimit
+	}
+}
+
+// OnOrderFilled implements FillStrategy
+func (d *defaultFillStrategy) OnOrderFilled(order *BasicOrder, fill *FillInfo) {
+	if v, ok := d.volumeLeft[order.Instrument]; ok {
+		d.volumeLeft[order.Instrument] = math.Max(v-fill.Quantity, 0)
+	}
+}
+
+// fill returns the fill of order at price after applying the volume limit
+// and slippage. it returns nil if there is no volume left on this bar.
+func (d *defaultFillStrategy) fill(order *BasicOrder, price float64, bar Bar) *FillInfo {
+	quantity := order.GetRemaining()
+	if v, ok := d.volumeLeft[order.Instrument]; ok {
+		quantity = math.Min(quantity, v)
+	}
+	if quantity <= 0 {
+		return nil
+	}
+
+	slippage, _ := d.instrumentConfig(order.Instrument)
+	price = slippage.AdjustPrice(order, price, quantity, bar)
+	if order.Type == OrderTypeLimit || order.Type == OrderTypeStopLimit {
+		// slippage never makes a fill worse than the limit price
+		if order.Action.IsBuy() {
+			price = math.Min(price, order.LimitPrice)
+		} else {
+			price = math.Max(price, order.LimitPrice)
+		}
+	}
+	return &FillInfo{
+		Price:    price,
+		Quantity: quantity,
+	}
+}
+
+// FillMarketOrder implements FillStrategy
+func (d *defaultFillStrategy) FillMarketOrder(order *BasicOrder, bar Bar) *FillInfo {
+	price := bar.Open()
+	if order.FillOnClose {
+		price = bar.Close()
+	}
+	return d.fill(order, price, bar)
+}
+
+// FillLimitOrder implements FillStrategy
+func (d *defaultFillStrategy) FillLimitOrder(order *BasicOrder, bar Bar) *FillInfo {
+	if price, ok := limitOrderPrice(order.Action, order.LimitPrice, bar); ok {
+		return d.fill(order, price, bar)
+	}
+	return nil
+}
+
+// FillStopOrder implements FillStrategy
+func (d *defaultFillStrategy) FillStopOrder(order *BasicOrder, bar Bar) *FillInfo {
+	price, ok := stopOrderPrice(order.Action, order.StopPrice, bar)
+	if !order.StopHit {
+		order.StopHit = ok
+	}
+	if !order.StopHit {
+		return nil
+	}
+	if !ok {
+		// the stop was hit on a previous bar but we could not fill it then
+		price = bar.Open()
+	}
+	return d.fill(order, price, bar)
+}
+
+// FillStopLimitOrder implements FillStrategy
+func (d *defaultFillStrategy) FillStopLimitOrder(order *BasicOrder, bar Bar) *FillInfo {
+	stopHitNow := false
+	if !order.StopHit {
+		var stopPrice float64
+		if stopPrice, order.StopHit = stopOrderPrice(order.Action, order.StopPrice, bar); !order.StopHit {
+			return nil
+		}
+		stopHitNow = true
+		// if the stop price is hit inside the bar, the limit price cannot be
+		// filled with a better price than the stop price.
+		if stopPrice != bar.Open() {
+			if order.Action.IsBuy() && order.LimitPrice >= stopPrice {
+				return d.fill(order, stopPrice, bar)
+			} else if !order.Action.IsBuy() && order.LimitPrice <= stopPrice {
+				return d.fill(order, stopPrice, bar)
+			}
+		}
+	}
+	price, ok := limitOrderPrice(order.Action, order.LimitPrice, bar)
+	if !ok {
+		return nil
+	}
+	if stopHitNow {
+		// the limit price is only reachable after the stop was triggered
+		if order.Action.IsBuy() {
+			price = math.Max(price, math.Min(order.StopPrice, order.LimitPrice))
+		} else {
+			price = math.Min(price, math.Max(order.StopPrice, order.LimitPrice))
+		}
+	}
+	return d.fill(order, price, bar)
+}
+
+func limitOrderPrice(action OrderAction, limitPrice float64, bar Bar) (float64, bool) {
+	if action.IsBuy() {
+		if bar.Open() <= limitPrice {
+			return bar.Open(), true
+		} else if bar.Low() <= limitPrice {
+			return limitPrice, true
+		}
+	} else {
+		if bar.Open() >= limitPrice {
+			return bar.Open(), true
+		} else if bar.High() >= limitPrice {
+			return limitPrice, true
+		}
+	}
+	return 0, false
+}
+
+func stopOrderPrice(action OrderAction, stopPrice float64, bar Bar) (float64, bool) {
+	if action.IsBuy() {
+		if bar.Open() >= stopPrice {
+			return bar.Open(), true
+		} else if bar.High() >= stopPrice {
+			return stopPrice, true
+		}
+	} else {
+		if bar.Open() <= stopPrice {
+			return bar.Open(), true
+		} else if bar.Low() <= stopPrice {
+			return stopPrice, true
+		}
+	}
+	return 0, false
+}
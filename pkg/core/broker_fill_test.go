@@ -0,0 +1,121 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+)
+
+func TestSlippageModels(t *testing.T) {
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	bar := NewBasicBar(tm, 100, 110, 90, 105, 105, 1000, DAY)
+	buy := NewMarketOrder(OrderActionBuy, "GLD", 100, false)
+	sell := NewMarketOrder(OrderActionSell, "GLD", 100, false)
+
+	if v := NewNoSlippage().AdjustPrice(buy, 100, 100, bar); v != 100 {
+		t.Error("no slippage should keep the price", v)
+	}
+
+	bps := NewFixedBpsSlippage(10)
+	if v := bps.AdjustPrice(buy, 100, 100, bar); !almostEqual(v, 100.1) {
+		t.Error("buy should pay 10 bps more", v)
+	}
+	if v := bps.AdjustPrice(sell, 100, 100, bar); !almostEqual(v, 99.9) {
+		t.Error("sell should receive 10 bps less", v)
+	}
+
+	volumeShare := NewVolumeShareSlippage(0.1)
+	if v := volumeShare.AdjustPrice(buy, 100, 100, bar); !almostEqual(v, 100.1) {
+		t.Error("unexpected volume share slippage", v)
+	}
+	noVolume := NewBasicBar(tm, 100, 110, 90, 105, 105, 0, DAY)
+	if v := volumeShare.AdjustPrice(buy, 100, 100, noVolume); v != 100 {
+		t.Error("bars without volume should not slip", v)
+	}
+
+	spread := NewHalfSpreadSlippage(0.5)
+	if v := spread.AdjustPrice(buy, 100, 100, bar); !almostEqual(v, 100.25) {
+		t.Error("buy should pay half of the spread", v)
+	}
+	if v := spread.AdjustPrice(sell, 100, 100, bar); !almostEqual(v, 99.75) {
+		t.Error("sell should receive half of the spread", v)
+	}
+}
+
+func TestFillStrategyLimitPrice(t *testing.T) {
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	bar := NewBasicBar(tm, 100, 110, 90, 105, 105, 1000, DAY)
+	strategy := NewFillStrategy(NewHalfSpreadSlippage(2), 0, nil)
+
+	order := NewLimitOrder(OrderActionBuy, "GLD", 95, 10).(*BasicOrder)
+	fill := strategy.FillLimitOrder(order, bar)
+	if fill == nil || !almostEqual(fill.Price, 95) {
+		t.Fatal("slippage should not exceed the limit price", fill)
+	}
+}
+
+func TestFillStrategyFromConfig(t *testing.T) {
+	cfg := &config.SlippageConfig{
+		Type:        "fixedbps",
+		Amount:      10,
+		VolumeLimit: 0.1,
+		Instruments: map[string]config.SlippageConfig{
+			"xauusd": {Type: "halfspread", Amount: 0.5},
+		},
+	}
+	strategy, err := NewFillStrategyFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	strategy.OnBars(Bars{
+		"GLD":    NewBasicBar(tm, 100, 110, 90, 105, 105, 1000, DAY),
+		"XAUUSD": NewBasicBar(tm, 1800, 1810, 1790, 1805, 1805, 1000, DAY),
+	})
+
+	order := NewMarketOrder(OrderActionBuy, "GLD", 500, false).(*BasicOrder)
+	fill := strategy.FillMarketOrder(order, NewBasicBar(tm, 100, 110, 90, 105, 105, 1000, DAY))
+	if fill == nil || !almostEqual(fill.Quantity, 100) || !almostEqual(fill.Price, 100.1) {
+		t.Fatal("fill should be limited to 10% of the volume", fill)
+	}
+
+	gold := NewMarketOrder(OrderActionBuy, "XAUUSD", 500, false).(*BasicOrder)
+	fill = strategy.FillMarketOrder(gold, NewBasicBar(tm, 1800, 1810, 1790, 1805, 1805, 1000, DAY))
+	if fill == nil || !almostEqual(fill.Quantity, 500) || !almostEqual(fill.Price, 1800.25) {
+		t.Fatal("instrument override should be used", fill)
+	}
+
+	if _, err := NewFillStrategyFromConfig(&config.SlippageConfig{Type: "foo"}); err == nil {
+		t.Error("unknown slippage type should fail")
+	}
+}
+
+func TestBacktestBrokerPartialFills(t *testing.T) {
+	broker, events := newTestBacktestBroker(100000)
+	broker.fillStrategy = NewFillStrategy(NewNoSlippage(), 0.25, nil)
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	order := NewMarketOrder(OrderActionBuy, "GLD", 600, false)
+	broker.SubmitOrder(order)
+	pushTestBar(broker, tm, 100, 110, 90, 105)
+	if order.GetState() != OrderStatePartiallyFilled || !almostEqual(order.GetFilled(), 250) {
+		t.Fatal("order should be partially filled with 25% of the volume", order)
+	}
+	if (*events)[len(*events)-1].GetEventType() != OrderEventPartiallyFilled {
+		t.Fatal("partial fill event should be emitted", *events)
+	}
+
+	pushTestBar(broker, tm.AddDate(0, 0, 1), 102, 110, 90, 105)
+	pushTestBar(broker, tm.AddDate(0, 0, 2), 104, 110, 90, 105)
+	if !order.IsFilled() || !almostEqual(broker.GetPosition("GLD"), 600) {
+		t.Fatal("order should be filled across 3 bars", order)
+	}
+	if !almostEqual(order.GetAvgFillPrice(), (250*100+250*102+100*104)/600.0) {
+		t.Fatal("unexpected average fill price", order.GetAvgFillPrice())
+	}
+	if (*events)[len(*events)-1].GetEventType() != OrderEventFilled {
+		t.Fatal("fill event should be emitted", *events)
+	}
+}
@@ -0,0 +1,303 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"goat/pkg/config"
+	"goat/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultInitialMargin     = 0.5
+	defaultMaintenanceMargin = 0.25
+	defaultDayCount          = 360
+
+	LiquidateAll     = "all"
+	LiquidateLargest = "largest"
+)
+
+// marginModel holds the margin requirements and the financing rates of a
+// margin account
+type marginModel struct {
+	initial       float64
+	maintenance   float64
+	maxLeverage   float64
+	policy        string
+	financingRate float64
+	borrowRate    float64
+	dayCount      float64
+	instruments   map[string]*marginModel // by lowercase instrument
+}
+
+// newMarginModel returns nil if margin trading is disabled
+func newMarginModel(cfg *config.MarginConfig) (*marginModel, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	m, err := newInstrumentMarginModel(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	m.maxLeverage = cfg.MaxLeverage
+	m.financingRate = cfg.FinancingRate
+	m.policy = strings.ToLower(cfg.LiquidationPolicy)
+	if m.policy == "" {
+		m.policy = LiquidateAll
+	}
+	if m.policy != LiquidateAll && m.policy != LiquidateLargest {
+		return nil, fmt.Errorf("unknown liquidation policy %s", cfg.LiquidationPolicy)
+	}
+	m.dayCount = defaultDayCount
+	if cfg.DayCount > 0 {
+		m.dayCount = float64(cfg.DayCount)
+	}
+	m.instruments = map[string]*marginModel{}
+	for k, v := range cfg.Instruments {
+		v := v
+		im, err := newInstrumentMarginModel(&v, m)
+		if err != nil {
+			return nil, fmt.Errorf("instrument %s: %v", k, err)
+		}
+		// viper lowercases the keys of the config maps
+		m.instruments[strings.ToLower(k)] = im
+	}
+	return m, nil
+}
+
+// newInstrumentMarginModel creates the requirements of cfg, the values
+// which are not set are taken from parent or the defaults
+func newInstrumentMarginModel(cfg *config.MarginConfig, parent *marginModel) (*marginModel, error) {
+	m := &marginModel{
+		initial:     defaultInitialMargin,
+		maintenance: defaultMaintenanceMargin,
+	}
+	if parent != nil {
+		m.initial, m.maintenance, m.borrowRate = parent.initial, parent.maintenance, parent.borrowRate
+	}
+	if cfg.Initial > 0 {
+		m.initial = cfg.Initial
+	}
+	if cfg.Maintenance > 0 {
+		m.maintenance = cfg.Maintenance
+	}
+	if cfg.BorrowRate > 0 {
+		m.borrowRate = cfg.BorrowRate
+	}
+	if m.initial > 1 || m.maintenance > m.initial {
+		return nil, fmt.Errorf("invalid margin requirements initial %f maintenance %f", m.initial, m.maintenance)
+	}
+	return m, nil
+}
+
+func (m *marginModel) forInstrument(instrument string) *marginModel {
+	if im, ok := m.instruments[strings.ToLower(instrument)]; ok {
+		return im
+	}
+	return m
+}
+
+// requirement returns the margin needed by positions valued at prices
+func (m *marginModel) requirement(positions map[string]float64, prices map[string]float64,
+	maintenance bool,
+) float64 {
+	res := 0.0
+	for instrument, quantity := range positions {
+		rate := m.forInstrument(instrument).initial
+		if maintenance {
+			rate = m.forInstrument(instrument).maintenance
+		}
+		res += math.Abs(quantity*prices[instrument]) * rate
+	}
+	return res
+}
+
+func grossValue(positions map[string]float64, prices map[string]float64) float64 {
+	res := 0.0
+	for instrument, quantity := range positions {
+		res += math.Abs(quantity * prices[instrument])
+	}
+	return res
+}
+
+func accountEquity(cash float64, positions map[string]float64, prices map[string]float64) float64 {
+	res := cash
+	for instrument, quantity := range positions {
+		res += quantity * prices[instrument]
+	}
+	return res
+}
+
+// contractPrices returns the last prices multiplied by the contract
+// multipliers and converted to the base currency, so that a position is
+// valued at quantity * price
+func (b *backtestBroker) contractPrices() map[string]float64 {
+	res := make(map[string]float64, len(b.lastPrices)+1)
+	for k, v := range b.lastPrices {
+		res[k] = v * b.valueFactor(k)
+	}
+	return res
+}
+
+// valueFactor converts a price of instrument to the value of one unit in
+// the base currency. positions can not be opened before the fx rate is
+// known, so a missing rate is left out.
+func (b *backtestBroker) valueFactor(instrument string) float64 {
+	res := b.GetInstrument(instrument).GetMultiplier()
+	if rate, ok := b.fxRate(instrument); ok {
+		res *= rate
+	}
+	return res
+}
+
+// checkMarginFill returns why the fill of o can not be done on the margin
+// account, or an empty string. price is in the base currency. fills
+// reducing the position are always accepted.
+func (b *backtestBroker) checkMarginFill(o *BasicOrder, price, quantity, commission float64) string {
+	current := b.positions[o.Instrument]
+	cost := price * quantity * b.GetInstrument(o.Instrument).GetMultiplier()
+	next := current - quantity
+	cash := b.cash + cost - commission
+	if o.Action.IsBuy() {
+		next = current + quantity
+		cash = b.cash - cost - commission
+	}
+	if math.Abs(next) <= math.Abs(current) && next*current >= 0 {
+		return ""
+	}
+
+	positions := make(map[string]float64, len(b.positions)+1)
+	for k, v := range b.positions {
+		positions[k] = v
+	}
+	positions[o.Instrument] = next
+	prices := b.contractPrices()
+	prices[o.Instrument] = price * b.GetInstrument(o.Instrument).GetMultiplier()
+
+	equity := accountEquity(cash, positions, prices)
+	if required := b.margin.requirement(positions, prices, false); equity < required {
+		logger.Logger.Debug("not enough margin to fill order",
+			zap.Uint64("order", o.ID),
+			zap.Float64("equity", equity),
+			zap.Float64("required", required))
+		return "not enough margin"
+	}
+	if b.margin.maxLeverage > 0 && grossValue(positions, prices) > equity*b.margin.maxLeverage {
+		return "leverage limit exceeded"
+	}
+	return ""
+}
+
+// checkMaintenanceMargin liquidates positions according to the liquidation
+// policy if the equity is below the maintenance margin
+func (b *backtestBroker) checkMaintenanceMargin() {
+	prices := b.contractPrices()
+	equity := accountEquity(b.cash, b.positions, prices)
+	required := b.margin.requirement(b.positions, prices, true)
+	if equity >= required || len(b.positions) == 0 {
+		return
+	}
+	logger.Logger.Warn("margin call",
+		zap.Float64("equity", equity),
+		zap.Float64("maintenance", required),
+		zap.String("policy", b.margin.policy))
+
+	instruments := make([]string, 0, len(b.positions))
+	for instrument := range b.positions {
+		instruments = append(instruments, instrument)
+	}
+	// the largest positions are closed first
+	sort.Slice(instruments, func(i, j int) bool {
+		vi := math.Abs(b.positions[instruments[i]] * prices[instruments[i]])
+		vj := math.Abs(b.positions[instruments[j]] * prices[instruments[j]])
+		if vi != vj {
+			return vi > vj
+		}
+		return instruments[i] < instruments[j]
+	})
+	if b.margin.policy == LiquidateAll {
+		for _, o := range b.sortedActiveOrders() {
+			if o.IsActive() {
+				b.cancelOrder(o, "margin call")
+			}
+		}
+	}
+	for _, instrument := range instruments {
+		if b.margin.policy == LiquidateLargest {
+			equity = accountEquity(b.cash, b.positions, prices)
+			if equity >= b.margin.requirement(b.positions, prices, true) {
+				return
+			}
+			for _, o := range b.sortedActiveOrders() {
+				if o.IsActive() && o.Instrument == instrument {
+					b.cancelOrder(o, "margin call")
+				}
+			}
+		}
+		b.liquidate(instrument)
+	}
+}
+
+// liquidate closes the position of instrument at the close of its last bar
+func (b *backtestBroker) liquidate(instrument string) {
+	quantity := b.positions[instrument]
+	bar, ok := b.lastBars[instrument]
+	if !ok || quantity == 0 {
+		return
+	}
+	action := OrderActionSell
+	if quantity < 0 {
+		action = OrderActionBuy
+	}
+	o := NewMarketOrder(action, instrument, math.Abs(quantity), true).(*BasicOrder)
+	b.submitOrder(o)
+	o.State = OrderStateAccepted
+	b.queueEvent(o, OrderEventAccepted, nil)
+	b.tryFillOrder(o, bar)
+}
+
+// accrueFinancing charges the interest of the borrowed cash and the borrow
+// cost of the short positions for the days since the last accrual. it is
+// called with the DAY bars, e.g. the ones generated by NewDayBarGenHook.
+func (b *backtestBroker) accrueFinancing(day time.Time) {
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	days := 1.0
+	if !b.lastFinancingDay.IsZero() {
+		if !day.After(b.lastFinancingDay) {
+			return
+		}
+		days = math.Round(day.Sub(b.lastFinancingDay).Hours() / 24)
+	}
+	b.lastFinancingDay = day
+
+	cost := 0.0
+	if b.cash < 0 {
+		cost += -b.cash * b.margin.financingRate * days / b.margin.dayCount
+	}
+	for instrument, quantity := range b.positions {
+		if quantity < 0 {
+			rate := b.margin.forInstrument(instrument).borrowRate
+			value := -quantity * b.lastPrices[instrument] * b.valueFactor(instrument)
+			cost += value * rate * days / b.margin.dayCount
+		}
+	}
+	if cost == 0 {
+		return
+	}
+	b.cash -= cost
+	b.financingCost += cost
+	logger.Logger.Debug("financing accrued", zap.Time("day", day), zap.Float64("cost", cost))
+}
+
+// GetFinancingCost returns the total interest and borrow cost charged to
+// the margin account
+func (b *backtestBroker) GetFinancingCost() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.financingCost
+}
@@ -0,0 +1,157 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+)
+
+// newTestMarginConfig returns the config of a margin account of 10000
+func newTestMarginConfig(margin config.MarginConfig) *config.Config {
+	cfg := &config.Config{}
+	cfg.Broker.Cash = 10000
+	margin.Enabled = true
+	cfg.Broker.Margin = margin
+	return cfg
+}
+
+func TestMarginBrokerShortSelling(t *testing.T) {
+	cash, _ := newTestBacktestBroker(10000)
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	short := NewMarketOrder(OrderActionSell, "GLD", 10, false)
+	cash.SubmitOrder(short)
+	pushTestBar(cash, tm, 100, 100, 100, 100)
+	if short.GetState() != OrderStateCanceled {
+		t.Fatal("a cash account should not sell short", short)
+	}
+
+	b, _ := newTestBacktestBrokerWithConfig(newTestMarginConfig(config.MarginConfig{}))
+	short = NewMarketOrder(OrderActionSell, "GLD", 50, false)
+	b.SubmitOrder(short)
+	pushTestBar(b, tm, 100, 100, 100, 100)
+	if !short.IsFilled() || b.GetPosition("GLD") != -50 || !almostEqual(b.GetCash(), 15000) {
+		t.Fatal("short sale should be filled", short, b.GetPosition("GLD"), b.GetCash())
+	}
+
+	// the position is reversed to 100 long, which needs 5000 of margin
+	reverse := NewMarketOrder(OrderActionBuy, "GLD", 150, false)
+	b.SubmitOrder(reverse)
+	pushTestBar(b, tm.AddDate(0, 0, 1), 100, 100, 100, 100)
+	if !reverse.IsFilled() || b.GetPosition("GLD") != 100 || !almostEqual(b.GetCash(), 0) {
+		t.Fatal("reversal should be filled", reverse, b.GetPosition("GLD"), b.GetCash())
+	}
+}
+
+func TestMarginBrokerInitialMarginAndLeverage(t *testing.T) {
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	b, _ := newTestBacktestBrokerWithConfig(newTestMarginConfig(config.MarginConfig{
+		Instruments: map[string]config.MarginConfig{"SLV": {Initial: 1}},
+	}))
+	big := NewMarketOrder(OrderActionBuy, "GLD", 201, false)
+	levered := NewMarketOrder(OrderActionBuy, "GLD", 150, false)
+	b.SubmitOrder(big)
+	b.SubmitOrder(levered)
+	pushTestBars(b, tm, map[string]float64{"GLD": 100, "SLV": 10})
+	if big.GetState() != OrderStateCanceled || !levered.IsFilled() || !almostEqual(b.GetCash(), -5000) {
+		t.Fatal("only the order within the initial margin should be filled", big, levered, b.GetCash())
+	}
+	// SLV needs 100% margin and the equity is 10000 with 7500 already used
+	slv := NewMarketOrder(OrderActionBuy, "SLV", 300, false)
+	b.SubmitOrder(slv)
+	pushTestBars(b, tm.AddDate(0, 0, 1), map[string]float64{"GLD": 100, "SLV": 10})
+	if slv.GetState() != OrderStateCanceled {
+		t.Fatal("order above the instrument margin should be canceled", slv)
+	}
+
+	b, _ = newTestBacktestBrokerWithConfig(newTestMarginConfig(config.MarginConfig{MaxLeverage: 1.2}))
+	levered = NewMarketOrder(OrderActionBuy, "GLD", 150, false)
+	b.SubmitOrder(levered)
+	pushTestBar(b, tm, 100, 100, 100, 100)
+	if levered.GetState() != OrderStateCanceled {
+		t.Fatal("order above the max leverage should be canceled", levered)
+	}
+}
+
+func TestMarginBrokerMarginCall(t *testing.T) {
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	b, _ := newTestBacktestBrokerWithConfig(newTestMarginConfig(config.MarginConfig{}))
+	b.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 190, false))
+	pushTestBar(b, tm, 100, 100, 100, 100)
+	pending := NewLimitOrder(OrderActionBuy, "GLD", 10, 1)
+	b.SubmitOrder(pending)
+
+	// equity 2400 is below the maintenance margin of 2850
+	pushTestBar(b, tm.AddDate(0, 0, 1), 60, 60, 60, 60)
+	if b.GetPosition("GLD") != 0 || !almostEqual(b.GetCash(), 2400) {
+		t.Fatal("position should be liquidated", b.GetPosition("GLD"), b.GetCash())
+	}
+	if pending.GetState() != OrderStateCanceled {
+		t.Fatal("active orders should be canceled by the margin call", pending)
+	}
+
+	// the largest position is closed first, which restores the margin
+	b, _ = newTestBacktestBrokerWithConfig(newTestMarginConfig(config.MarginConfig{LiquidationPolicy: LiquidateLargest}))
+	b.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 150, false))
+	b.SubmitOrder(NewMarketOrder(OrderActionBuy, "SLV", 400, false))
+	pushTestBars(b, tm, map[string]float64{"GLD": 100, "SLV": 10})
+	pushTestBars(b, tm.AddDate(0, 0, 1), map[string]float64{"GLD": 50, "SLV": 10})
+	if b.GetPosition("GLD") != 0 || b.GetPosition("SLV") != 400 {
+		t.Fatal("only the largest position should be liquidated", b.GetPositions())
+	}
+}
+
+func TestMarginBrokerFinancing(t *testing.T) {
+	b, _ := newTestBacktestBrokerWithConfig(newTestMarginConfig(config.MarginConfig{FinancingRate: 0.036, BorrowRate: 0.072}))
+	friday := time.Date(2022, time.January, 7, 0, 0, 0, 0, time.UTC)
+	b.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 150, false))
+	b.SubmitOrder(NewMarketOrder(OrderActionSell, "SLV", 100, false))
+	pushTestBars(b, friday, map[string]float64{"GLD": 100, "SLV": 10})
+	cash := b.GetCash()
+	if !almostEqual(cash, -4000) {
+		t.Fatal("unexpected cash", cash)
+	}
+
+	// three days of interest on 4000 and borrow cost on 1000
+	pushTestBars(b, friday.AddDate(0, 0, 3), map[string]float64{"GLD": 100, "SLV": 10})
+	expected := 4000*0.036*3/360 + 1000*0.072*3/360
+	if !almostEqual(b.GetFinancingCost(), expected) || !almostEqual(b.GetCash(), cash-expected) {
+		t.Fatal("unexpected financing", b.GetFinancingCost(), b.GetCash())
+	}
+
+	// intraday bars do not accrue financing
+	b.onBars(friday.AddDate(0, 0, 3).Add(time.Hour), map[string]interface{}{
+		"GLD": NewBasicBar(friday, 100, 100, 100, 100, 100, 1000, MINUTE),
+	})
+	if !almostEqual(b.GetFinancingCost(), expected) {
+		t.Fatal("financing should accrue once a day", b.GetFinancingCost())
+	}
+}
+
+func TestMarginBrokerInstrumentsFromViper(t *testing.T) {
+	cfg := loadTestConfig(t, `{
+		"broker": {"cash": 10000, "margin": {
+			"enabled": true, "borrowRate": 0.036,
+			"instruments": {"SLV": {"initial": 1, "borrowRate": 0.072}}
+		}}
+	}`)
+	b, _ := newTestBacktestBrokerWithConfig(cfg)
+	if m := b.margin.forInstrument("SLV"); m.initial != 1 || m.borrowRate != 0.072 {
+		t.Fatal("the instrument overrides should be case-insensitive", m)
+	}
+
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	slv := NewMarketOrder(OrderActionBuy, "SLV", 1001, false)
+	b.SubmitOrder(slv)
+	pushTestBars(b, tm, map[string]float64{"SLV": 10})
+	if slv.GetState() != OrderStateCanceled {
+		t.Fatal("order above the instrument margin should be canceled", slv)
+	}
+	short := NewMarketOrder(OrderActionSell, "SLV", 100, false)
+	b.SubmitOrder(short)
+	pushTestBars(b, tm.AddDate(0, 0, 1), map[string]float64{"SLV": 10})
+	pushTestBars(b, tm.AddDate(0, 0, 2), map[string]float64{"SLV": 10})
+	if !short.IsFilled() || !almostEqual(b.GetFinancingCost(), 1000*0.072/360) {
+		t.Fatal("the instrument borrow rate should be used", short, b.GetFinancingCost())
+	}
+}
@@ -0,0 +1,233 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+)
+
+func TestBacktestBrokerOCOOrders(t *testing.T) {
+	broker, events := newTestBacktestBroker(10000)
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	broker.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 10, false))
+	pushTestBar(broker, tm, 100, 105, 95, 100)
+
+	takeProfit := NewLimitOrder(OrderActionSell, "GLD", 110, 10)
+	stopLoss := NewStopOrder(OrderActionSell, "GLD", 90, 10)
+	if err := broker.SubmitOCOOrders(takeProfit, stopLoss); err != nil {
+		t.Fatal(err)
+	}
+	if takeProfit.GetOCOGroup() == 0 || takeProfit.GetOCOGroup() != stopLoss.GetOCOGroup() {
+		t.Fatal("orders should be in the same group", takeProfit, stopLoss)
+	}
+	pushTestBar(broker, tm.AddDate(0, 0, 1), 100, 105, 95, 100)
+	if !takeProfit.IsActive() || !stopLoss.IsActive() {
+		t.Fatal("orders should be active")
+	}
+
+	*events = nil
+	pushTestBar(broker, tm.AddDate(0, 0, 2), 100, 112, 95, 100)
+	if !takeProfit.IsFilled() || !almostEqual(takeProfit.GetAvgFillPrice(), 110) {
+		t.Fatal("take profit should be filled", takeProfit)
+	}
+	if stopLoss.GetState() != OrderStateCanceled {
+		t.Fatal("stop loss should be canceled", stopLoss)
+	}
+	if len(*events) != 2 || (*events)[0].GetEventType() != OrderEventFilled ||
+		(*events)[1].GetEventType() != OrderEventCanceled ||
+		!strings.Contains((*events)[1].GetEventInfo().(string), "oco group is filled") {
+		t.Fatal("unexpected order events", *events)
+	}
+
+	// canceling one order cancels the others
+	a := NewLimitOrder(OrderActionBuy, "GLD", 50, 1)
+	b := NewLimitOrder(OrderActionBuy, "GLD", 60, 1)
+	c := NewStopOrder(OrderActionBuy, "GLD", 200, 1)
+	if err := broker.SubmitOCOOrders(a, b, c); err != nil {
+		t.Fatal(err)
+	}
+	broker.CancelOrder(b)
+	if a.IsActive() || b.IsActive() || c.IsActive() {
+		t.Fatal("all orders should be canceled", a, b, c)
+	}
+
+	if err := broker.SubmitOCOOrders(NewLimitOrder(OrderActionBuy, "GLD", 50, 1)); err == nil {
+		t.Fatal("expected error for a single order")
+	}
+	d := NewLimitOrder(OrderActionBuy, "GLD", 50, 1)
+	if err := broker.SubmitOCOOrders(d, d); err == nil {
+		t.Fatal("expected error for the same order")
+	}
+}
+
+func TestBacktestBrokerBracketOrder(t *testing.T) {
+	broker, events := newTestBacktestBroker(10000)
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	entry := NewMarketOrder(OrderActionBuy, "GLD", 10, false)
+	takeProfit := NewLimitOrder(OrderActionSell, "GLD", 110, 10)
+	stopLoss := NewStopOrder(OrderActionSell, "GLD", 95, 10)
+	if err := broker.SubmitBracketOrder(entry, takeProfit, stopLoss); err != nil {
+		t.Fatal(err)
+	}
+	if stopLoss.GetParentID() != entry.GetID() || takeProfit.GetParentID() != entry.GetID() ||
+		stopLoss.GetOCOGroup() != takeProfit.GetOCOGroup() || stopLoss.GetID() > takeProfit.GetID() {
+		t.Fatal("unexpected bracket legs", stopLoss, takeProfit)
+	}
+	if len(*events) != 0 {
+		t.Fatal("events should be queued", *events)
+	}
+	broker.Dispatch()
+	if len(*events) != 3 {
+		t.Fatal("every leg should be submitted", *events)
+	}
+
+	// the legs are held on the bar the entry order is filled
+	pushTestBar(broker, tm, 100, 112, 90, 100)
+	if !entry.IsFilled() || stopLoss.GetState() != OrderStateSubmitted ||
+		takeProfit.GetState() != OrderStateSubmitted {
+		t.Fatal("only the entry order should be processed", entry, stopLoss, takeProfit)
+	}
+
+	// both legs can be filled, the stop loss goes first
+	*events = nil
+	pushTestBar(broker, tm.AddDate(0, 0, 1), 100, 112, 90, 100)
+	if !stopLoss.IsFilled() || !almostEqual(stopLoss.GetAvgFillPrice(), 95) ||
+		takeProfit.GetState() != OrderStateCanceled {
+		t.Fatal("stop loss should be filled", stopLoss, takeProfit)
+	}
+	if broker.GetPosition("GLD") != 0 {
+		t.Fatal("position should be closed", broker.GetPosition("GLD"))
+	}
+	types := []OrderEventType{
+		OrderEventAccepted, OrderEventFilled, OrderEventCanceled,
+	}
+	if len(*events) != len(types) {
+		t.Fatal("unexpected order events", *events)
+	}
+	for i, eventType := range types {
+		if (*events)[i].GetEventType() != eventType {
+			t.Fatal("unexpected order events", *events)
+		}
+	}
+
+	// canceling an entry order which is not filled cancels its legs
+	entry = NewLimitOrder(OrderActionBuy, "GLD", 50, 10)
+	takeProfit = NewLimitOrder(OrderActionSell, "GLD", 110, 10)
+	if err := broker.SubmitBracketOrder(entry, takeProfit, nil); err != nil {
+		t.Fatal(err)
+	}
+	broker.CancelOrder(entry)
+	if takeProfit.GetState() != OrderStateCanceled {
+		t.Fatal("take profit should be canceled", takeProfit)
+	}
+}
+
+func TestBacktestBrokerBracketPartialFills(t *testing.T) {
+	broker, _ := newTestBacktestBroker(10000)
+	// 0.5% of the 1000 volume of the test bars
+	broker.fillStrategy = NewFillStrategy(NewNoSlippage(), 0.005, nil)
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	entry := NewMarketOrder(OrderActionBuy, "GLD", 10, false)
+	stopLoss := NewTrailingStopOrder(OrderActionSell, "GLD", 50, 10)
+	if err := broker.SubmitBracketOrder(entry, nil, stopLoss); err != nil {
+		t.Fatal(err)
+	}
+	pushTestBar(broker, tm, 100, 105, 95, 100)
+	if entry.GetFilled() != 5 || stopLoss.GetQuantity() != 5 {
+		t.Fatal("stop loss should protect the filled quantity", entry, stopLoss)
+	}
+	broker.CancelOrder(entry)
+	if !stopLoss.IsActive() || stopLoss.GetQuantity() != 5 {
+		t.Fatal("stop loss should stay active", stopLoss)
+	}
+}
+
+func TestBacktestBrokerBracketValidation(t *testing.T) {
+	broker, _ := newTestBacktestBroker(10000)
+	entry := func() Order { return NewMarketOrder(OrderActionBuy, "GLD", 10, false) }
+
+	for name, legs := range map[string][2]Order{
+		"no legs":        {nil, nil},
+		"same side":      {NewLimitOrder(OrderActionBuy, "GLD", 110, 10), nil},
+		"instrument":     {NewLimitOrder(OrderActionSell, "SPY", 110, 10), nil},
+		"quantity":       {NewLimitOrder(OrderActionSell, "GLD", 110, 5), nil},
+		"take profit":    {NewStopOrder(OrderActionSell, "GLD", 110, 10), nil},
+		"stop loss":      {nil, NewLimitOrder(OrderActionSell, "GLD", 90, 10)},
+		"trailing stop":  {nil, NewTrailingStopOrder(OrderActionSell, "GLD", 0, 10)},
+		"atr period":     {nil, NewATRTrailingStopOrder(OrderActionSell, "GLD", 2, 0, 10)},
+		"invalid amount": {nil, NewStopOrder(OrderActionSell, "GLD", 90, -1)},
+	} {
+		if err := broker.SubmitBracketOrder(entry(), legs[0], legs[1]); err == nil {
+			t.Error("expected error for", name)
+		}
+	}
+	if len(broker.orders) != 0 {
+		t.Fatal("invalid brackets should not submit any order", broker.orders)
+	}
+}
+
+func TestBacktestBrokerTrailingStop(t *testing.T) {
+	broker, _ := newTestBacktestBroker(10000)
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	broker.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 10, false))
+	stop := NewTrailingStopOrder(OrderActionSell, "GLD", 5, 10)
+	broker.SubmitOrder(stop)
+
+	// the stop starts from the open price and follows the high
+	pushTestBar(broker, tm, 100, 110, 96, 108)
+	if stop.GetFilled() != 0 || !almostEqual(stop.GetStopPrice(), 105) {
+		t.Fatal("unexpected stop price", stop)
+	}
+	// the stop price does not move down
+	pushTestBar(broker, tm.AddDate(0, 0, 1), 108, 109, 106, 107)
+	if !almostEqual(stop.GetStopPrice(), 105) {
+		t.Fatal("unexpected stop price", stop)
+	}
+	pushTestBar(broker, tm.AddDate(0, 0, 2), 107, 108, 101, 102)
+	if !stop.IsFilled() || !almostEqual(stop.GetAvgFillPrice(), 105) {
+		t.Fatal("stop should be filled", stop)
+	}
+}
+
+func TestBacktestBrokerATRTrailingStop(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Broker.Cash = 10000
+	gen := NewBarFeedGenerator([]Frequency{DAY}, 100)
+	feed := NewGenericDataFeed(context.TODO(), cfg, gen, nil, 100, "")
+	broker, err := NewBacktestBroker(cfg, feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	dispatch := func(days int, open, high, low, close float64) {
+		t := tm.AddDate(0, 0, days)
+		gen.AppendNewValueToBuffer(t, map[string]interface{}{
+			"GLD": NewBasicBar(t, open, high, low, close, close, 1000, DAY),
+		}, DAY)
+		feed.Dispatch()
+	}
+
+	dispatch(0, 100, 102, 98, 100)
+	broker.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 10, false))
+	stop := NewATRTrailingStopOrder(OrderActionSell, "GLD", 1, 2, 10)
+	broker.SubmitOrder(stop)
+
+	dispatch(1, 100, 104, 99, 103)
+	dispatch(2, 103, 106, 101, 105)
+	dispatch(3, 105, 108, 104, 107)
+	// true ranges of the last 2 bars are 4 and 5
+	if !almostEqual(stop.GetStopPrice(), 103.5) || stop.GetFilled() != 0 {
+		t.Fatal("unexpected stop price", stop)
+	}
+	dispatch(4, 106, 107, 102, 103)
+	if !stop.IsFilled() || !almostEqual(stop.GetAvgFillPrice(), 103.5) {
+		t.Fatal("stop should be filled", stop)
+	}
+}
@@ -0,0 +1,441 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"goat/pkg/config"
+	"goat/pkg/db"
+	"goat/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// paperBroker simulates the executions of the live feed like the backtest
+// broker and persists its orders, fills, positions and cash to the bar dump
+// database after every change, so that the book survives restarts.
+type paperBroker struct {
+	*backtestBroker
+
+	saveMu   sync.Mutex
+	dbPath   string
+	db       *db.DB
+	replaced bool // the previous book of db has been replaced
+
+	// bars at or before restoredTime were processed before the restart. they
+	// are replayed from the recovery database and must not fill orders again.
+	restoredTime    time.Time
+	replayFrequency Frequency // finest frequency of the bars since the restart
+	replaying       bool
+	lastBarTime     time.Time
+
+	fills       []historicalFill
+	newFills    []db.PaperFill
+	savedActive map[uint64]bool
+	savedNextID uint64
+}
+
+// historicalFill is a fill restored from the database
+type historicalFill struct {
+	OrderID    uint64
+	Instrument string
+	Action     OrderAction
+	Info       OrderExecutionInfo
+}
+
+// fillHistory is implemented by brokers which restore their fills, the
+// portfolio replays them to start with the restored positions and marks
+// them with the restored prices
+type fillHistory interface {
+	getHistoricalFills() []historicalFill
+	getHistoricalPrices() map[string]float64
+}
+
+// NewPaperBroker creates a paper trading broker for live strategies. The
+// book is saved to the bar dump database of cfg. If recoveryDB is not empty
+// and it has a book, the book is restored from it and bars replayed from
+// the recovery database are not used to fill orders again.
+func NewPaperBroker(cfg *config.Config, feed DataFeed, recoveryDB string) (Broker, error) {
+	if cfg.Dump.BarDumpDB == "" {
+		return nil, fmt.Errorf("paper broker needs a bar dump db to save its book")
+	}
+	backtestBroker, err := newBacktestBroker(cfg, feed)
+	if err != nil {
+		return nil, err
+	}
+	broker := &paperBroker{
+		backtestBroker:  backtestBroker,
+		dbPath:          cfg.Dump.BarDumpDB,
+		replayFrequency: UNKNOWN,
+		savedActive:     map[uint64]bool{},
+		savedNextID:     1,
+	}
+	broker.onFill = broker.recordFill
+
+	if recoveryDB != "" {
+		recDB, err := db.NewSQLiteDataBase(recoveryDB, false)
+		if err != nil {
+			return nil, err
+		}
+		book, err := recDB.LoadPaperBook()
+		if sqlDB, e := recDB.DB.DB(); e == nil {
+			sqlDB.Close()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load paper book: %v", err)
+		}
+		if book != nil {
+			if err := broker.restore(book); err != nil {
+				return nil, err
+			}
+			logger.Logger.Info("paper book is restored",
+				zap.String("db", recoveryDB),
+				zap.Float64("cash", broker.cash),
+				zap.Int("orders", len(broker.orders)),
+				zap.Int("fills", len(broker.fills)),
+				zap.Time("lastBarTime", broker.lastBarTime))
+		}
+	}
+
+	feed.GetNewValueEvent().Subscribe(broker.onBars)
+	return broker, nil
+}
+
+func (p *paperBroker) restore(book *db.PaperBook) error {
+	p.cash = book.Account.Cash
+	p.nextOrderID = book.Account.NextOrderID
+	if p.nextOrderID == 0 {
+		p.nextOrderID = 1
+	}
+	if book.Account.LastBarTime != 0 {
+		p.restoredTime = time.Unix(0, book.Account.LastBarTime).UTC()
+		p.lastBarTime = p.restoredTime
+		p.replaying = true
+	}
+	if book.Account.LastFinancingDay != 0 {
+		p.lastFinancingDay = time.Unix(0, book.Account.LastFinancingDay).UTC()
+	}
+	p.financingCost = book.Account.FinancingCost
+	for _, pos := range book.Positions {
+		p.positions[pos.Instrument] = pos.Quantity
+	}
+	for _, price := range book.Prices {
+		p.lastPrices[price.Instrument] = price.Price
+		if p.fx != nil {
+			p.fx.update(price.Instrument, price.Price)
+		}
+	}
+	for _, order := range book.Orders {
+		o := &BasicOrder{}
+		if err := json.Unmarshal([]byte(order.Data), o); err != nil {
+			return fmt.Errorf("invalid paper order %d: %v", order.ID, err)
+		}
+		p.orders[o.ID] = o
+		if o.IsActive() {
+			p.activeOrders[o.ID] = o
+		}
+	}
+	for _, fill := range book.Fills {
+		o, ok := p.orders[fill.OrderID]
+		if !ok {
+			return fmt.Errorf("paper fill %d has no order %d", fill.ID, fill.OrderID)
+		}
+		p.fills = append(p.fills, historicalFill{
+			OrderID:    fill.OrderID,
+			Instrument: fill.Instrument,
+			Action:     o.Action,
+			Info: OrderExecutionInfo{
+				Price:      fill.Price,
+				Quantity:   fill.Quantity,
+				Commission: fill.Commission,
+				DateTime:   time.Unix(0, fill.DateTime).UTC(),
+				FXRate:     fill.FXRate,
+			},
+		})
+	}
+	p.savedNextID = p.nextOrderID
+	for id := range p.activeOrders {
+		p.savedActive[id] = true
+	}
+	return nil
+}
+
+func (p *paperBroker) getHistoricalFills() []historicalFill {
+	return p.fills
+}
+
+func (p *paperBroker) getHistoricalPrices() map[string]float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := make(map[string]float64, len(p.lastPrices))
+	for k, v := range p.lastPrices {
+		res[k] = v
+	}
+	return res
+}
+
+// recordFill is called by the backtest broker with the lock held
+func (p *paperBroker) recordFill(o *BasicOrder, info *OrderExecutionInfo) {
+	p.newFills = append(p.newFills, db.PaperFill{
+		OrderID:    o.ID,
+		Instrument: o.Instrument,
+		Action:     o.Action.String(),
+		Price:      info.Price,
+		Quantity:   info.Quantity,
+		Commission: info.Commission,
+		DateTime:   info.DateTime.UnixNano(),
+		FXRate:     info.FXRate,
+	})
+}
+
+// Stop implements Broker
+func (p *paperBroker) Stop() error {
+	p.saveMu.Lock()
+	defer p.saveMu.Unlock()
+	if p.db != nil {
+		if sqlDB, err := p.db.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+		p.db = nil
+	}
+	return nil
+}
+
+func (p *paperBroker) checkReplaying() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.replaying {
+		return fmt.Errorf("paper broker is replaying bars processed before the restart")
+	}
+	return nil
+}
+
+// SubmitOrder implements Broker
+func (p *paperBroker) SubmitOrder(order Order) error {
+	if err := p.checkReplaying(); err != nil {
+		return err
+	}
+	if err := p.backtestBroker.SubmitOrder(order); err != nil {
+		return err
+	}
+	p.save()
+	return nil
+}
+
+// SubmitBracketOrder implements Broker
+func (p *paperBroker) SubmitBracketOrder(entry Order, takeProfit Order, stopLoss Order) error {
+	if err := p.checkReplaying(); err != nil {
+		return err
+	}
+	if err := p.backtestBroker.SubmitBracketOrder(entry, takeProfit, stopLoss); err != nil {
+		return err
+	}
+	p.save()
+	return nil
+}
+
+// SubmitOCOOrders implements Broker
+func (p *paperBroker) SubmitOCOOrders(orders ...Order) error {
+	if err := p.checkReplaying(); err != nil {
+		return err
+	}
+	if err := p.backtestBroker.SubmitOCOOrders(orders...); err != nil {
+		return err
+	}
+	p.save()
+	return nil
+}
+
+// CancelOrder implements Broker
+func (p *paperBroker) CancelOrder(order Order) error {
+	if err := p.checkReplaying(); err != nil {
+		return err
+	}
+	if err := p.backtestBroker.CancelOrder(order); err != nil {
+		return err
+	}
+	p.save()
+	return nil
+}
+
+// isReplayed returns true if bar was processed before the restart, its
+// fills are already in the book. the bars of the recovery database are
+// replayed, and so are the bars at or before the restored time which have
+// the finest frequency seen since the restart. the coarser bars, e.g. the
+// DAY bar of the current session labelled at midnight, are resampled after
+// the restart.
+func (p *paperBroker) isReplayed(bar Bar, currentTime time.Time) bool {
+	if p.restoredTime.IsZero() || currentTime.After(p.restoredTime) {
+		return false
+	}
+	if r := bar.GetMeta(BarMetaIsRecovery); r != nil && r.(bool) {
+		return true
+	}
+	return bar.Frequency() <= p.replayFrequency
+}
+
+func (p *paperBroker) onBars(args ...interface{}) error {
+	if len(args) != 2 {
+		return fmt.Errorf("onBars args length should be 2")
+	}
+
+	currentTime := args[0].(time.Time)
+	data := args[1].(map[string]interface{})
+	p.mu.Lock()
+	for _, v := range data {
+		if f := v.(Bar).Frequency(); p.replayFrequency == UNKNOWN || f < p.replayFrequency {
+			p.replayFrequency = f
+		}
+	}
+	bars := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		if !p.isReplayed(v.(Bar), currentTime) {
+			bars[k] = v
+		}
+	}
+	if len(bars) == 0 {
+		p.mu.Unlock()
+		return nil
+	}
+	p.replaying = false
+	p.mu.Unlock()
+
+	if err := p.backtestBroker.onBars(currentTime, bars); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	if currentTime.After(p.lastBarTime) {
+		p.lastBarTime = currentTime
+	}
+	p.mu.Unlock()
+	p.save()
+	return nil
+}
+
+// save writes the changes of the book since the last save. errors are only
+// logged since the book in memory is still valid.
+func (p *paperBroker) save() {
+	p.saveMu.Lock()
+	defer p.saveMu.Unlock()
+
+	if p.db == nil {
+		// the database is opened on the first save since the strategy
+		// controller may remove the old bar dump when it is created
+		d, err := db.NewSQLiteDataBase(p.dbPath, false)
+		if err != nil {
+			logger.Logger.Error("failed to open paper broker db", zap.Error(err))
+			return
+		}
+		p.db = d
+	}
+
+	book, newFills, active, nextID := p.changes()
+	if err := p.db.SavePaperBook(book, !p.replaced); err != nil {
+		logger.Logger.Error("failed to save paper book", zap.Error(err))
+		return
+	}
+	p.replaced = true
+	p.savedActive = active
+	p.savedNextID = nextID
+
+	p.mu.Lock()
+	p.newFills = p.newFills[newFills:]
+	p.mu.Unlock()
+}
+
+// changes returns the book with the orders changed since the last save and
+// the number of new fills in it, or the whole book if the previous book of
+// the database is not replaced yet.
+// orders only change while they are active, so the orders active at the
+// last save, the active orders and the new orders are saved.
+func (p *paperBroker) changes() (*db.PaperBook, int, map[uint64]bool, uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	book := &db.PaperBook{
+		Account: db.PaperAccount{
+			Cash:        p.cash,
+			NextOrderID: p.nextOrderID,
+		},
+	}
+	if !p.lastBarTime.IsZero() {
+		book.Account.LastBarTime = p.lastBarTime.UnixNano()
+	}
+	if !p.lastFinancingDay.IsZero() {
+		book.Account.LastFinancingDay = p.lastFinancingDay.UnixNano()
+	}
+	book.Account.FinancingCost = p.financingCost
+	for instrument, quantity := range p.positions {
+		book.Positions = append(book.Positions, db.PaperPosition{
+			Instrument: instrument,
+			Quantity:   quantity,
+		})
+	}
+	for instrument, price := range p.lastPrices {
+		book.Prices = append(book.Prices, db.PaperPrice{
+			Instrument: instrument,
+			Price:      price,
+		})
+	}
+
+	ids := []uint64{}
+	if !p.replaced {
+		for id := range p.orders {
+			ids = append(ids, id)
+		}
+		for _, fill := range p.fills {
+			book.Fills = append(book.Fills, db.PaperFill{
+				OrderID:    fill.OrderID,
+				Instrument: fill.Instrument,
+				Action:     fill.Action.String(),
+				Price:      fill.Info.Price,
+				Quantity:   fill.Info.Quantity,
+				Commission: fill.Info.Commission,
+				DateTime:   fill.Info.DateTime.UnixNano(),
+				FXRate:     fill.Info.FXRate,
+			})
+		}
+	} else {
+		for id := range p.savedActive {
+			ids = append(ids, id)
+		}
+		for id := range p.activeOrders {
+			if !p.savedActive[id] {
+				ids = append(ids, id)
+			}
+		}
+		for id := p.savedNextID; id < p.nextOrderID; id++ {
+			if _, ok := p.orders[id]; ok && !p.savedActive[id] && p.activeOrders[id] == nil {
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		o, ok := p.orders[id]
+		if !ok {
+			continue
+		}
+		data, err := json.Marshal(o)
+		if err != nil {
+			logger.Logger.Error("failed to encode paper order", zap.Uint64("id", id), zap.Error(err))
+			continue
+		}
+		book.Orders = append(book.Orders, db.PaperOrder{
+			ID:         o.ID,
+			Instrument: o.Instrument,
+			State:      o.State.String(),
+			Data:       string(data),
+		})
+	}
+	book.Fills = append(book.Fills, p.newFills...)
+
+	active := make(map[uint64]bool, len(p.activeOrders))
+	for id := range p.activeOrders {
+		active[id] = true
+	}
+	return book, len(p.newFills), active, p.nextOrderID
+}
@@ -0,0 +1,208 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+)
+
+func newTestPaperBroker(t *testing.T, dumpDB, recoveryDB string) (*paperBroker, DataFeed) {
+	return newTestPaperBrokerWithConfig(t, &config.Config{}, dumpDB, recoveryDB)
+}
+
+func newTestPaperBrokerWithConfig(t *testing.T, cfg *config.Config, dumpDB, recoveryDB string) (*paperBroker, DataFeed) {
+	cfg.Broker.Cash = 10000
+	cfg.Dump.BarDumpDB = dumpDB
+	feed := newTestFeed(cfg)
+	broker, err := NewPaperBroker(cfg, feed, recoveryDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return broker.(*paperBroker), feed
+}
+
+func TestPaperBrokerRecovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goat-paper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	firstDB := filepath.Join(dir, "first.db")
+	secondDB := filepath.Join(dir, "second.db")
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	if _, err := NewPaperBroker(&config.Config{}, nil, ""); err == nil {
+		t.Fatal("expected error without a bar dump db")
+	}
+
+	broker, _ := newTestPaperBroker(t, firstDB, "")
+	broker.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 10, false))
+	pushTestBar(broker, tm, 100, 105, 95, 100)
+	limit := NewLimitOrder(OrderActionSell, "GLD", 120, 4)
+	broker.SubmitOrder(limit)
+	pushTestBar(broker, tm.AddDate(0, 0, 1), 100, 110, 95, 100)
+	cash := broker.GetCash()
+	broker.Stop()
+
+	// restart from the first db and dump to a new one
+	broker, feed := newTestPaperBroker(t, secondDB, firstDB)
+	portfolio := NewPortfolio(broker, feed, 0)
+	if !almostEqual(broker.GetCash(), cash) || !almostEqual(broker.GetPosition("GLD"), 10) {
+		t.Fatal("book should be restored", broker.GetCash(), broker.GetPositions())
+	}
+	active := broker.GetActiveOrders("")
+	if len(active) != 1 || active[0].GetID() != limit.GetID() || active[0].GetLimitPrice() != 120 {
+		t.Fatal("active orders should be restored", active)
+	}
+	if pos := portfolio.GetPosition("GLD"); pos == nil || !almostEqual(pos.Quantity, 10) ||
+		!almostEqual(pos.AvgCost, 100) {
+		t.Fatal("portfolio should be restored", pos)
+	}
+
+	// replayed bars do not fill the orders again, and no order is accepted
+	// until the replay is finished
+	if err := broker.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 1, false)); err == nil {
+		t.Fatal("expected error while replaying")
+	}
+	pushTestBar(broker, tm, 100, 125, 95, 100)
+	pushTestBar(broker, tm.AddDate(0, 0, 1), 100, 125, 95, 100)
+	if !almostEqual(broker.GetCash(), cash) || len(broker.GetActiveOrders("")) != 1 {
+		t.Fatal("replayed bars should be skipped", broker.GetCash())
+	}
+
+	pushTestBar(broker, tm.AddDate(0, 0, 2), 100, 125, 95, 100)
+	if !almostEqual(broker.GetPosition("GLD"), 6) || len(broker.GetActiveOrders("")) != 0 {
+		t.Fatal("limit order should be filled", broker.GetPositions())
+	}
+	order := NewMarketOrder(OrderActionBuy, "GLD", 1, false)
+	if err := broker.SubmitOrder(order); err != nil || order.GetID() != 3 {
+		t.Fatal("order ids should continue", err, order)
+	}
+	cash = broker.GetCash()
+	broker.Stop()
+
+	// the second db has the whole book
+	broker, feed = newTestPaperBroker(t, filepath.Join(dir, "third.db"), secondDB)
+	defer broker.Stop()
+	portfolio = NewPortfolio(broker, feed, 0)
+	if !almostEqual(broker.GetCash(), cash) || !almostEqual(broker.GetPosition("GLD"), 6) {
+		t.Fatal("book should be restored", broker.GetCash(), broker.GetPositions())
+	}
+	if len(broker.orders) != 3 || len(broker.GetActiveOrders("")) != 1 {
+		t.Fatal("orders should be restored", broker.orders)
+	}
+	if pos := portfolio.GetPosition("GLD"); pos == nil || !almostEqual(pos.Quantity, 6) ||
+		!almostEqual(pos.RealizedPnL, 4*20-pos.Commission) {
+		t.Fatal("portfolio should be restored", pos)
+	}
+}
+
+func TestPaperBrokerRecoveryFXRate(t *testing.T) {
+	dir := t.TempDir()
+	newBroker := func(dumpDB, recoveryDB string) (*paperBroker, DataFeed) {
+		return newTestPaperBrokerWithConfig(t, &config.Config{
+			BaseCurrency: "USD",
+			Instruments:  map[string]config.InstrumentConfig{"XAUEUR": {Currency: "EUR"}},
+		}, dumpDB, recoveryDB)
+	}
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	broker, feed := newBroker(filepath.Join(dir, "first.db"), "")
+	broker.SubmitOrder(NewMarketOrder(OrderActionBuy, "XAUEUR", 10, false))
+	pushTestBars(feed, tm, map[string]float64{"EURUSD": 1.1, "XAUEUR": 100})
+	if !almostEqual(broker.GetCash(), 8900) {
+		t.Fatal("the cost should be converted to the base currency", broker.GetCash())
+	}
+	broker.Stop()
+
+	broker, feed = newBroker(filepath.Join(dir, "second.db"), filepath.Join(dir, "first.db"))
+	defer broker.Stop()
+	if len(broker.fills) != 1 || !almostEqual(broker.fills[0].Info.FXRate, 1.1) {
+		t.Fatal("the fx rate of the fill should be restored", broker.fills)
+	}
+	portfolio := NewPortfolio(broker, feed, 0)
+	if pos := portfolio.GetPosition("XAUEUR"); pos == nil || !almostEqual(pos.Quantity, 10) {
+		t.Fatal("portfolio should be restored", pos)
+	}
+	pushTestBars(feed, tm.AddDate(0, 0, 1), map[string]float64{"EURUSD": 1.2, "XAUEUR": 100})
+	if !almostEqual(portfolio.GetUnrealizedPnL(), 100) || !almostEqual(portfolio.GetEquity(), 10100) {
+		t.Fatal("the cost of the restored position should use the fx rate of the fill",
+			portfolio.GetUnrealizedPnL(), portfolio.GetEquity())
+	}
+}
+
+func TestPaperBrokerRecoveryMarginState(t *testing.T) {
+	dir := t.TempDir()
+	newBroker := func(dumpDB, recoveryDB string) (*paperBroker, DataFeed) {
+		cfg := &config.Config{}
+		cfg.Broker.Margin = config.MarginConfig{Enabled: true, FinancingRate: 0.036}
+		return newTestPaperBrokerWithConfig(t, cfg, dumpDB, recoveryDB)
+	}
+	friday := time.Date(2022, time.January, 7, 0, 0, 0, 0, time.UTC)
+
+	broker, _ := newBroker(filepath.Join(dir, "first.db"), "")
+	broker.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 150, false))
+	pushTestBar(broker, friday.AddDate(0, 0, -1), 100, 100, 100, 100)
+	pushTestBar(broker, friday, 110, 110, 110, 110)
+	// one day of interest on 5000
+	cost := 5000 * 0.036 / 360
+	if !almostEqual(broker.GetCash(), -5000-cost) || !almostEqual(broker.GetFinancingCost(), cost) {
+		t.Fatal("unexpected financing", broker.GetCash(), broker.GetFinancingCost())
+	}
+	broker.Stop()
+
+	broker, feed := newBroker(filepath.Join(dir, "second.db"), filepath.Join(dir, "first.db"))
+	defer broker.Stop()
+	if !almostEqual(broker.GetFinancingCost(), cost) || !broker.lastFinancingDay.Equal(friday) {
+		t.Fatal("the financing state should be restored", broker.GetFinancingCost(), broker.lastFinancingDay)
+	}
+	portfolio := NewPortfolio(broker, feed, 0)
+	if pos := portfolio.GetPosition("GLD"); pos == nil || !almostEqual(pos.LastPrice, 110) ||
+		!almostEqual(portfolio.GetEquity(), 11500-cost) {
+		t.Fatal("the positions should be marked with the restored prices", pos, portfolio.GetEquity())
+	}
+
+	// the interest of the weekend is charged once
+	cash := broker.GetCash()
+	pushTestBar(broker, friday.AddDate(0, 0, 3), 110, 110, 110, 110)
+	expected := -cash * 0.036 * 3 / 360
+	if !almostEqual(broker.GetCash(), cash-expected) || !almostEqual(broker.GetFinancingCost(), cost+expected) {
+		t.Fatal("unexpected financing after the restart", broker.GetCash(), broker.GetFinancingCost())
+	}
+}
+
+func TestPaperBrokerRecoveryResampledBar(t *testing.T) {
+	dir := t.TempDir()
+	monday := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	newBar := func(tm time.Time, price float64, freq Frequency, recovery bool) Bar {
+		bar := NewBasicBar(tm, price, price, price, price, price, 1000, freq)
+		if recovery {
+			bar.SetMeta(BarMetaIsRecovery, true)
+		}
+		return bar
+	}
+
+	broker, _ := newTestPaperBroker(t, filepath.Join(dir, "first.db"), "")
+	broker.onBars(monday.AddDate(0, 0, -3), map[string]interface{}{"SPY": newBar(monday.AddDate(0, 0, -3), 100, DAY, false)})
+	broker.SubmitOrder(NewLimitOrder(OrderActionBuy, "SPY", 90, 1))
+	broker.onBars(monday.Add(10*time.Hour), map[string]interface{}{"GLD": newBar(monday.Add(10*time.Hour), 100, MINUTE, false)})
+	broker.Stop()
+
+	broker, _ = newTestPaperBroker(t, filepath.Join(dir, "second.db"), filepath.Join(dir, "first.db"))
+	defer broker.Stop()
+	// the bars of the recovery database are skipped whatever their frequency
+	broker.onBars(monday.AddDate(0, 0, -3), map[string]interface{}{"SPY": newBar(monday.AddDate(0, 0, -3), 80, DAY, true)})
+	broker.onBars(monday.Add(10*time.Hour), map[string]interface{}{"GLD": newBar(monday.Add(10*time.Hour), 80, MINUTE, true)})
+	if len(broker.GetActiveOrders("")) != 1 {
+		t.Fatal("replayed bars should be skipped", broker.GetPositions())
+	}
+	// the DAY bar of the current session is labelled before the restored time
+	broker.onBars(monday, map[string]interface{}{"SPY": newBar(monday, 85, DAY, false)})
+	if !almostEqual(broker.GetPosition("SPY"), 1) {
+		t.Fatal("the DAY bar resampled after the restart should fill the order", broker.GetPositions())
+	}
+}
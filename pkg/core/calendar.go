@@ -0,0 +1,471 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"goat/pkg/config"
+)
+
+// maxCalendarDays is the number of days searched for a session before a
+// calendar gives up
+const maxCalendarDays = 366
+
+const calendarDateLayout = "2006-01-02"
+
+// Session is a trading session of a calendar. A session which opens the
+// evening before its trading day, e.g. FX or COMEX, belongs to the day it
+// closes.
+type Session struct {
+	Date  time.Time // trading day, midnight UTC like the DAY bars
+	Open  time.Time
+	Close time.Time
+}
+
+// IsZero returns true if the session is not found
+func (s Session) IsZero() bool {
+	return s.Close.IsZero()
+}
+
+// TradingCalendar tells the trading sessions of an exchange, its holidays
+// and its half days
+type TradingCalendar interface {
+	Name() string
+	Location() *time.Location
+	// IsOpen returns true if t is in a session
+	IsOpen(t time.Time) bool
+	// SessionAt returns the session of t, false if t is outside of the
+	// sessions
+	SessionAt(t time.Time) (Session, bool)
+	// NextSession returns the first session which closes after t, it may be
+	// open at t. The session is zero if there is none.
+	NextSession(t time.Time) Session
+	// PreviousSession returns the last session which closes at or before t.
+	// The session is zero if there is none.
+	PreviousSession(t time.Time) Session
+}
+
+// calendarRules returns the holidays and the early closes (minutes of the
+// day) of a year by date
+type calendarRules func(year int) (map[string]bool, map[string]int)
+
+type tradingCalendar struct {
+	name string
+	loc  *time.Location
+	// minutes of the day, the session opens the day before if it closes at
+	// or before its open
+	open, close int
+	weekdays    [7]bool // trading days of the session closes
+	holidays    map[string]bool
+	earlyCloses map[string]int
+	rules       calendarRules
+
+	mu        sync.Mutex
+	ruleCache map[int]*calendarYear
+}
+
+type calendarYear struct {
+	holidays    map[string]bool
+	earlyCloses map[string]int
+}
+
+// Name implements TradingCalendar
+func (c *tradingCalendar) Name() string {
+	return c.name
+}
+
+// Location implements TradingCalendar
+func (c *tradingCalendar) Location() *time.Location {
+	return c.loc
+}
+
+// IsOpen implements TradingCalendar
+func (c *tradingCalendar) IsOpen(t time.Time) bool {
+	_, ok := c.SessionAt(t)
+	return ok
+}
+
+// SessionAt implements TradingCalendar
+func (c *tradingCalendar) SessionAt(t time.Time) (Session, bool) {
+	s := c.NextSession(t)
+	if s.IsZero() || t.Before(s.Open) {
+		return Session{}, false
+	}
+	return s, true
+}
+
+// NextSession implements TradingCalendar
+func (c *tradingCalendar) NextSession(t time.Time) Session {
+	// the session of a day always closes on that day
+	y, m, d := t.In(c.loc).Date()
+	for i := 0; i < maxCalendarDays; i++ {
+		if s, ok := c.sessionOf(y, m, d+i); ok && s.Close.After(t) {
+			return s
+		}
+	}
+	return Session{}
+}
+
+// PreviousSession implements TradingCalendar
+func (c *tradingCalendar) PreviousSession(t time.Time) Session {
+	y, m, d := t.In(c.loc).Date()
+	for i := 0; i < maxCalendarDays; i++ {
+		if s, ok := c.sessionOf(y, m, d-i); ok && !s.Close.After(t) {
+			return s
+		}
+	}
+	return Session{}
+}
+
+// sessionOf returns the session of a trading day in the time zone of the
+// calendar, false if the exchange is closed on that day
+func (c *tradingCalendar) sessionOf(y int, m time.Month, d int) (Session, bool) {
+	date := time.Date(y, m, d, 0, 0, 0, 0, c.loc)
+	y, m, d = date.Date()
+	key := date.Format(calendarDateLayout)
+	if !c.weekdays[date.Weekday()] || c.holidays[key] {
+		return Session{}, false
+	}
+	closeMinutes := c.close
+	if c.rules != nil {
+		year := c.ruleYear(y)
+		if year.holidays[key] {
+			return Session{}, false
+		}
+		if v, ok := year.earlyCloses[key]; ok {
+			closeMinutes = v
+		}
+	}
+	if v, ok := c.earlyCloses[key]; ok {
+		closeMinutes = v
+	}
+	openDay := d
+	if c.close <= c.open {
+		openDay--
+	}
+	// the minutes are normalized on the dates, so the sessions keep their
+	// local hours across the daylight saving changes
+	return Session{
+		Date:  time.Date(y, m, d, 0, 0, 0, 0, time.UTC),
+		Open:  time.Date(y, m, openDay, 0, c.open, 0, 0, c.loc),
+		Close: time.Date(y, m, d, 0, closeMinutes, 0, 0, c.loc),
+	}, true
+}
+
+func (c *tradingCalendar) ruleYear(y int) *calendarYear {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if year, ok := c.ruleCache[y]; ok {
+		return year
+	}
+	holidays, earlyCloses := c.rules(y)
+	year := &calendarYear{holidays: holidays, earlyCloses: earlyCloses}
+	if c.ruleCache == nil {
+		c.ruleCache = map[int]*calendarYear{}
+	}
+	c.ruleCache[y] = year
+	return year
+}
+
+// builtinCalendars creates the calendars of GetTradingCalendar by name
+var builtinCalendars = map[string]func() *tradingCalendar{
+	"24/7": func() *tradingCalendar {
+		return newTradingCalendar("24/7", time.UTC, 0, 24*60, everyDay)
+	},
+	"crypto": func() *tradingCalendar {
+		return newTradingCalendar("crypto", time.UTC, 0, 24*60, everyDay)
+	},
+	"nyse": func() *tradingCalendar {
+		c := newTradingCalendar("nyse", mustLoadLocation("America/New_York"), 9*60+30, 16*60, weekDays)
+		c.rules = nyseRules
+		return c
+	},
+	// COMEX metals trade on Globex from 17:00 to 16:00 Chicago time
+	"comex": func() *tradingCalendar {
+		c := newTradingCalendar("comex", mustLoadLocation("America/Chicago"), 17*60, 16*60, weekDays)
+		c.rules = cmeRules
+		return c
+	},
+	// FX rolls over at 17:00 New York time
+	"fx": func() *tradingCalendar {
+		c := newTradingCalendar("fx", mustLoadLocation("America/New_York"), 17*60, 17*60, weekDays)
+		c.rules = fxRules
+		return c
+	},
+}
+
+var (
+	everyDay = []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday,
+		time.Thursday, time.Friday, time.Saturday}
+	weekDays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+)
+
+func newTradingCalendar(name string, loc *time.Location, open, close int,
+	weekdays []time.Weekday,
+) *tradingCalendar {
+	c := &tradingCalendar{
+		name:        name,
+		loc:         loc,
+		open:        open,
+		close:       close,
+		holidays:    map[string]bool{},
+		earlyCloses: map[string]int{},
+	}
+	for _, wd := range weekdays {
+		c.weekdays[wd] = true
+	}
+	return c
+}
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// GetTradingCalendar returns a built-in calendar, name is one of "24/7"
+// (days from midnight UTC), "crypto", "nyse", "comex" or "fx"
+func GetTradingCalendar(name string) (TradingCalendar, error) {
+	if fn, ok := builtinCalendars[strings.ToLower(name)]; ok {
+		return fn(), nil
+	}
+	return nil, fmt.Errorf("unknown trading calendar %s", name)
+}
+
+// NewTradingCalendarFromConfig returns the calendar of cfg.Calendar, the
+// 24/7 calendar if it is not set
+func NewTradingCalendarFromConfig(cfg *config.Config) (TradingCalendar, error) {
+	cc := cfg.Calendar
+	name := cc.Name
+	if name == "" {
+		name = "24/7"
+	}
+	fn, ok := builtinCalendars[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown trading calendar %s", name)
+	}
+	c := fn()
+	if cc.Timezone != "" {
+		loc, err := time.LoadLocation(cc.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		c.loc = loc
+	}
+	if cc.Hours != "" {
+		open, close, err := parseTradingHours(cc.Hours)
+		if err != nil {
+			return nil, err
+		}
+		c.open, c.close = open, close
+	}
+	if len(cc.Weekdays) != 0 {
+		c.weekdays = [7]bool{}
+		for _, wd := range cc.Weekdays {
+			if wd < 0 || wd > 6 {
+				return nil, fmt.Errorf("invalid calendar weekday %d, expected 0 (sunday) to 6", wd)
+			}
+			c.weekdays[wd] = true
+		}
+	}
+	for _, date := range cc.Holidays {
+		t, err := time.Parse(calendarDateLayout, date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid calendar holiday %s: %v", date, err)
+		}
+		c.holidays[t.Format(calendarDateLayout)] = true
+	}
+	for date, hour := range cc.HalfDays {
+		t, err := time.Parse(calendarDateLayout, date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid calendar half day %s: %v", date, err)
+		}
+		minutes, err := parseTimeOfDay(hour)
+		if err != nil {
+			return nil, fmt.Errorf("invalid close %s of half day %s", hour, date)
+		}
+		c.earlyCloses[t.Format(calendarDateLayout)] = minutes
+	}
+	return c, nil
+}
+
+// parseTradingHours parses HH:MM-HH:MM into minutes of the day
+func parseTradingHours(hours string) (int, int, error) {
+	var h1, m1, h2, m2 int
+	if n, err := fmt.Sscanf(hours, "%d:%d-%d:%d", &h1, &m1, &h2, &m2); err != nil || n != 4 ||
+		h1 < 0 || h2 < 0 || m1 < 0 || m2 < 0 || h1 > 24 || h2 > 24 || m1 > 59 || m2 > 59 {
+		return 0, 0, fmt.Errorf("invalid trading hours %s, expected HH:MM-HH:MM", hours)
+	}
+	return h1*60 + m1, h2*60 + m2, nil
+}
+
+// parseTimeOfDay parses HH:MM into minutes of the day
+func parseTimeOfDay(s string) (int, error) {
+	var h, m int
+	if n, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || n != 2 ||
+		h < 0 || m < 0 || h > 24 || m > 59 {
+		return 0, fmt.Errorf("invalid time %s, expected HH:MM", s)
+	}
+	return h*60 + m, nil
+}
+
+// nyseRules are the holidays of the NYSE, the early closes are at 13:00
+func nyseRules(year int) (map[string]bool, map[string]int) {
+	holidays := map[string]bool{}
+	// new year's day is not observed on the friday before
+	if newYear := civilDate(year, time.January, 1); newYear.Weekday() != time.Saturday {
+		holidays[observedDate(newYear)] = true
+	}
+	holidays[dateKey(nthWeekday(year, time.January, time.Monday, 3))] = true
+	holidays[dateKey(nthWeekday(year, time.February, time.Monday, 3))] = true
+	holidays[dateKey(easterSunday(year).AddDate(0, 0, -2))] = true
+	holidays[dateKey(lastWeekday(year, time.May, time.Monday))] = true
+	if year >= 2022 {
+		holidays[observedDate(civilDate(year, time.June, 19))] = true
+	}
+	holidays[observedDate(civilDate(year, time.July, 4))] = true
+	holidays[dateKey(nthWeekday(year, time.September, time.Monday, 1))] = true
+	thanksgiving := nthWeekday(year, time.November, time.Thursday, 4)
+	holidays[dateKey(thanksgiving)] = true
+	holidays[observedDate(civilDate(year, time.December, 25))] = true
+
+	earlyCloses := map[string]int{}
+	earlyCloses[dateKey(thanksgiving.AddDate(0, 0, 1))] = 13 * 60
+	for _, d := range []time.Time{civilDate(year, time.July, 3), civilDate(year, time.December, 24)} {
+		if wd := d.Weekday(); wd >= time.Monday && wd <= time.Thursday {
+			earlyCloses[dateKey(d)] = 13 * 60
+		}
+	}
+	return holidays, earlyCloses
+}
+
+// cmeRules are the holidays of the CME metals, the other US holidays halt
+// the trading at 12:00 Chicago time
+func cmeRules(year int) (map[string]bool, map[string]int) {
+	holidays := map[string]bool{
+		observedDate(civilDate(year, time.January, 1)):   true,
+		dateKey(easterSunday(year).AddDate(0, 0, -2)):    true,
+		observedDate(civilDate(year, time.December, 25)): true,
+	}
+	earlyCloses := map[string]int{}
+	for _, d := range []time.Time{
+		nthWeekday(year, time.January, time.Monday, 3),
+		nthWeekday(year, time.February, time.Monday, 3),
+		lastWeekday(year, time.May, time.Monday),
+		civilDate(year, time.June, 19),
+		civilDate(year, time.July, 4),
+		nthWeekday(year, time.September, time.Monday, 1),
+		nthWeekday(year, time.November, time.Thursday, 4),
+	} {
+		if d.Month() == time.June && year < 2022 {
+			continue
+		}
+		earlyCloses[observedDate(d)] = 12 * 60
+	}
+	return holidays, earlyCloses
+}
+
+// fxRules are the days without FX session, new year's day and christmas
+func fxRules(year int) (map[string]bool, map[string]int) {
+	return map[string]bool{
+		dateKey(civilDate(year, time.January, 1)):   true,
+		dateKey(civilDate(year, time.December, 25)): true,
+	}, nil
+}
+
+func civilDate(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func dateKey(t time.Time) string {
+	return t.Format(calendarDateLayout)
+}
+
+// observedDate moves a holiday on saturday to friday and a holiday on
+// sunday to monday
+func observedDate(t time.Time) string {
+	switch t.Weekday() {
+	case time.Saturday:
+		t = t.AddDate(0, 0, -1)
+	case time.Sunday:
+		t = t.AddDate(0, 0, 1)
+	}
+	return dateKey(t)
+}
+
+// nthWeekday returns the nth weekday of a month, e.g. the third monday
+func nthWeekday(year int, month time.Month, wd time.Weekday, n int) time.Time {
+	t := civilDate(year, month, 1)
+	offset := (int(wd) - int(t.Weekday()) + 7) % 7
+	return t.AddDate(0, 0, offset+7*(n-1))
+}
+
+// lastWeekday returns the last weekday of a month, e.g. the last monday
+func lastWeekday(year int, month time.Month, wd time.Weekday) time.Time {
+	t := civilDate(year, month+1, 0)
+	offset := (int(t.Weekday()) - int(wd) + 7) % 7
+	return t.AddDate(0, 0, -offset)
+}
+
+// easterSunday returns the date of easter of the gregorian calendar
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return civilDate(year, time.Month(month), day)
+}
+
+type sessionSpec struct {
+	calendar TradingCalendar
+	close    bool
+}
+
+// Next implements CronSpec
+func (s *sessionSpec) Next(t time.Time) time.Time {
+	session := s.calendar.NextSession(t)
+	if s.close {
+		return session.Close
+	}
+	if session.IsZero() || session.Open.After(t) {
+		return session.Open
+	}
+	return s.calendar.NextSession(session.Close).Open
+}
+
+// AddSessionJobs adds the cron jobs which call onOpen and onClose with the
+// sessions of calendar when they open and close on clock. A nil callback is
+// not added. A session which opens when the previous one closes, e.g. 24/7,
+// is opened after the previous one is closed.
+func AddSessionJobs(scheduler Scheduler, clock Clock, calendar TradingCalendar,
+	onOpen, onClose func(Session),
+) {
+	if onClose != nil {
+		scheduler.AddCronJob(&sessionSpec{calendar: calendar, close: true}, func() {
+			if session := calendar.PreviousSession(clockNow(clock)); !session.IsZero() {
+				onClose(session)
+			}
+		})
+	}
+	if onOpen != nil {
+		scheduler.AddCronJob(&sessionSpec{calendar: calendar}, func() {
+			if session, ok := calendar.SessionAt(clockNow(clock)); ok {
+				onOpen(session)
+			}
+		})
+	}
+}
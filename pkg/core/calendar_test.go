@@ -0,0 +1,210 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+)
+
+func TestCalendarNYSE(t *testing.T) {
+	c, err := GetTradingCalendar("NYSE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ny := c.Location()
+	cases := []struct {
+		date  time.Time
+		open  bool
+		close time.Time
+	}{
+		{time.Date(2023, time.January, 3, 12, 0, 0, 0, ny), true, time.Date(2023, time.January, 3, 16, 0, 0, 0, ny)},
+		// new year's day observed on monday
+		{time.Date(2023, time.January, 2, 12, 0, 0, 0, ny), false, time.Time{}},
+		// good friday
+		{time.Date(2023, time.April, 7, 12, 0, 0, 0, ny), false, time.Time{}},
+		{time.Date(2023, time.June, 19, 12, 0, 0, 0, ny), false, time.Time{}},
+		{time.Date(2023, time.July, 3, 12, 0, 0, 0, ny), true, time.Date(2023, time.July, 3, 13, 0, 0, 0, ny)},
+		{time.Date(2023, time.November, 23, 12, 0, 0, 0, ny), false, time.Time{}},
+		{time.Date(2023, time.November, 24, 12, 0, 0, 0, ny), true, time.Date(2023, time.November, 24, 13, 0, 0, 0, ny)},
+		{time.Date(2023, time.December, 25, 12, 0, 0, 0, ny), false, time.Time{}},
+		{time.Date(2023, time.December, 30, 12, 0, 0, 0, ny), false, time.Time{}},
+		// 9:30 on the day daylight saving time starts is 13:30 UTC
+		{time.Date(2023, time.March, 13, 13, 30, 0, 0, time.UTC), true, time.Date(2023, time.March, 13, 20, 0, 0, 0, time.UTC)},
+		{time.Date(2023, time.March, 10, 14, 0, 0, 0, time.UTC), false, time.Time{}},
+	}
+	for _, tc := range cases {
+		s, ok := c.SessionAt(tc.date)
+		if ok != tc.open {
+			t.Error("unexpected open state", tc.date, ok)
+			continue
+		}
+		if ok && !s.Close.Equal(tc.close) {
+			t.Error("unexpected close", tc.date, s.Close)
+		}
+	}
+
+	// the next session after the thanksgiving weekend
+	s := c.NextSession(time.Date(2023, time.November, 24, 14, 0, 0, 0, ny))
+	if !s.Date.Equal(time.Date(2023, time.November, 27, 0, 0, 0, 0, time.UTC)) ||
+		!s.Open.Equal(time.Date(2023, time.November, 27, 9, 30, 0, 0, ny)) {
+		t.Error("unexpected next session", s)
+	}
+	s = c.PreviousSession(time.Date(2023, time.November, 27, 9, 0, 0, 0, ny))
+	if !s.Date.Equal(time.Date(2023, time.November, 24, 0, 0, 0, 0, time.UTC)) {
+		t.Error("unexpected previous session", s)
+	}
+}
+
+func TestCalendarOvernight(t *testing.T) {
+	fx, _ := GetTradingCalendar("fx")
+	ny := fx.Location()
+	// the session of monday opens on sunday at 17:00 New York time
+	s, ok := fx.SessionAt(time.Date(2023, time.March, 5, 18, 0, 0, 0, ny))
+	if !ok || !s.Date.Equal(time.Date(2023, time.March, 6, 0, 0, 0, 0, time.UTC)) ||
+		!s.Open.Equal(time.Date(2023, time.March, 5, 17, 0, 0, 0, ny)) ||
+		!s.Close.Equal(time.Date(2023, time.March, 6, 17, 0, 0, 0, ny)) {
+		t.Error("unexpected fx session", s, ok)
+	}
+	if fx.IsOpen(time.Date(2023, time.March, 4, 12, 0, 0, 0, ny)) {
+		t.Error("fx should be closed on saturday")
+	}
+	if !fx.IsOpen(time.Date(2023, time.March, 10, 16, 59, 0, 0, ny)) ||
+		fx.IsOpen(time.Date(2023, time.March, 10, 17, 0, 0, 0, ny)) {
+		t.Error("fx should close at 17:00 on friday")
+	}
+
+	comex, _ := GetTradingCalendar("comex")
+	chicago := comex.Location()
+	s, ok = comex.SessionAt(time.Date(2023, time.March, 7, 16, 30, 0, 0, chicago))
+	if ok {
+		t.Error("comex should be closed between the sessions", s)
+	}
+	s, ok = comex.SessionAt(time.Date(2023, time.March, 7, 17, 0, 0, 0, chicago))
+	if !ok || !s.Date.Equal(time.Date(2023, time.March, 8, 0, 0, 0, 0, time.UTC)) {
+		t.Error("unexpected comex session", s, ok)
+	}
+	// trading halts at 12:00 on independence day
+	s, ok = comex.SessionAt(time.Date(2023, time.July, 4, 11, 0, 0, 0, chicago))
+	if !ok || !s.Close.Equal(time.Date(2023, time.July, 4, 12, 0, 0, 0, chicago)) {
+		t.Error("unexpected comex early close", s, ok)
+	}
+
+	crypto, _ := GetTradingCalendar("crypto")
+	if !crypto.IsOpen(time.Date(2023, time.December, 25, 12, 0, 0, 0, time.UTC)) {
+		t.Error("crypto should be open every day")
+	}
+}
+
+func TestCalendarConfig(t *testing.T) {
+	cfg := &config.Config{Calendar: config.CalendarConfig{
+		Name:     "nyse",
+		Hours:    "09:00-15:00",
+		Holidays: []string{"2023-03-08"},
+		HalfDays: map[string]string{"2023-03-09": "12:00"},
+	}}
+	c, err := NewTradingCalendarFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ny := c.Location()
+	if !c.IsOpen(time.Date(2023, time.March, 7, 9, 0, 0, 0, ny)) || c.IsOpen(time.Date(2023, time.March, 7, 15, 0, 0, 0, ny)) {
+		t.Error("the hours should be overridden")
+	}
+	if c.IsOpen(time.Date(2023, time.March, 8, 10, 0, 0, 0, ny)) {
+		t.Error("the holiday should be closed")
+	}
+	if s, ok := c.SessionAt(time.Date(2023, time.March, 9, 10, 0, 0, 0, ny)); !ok ||
+		!s.Close.Equal(time.Date(2023, time.March, 9, 12, 0, 0, 0, ny)) {
+		t.Error("unexpected half day", s, ok)
+	}
+
+	for _, cc := range []config.CalendarConfig{
+		{Name: "lse"}, {Timezone: "Nowhere/City"}, {Hours: "9h-16h"},
+		{Weekdays: []int{7}}, {Holidays: []string{"2023/01/02"}}, {HalfDays: map[string]string{"2023-01-02": "1pm"}},
+	} {
+		if _, err := NewTradingCalendarFromConfig(&config.Config{Calendar: cc}); err == nil {
+			t.Error("invalid calendar should be rejected", cc)
+		}
+	}
+}
+
+func TestDayBarGenHookSessions(t *testing.T) {
+	comex, _ := GetTradingCalendar("comex")
+	chicago := comex.Location()
+	clock := NewSimulatedClock()
+	ctrl := NewDataFeedValueHookControl()
+	ctrl.AddNewHook(NewDayBarGenHook(comex))
+	ctrl.(ClockUser).SetClock(clock)
+
+	var generated []*PendingDataFeedValue
+	push := func(tm time.Time, price float64) {
+		clock.Advance(tm)
+		if v := ctrl.PossibleOneNewValue(); v != nil {
+			generated = append(generated, v)
+		}
+		ctrl.FilterNewValue(&PendingDataFeedValue{
+			t: tm,
+			f: MINUTE,
+			v: map[string]interface{}{
+				"GC": NewBasicBar(tm, price, price, price, price, price, 1, MINUTE),
+			},
+		}, false)
+	}
+	// the evening bars belong to the session of the next day
+	push(time.Date(2023, time.March, 6, 18, 0, 0, 0, chicago), 100)
+	push(time.Date(2023, time.March, 7, 9, 0, 0, 0, chicago), 110)
+	push(time.Date(2023, time.March, 7, 15, 59, 0, 0, chicago), 90)
+	// the bar between the sessions is ignored
+	push(time.Date(2023, time.March, 7, 16, 30, 0, 0, chicago), 200)
+	push(time.Date(2023, time.March, 7, 17, 0, 0, 0, chicago), 95)
+
+	if len(generated) != 1 {
+		t.Fatal("one day bar should be generated", len(generated))
+	}
+	if !generated[0].t.Equal(time.Date(2023, time.March, 7, 0, 0, 0, 0, time.UTC)) {
+		t.Error("unexpected day bar time", generated[0].t)
+	}
+	bar := generated[0].v["GC"].(Bar)
+	if bar.Open() != 100 || bar.High() != 110 || bar.Low() != 90 || bar.Close() != 90 {
+		t.Error("unexpected day bar", bar)
+	}
+}
+
+func TestSessionJobs(t *testing.T) {
+	cfg := &config.Config{Calendar: config.CalendarConfig{Name: "nyse"}}
+	gen := NewBarFeedGenerator([]Frequency{HOUR}, 100)
+	feed := NewGenericDataFeed(context.TODO(), cfg, gen, nil, 100, "")
+	// thursday to monday
+	for tm := time.Date(2023, time.July, 6, 12, 0, 0, 0, time.UTC); !tm.After(time.Date(2023, time.July, 11, 0, 0, 0, 0, time.UTC)); tm = tm.Add(6 * time.Hour) {
+		gen.AppendNewValueToBuffer(tm, map[string]interface{}{
+			"X": NewBasicBar(tm, 1, 1, 1, 1, 1, 1, HOUR),
+		}, HOUR)
+	}
+	gen.Finish()
+
+	calendar, _ := NewTradingCalendarFromConfig(cfg)
+	d := NewDispatcher(context.TODO())
+	d.AddSubject(feed)
+	events := []string{}
+	AddSessionJobs(d.GetScheduler(), d.GetClock(), calendar, func(s Session) {
+		events = append(events, "open "+s.Date.Format("01-02")+" "+d.GetClock().Now().UTC().Format("15:04"))
+	}, func(s Session) {
+		events = append(events, "close "+s.Date.Format("01-02")+" "+d.GetClock().Now().UTC().Format("15:04"))
+	})
+	d.Run()
+
+	expected := []string{
+		"open 07-06 13:30",
+		"close 07-06 20:00",
+		"open 07-07 13:30",
+		"close 07-07 20:00",
+		"open 07-10 13:30",
+		"close 07-10 20:00",
+	}
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Error("unexpected session events", events)
+	}
+}
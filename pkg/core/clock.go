@@ -0,0 +1,77 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time of a strategy. It is owned by the dispatcher,
+// the wall time in live trading and the time of the dispatched values in
+// backtests.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockUser is implemented by the components which read the current time,
+// the dispatcher sets its clock on its subjects before starting them
+type ClockUser interface {
+	SetClock(clock Clock)
+}
+
+type wallClock struct{}
+
+// Now implements Clock
+func (c *wallClock) Now() time.Time {
+	return time.Now().UTC()
+}
+
+// NewWallClock returns the clock of live trading
+func NewWallClock() Clock {
+	return &wallClock{}
+}
+
+// SimulatedClock is the clock of backtests, it is moved forward by the
+// dispatcher
+type SimulatedClock interface {
+	Clock
+	// Advance sets the time to t if it is after the current time
+	Advance(t time.Time)
+}
+
+type simulatedClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// Now implements Clock, it is the wall time until the first value is
+// dispatched
+func (c *simulatedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.t.IsZero() {
+		return time.Now().UTC()
+	}
+	return c.t
+}
+
+// Advance implements SimulatedClock
+func (c *simulatedClock) Advance(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.After(c.t) {
+		c.t = t
+	}
+}
+
+func NewSimulatedClock() SimulatedClock {
+	return &simulatedClock{}
+}
+
+// clockNow returns the time of clock, or the wall time if the clock is not
+// set yet
+func clockNow(clock Clock) time.Time {
+	if clock == nil {
+		return time.Now().UTC()
+	}
+	return clock.Now()
+}
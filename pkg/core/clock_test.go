@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+)
+
+func TestSimulatedClock(t *testing.T) {
+	clock := NewSimulatedClock()
+	if time.Since(clock.Now()) > time.Minute {
+		t.Error("the clock should be the wall time before it is advanced")
+	}
+	tm := time.Date(2022, time.January, 3, 10, 0, 0, 0, time.UTC)
+	clock.Advance(tm)
+	clock.Advance(tm.Add(-time.Hour))
+	if !clock.Now().Equal(tm) {
+		t.Error("the clock should not go backwards", clock.Now())
+	}
+}
+
+func TestDispatcherClockDayBars(t *testing.T) {
+	gen := NewBarFeedGenerator([]Frequency{HOUR, DAY}, 100)
+	feed := NewGenericDataFeed(context.TODO(), &config.Config{}, gen, nil, 100, "")
+	start := time.Date(2022, time.January, 3, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		tm := start.Add(time.Duration(i/3)*24*time.Hour + time.Duration(i%3)*time.Hour)
+		gen.AppendNewValueToBuffer(tm, map[string]interface{}{
+			"X": NewBasicBar(tm, 1, 2, 0.5, 1, 1, 10, HOUR),
+		}, HOUR)
+	}
+	gen.Finish()
+
+	d := NewDispatcher(context.TODO())
+	d.AddSubject(feed)
+	type dispatched struct {
+		t     time.Time
+		freq  Frequency
+		clock time.Time
+	}
+	got := []dispatched{}
+	feed.GetNewValueEvent().Subscribe(func(args ...interface{}) error {
+		for _, v := range args[1].(map[string]interface{}) {
+			got = append(got, dispatched{args[0].(time.Time), v.(Bar).Frequency(), d.GetClock().Now()})
+		}
+		return nil
+	})
+	d.Run()
+
+	if len(got) != 7 {
+		t.Fatal("expected 6 hour bars and a day bar", got)
+	}
+	// the day bar of the first day is generated when the clock reaches the
+	// second day, before its first bar
+	if got[3].freq != DAY || !got[3].t.Equal(time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Error("unexpected day bar", got[3])
+	}
+	for i, v := range append(got[:3], got[4:]...) {
+		if v.freq != HOUR || !v.clock.Equal(v.t) {
+			t.Error("the clock should be the time of the bar", i, v)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"goat/pkg/config"
+)
+
+// Commission calculates the fee charged by the broker for a fill
+type Commission interface {
+	// Calculate returns the commission for filling quantity at price. The
+	// order has not been updated with this fill yet.
+	Calculate(order Order, price float64, quantity float64) float64
+}
+
+type noCommission struct{}
+
+// NewNoCommission returns a commission model that does not charge anything
+func NewNoCommission() Commission {
+	return &noCommission{}
+}
+
+// Calculate implements Commission
+func (c *noCommission) Calculate(order Order, price float64, quantity float64) float64 {
+	return 0
+}
+
+type fixedPerTradeCommission struct {
+	amount float64
+}
+
+// NewFixedPerTradeCommission charges a fixed amount per order. Partially
+// filled orders are only charged on the first fill.
+func NewFixedPerTradeCommission(amount float64) Commission {
+	return &fixedPerTradeCommission{
+		amount: amount,
+	}
+}
+
+// Calculate implements Commission
+func (c *fixedPerTradeCommission) Calculate(order Order, price float64, quantity float64) float64 {
+	if order.GetFilled() == 0 {
+		return c.amount
+	}
+	return 0
+}
+
+type perShareCommission struct {
+	amount  float64
+	minimum float64
+	maximum float64
+}
+
+// NewPerShareCommission charges amount per share (or contract, or ounce)
+// with optional minimum and maximum fees per order. Pass 0 to disable the
+// bounds.
+func NewPerShareCommission(amount, minimum, maximum float64) Commission {
+	return &perShareCommission{
+		amount:  amount,
+		minimum: minimum,
+		maximum: maximum,
+	}
+}
+
+// Calculate implements Commission
+func (c *perShareCommission) Calculate(order Order, price float64, quantity float64) float64 {
+	return boundCommission(order, c.amount*quantity, c.minimum, c.maximum)
+}
+
+type percentageCommission struct {
+	percentage float64
+	minimum    float64
+	maximum    float64
+}
+
+// NewPercentageCommission charges a fraction of the fill notional (0.001 is
+// 0.1%) with optional minimum and maximum fees per order.
+func NewPercentageCommission(percentage, minimum, maximum float64) Commission {
+	return &percentageCommission{
+		percentage: percentage,
+		minimum:    minimum,
+		maximum:    maximum,
+	}
+}
+
+// Calculate implements Commission
+func (c *percentageCommission) Calculate(order Order, price float64, quantity float64) float64 {
+	return boundCommission(order, c.percentage*price*quantity, c.minimum, c.maximum)
+}
+
+// boundCommission keeps the total commission of an order within minimum and
+// maximum. fee is the commission of the current fill.
+func boundCommission(order Order, fee, minimum, maximum float64) float64 {
+	charged := order.GetCommission()
+	if minimum > 0 && charged+fee < minimum {
+		fee = minimum - charged
+	}
+	if maximum > 0 && charged+fee > maximum {
+		fee = math.Max(maximum-charged, 0)
+	}
+	return fee
+}
+
+// CommissionTier is one band of a tiered commission schedule
+type CommissionTier struct {
+	UpTo       float64 // upper bound of the fill notional, 0 means no bound
+	Commission Commission
+}
+
+type tieredCommission struct {
+	tiers []CommissionTier
+}
+
+// NewTieredCommission picks the commission model of the first tier whose
+// bound is not lower than the fill notional. Tiers must be sorted by their
+// bound and the last tier should be unbounded.
+func NewTieredCommission(tiers []CommissionTier) Commission {
+	return &tieredCommission{
+		tiers: tiers,
+	}
+}
+
+// Calculate implements Commission
+func (c *tieredCommission) Calculate(order Order, price float64, quantity float64) float64 {
+	notional := math.Abs(price * quantity)
+	for _, tier := range c.tiers {
+		if tier.UpTo <= 0 || notional <= tier.UpTo {
+			return tier.Commission.Calculate(order, price, quantity)
+		}
+	}
+	if len(c.tiers) > 0 {
+		return c.tiers[len(c.tiers)-1].Commission.Calculate(order, price, quantity)
+	}
+	return 0
+}
+
+type instrumentCommission struct {
+	defaultCommission Commission
+	instruments       map[string]Commission
+}
+
+// NewInstrumentCommission uses a different commission model per instrument
+// and falls back to defaultCommission for the others. Instrument names are
+// case insensitive since viper lower cases map keys in config files.
+func NewInstrumentCommission(defaultCommission Commission,
+	instruments map[string]Commission,
+) Commission {
+	res := &instrumentCommission{
+		defaultCommission: defaultCommission,
+		instruments:       make(map[string]Commission, len(instruments)),
+	}
+	for k, v := range instruments {
+		res.instruments[strings.ToLower(k)] = v
+	}
+	return res
+}
+
+// Calculate implements Commission
+func (c *instrumentCommission) Calculate(order Order, price float64, quantity float64) float64 {
+	if v, ok := c.instruments[strings.ToLower(order.GetInstrument())]; ok {
+		return v.Calculate(order, price, quantity)
+	}
+	return c.defaultCommission.Calculate(order, price, quantity)
+}
+
+// NewCommissionFromConfig creates the commission model described by the
+// broker configuration.
+func NewCommissionFromConfig(cfg *config.CommissionConfig) (Commission, error) {
+	var res Commission
+	switch strings.ToLower(cfg.Type) {
+	case "", "none":
+		res = NewNoCommission()
+	case "fixed":
+		res = NewFixedPerTradeCommission(cfg.Amount)
+	case "pershare":
+		res = NewPerShareCommission(cfg.Amount, cfg.Minimum, cfg.Maximum)
+	case "percentage":
+		res = NewPercentageCommission(cfg.Amount, cfg.Minimum, cfg.Maximum)
+	case "tiered":
+		if len(cfg.Tiers) == 0 {
+			return nil, fmt.Errorf("tiered commission needs at least one tier")
+		}
+		tiers := make([]CommissionTier, 0, len(cfg.Tiers))
+		for i := range cfg.Tiers {
+			if i > 0 && cfg.Tiers[i-1].UpTo <= 0 {
+				return nil, fmt.Errorf("only the last commission tier can be unbounded")
+			}
+			if i > 0 && cfg.Tiers[i].UpTo > 0 && cfg.Tiers[i].UpTo <= cfg.Tiers[i-1].UpTo {
+				return nil, fmt.Errorf("commission tiers must be sorted by their bound")
+			}
+			c, err := NewCommissionFromConfig(&cfg.Tiers[i].CommissionConfig)
+			if err != nil {
+				return nil, err
+			}
+			tiers = append(tiers, CommissionTier{
+				UpTo:       cfg.Tiers[i].UpTo,
+				Commission: c,
+			})
+		}
+		res = NewTieredCommission(tiers)
+	default:
+		return nil, fmt.Errorf("unknown commission type %s", cfg.Type)
+	}
+
+	if len(cfg.Instruments) == 0 {
+		return res, nil
+	}
+	instruments := make(map[string]Commission, len(cfg.Instruments))
+	for k, v := range cfg.Instruments {
+		v := v
+		c, err := NewCommissionFromConfig(&v)
+		if err != nil {
+			return nil, fmt.Errorf("instrument %s: %v", k, err)
+		}
+		instruments[k] = c
+	}
+	return NewInstrumentCommission(res, instruments), nil
+}
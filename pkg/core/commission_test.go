@@ -0,0 +1,101 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+)
+
+func TestCommissionModels(t *testing.T) {
+	order := NewMarketOrder(OrderActionBuy, "GLD", 100, false).(*BasicOrder)
+
+	if v := NewNoCommission().Calculate(order, 10, 100); v != 0 {
+		t.Error("no commission should be 0", v)
+	}
+
+	fixed := NewFixedPerTradeCommission(5)
+	if v := fixed.Calculate(order, 10, 50); !almostEqual(v, 5) {
+		t.Error("fixed commission should be 5", v)
+	}
+
+	perShare := NewPerShareCommission(0.005, 1, 2)
+	if v := perShare.Calculate(order, 10, 10); !almostEqual(v, 1) {
+		t.Error("per share commission should be raised to the minimum", v)
+	}
+	if v := perShare.Calculate(order, 10, 1000); !almostEqual(v, 2) {
+		t.Error("per share commission should be capped", v)
+	}
+
+	pct := NewPercentageCommission(0.001, 0, 0)
+	if v := pct.Calculate(order, 10, 100); !almostEqual(v, 1) {
+		t.Error("percentage commission should be 1", v)
+	}
+
+	order.addExecution(&OrderExecutionInfo{Price: 10, Quantity: 50, Commission: 5})
+	if v := fixed.Calculate(order, 10, 50); v != 0 {
+		t.Error("fixed commission should only be charged once", v)
+	}
+	if !almostEqual(order.GetCommission(), 5) {
+		t.Error("order should record commission", order.GetCommission())
+	}
+}
+
+func TestCommissionFromConfig(t *testing.T) {
+	cfg := &config.CommissionConfig{
+		Type: "tiered",
+	}
+	if _, err := NewCommissionFromConfig(cfg); err == nil {
+		t.Error("tiered commission without tiers should fail")
+	}
+
+	cfg.Tiers = make([]config.CommissionTierConfig, 2)
+	cfg.Tiers[0].UpTo = 1000
+	cfg.Tiers[0].Type = "fixed"
+	cfg.Tiers[0].Amount = 1
+	cfg.Tiers[1].Type = "percentage"
+	cfg.Tiers[1].Amount = 0.01
+	cfg.Instruments = map[string]config.CommissionConfig{
+		"XAUUSD": {Type: "pershare", Amount: 0.5},
+	}
+	c, err := NewCommissionFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := NewMarketOrder(OrderActionBuy, "GLD", 100, false)
+	if v := c.Calculate(order, 5, 100); !almostEqual(v, 1) {
+		t.Error("small fills should use the first tier", v)
+	}
+	if v := c.Calculate(order, 50, 100); !almostEqual(v, 50) {
+		t.Error("large fills should use the second tier", v)
+	}
+	gold := NewMarketOrder(OrderActionBuy, "XAUUSD", 10, false)
+	if v := c.Calculate(gold, 1700, 10); !almostEqual(v, 5) {
+		t.Error("instrument override should be used", v)
+	}
+
+	if _, err := NewCommissionFromConfig(&config.CommissionConfig{Type: "foo"}); err == nil {
+		t.Error("unknown commission type should fail")
+	}
+}
+
+func TestBacktestBrokerCommission(t *testing.T) {
+	broker, events := newTestBacktestBroker(1000)
+	broker.commission = NewFixedPerTradeCommission(10)
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	order := NewMarketOrder(OrderActionBuy, "GLD", 5, false)
+	broker.SubmitOrder(order)
+	pushTestBar(broker, tm, 100, 110, 90, 105)
+	if !order.IsFilled() || !almostEqual(order.GetCommission(), 10) {
+		t.Fatal("order should be filled with commission", order)
+	}
+	if !almostEqual(broker.GetCash(), 490) {
+		t.Fatal("commission should be charged", broker.GetCash())
+	}
+	info := (*events)[len(*events)-1].GetEventInfo().(*OrderExecutionInfo)
+	if !almostEqual(info.Commission, 10) {
+		t.Fatal("execution info should record commission", info)
+	}
+}
@@ -0,0 +1,237 @@
+package core
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"goat/pkg/logger"
+
+	"github.com/araddon/dateparse"
+	"go.uber.org/zap"
+)
+
+type CorporateActionType string
+
+const (
+	CorporateActionSplit    CorporateActionType = "SPLIT"
+	CorporateActionDividend CorporateActionType = "DIVIDEND"
+)
+
+// CorporateAction is a split or a cash dividend of an instrument, it takes
+// effect with the first bar of its ex date
+type CorporateAction struct {
+	Instrument string              `json:"instrument"`
+	Type       CorporateActionType `json:"type"`
+	DateTime   time.Time           `json:"dateTime"`
+	// Ratio is the number of new shares for one old share of a split, e.g. 2
+	// for a 2:1 split and 0.1 for a 1:10 reverse split
+	Ratio float64 `json:"ratio,omitempty"`
+	// Amount is the dividend per share in the quote currency
+	Amount float64 `json:"amount,omitempty"`
+}
+
+// CorporateActionEvent is emitted by the broker with the corporate actions
+// applied to a position
+type CorporateActionEvent struct {
+	Action CorporateAction `json:"action"`
+	// Quantity is the position before the action
+	Quantity float64 `json:"quantity"`
+	// Cash is the dividend credited to the account in the base currency,
+	// it is negative for a short position
+	Cash float64 `json:"cash"`
+}
+
+// CorporateActionHandler is implemented by the brokers which apply splits
+// and dividends to their positions
+type CorporateActionHandler interface {
+	AddCorporateActions(actions ...CorporateAction)
+	// GetCorporateActionEvent emits a CorporateActionEvent for each action
+	// applied to a position
+	GetCorporateActionEvent() Event
+}
+
+// ParseSplitRatio parses a split ratio such as 2, 0.5, 2:1 or 1:10
+func ParseSplitRatio(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	sep := strings.IndexAny(s, ":/")
+	if sep < 0 {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v <= 0 {
+			return 0, fmt.Errorf("invalid split ratio %s", s)
+		}
+		return v, nil
+	}
+	num, err1 := strconv.ParseFloat(strings.TrimSpace(s[:sep]), 64)
+	den, err2 := strconv.ParseFloat(strings.TrimSpace(s[sep+1:]), 64)
+	if err1 != nil || err2 != nil || num <= 0 || den <= 0 {
+		return 0, fmt.Errorf("invalid split ratio %s", s)
+	}
+	return num / den, nil
+}
+
+// LoadCorporateActionsFile reads a csv file with a header and symbol, date,
+// type and value columns. The value is the ratio of a split or the amount of
+// a dividend.
+func LoadCorporateActionsFile(path string) ([]CorporateAction, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	columns := map[string]int{}
+	res := []CorporateAction{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 {
+			for i, name := range record {
+				columns[strings.ToLower(strings.TrimSpace(name))] = i
+			}
+			for _, name := range []string{"symbol", "date", "type", "value"} {
+				if _, ok := columns[name]; !ok {
+					return nil, fmt.Errorf("corporate actions file has no %s column", name)
+				}
+			}
+			continue
+		}
+
+		action, err := parseCorporateAction(record[columns["symbol"]], record[columns["date"]],
+			record[columns["type"]], record[columns["value"]])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		res = append(res, action)
+	}
+	return res, nil
+}
+
+func parseCorporateAction(symbol, date, actionType, value string) (CorporateAction, error) {
+	action := CorporateAction{Instrument: strings.TrimSpace(symbol)}
+	if action.Instrument == "" {
+		return action, fmt.Errorf("symbol is empty")
+	}
+	t, err := dateparse.ParseIn(strings.TrimSpace(date), time.UTC)
+	if err != nil {
+		return action, err
+	}
+	action.DateTime = t
+	switch CorporateActionType(strings.ToUpper(strings.TrimSpace(actionType))) {
+	case CorporateActionSplit:
+		action.Type = CorporateActionSplit
+		if action.Ratio, err = ParseSplitRatio(value); err != nil {
+			return action, err
+		}
+	case CorporateActionDividend:
+		action.Type = CorporateActionDividend
+		if action.Amount, err = strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil || action.Amount < 0 {
+			return action, fmt.Errorf("invalid dividend amount %s", value)
+		}
+	default:
+		return action, fmt.Errorf("unknown corporate action type %s", actionType)
+	}
+	return action, nil
+}
+
+// corporateActions keeps the pending corporate actions of each instrument
+// sorted by date
+type corporateActions struct {
+	pending map[string][]CorporateAction
+}
+
+func newCorporateActions() *corporateActions {
+	return &corporateActions{
+		pending: map[string][]CorporateAction{},
+	}
+}
+
+func (c *corporateActions) add(actions ...CorporateAction) {
+	for _, a := range actions {
+		c.pending[a.Instrument] = append(c.pending[a.Instrument], a)
+	}
+	for _, pending := range c.pending {
+		sort.SliceStable(pending, func(i, j int) bool {
+			return pending[i].DateTime.Before(pending[j].DateTime)
+		})
+	}
+}
+
+// pop removes and returns the actions of instrument due at t
+func (c *corporateActions) pop(instrument string, t time.Time) []CorporateAction {
+	pending := c.pending[instrument]
+	n := 0
+	for n < len(pending) && !pending[n].DateTime.After(t) {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	c.pending[instrument] = pending[n:]
+	return pending[:n]
+}
+
+// AddCorporateActions implements CorporateActionHandler, the actions are
+// ignored in adjusted mode
+func (b *backtestBroker) AddCorporateActions(actions ...CorporateAction) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.corporateActions == nil {
+		logger.Logger.Debug("corporate actions are ignored in adjusted mode", zap.Int("count", len(actions)))
+		return
+	}
+	b.corporateActions.add(actions...)
+}
+
+// GetCorporateActionEvent implements CorporateActionHandler
+func (b *backtestBroker) GetCorporateActionEvent() Event {
+	return b.corporateActionEvent
+}
+
+// applyCorporateAction changes the position of a split and credits the
+// dividends. The active orders of a split instrument are canceled since
+// their prices and quantities are not valid anymore.
+func (b *backtestBroker) applyCorporateAction(action CorporateAction) {
+	quantity := b.positions[action.Instrument]
+	event := CorporateActionEvent{Action: action, Quantity: quantity}
+	switch action.Type {
+	case CorporateActionSplit:
+		for _, o := range b.sortedActiveOrders() {
+			if o.IsActive() && o.Instrument == action.Instrument {
+				b.cancelOrder(o, fmt.Sprintf("split %g of %s", action.Ratio, action.Instrument))
+			}
+		}
+		if quantity == 0 {
+			return
+		}
+		b.positions[action.Instrument] = quantity * action.Ratio
+	case CorporateActionDividend:
+		if quantity == 0 {
+			return
+		}
+		rate, ok := b.fxRate(action.Instrument)
+		if !ok {
+			logger.Logger.Warn("no fx rate for the dividend", zap.String("instrument", action.Instrument))
+			return
+		}
+		event.Cash = quantity * action.Amount * b.GetInstrument(action.Instrument).GetMultiplier() * rate
+		b.cash += event.Cash
+	}
+	logger.Logger.Debug("corporate action applied",
+		zap.String("instrument", action.Instrument),
+		zap.String("type", string(action.Type)),
+		zap.Float64("quantity", quantity),
+		zap.Float64("cash", event.Cash))
+	b.pendingActionEvents = append(b.pendingActionEvents, event)
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+)
+
+func TestParseSplitRatio(t *testing.T) {
+	for s, expected := range map[string]float64{"2": 2, "0.5": 0.5, "3:2": 1.5, "1/10": 0.1} {
+		if v, err := ParseSplitRatio(s); err != nil || !almostEqual(v, expected) {
+			t.Error("unexpected ratio", s, v, err)
+		}
+	}
+	for _, s := range []string{"", "0", "-2", "2:0", "a:b"} {
+		if _, err := ParseSplitRatio(s); err == nil {
+			t.Error("invalid ratio should fail", s)
+		}
+	}
+}
+
+func TestLoadCorporateActionsFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "actions.csv")
+	data := "Symbol,Date,Type,Value\nGLD,2022-01-05,split,2:1\nGLD,2022-01-04,Dividend,0.5\n"
+	if err := ioutil.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	actions, err := LoadCorporateActionsFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 || actions[0].Type != CorporateActionSplit || actions[0].Ratio != 2 ||
+		actions[1].Type != CorporateActionDividend || actions[1].Amount != 0.5 ||
+		!actions[1].DateTime.Equal(time.Date(2022, time.January, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Fatal("unexpected actions", actions)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("Symbol,Date,Type,Value\nGLD,2022-01-05,merger,1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCorporateActionsFile(file); err == nil {
+		t.Fatal("unknown action type should fail")
+	}
+}
+
+func TestBacktestBrokerCorporateActions(t *testing.T) {
+	broker, events := newTestBacktestBroker(10000)
+	portfolio := NewPortfolio(broker, broker.datafeed, 0)
+	trades := newTradesAnalyzer(portfolio)
+	broker.GetOrderUpdatedEvent().Subscribe(func(args ...interface{}) error {
+		return trades.OnOrderEvent(args[1].(OrderEvent))
+	})
+	day := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	broker.AddCorporateActions(
+		CorporateAction{Instrument: "GLD", Type: CorporateActionSplit, DateTime: day.AddDate(0, 0, 2), Ratio: 2},
+		CorporateAction{Instrument: "GLD", Type: CorporateActionDividend, DateTime: day.AddDate(0, 0, 1), Amount: 1},
+		CorporateAction{Instrument: "SLV", Type: CorporateActionDividend, DateTime: day.AddDate(0, 0, 1), Amount: 1},
+	)
+
+	broker.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 10, false))
+	pushTestBar(broker.datafeed, day, 100, 100, 100, 100)
+	pushTestBar(broker.datafeed, day.AddDate(0, 0, 1), 100, 100, 100, 100)
+	if !almostEqual(broker.GetCash(), 9010) || !almostEqual(portfolio.GetEquity(), 10010) {
+		t.Fatal("dividend should be credited", broker.GetCash(), portfolio.GetEquity())
+	}
+
+	pending := NewLimitOrder(OrderActionSell, "GLD", 120, 10)
+	broker.SubmitOrder(pending)
+	pushTestBar(broker.datafeed, day.AddDate(0, 0, 2), 50, 50, 50, 50)
+	if broker.GetPosition("GLD") != 20 || pending.GetState() != OrderStateCanceled ||
+		countEvents(*events, OrderEventCanceled) != 1 {
+		t.Fatal("split should double the position and cancel the orders", broker.GetPosition("GLD"), pending)
+	}
+	if pos := portfolio.GetPosition("GLD"); pos.Quantity != 20 || !almostEqual(pos.AvgCost, 50) ||
+		!almostEqual(pos.Dividends, 10) || !almostEqual(portfolio.GetEquity(), 10010) {
+		t.Fatal("unexpected position after the split", pos, portfolio.GetEquity())
+	}
+
+	broker.SubmitOrder(NewMarketOrder(OrderActionSell, "GLD", 20, false))
+	pushTestBar(broker.datafeed, day.AddDate(0, 0, 3), 55, 55, 55, 55)
+	if broker.GetPosition("GLD") != 0 || len(trades.trades) != 1 || !almostEqual(trades.trades[0], 110) {
+		t.Fatal("the trade should include the dividend and the split", broker.GetPosition("GLD"), trades.trades)
+	}
+}
+
+func TestBacktestBrokerAdjustedMode(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Broker.Cash = 10000
+	cfg.CorporateActions.Adjusted = true
+	gen := NewBarFeedGenerator([]Frequency{DAY}, 100)
+	feed := NewGenericDataFeed(context.TODO(), cfg, gen, nil, 100, "")
+	broker := newTestBroker(cfg, feed)
+	day := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	broker.AddCorporateActions(CorporateAction{Instrument: "GLD", Type: CorporateActionSplit, DateTime: day, Ratio: 2})
+
+	bar := NewBasicBar(day, 100, 100, 100, 100, 50, 1000, DAY)
+	if err := gen.AppendNewValueToBuffer(day, map[string]interface{}{"GLD": bar}, DAY); err != nil {
+		t.Fatal(err)
+	}
+	broker.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 10, false))
+	feed.Dispatch()
+	if bar.Close() != 100 || !almostEqual(broker.GetCash(), 9500) || broker.GetPosition("GLD") != 10 {
+		t.Fatal("the broker should use the adjusted prices without splitting", bar, broker.GetCash(),
+			broker.GetPosition("GLD"))
+	}
+}
@@ -0,0 +1,52 @@
+package core
+
+// CurrencyConverter converts the amounts in the quote currencies of the
+// instruments to the base currency of the account
+type CurrencyConverter interface {
+	// GetBaseCurrency returns an empty string if the amounts are not
+	// converted
+	GetBaseCurrency() string
+	// GetFXRate returns the value of one unit of currency in the base
+	// currency, false if no rate of currency has been seen yet
+	GetFXRate(currency string) (float64, bool)
+}
+
+// fxRates keeps the last closes of the FX pairs of the data feed. The rate
+// of EUR in a USD account is the close of EURUSD, or the inverse of the
+// close of USDEUR.
+type fxRates struct {
+	base   string
+	closes map[string]float64
+}
+
+func newFXRates(base string) *fxRates {
+	return &fxRates{
+		base:   base,
+		closes: map[string]float64{},
+	}
+}
+
+func (r *fxRates) update(instrument string, close float64) {
+	if len(instrument) == 2*len(r.base) && close > 0 {
+		r.closes[instrument] = close
+	}
+}
+
+// GetBaseCurrency implements CurrencyConverter
+func (r *fxRates) GetBaseCurrency() string {
+	return r.base
+}
+
+// GetFXRate implements CurrencyConverter
+func (r *fxRates) GetFXRate(currency string) (float64, bool) {
+	if currency == "" || currency == r.base {
+		return 1, true
+	}
+	if v, ok := r.closes[currency+r.base]; ok {
+		return v, true
+	}
+	if v, ok := r.closes[r.base+currency]; ok {
+		return 1 / v, true
+	}
+	return 0, false
+}
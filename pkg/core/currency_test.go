@@ -0,0 +1,79 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+)
+
+func TestFXRates(t *testing.T) {
+	r := newFXRates("USD")
+	r.update("EURUSD", 1.1)
+	r.update("USDJPY", 125)
+	r.update("XAUUSDT", 1800)
+	if v, ok := r.GetFXRate("USD"); !ok || v != 1 {
+		t.Error("unexpected base rate", v)
+	}
+	if v, ok := r.GetFXRate("EUR"); !ok || v != 1.1 {
+		t.Error("unexpected EUR rate", v)
+	}
+	if v, ok := r.GetFXRate("JPY"); !ok || !almostEqual(v, 0.008) {
+		t.Error("unexpected inverse JPY rate", v)
+	}
+	if _, ok := r.GetFXRate("GBP"); ok {
+		t.Error("GBP rate should be missing")
+	}
+}
+
+func TestPortfolioBaseCurrency(t *testing.T) {
+	cfg := &config.Config{
+		BaseCurrency: "USD",
+		Instruments: map[string]config.InstrumentConfig{
+			"XAUEUR": {Currency: "EUR"},
+			"XAUGBP": {Currency: "GBP"},
+		},
+	}
+	cfg.Broker.Cash = 10000
+	broker, _ := newTestBacktestBrokerWithConfig(cfg)
+	feed := broker.datafeed
+	portfolio := NewPortfolio(broker, feed, 0)
+	trades := newTradesAnalyzer(portfolio)
+	broker.GetOrderUpdatedEvent().Subscribe(func(args ...interface{}) error {
+		return trades.OnOrderEvent(args[1].(OrderEvent))
+	})
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	buy := NewMarketOrder(OrderActionBuy, "XAUEUR", 10, false)
+	noRate := NewMarketOrder(OrderActionBuy, "XAUGBP", 1, false)
+	broker.SubmitOrder(buy)
+	broker.SubmitOrder(noRate)
+	pushTestBars(feed, tm, map[string]float64{"EURUSD": 1.1, "XAUEUR": 100, "XAUGBP": 90})
+	if !buy.IsFilled() || noRate.GetState() != OrderStateCanceled || !almostEqual(broker.GetCash(), 8900) {
+		t.Fatal("the cost should be converted to the base currency", buy, noRate, broker.GetCash())
+	}
+	if portfolio.GetBaseCurrency() != "USD" || !almostEqual(portfolio.GetEquity(), 10000) {
+		t.Fatal("unexpected equity", portfolio.GetEquity())
+	}
+
+	// the position moves with the fx rate only
+	pushTestBars(feed, tm.AddDate(0, 0, 1), map[string]float64{"EURUSD": 1.2, "XAUEUR": 100})
+	if !almostEqual(portfolio.GetEquity(), 10100) || !almostEqual(portfolio.GetUnrealizedPnL(), 100) {
+		t.Fatal("unexpected equity", portfolio.GetEquity(), portfolio.GetUnrealizedPnL())
+	}
+	pushTestBars(feed, tm.AddDate(0, 0, 2), map[string]float64{"EURUSD": 1.0})
+	if pos := portfolio.GetPosition("XAUEUR"); pos.Currency != "EUR" || !almostEqual(pos.LastPrice, 100) ||
+		!almostEqual(portfolio.GetEquity(), 9900) {
+		t.Fatal("unexpected position", pos, portfolio.GetEquity())
+	}
+
+	broker.SubmitOrder(NewMarketOrder(OrderActionSell, "XAUEUR", 10, false))
+	pushTestBars(feed, tm.AddDate(0, 0, 3), map[string]float64{"EURUSD": 1.25, "XAUEUR": 96})
+	if !almostEqual(broker.GetCash(), 10100) || !almostEqual(portfolio.GetRealizedPnL(), 100) ||
+		!almostEqual(portfolio.GetEquity(), 10100) {
+		t.Fatal("unexpected pnl", broker.GetCash(), portfolio.GetRealizedPnL(), portfolio.GetEquity())
+	}
+	if len(trades.trades) != 1 || !almostEqual(trades.trades[0], 100) {
+		t.Fatal("trades should be in the base currency", trades.trades)
+	}
+}
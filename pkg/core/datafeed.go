@@ -38,10 +38,28 @@ type barFeedGenerator struct {
 	dataBuf      []*BarFeedGeneratorData
 	dataBufMutex sync.Mutex
 	eof          bool
+	wakeup       func()
+}
+
+// SetWakeupFunc implements Waker
+func (b *barFeedGenerator) SetWakeupFunc(wakeup func()) {
+	b.dataBufMutex.Lock()
+	defer b.dataBufMutex.Unlock()
+	b.wakeup = wakeup
+}
+
+// wakeupLocked signals the dispatcher that there are new values, the lock
+// must be held
+func (b *barFeedGenerator) wakeupLocked() {
+	if b.wakeup != nil {
+		b.wakeup()
+	}
 }
 
 // IsComplete implements FeedGenerator
 func (b *barFeedGenerator) IsComplete() bool {
+	b.dataBufMutex.Lock()
+	defer b.dataBufMutex.Unlock()
 	return b.eof && len(b.dataBuf) == 0
 }
 
@@ -87,7 +105,10 @@ func (b *barFeedGenerator) PopNextValues() (time.Time, map[string]interface{}, F
 }
 
 func (b *barFeedGenerator) Finish() {
+	b.dataBufMutex.Lock()
+	defer b.dataBufMutex.Unlock()
 	b.eof = true
+	b.wakeupLocked()
 }
 
 func (b *barFeedGenerator) AppendNewValueToBuffer(t time.Time, v map[string]interface{},
@@ -103,12 +124,12 @@ func (b *barFeedGenerator) AppendNewValueToBuffer(t time.Time, v map[string]inte
 		return fmt.Errorf("frequency %d not valid for generator. possible ones are %v",
 			f, b.freq)
 	}
-	if b.eof {
-		return fmt.Errorf("feed generator is closed")
-	}
 
 	b.dataBufMutex.Lock()
 	defer b.dataBufMutex.Unlock()
+	if b.eof {
+		return fmt.Errorf("feed generator is closed")
+	}
 	if len(b.dataBuf) >= config.DataFeedMaxPendingBars {
 		return fmt.Errorf("feed generator buffer is full")
 	}
@@ -117,6 +138,7 @@ func (b *barFeedGenerator) AppendNewValueToBuffer(t time.Time, v map[string]inte
 		d: v,
 		f: f,
 	})
+	b.wakeupLocked()
 	return nil
 }
 
@@ -170,7 +192,9 @@ func (d *genericDataFeed) GetDataSeries(symbol string,
 }
 
 func (d *genericDataFeed) maybeFetchNextGeneratedData() {
-	if v := d.dataFeedHooksControl.PossibleOneNewValue(); v != nil {
+	// the hooks may generate several values at once, e.g. the HOUR and
+	// the DAY bars at the end of a day
+	for v := d.dataFeedHooksControl.PossibleOneNewValue(); v != nil; v = d.dataFeedHooksControl.PossibleOneNewValue() {
 		d.pendingData = append(d.pendingData, v)
 	}
 }
@@ -258,19 +282,22 @@ func (d *genericDataFeed) Dispatch() bool {
 	var err error
 	var isRecovery bool
 
-	if t, v, f, err = d.feedGenerator.PopNextValues(); err != nil {
-		return false
-	}
-
 	// we may need to read data from recovery db
 	d.maybeFetchNextRecoveryData()
 	// we may need to read data from feed hooks
 	d.maybeFetchNextGeneratedData()
-
-	if d.recoveryDB != nil {
-		isRecovery = true
-	} else {
-		isRecovery = false
+	isRecovery = d.recoveryDB != nil
+
+	// the generated values go first, the values of the generator are read
+	// once they are dispatched
+	if isRecovery || len(d.pendingData) == 0 {
+		if t, v, f, err = d.feedGenerator.PopNextValues(); err != nil {
+			if len(d.pendingData) == 0 {
+				return false
+			}
+			// the generator is complete, dispatch the pending values
+			v = nil
+		}
 	}
 
 	for {
@@ -307,7 +334,9 @@ func (d *genericDataFeed) Dispatch() bool {
 				d.lastDispatchedTime[f] = t
 			}
 
-			// fmt.Printf("%s %s %s\n", t, f, v)
+			if d.cfg.CorporateActions.Adjusted {
+				v = adjustedValues(v)
+			}
 			d.dataFeedHooksControl.FilterNewValue(&PendingDataFeedValue{
 				t: t,
 				v: v,
@@ -330,10 +359,27 @@ func (d *genericDataFeed) Dispatch() bool {
 	}
 }
 
+// adjustedValues returns copies of the bars of values which use their
+// adjusted values, the bars of the generators may be shared by several feeds
+func adjustedValues(values map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if bar, ok := v.(*BasicBarData); ok {
+			adjusted := *bar
+			adjusted.UseAdjustedV = true
+			v = &adjusted
+		} else if bar, ok := v.(Bar); ok {
+			bar.SetUseAdjustedValue(true)
+		}
+		res[k] = v
+	}
+	return res
+}
+
 // Eof implements DataFeed
 func (d *genericDataFeed) Eof() bool {
 	// logger.Logger.Debug("feed eof", zap.Bool("eof", d.eof))
-	return d.feedGenerator.IsComplete()
+	return d.feedGenerator.IsComplete() && len(d.pendingData) == 0
 }
 
 // Join implements DataFeed
@@ -345,6 +391,11 @@ func (d *genericDataFeed) Join() error {
 func (d *genericDataFeed) PeekDateTime() *time.Time {
 	// NOTE: we need to read data
 	d.maybeFetchNextRecoveryData()
+	if len(d.pendingData) == 0 && d.recoveryDB == nil && d.feedGenerator.PeekNextTime() == nil {
+		// the hooks may generate values without a new value of the
+		// generator, e.g. at the end of a period of a live feed
+		d.maybeFetchNextGeneratedData()
+	}
 	if len(d.pendingData) != 0 {
 		// we have data from the recovery database, use it
 		return &d.pendingData[0].t
@@ -352,6 +403,30 @@ func (d *genericDataFeed) PeekDateTime() *time.Time {
 	return d.feedGenerator.PeekNextTime()
 }
 
+// SetWakeupFunc implements Waker, the generator of the feed wakes the
+// dispatcher up when it has new values
+func (d *genericDataFeed) SetWakeupFunc(wakeup func()) {
+	if waker, ok := d.feedGenerator.(Waker); ok {
+		waker.SetWakeupFunc(wakeup)
+	}
+}
+
+// SetClock implements ClockUser, the clock is passed to the hooks
+func (d *genericDataFeed) SetClock(clock Clock) {
+	if user, ok := d.dataFeedHooksControl.(ClockUser); ok {
+		user.SetClock(clock)
+	}
+}
+
+// NextWakeupTime implements WakeupTimer, the hooks generate their values at
+// a time of the clock
+func (d *genericDataFeed) NextWakeupTime() *time.Time {
+	if timer, ok := d.dataFeedHooksControl.(WakeupTimer); ok {
+		return timer.NextWakeupTime()
+	}
+	return nil
+}
+
 // Start implements DataFeed
 func (d *genericDataFeed) Start() error {
 	return nil
@@ -374,6 +449,7 @@ func NewGenericDataFeed(ctx context.Context, cfg *config.Config, fg FeedGenerato
 ) DataFeed {
 	var recDB *db.DB
 	var recCount int64
+	var recBar *progressBar.ProgressBar
 	var err error
 	if recoveryDB != "" {
 		logger.Logger.Debug("recovery mode is enabled", zap.String("db", recoveryDB))
@@ -382,11 +458,14 @@ func NewGenericDataFeed(ctx context.Context, cfg *config.Config, fg FeedGenerato
 			panic(err)
 		}
 		recCount = recDB.FetchAll(true)
+		// the bar is only used while the recovery database is replayed
+		recBar = progressBar.Default(recCount)
 	}
 	if hooksCtrl == nil {
-		// default hooks
-		hooksCtrl = NewDataFeedValueHookControl()
-		hooksCtrl.AddNewHook(NewDayBarGenHook())
+		// default hooks, the DAY bars unless cfg.Resample is set
+		if hooksCtrl, err = NewResampleHooksControl(cfg, []Frequency{DAY}); err != nil {
+			panic(err)
+		}
 	}
 	df := &genericDataFeed{
 		ctx:                  ctx,
@@ -396,7 +475,7 @@ func NewGenericDataFeed(ctx context.Context, cfg *config.Config, fg FeedGenerato
 		recoveryDB:           recDB,
 		recoveryCount:        recCount,
 		recoveryProgress:     0,
-		recoveryBar:          progressBar.Default(recCount),
+		recoveryBar:          recBar,
 		pendingData:          []*PendingDataFeedValue{},
 		dataFeedHooksControl: hooksCtrl,
 		lastDispatchedTime:   map[Frequency]time.Time{},
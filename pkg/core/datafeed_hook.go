@@ -1,13 +1,6 @@
 package core
 
-import (
-	"fmt"
-	"time"
-
-	"goat/pkg/logger"
-
-	"go.uber.org/zap"
-)
+import "time"
 
 type DataFeedHooksControl interface {
 	FilterNewValue(value *PendingDataFeedValue, isRecovery bool)
@@ -47,107 +40,39 @@ func (d *dataFeedHookControl) AddNewHook(hook DataFeedHook) {
 	d.hooks = append(d.hooks, hook)
 }
 
-type DataFeedHook interface {
-	Invoke(value *PendingDataFeedValue, isRecovery bool)
-	MayHaveNewValue() *PendingDataFeedValue
-}
-
-type dataFeedHook struct {
-	dayBarMap         map[string]Bar
-	lastGeneratedTime *time.Time
-	startTime         *time.Time
-	stopTime          *time.Time
-}
-
-func NewDayBarGenHook() DataFeedHook {
-	return &dataFeedHook{
-		dayBarMap:         make(map[string]Bar),
-		lastGeneratedTime: nil,
-		startTime:         nil,
-		stopTime:          nil,
-	}
-}
-
-func (d *dataFeedHook) timeToGenDayBar() bool {
-	if d.startTime == nil {
-		return false
-	}
-	if time.Now().UTC().After(*d.stopTime) {
-		return true
+// SetClock implements ClockUser, the clock is passed to the hooks
+func (d *dataFeedHookControl) SetClock(clock Clock) {
+	for _, h := range d.hooks {
+		if user, ok := h.(ClockUser); ok {
+			user.SetClock(clock)
+		}
 	}
-	return false
 }
 
-func (d *dataFeedHook) MayHaveNewValue() *PendingDataFeedValue {
-	if d.timeToGenDayBar() {
-		var newDayBar PendingDataFeedValue
-		newDayBar.f = DAY
-		newDayBar.v = map[string]interface{}{}
-		for k, v := range d.dayBarMap {
-			newDayBar.v[k] = v
+// NextWakeupTime implements WakeupTimer, it returns the first time of the
+// hooks
+func (d *dataFeedHookControl) NextWakeupTime() *time.Time {
+	var res *time.Time
+	for _, h := range d.hooks {
+		timer, ok := h.(WakeupTimer)
+		if !ok {
+			continue
 		}
-		newDayBar.t = time.Date(d.startTime.Year(), d.startTime.Month(),
-			d.startTime.Day(),
-			0, 0, 0, 0, time.UTC)
-		barData := fmt.Sprintf("newDayBar: %+v, starttime %+v, stoptime %+v\n",
-			newDayBar, d.startTime, d.stopTime)
-		d.startTime = nil
-		d.stopTime = nil
-		d.dayBarMap = make(map[string]Bar)
-		// do not generate bar if there is already a bar generated on that day
-		if d.lastGeneratedTime != nil && !d.lastGeneratedTime.Before(newDayBar.t) {
-			return nil
+		if t := timer.NextWakeupTime(); t != nil && (res == nil || t.Before(*res)) {
+			res = t
 		}
-		d.lastGeneratedTime = &newDayBar.t
-		logger.Logger.Info("new day bar generated", zap.Time("newDayBar.t", newDayBar.t), zap.String("barData", barData))
-		return &newDayBar
 	}
-	return nil
+	return res
 }
 
-// Invoke implements DataFeedHook
-func (d *dataFeedHook) Invoke(value *PendingDataFeedValue, isRecovery bool) {
-	if isRecovery {
-		y, m, d := time.Now().UTC().Date()
-		y2, m2, d2 := value.t.UTC().Date()
-		if !(y == y2 && m == m2 && d == d2) {
-			return
-		}
-		// lets continue if it is the same day
-	}
-	if !(value.f >= REALTIME && value.f < DAY) {
-		// we don't care about other data frequencies
-		return
-	}
-	if d.startTime == nil {
-		// fmt.Printf("startTime: %+v\n", value.t)
-		startTime := value.t.UTC()
-		d.startTime = &startTime
-		// set the stop time
-		stopTime := time.Date(d.startTime.Year(), d.startTime.Month(), d.startTime.Day(),
-			23, 59, 59, 0, time.UTC)
-		d.stopTime = &stopTime
-	}
-	for k, v := range value.v {
-		if d.dayBarMap[k] == nil {
-			bar := v.(Bar)
-			tmDay := time.Date(value.t.UTC().Year(), value.t.UTC().Month(), value.t.UTC().Day(),
-				0, 0, 0, 0, time.UTC)
-			d.dayBarMap[k] = NewBasicBar(tmDay,
-				bar.Open(), bar.High(), bar.Low(), bar.Close(),
-				bar.AdjClose(), bar.Volume(), DAY)
-		} else {
-			bar := v.(Bar)
-			if bar.Close() > d.dayBarMap[k].High() {
-				d.dayBarMap[k] = NewBasicBar(d.dayBarMap[k].DateTime(),
-					d.dayBarMap[k].Open(), bar.Close(), d.dayBarMap[k].Low(), bar.Close(),
-					d.dayBarMap[k].AdjClose(), d.dayBarMap[k].Volume(), d.dayBarMap[k].Frequency())
-			}
-			if bar.Close() < d.dayBarMap[k].Low() {
-				d.dayBarMap[k] = NewBasicBar(d.dayBarMap[k].DateTime(),
-					d.dayBarMap[k].Open(), d.dayBarMap[k].High(), bar.Close(), bar.Close(),
-					d.dayBarMap[k].AdjClose(), d.dayBarMap[k].Volume(), d.dayBarMap[k].Frequency())
-			}
-		}
-	}
+type DataFeedHook interface {
+	Invoke(value *PendingDataFeedValue, isRecovery bool)
+	MayHaveNewValue() *PendingDataFeedValue
+}
+
+// NewDayBarGenHook generates the DAY bars of the sessions of calendar from
+// the intraday bars, the days are from midnight UTC if calendar is nil
+func NewDayBarGenHook(calendar TradingCalendar) DataFeedHook {
+	hook, _ := NewResampleHook(DAY, calendar)
+	return hook
 }
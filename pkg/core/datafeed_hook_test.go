@@ -15,7 +15,7 @@ func almostEqual(a, b float64) bool {
 
 func TestHookSimple(t *testing.T) {
 	ctrl := NewDataFeedValueHookControl()
-	ctrl.AddNewHook(NewDayBarGenHook())
+	ctrl.AddNewHook(NewDayBarGenHook(nil))
 
 	barData := NewBasicBar(time.Now().UTC(),
 		1.0, 1.0, 1.0, 1.0, 1.0, 0, REALTIME)
@@ -37,7 +37,7 @@ func TestHookSimple(t *testing.T) {
 
 func TestHookSimple2(t *testing.T) {
 	ctrl := NewDataFeedValueHookControl()
-	ctrl.AddNewHook(NewDayBarGenHook())
+	ctrl.AddNewHook(NewDayBarGenHook(nil))
 	tm := time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
 
 	barData := NewBasicBar(tm,
@@ -65,7 +65,7 @@ func TestHookSimple2(t *testing.T) {
 
 func TestHookVerify(t *testing.T) {
 	ctrl := NewDataFeedValueHookControl()
-	ctrl.AddNewHook(NewDayBarGenHook())
+	ctrl.AddNewHook(NewDayBarGenHook(nil))
 
 	for i := 1; i < 10; i++ {
 		tm := time.Date(2016, time.January, 1, i, 0, 0, 0, time.UTC)
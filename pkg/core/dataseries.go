@@ -189,7 +189,9 @@ func (b *barDataSeries) Append(values interface{}) error {
 // AppendWithDateTime implements BarDataSeries
 func (b *barDataSeries) AppendWithDateTime(timeVal time.Time, values interface{}) error {
 	bar := values.(Bar)
-	bar.SetUseAdjustedValue(b.useAdjValues)
+	if b.useAdjValues {
+		bar.SetUseAdjustedValue(true)
+	}
 	b.sequenceDataSeries.AppendWithDateTime(timeVal, bar)
 
 	b.open.AppendWithDateTime(timeVal, bar.Open())
@@ -22,7 +22,24 @@ type Subject interface {
 	PeekDateTime() *time.Time // it can be nil if no data is available
 }
 
-// Dispatcher interface
+// Waker is implemented by the subjects and the feed generators which can
+// tell when they have new values, e.g. when a live bar is received, so that
+// the dispatcher waits for them instead of polling
+type Waker interface {
+	// SetWakeupFunc sets the function to call when there is something new
+	// to dispatch, it must not block
+	SetWakeupFunc(wakeup func())
+}
+
+// WakeupTimer is implemented by the subjects which have new values at a
+// time of the clock without a wakeup, e.g. the bars resampled at the end of
+// their period, the dispatcher of a live clock waits until that time
+type WakeupTimer interface {
+	// NextWakeupTime returns nil if there is no such time
+	NextWakeupTime() *time.Time
+}
+
+// Dispatcher interface, the clock of a new dispatcher is a simulated one
 type Dispatcher interface {
 	AddSubject(subject Subject)
 	Run()
@@ -30,6 +47,13 @@ type Dispatcher interface {
 	GetSubjects() []Subject
 	GetStartEvent() Event
 	GetIdleEvent() Event
+	// SetClock replaces the clock of the dispatcher, it must be called
+	// before Run
+	SetClock(clock Clock)
+	GetClock() Clock
+	// GetScheduler returns the timers which are fired by the dispatcher on
+	// its clock
+	GetScheduler() Scheduler
 }
 
 // EventHandler interface
@@ -51,6 +75,54 @@ type dispatcher struct {
 	startEvent Event
 	idleEvent  Event
 	lastTime   time.Time
+	// wakeC is signaled by the subjects which have new values
+	wakeC     chan struct{}
+	clock     Clock
+	scheduler *scheduler
+}
+
+// SetClock implements Dispatcher
+func (d *dispatcher) SetClock(clock Clock) {
+	d.clock = clock
+	d.scheduler.clock = clock
+}
+
+// GetScheduler implements Dispatcher
+func (d *dispatcher) GetScheduler() Scheduler {
+	return d.scheduler
+}
+
+// fireTimers calls the timers which are due before the values at next of
+// the subjects in a backtest, or at the wall time in live trading
+func (d *dispatcher) fireTimers(next *time.Time) bool {
+	clock, simulated := d.clock.(SimulatedClock)
+	var now time.Time
+	if simulated {
+		if next == nil {
+			return false
+		}
+		now = *next
+		d.scheduler.start(now)
+	} else {
+		now = d.clock.Now()
+	}
+	fired := false
+	for {
+		t, fn := d.scheduler.popDue(now)
+		if fn == nil {
+			return fired
+		}
+		if simulated {
+			clock.Advance(t)
+		}
+		fn()
+		fired = true
+	}
+}
+
+// GetClock implements Dispatcher
+func (d *dispatcher) GetClock() Clock {
+	return d.clock
 }
 
 // GetIdleEvent implements Dispatcher
@@ -97,6 +169,10 @@ func (d *dispatcher) dispatch() (eof bool, dispatched bool) {
 		}
 	}
 
+	if !eof && d.fireTimers(smallestNewTime) {
+		dispatched = true
+	}
+
 	if smallestNewTime == nil {
 		// we dont have any data yet
 		return
@@ -105,6 +181,9 @@ func (d *dispatcher) dispatch() (eof bool, dispatched bool) {
 	if !eof {
 		if smallestNewTime != nil {
 			d.lastTime = *smallestNewTime
+			if clock, ok := d.clock.(SimulatedClock); ok {
+				clock.Advance(d.lastTime)
+			}
 		}
 		for _, subject := range d.subjects {
 			if d.dispatchSubject(subject, *smallestNewTime) {
@@ -115,7 +194,38 @@ func (d *dispatcher) dispatch() (eof bool, dispatched bool) {
 	return
 }
 
+// wakeup signals the dispatcher without blocking, a pending signal is
+// enough to dispatch all the new values
+func (d *dispatcher) wakeup() {
+	select {
+	case d.wakeC <- struct{}{}:
+	default:
+	}
+}
+
+func (d *dispatcher) stopSubjects() {
+	for _, subject := range d.subjects {
+		subject.Stop()
+	}
+	for _, subject := range d.subjects {
+		subject.Join()
+	}
+	close(d.stopC)
+}
+
 func (d *dispatcher) Run() {
+	d.scheduler.SetWakeupFunc(d.wakeup)
+	if _, ok := d.clock.(SimulatedClock); !ok {
+		d.scheduler.start(d.clock.Now())
+	}
+	for _, subject := range d.subjects {
+		if waker, ok := subject.(Waker); ok {
+			waker.SetWakeupFunc(d.wakeup)
+		}
+		if user, ok := subject.(ClockUser); ok {
+			user.SetClock(d.clock)
+		}
+	}
 	for _, subject := range d.subjects {
 		subject.Start()
 	}
@@ -124,35 +234,99 @@ func (d *dispatcher) Run() {
 	for {
 		select {
 		case <-d.stopC:
-			for _, subject := range d.subjects {
-				subject.Stop()
-			}
-			for _, subject := range d.subjects {
-				subject.Join()
-			}
-			close(d.stopC)
+			d.stopSubjects()
 			return
 		case <-d.ctx.Done():
-			for _, subject := range d.subjects {
-				subject.Stop()
-			}
-			for _, subject := range d.subjects {
-				subject.Join()
-			}
-			close(d.stopC)
+			d.stopSubjects()
 			return
 		default:
-			if eof, dispatched := d.dispatch(); eof {
-				d.Stop()
-			} else {
-				if !dispatched {
-					d.idleEvent.Emit()
-				}
-			}
+		}
+
+		eof, dispatched := d.dispatch()
+		if eof {
+			d.Stop()
+			continue
+		}
+		if dispatched {
+			continue
+		}
+		// the idle handlers may submit orders, the brokers which have new
+		// events are dispatched without waiting
+		pending := d.eofSubjects()
+		d.idleEvent.Emit()
+		if d.hasNewEvents(pending) {
+			continue
+		}
+
+		// nothing to dispatch, wait for a subject to wake us up or for the
+		// next timer of a live clock
+		var timer *time.Timer
+		var deadline <-chan time.Time
+		if next, ok := d.nextTimer(); ok {
+			timer = time.NewTimer(next.Sub(d.clock.Now()))
+			deadline = timer.C
+		}
+		stopped := false
+		select {
+		case <-d.stopC:
+			stopped = true
+		case <-d.ctx.Done():
+			stopped = true
+		case <-d.wakeC:
+		case <-deadline:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if stopped {
+			d.stopSubjects()
+			return
 		}
 	}
 }
 
+// nextTimer returns the time of the next timer or subject wakeup of a live
+// clock, the timers of a simulated clock fire at the times of the values of
+// the subjects
+func (d *dispatcher) nextTimer() (time.Time, bool) {
+	if _, ok := d.clock.(SimulatedClock); ok {
+		return time.Time{}, false
+	}
+	res, ok := d.scheduler.nextDue()
+	for _, subject := range d.subjects {
+		timer, isTimer := subject.(WakeupTimer)
+		if !isTimer {
+			continue
+		}
+		if t := timer.NextWakeupTime(); t != nil && (!ok || t.Before(res)) {
+			res, ok = *t, true
+		}
+	}
+	return res, ok
+}
+
+// eofSubjects returns the subjects which have nothing to dispatch
+func (d *dispatcher) eofSubjects() map[Subject]bool {
+	res := map[Subject]bool{}
+	for _, subject := range d.subjects {
+		if subject.Eof() {
+			res[subject] = true
+		}
+	}
+	return res
+}
+
+// hasNewEvents returns true if one of the subjects of eof has something to
+// dispatch now
+func (d *dispatcher) hasNewEvents(eof map[Subject]bool) bool {
+	for subject := range eof {
+		if !subject.Eof() {
+			return true
+		}
+	}
+	return false
+}
+
 func (d *dispatcher) Stop() {
 	logger.Logger.Debug("dispatcher stopped")
 	d.stopCMutex.Lock()
@@ -169,6 +343,7 @@ func (d *dispatcher) GetSubjects() []Subject {
 }
 
 func NewDispatcher(ctx context.Context) Dispatcher {
+	clock := NewSimulatedClock()
 	return &dispatcher{
 		ctx:        ctx,
 		stopC:      make(chan struct{}, 2),
@@ -176,6 +351,9 @@ func NewDispatcher(ctx context.Context) Dispatcher {
 		startEvent: NewEvent(),
 		idleEvent:  NewEvent(),
 		isStopped:  false,
+		wakeC:      make(chan struct{}, 1),
+		clock:      clock,
+		scheduler:  newScheduler(clock),
 	}
 }
 
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"testing"
 	"time"
+
+	"goat/pkg/config"
 )
 
 func TestSimpleDispatcher(t *testing.T) {
@@ -15,3 +17,125 @@ func TestSimpleDispatcher(t *testing.T) {
 	fmt.Println("stop dispatcher")
 	d.Stop()
 }
+
+func TestDispatcherWakeup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gen := NewBarFeedGenerator([]Frequency{DAY}, 100)
+	feed := NewGenericDataFeed(ctx, &config.Config{}, gen, nil, 100, "")
+	bars := make(chan time.Time, 1)
+	feed.GetNewValueEvent().Subscribe(func(args ...interface{}) error {
+		bars <- args[0].(time.Time)
+		return nil
+	})
+	d := NewDispatcher(ctx)
+	d.AddSubject(feed)
+	idle := 0
+	d.GetIdleEvent().Subscribe(func(args ...interface{}) error {
+		idle++
+		return nil
+	})
+	done := make(chan struct{})
+	go func() {
+		d.Run()
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	gen.AppendNewValueToBuffer(tm, map[string]interface{}{
+		"GLD": NewBasicBar(tm, 1, 1, 1, 1, 1, 1, DAY),
+	}, DAY)
+	select {
+	case v := <-bars:
+		if !v.Equal(tm) {
+			t.Error("unexpected bar", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the new bar should wake the dispatcher up")
+	}
+
+	gen.Finish()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the dispatcher should stop at the end of the feed")
+	}
+	// the dispatcher waits between the idle events instead of spinning
+	if idle == 0 || idle > 50 {
+		t.Error("unexpected idle events", idle)
+	}
+}
+
+// testTimedHook generates one value at a time of the clock
+type testTimedHook struct {
+	at    time.Time
+	done  bool
+	clock Clock
+}
+
+func (h *testTimedHook) SetClock(clock Clock) { h.clock = clock }
+
+func (h *testTimedHook) Invoke(value *PendingDataFeedValue, isRecovery bool) {}
+
+func (h *testTimedHook) NextWakeupTime() *time.Time {
+	if h.done {
+		return nil
+	}
+	return &h.at
+}
+
+func (h *testTimedHook) MayHaveNewValue() *PendingDataFeedValue {
+	if h.done || clockNow(h.clock).Before(h.at) {
+		return nil
+	}
+	h.done = true
+	return &PendingDataFeedValue{
+		t: h.at,
+		f: DAY,
+		v: map[string]interface{}{"GLD": NewBasicBar(h.at, 1, 1, 1, 1, 1, 1, DAY)},
+	}
+}
+
+func TestDispatcherWakeupTime(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hook := &testTimedHook{at: time.Now().Add(200 * time.Millisecond)}
+	ctrl := NewDataFeedValueHookControl()
+	ctrl.AddNewHook(hook)
+	gen := NewBarFeedGenerator([]Frequency{MINUTE}, 100)
+	feed := NewGenericDataFeed(ctx, &config.Config{}, gen, ctrl, 100, "")
+	bars := make(chan time.Time, 1)
+	feed.GetNewValueEvent().Subscribe(func(args ...interface{}) error {
+		bars <- time.Now()
+		return nil
+	})
+	d := NewDispatcher(ctx)
+	d.SetClock(NewWallClock())
+	d.AddSubject(feed)
+	idle := 0
+	d.GetIdleEvent().Subscribe(func(args ...interface{}) error {
+		idle++
+		return nil
+	})
+	done := make(chan struct{})
+	go func() {
+		d.Run()
+		close(done)
+	}()
+
+	select {
+	case tm := <-bars:
+		if tm.Before(hook.at) {
+			t.Error("the value should be generated at the time of the hook", tm)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the dispatcher should wake up at the time of the hook")
+	}
+	cancel()
+	<-done
+	// the dispatcher blocks between the wakeups instead of polling
+	if idle > 3 {
+		t.Error("unexpected idle events", idle)
+	}
+}
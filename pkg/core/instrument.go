@@ -0,0 +1,185 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"goat/pkg/config"
+)
+
+// Instrument is the metadata of a traded symbol
+type Instrument struct {
+	Symbol       string  `json:"symbol"`
+	AssetClass   string  `json:"assetClass"`
+	Currency     string  `json:"currency"`
+	TickSize     float64 `json:"tickSize"`
+	LotSize      float64 `json:"lotSize"`
+	Multiplier   float64 `json:"multiplier"`
+	TradingHours string  `json:"tradingHours"`
+	Timezone     string  `json:"timezone"`
+}
+
+// defaultInstrument is used for the symbols which are not registered
+func defaultInstrument(symbol string) *Instrument {
+	return &Instrument{Symbol: symbol, Multiplier: 1}
+}
+
+// RoundPrice rounds price to the nearest tick
+func (i *Instrument) RoundPrice(price float64) float64 {
+	if i.TickSize <= 0 {
+		return price
+	}
+	return roundFloat(math.Round(price/i.TickSize) * i.TickSize)
+}
+
+// RoundQuantity rounds quantity down to a multiple of the lot size
+func (i *Instrument) RoundQuantity(quantity float64) float64 {
+	if i.LotSize <= 0 {
+		return quantity
+	}
+	return roundFloat(math.Floor(quantity/i.LotSize+1e-9) * i.LotSize)
+}
+
+// GetMultiplier returns the contract multiplier, 1 if it is not set
+func (i *Instrument) GetMultiplier() float64 {
+	if i.Multiplier <= 0 {
+		return 1
+	}
+	return i.Multiplier
+}
+
+// roundFloat removes the binary noise of tick and lot multiplications
+func roundFloat(v float64) float64 {
+	return math.Round(v*1e9) / 1e9
+}
+
+// InstrumentRegistry keeps the metadata of the traded symbols
+type InstrumentRegistry interface {
+	// GetInstrument returns nil if symbol is not registered
+	GetInstrument(symbol string) *Instrument
+	GetSymbols() []string
+}
+
+// InstrumentProvider is implemented by the brokers which know the
+// instruments they trade
+type InstrumentProvider interface {
+	// GetInstrument returns the registered instrument or the default
+	// instrument of symbol
+	GetInstrument(symbol string) *Instrument
+}
+
+type instrumentRegistry struct {
+	instruments map[string]*Instrument // by lowercase symbol
+}
+
+// NewInstrumentRegistry creates a registry of instruments, the symbols are
+// case-insensitive
+func NewInstrumentRegistry(instruments ...*Instrument) InstrumentRegistry {
+	r := &instrumentRegistry{
+		instruments: map[string]*Instrument{},
+	}
+	for _, i := range instruments {
+		r.instruments[strings.ToLower(i.Symbol)] = i
+	}
+	return r
+}
+
+// NewInstrumentRegistryFromConfig loads the instruments of
+// cfg.InstrumentsFile, then the instruments of cfg.Instruments. The symbols
+// are matched case-insensitively as viper lowercases the keys of
+// cfg.Instruments.
+func NewInstrumentRegistryFromConfig(cfg *config.Config) (InstrumentRegistry, error) {
+	configs := map[string]config.InstrumentConfig{}
+	symbols := map[string]string{}
+	add := func(symbol string, c config.InstrumentConfig) {
+		key := strings.ToLower(symbol)
+		if _, ok := symbols[key]; !ok {
+			// keep the case of the instruments file
+			symbols[key] = symbol
+		}
+		configs[key] = c
+	}
+	if cfg.InstrumentsFile != "" {
+		data, err := ioutil.ReadFile(cfg.InstrumentsFile)
+		if err != nil {
+			return nil, err
+		}
+		file := map[string]config.InstrumentConfig{}
+		// json keys match the field names case-insensitively, e.g. tickSize
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("invalid instruments file %s: %v", cfg.InstrumentsFile, err)
+		}
+		for symbol, c := range file {
+			add(symbol, c)
+		}
+	}
+	for symbol, c := range cfg.Instruments {
+		add(symbol, c)
+	}
+
+	instruments := make([]*Instrument, 0, len(configs))
+	for key, c := range configs {
+		symbol := symbols[key]
+		i := &Instrument{
+			Symbol:       symbol,
+			AssetClass:   c.AssetClass,
+			Currency:     c.Currency,
+			TickSize:     c.TickSize,
+			LotSize:      c.LotSize,
+			Multiplier:   c.Multiplier,
+			TradingHours: c.TradingHours,
+			Timezone:     c.Timezone,
+		}
+		if err := i.validate(); err != nil {
+			return nil, fmt.Errorf("instrument %s: %v", symbol, err)
+		}
+		if i.Multiplier == 0 {
+			i.Multiplier = 1
+		}
+		instruments = append(instruments, i)
+	}
+	return NewInstrumentRegistry(instruments...), nil
+}
+
+func (i *Instrument) validate() error {
+	if i.TickSize < 0 || i.LotSize < 0 || i.Multiplier < 0 {
+		return fmt.Errorf("tick size, lot size and multiplier should not be negative")
+	}
+	if i.Timezone != "" {
+		if _, err := time.LoadLocation(i.Timezone); err != nil {
+			return err
+		}
+	}
+	if i.TradingHours != "" {
+		if _, _, err := parseTradingHours(i.TradingHours); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetInstrument implements InstrumentRegistry, the returned instrument has
+// the case of symbol
+func (r *instrumentRegistry) GetInstrument(symbol string) *Instrument {
+	if i, ok := r.instruments[strings.ToLower(symbol)]; ok {
+		res := *i
+		res.Symbol = symbol
+		return &res
+	}
+	return nil
+}
+
+// GetSymbols implements InstrumentRegistry
+func (r *instrumentRegistry) GetSymbols() []string {
+	res := make([]string, 0, len(r.instruments))
+	for _, i := range r.instruments {
+		res = append(res, i.Symbol)
+	}
+	sort.Strings(res)
+	return res
+}
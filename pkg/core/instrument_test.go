@@ -0,0 +1,155 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+
+	"github.com/spf13/viper"
+)
+
+// loadTestConfig loads a json config the way cmd does, viper lowercases the
+// keys of the maps
+func loadTestConfig(t *testing.T, data string) *config.Config {
+	file := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{}
+	if err := v.Unmarshal(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestInstrumentRounding(t *testing.T) {
+	i := &Instrument{Symbol: "ES", TickSize: 0.25, LotSize: 1}
+	if p := i.RoundPrice(4001.13); p != 4001.25 {
+		t.Error("unexpected price", p)
+	}
+	if q := i.RoundQuantity(2.99); q != 2 {
+		t.Error("unexpected quantity", q)
+	}
+	i = &Instrument{Symbol: "EURUSD", TickSize: 0.0001, LotSize: 0.01}
+	if p := i.RoundPrice(1.123456); p != 1.1235 {
+		t.Error("unexpected price", p)
+	}
+	if q := i.RoundQuantity(0.3); q != 0.3 {
+		t.Error("unexpected quantity", q)
+	}
+	if i.GetMultiplier() != 1 || defaultInstrument("GLD").RoundPrice(1.23456) != 1.23456 {
+		t.Error("unknown instruments should not be rounded")
+	}
+}
+
+func TestInstrumentRegistryFromConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "instruments.json")
+	data := `{
+		"ES": {"assetClass": "future", "currency": "USD", "tickSize": 0.25, "multiplier": 50,
+			"tradingHours": "09:30-16:00", "timezone": "America/New_York"},
+		"GLD": {"tickSize": 0.01}
+	}`
+	if err := ioutil.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		InstrumentsFile: file,
+		Instruments:     map[string]config.InstrumentConfig{"GLD": {TickSize: 0.05, LotSize: 10}},
+	}
+	registry, err := NewInstrumentRegistryFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if symbols := registry.GetSymbols(); len(symbols) != 2 || symbols[0] != "ES" {
+		t.Fatal("unexpected symbols", symbols)
+	}
+	es := registry.GetInstrument("ES")
+	if es.AssetClass != "future" || es.Multiplier != 50 || es.TickSize != 0.25 || es.Timezone != "America/New_York" {
+		t.Error("unexpected instrument", es)
+	}
+	if gld := registry.GetInstrument("GLD"); gld.TickSize != 0.05 || gld.LotSize != 10 || gld.Multiplier != 1 {
+		t.Error("the config should override the instruments file", gld)
+	}
+	if registry.GetInstrument("SLV") != nil {
+		t.Error("unknown instrument should be nil")
+	}
+
+	for _, c := range []config.InstrumentConfig{{TickSize: -1}, {Timezone: "Nowhere/City"}, {TradingHours: "9h-16h"}} {
+		cfg := &config.Config{Instruments: map[string]config.InstrumentConfig{"GLD": c}}
+		if _, err := NewInstrumentRegistryFromConfig(cfg); err == nil {
+			t.Error("invalid instrument should fail", c)
+		}
+	}
+}
+
+func TestInstrumentRegistryFromViper(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "instruments.json")
+	if err := ioutil.WriteFile(file, []byte(`{"ES": {"tickSize": 0.25}, "GLD": {"tickSize": 0.01}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := loadTestConfig(t, `{
+		"instrumentsFile": "`+file+`",
+		"instruments": {"GLD": {"tickSize": 0.05, "lotSize": 10}, "EURUSD": {"currency": "USD", "tickSize": 0.0001}}
+	}`)
+	registry, err := NewInstrumentRegistryFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if symbols := registry.GetSymbols(); fmt.Sprint(symbols) != "[ES GLD eurusd]" {
+		t.Error("unexpected symbols", symbols)
+	}
+	if gld := registry.GetInstrument("GLD"); gld == nil || gld.TickSize != 0.05 || gld.LotSize != 10 {
+		t.Error("the config should override the instruments file", gld)
+	}
+	if eur := registry.GetInstrument("EURUSD"); eur == nil || eur.Symbol != "EURUSD" || eur.TickSize != 0.0001 {
+		t.Error("the symbols should be case-insensitive", eur)
+	}
+}
+
+func TestBacktestBrokerInstruments(t *testing.T) {
+	cfg := &config.Config{
+		Instruments: map[string]config.InstrumentConfig{"GLD": {TickSize: 0.5, LotSize: 10, Multiplier: 10}},
+	}
+	cfg.Broker.Cash = 100000
+	gen := NewBarFeedGenerator([]Frequency{REALTIME, DAY}, 100)
+	feed := NewGenericDataFeed(context.TODO(), cfg, gen, nil, 100, "")
+	broker := newTestBroker(cfg, feed)
+	portfolio := NewPortfolio(broker, feed, 0)
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	if err := broker.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 5, false)); err == nil {
+		t.Fatal("order below the lot size should fail")
+	}
+	limit := NewLimitOrder(OrderActionBuy, "GLD", 100.2, 25)
+	if err := broker.SubmitOrder(limit); err != nil {
+		t.Fatal(err)
+	}
+	if limit.GetQuantity() != 20 || limit.GetLimitPrice() != 100 {
+		t.Fatal("order should be rounded", limit.GetQuantity(), limit.GetLimitPrice())
+	}
+	pushTestBar(feed, tm, 100, 101, 99, 100)
+	if !limit.IsFilled() || !almostEqual(broker.GetCash(), 80000) {
+		t.Fatal("cost should use the multiplier", limit, broker.GetCash())
+	}
+
+	pushTestBar(feed, tm.AddDate(0, 0, 1), 101, 101, 101, 101)
+	if pos := portfolio.GetPosition("GLD"); pos.Multiplier != 10 || !almostEqual(pos.UnrealizedPnL(), 200) ||
+		!almostEqual(portfolio.GetEquity(), 100200) {
+		t.Fatal("position should use the multiplier", pos, portfolio.GetEquity())
+	}
+	broker.SubmitOrder(NewMarketOrder(OrderActionSell, "GLD", 20, true))
+	pushTestBar(feed, tm.AddDate(0, 0, 2), 102, 102, 102, 102)
+	if !almostEqual(portfolio.GetRealizedPnL(), 400) || !almostEqual(broker.GetCash(), 100400) {
+		t.Fatal("unexpected realized pnl", portfolio.GetRealizedPnL(), broker.GetCash())
+	}
+}
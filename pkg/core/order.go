@@ -0,0 +1,436 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// OrderAction ...
+type OrderAction int
+
+const (
+	OrderActionBuy OrderAction = iota + 1
+	OrderActionSell
+)
+
+func (a OrderAction) String() string {
+	switch a {
+	case OrderActionBuy:
+		return "BUY"
+	case OrderActionSell:
+		return "SELL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// IsBuy returns true if the action increases the position
+func (a OrderAction) IsBuy() bool {
+	return a == OrderActionBuy
+}
+
+// OrderType ...
+type OrderType int
+
+const (
+	OrderTypeMarket OrderType = iota + 1
+	OrderTypeLimit
+	OrderTypeStop
+	OrderTypeStopLimit
+	OrderTypeTrailingStop
+)
+
+func (t OrderType) String() string {
+	switch t {
+	case OrderTypeMarket:
+		return "MARKET"
+	case OrderTypeLimit:
+		return "LIMIT"
+	case OrderTypeStop:
+		return "STOP"
+	case OrderTypeStopLimit:
+		return "STOP_LIMIT"
+	case OrderTypeTrailingStop:
+		return "TRAILING_STOP"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// OrderState ...
+type OrderState int
+
+const (
+	OrderStateInitial OrderState = iota + 1
+	OrderStateSubmitted
+	OrderStateAccepted
+	OrderStateCanceled
+	OrderStatePartiallyFilled
+	OrderStateFilled
+)
+
+func (s OrderState) String() string {
+	switch s {
+	case OrderStateInitial:
+		return "INITIAL"
+	case OrderStateSubmitted:
+		return "SUBMITTED"
+	case OrderStateAccepted:
+		return "ACCEPTED"
+	case OrderStateCanceled:
+		return "CANCELED"
+	case OrderStatePartiallyFilled:
+		return "PARTIALLY_FILLED"
+	case OrderStateFilled:
+		return "FILLED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// OrderExecutionInfo describes a single fill of an order
+type OrderExecutionInfo struct {
+	Price      float64   `json:"price"`
+	Quantity   float64   `json:"quantity"`
+	Commission float64   `json:"commission"`
+	DateTime   time.Time `json:"dateTime"`
+	// FXRate converts Price to the base currency of the account, 0 means 1.
+	// Commission is already in the base currency.
+	FXRate float64 `json:"fxRate,omitempty"`
+}
+
+// basePrice returns the fill price in the base currency of the account
+func (i *OrderExecutionInfo) basePrice() float64 {
+	if i.FXRate > 0 {
+		return i.Price * i.FXRate
+	}
+	return i.Price
+}
+
+type Order interface {
+	GetID() uint64
+	GetType() OrderType
+	GetAction() OrderAction
+	GetState() OrderState
+	GetInstrument() string
+	GetQuantity() float64
+	GetFilled() float64
+	GetRemaining() float64
+	GetAvgFillPrice() float64
+	GetCommission() float64
+	GetLimitPrice() float64
+	GetStopPrice() float64
+	GetFillOnClose() bool
+	// GetParentID returns the entry order of a bracket leg, it is 0 for
+	// other orders
+	GetParentID() uint64
+	// GetOCOGroup returns the one-cancels-other group of the order, it is 0
+	// if the order is not in a group
+	GetOCOGroup() uint64
+	GetSubmitDateTime() time.Time
+	GetExecutionInfo() *OrderExecutionInfo
+	IsActive() bool
+	IsFilled() bool
+	String() string
+}
+
+// BasicOrder is the order model used by the brokers in this package. The
+// fields are exported so that orders can be serialized and passed to scripts.
+type BasicOrder struct {
+	ID             uint64              `json:"id"`
+	Type           OrderType           `json:"type"`
+	Action         OrderAction         `json:"action"`
+	State          OrderState          `json:"state"`
+	Instrument     string              `json:"instrument"`
+	Quantity       float64             `json:"quantity"`
+	Filled         float64             `json:"filled"`
+	AvgFillPrice   float64             `json:"avgFillPrice"`
+	Commission     float64             `json:"commission"`
+	LimitPrice     float64             `json:"limitPrice"`
+	StopPrice      float64             `json:"stopPrice"`
+	StopHit        bool                `json:"stopHit"`
+	FillOnClose    bool                `json:"fillOnClose"`
+	SubmitDateTime time.Time           `json:"submitDateTime"`
+	ExecutionInfo  *OrderExecutionInfo `json:"executionInfo"`
+
+	ParentID uint64 `json:"parentId"`
+	OCOGroup uint64 `json:"ocoGroup"`
+
+	// trailing stops follow the highest high (sell) or the lowest low (buy)
+	// by TrailAmount, or by TrailATRMultiple times the average true range of
+	// the last TrailATRPeriod bars
+	TrailAmount      float64 `json:"trailAmount"`
+	TrailATRMultiple float64 `json:"trailAtrMultiple"`
+	TrailATRPeriod   int     `json:"trailAtrPeriod"`
+	TrailExtreme     float64 `json:"trailExtreme"`
+}
+
+// GetID implements Order
+func (o *BasicOrder) GetID() uint64 {
+	return o.ID
+}
+
+// GetType implements Order
+func (o *BasicOrder) GetType() OrderType {
+	return o.Type
+}
+
+// GetAction implements Order
+func (o *BasicOrder) GetAction() OrderAction {
+	return o.Action
+}
+
+// GetState implements Order
+func (o *BasicOrder) GetState() OrderState {
+	return o.State
+}
+
+// GetInstrument implements Order
+func (o *BasicOrder) GetInstrument() string {
+	return o.Instrument
+}
+
+// GetQuantity implements Order
+func (o *BasicOrder) GetQuantity() float64 {
+	return o.Quantity
+}
+
+// GetFilled implements Order
+func (o *BasicOrder) GetFilled() float64 {
+	return o.Filled
+}
+
+// GetRemaining implements Order
+func (o *BasicOrder) GetRemaining() float64 {
+	return o.Quantity - o.Filled
+}
+
+// GetAvgFillPrice implements Order
+func (o *BasicOrder) GetAvgFillPrice() float64 {
+	return o.AvgFillPrice
+}
+
+// GetCommission implements Order. It is the total commission of all fills.
+func (o *BasicOrder) GetCommission() float64 {
+	return o.Commission
+}
+
+// GetLimitPrice implements Order
+func (o *BasicOrder) GetLimitPrice() float64 {
+	return o.LimitPrice
+}
+
+// GetStopPrice implements Order
+func (o *BasicOrder) GetStopPrice() float64 {
+	return o.StopPrice
+}
+
+// GetFillOnClose implements Order
+func (o *BasicOrder) GetFillOnClose() bool {
+	return o.FillOnClose
+}
+
+// GetParentID implements Order
+func (o *BasicOrder) GetParentID() uint64 {
+	return o.ParentID
+}
+
+// GetOCOGroup implements Order
+func (o *BasicOrder) GetOCOGroup() uint64 {
+	return o.OCOGroup
+}
+
+// GetSubmitDateTime implements Order
+func (o *BasicOrder) GetSubmitDateTime() time.Time {
+	return o.SubmitDateTime
+}
+
+// GetExecutionInfo implements Order
+func (o *BasicOrder) GetExecutionInfo() *OrderExecutionInfo {
+	return o.ExecutionInfo
+}
+
+// IsActive implements Order
+func (o *BasicOrder) IsActive() bool {
+	return o.State != OrderStateCanceled && o.State != OrderStateFilled
+}
+
+// IsFilled implements Order
+func (o *BasicOrder) IsFilled() bool {
+	return o.State == OrderStateFilled
+}
+
+// String implements Order
+func (o *BasicOrder) String() string {
+	return fmt.Sprintf("order %d %s %s %s %f filled %f @ %f (%s)", o.ID, o.Action, o.Type,
+		o.Instrument, o.Quantity, o.Filled, o.AvgFillPrice, o.State)
+}
+
+func (o *BasicOrder) clone() *BasicOrder {
+	res := *o
+	if o.ExecutionInfo != nil {
+		info := *o.ExecutionInfo
+		res.ExecutionInfo = &info
+	}
+	return &res
+}
+
+func (o *BasicOrder) addExecution(info *OrderExecutionInfo) {
+	total := o.Filled + info.Quantity
+	o.AvgFillPrice = (o.AvgFillPrice*o.Filled + info.Price*info.Quantity) / total
+	o.Filled = total
+	o.Commission += info.Commission
+	o.ExecutionInfo = info
+	if o.GetRemaining() <= 0 {
+		o.State = OrderStateFilled
+	} else {
+		o.State = OrderStatePartiallyFilled
+	}
+}
+
+func newBasicOrder(orderType OrderType, action OrderAction, instrument string,
+	quantity float64,
+) *BasicOrder {
+	return &BasicOrder{
+		Type:       orderType,
+		Action:     action,
+		State:      OrderStateInitial,
+		Instrument: instrument,
+		Quantity:   quantity,
+	}
+}
+
+// NewMarketOrder creates a market order. If onClose is true the order is
+// filled at the close price of the next bar instead of its open price.
+func NewMarketOrder(action OrderAction, instrument string, quantity float64,
+	onClose bool,
+) Order {
+	o := newBasicOrder(OrderTypeMarket, action, instrument, quantity)
+	o.FillOnClose = onClose
+	return o
+}
+
+func NewLimitOrder(action OrderAction, instrument string, limitPrice float64,
+	quantity float64,
+) Order {
+	o := newBasicOrder(OrderTypeLimit, action, instrument, quantity)
+	o.LimitPrice = limitPrice
+	return o
+}
+
+func NewStopOrder(action OrderAction, instrument string, stopPrice float64,
+	quantity float64,
+) Order {
+	o := newBasicOrder(OrderTypeStop, action, instrument, quantity)
+	o.StopPrice = stopPrice
+	return o
+}
+
+func NewStopLimitOrder(action OrderAction, instrument string, stopPrice float64,
+	limitPrice float64, quantity float64,
+) Order {
+	o := newBasicOrder(OrderTypeStopLimit, action, instrument, quantity)
+	o.StopPrice = stopPrice
+	o.LimitPrice = limitPrice
+	return o
+}
+
+// NewTrailingStopOrder creates a stop order whose stop price follows the
+// market by trailAmount. The stop of a sell order trails the highest high
+// since the order was accepted, the stop of a buy order trails the lowest
+// low. The stop price only moves in the direction of the market.
+func NewTrailingStopOrder(action OrderAction, instrument string, trailAmount float64,
+	quantity float64,
+) Order {
+	o := newBasicOrder(OrderTypeTrailingStop, action, instrument, quantity)
+	o.TrailAmount = trailAmount
+	return o
+}
+
+// NewATRTrailingStopOrder creates a trailing stop order which trails the
+// market by multiple times the average true range of the last period bars.
+// The stop price is not set until there are enough bars to compute the
+// average true range.
+func NewATRTrailingStopOrder(action OrderAction, instrument string, multiple float64,
+	period int, quantity float64,
+) Order {
+	o := newBasicOrder(OrderTypeTrailingStop, action, instrument, quantity)
+	o.TrailATRMultiple = multiple
+	o.TrailATRPeriod = period
+	return o
+}
+
+// OrderEventType ...
+type OrderEventType int
+
+const (
+	OrderEventSubmitted OrderEventType = iota + 1
+	OrderEventAccepted
+	OrderEventCanceled
+	OrderEventPartiallyFilled
+	OrderEventFilled
+	// OrderEventReplaced is emitted when the quantity or the prices of an
+	// order are changed by the broker
+	OrderEventReplaced
+	// OrderEventRejected is emitted when an order is refused before it
+	// reaches the broker, e.g. by the risk manager
+	OrderEventRejected
+)
+
+func (t OrderEventType) String() string {
+	switch t {
+	case OrderEventSubmitted:
+		return "SUBMITTED"
+	case OrderEventAccepted:
+		return "ACCEPTED"
+	case OrderEventCanceled:
+		return "CANCELED"
+	case OrderEventPartiallyFilled:
+		return "PARTIALLY_FILLED"
+	case OrderEventFilled:
+		return "FILLED"
+	case OrderEventReplaced:
+		return "REPLACED"
+	case OrderEventRejected:
+		return "REJECTED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+type OrderEvent interface {
+	GetOrder() Order
+	GetEventType() OrderEventType
+	// GetEventInfo returns *OrderExecutionInfo for fills and the reason
+	// string for cancellations and rejections. It is nil otherwise.
+	GetEventInfo() interface{}
+}
+
+type orderEvent struct {
+	order     Order
+	eventType OrderEventType
+	eventInfo interface{}
+}
+
+// GetOrder implements OrderEvent
+func (e *orderEvent) GetOrder() Order {
+	return e.order
+}
+
+// GetEventType implements OrderEvent
+func (e *orderEvent) GetEventType() OrderEventType {
+	return e.eventType
+}
+
+// GetEventInfo implements OrderEvent
+func (e *orderEvent) GetEventInfo() interface{} {
+	return e.eventInfo
+}
+
+func NewOrderEvent(order Order, eventType OrderEventType, eventInfo interface{}) OrderEvent {
+	return &orderEvent{
+		order:     order,
+		eventType: eventType,
+		eventInfo: eventInfo,
+	}
+}
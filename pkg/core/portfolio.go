@@ -0,0 +1,375 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// PortfolioPosition is the holding of one instrument in a portfolio. The
+// prices, values and profits are in the base currency of the portfolio.
+type PortfolioPosition struct {
+	Instrument  string  `json:"instrument"`
+	Quantity    float64 `json:"quantity"`
+	AvgCost     float64 `json:"avgCost"`
+	LastPrice   float64 `json:"lastPrice"`
+	RealizedPnL float64 `json:"realizedPnL"` // net of commissions
+	Commission  float64 `json:"commission"`
+	// contract multiplier of the values and the profits, 0 means 1
+	Multiplier float64 `json:"multiplier"`
+	Currency   string  `json:"currency"`  // quote currency of the instrument
+	Dividends  float64 `json:"dividends"` // dividends included in the realized pnl
+}
+
+func (p *PortfolioPosition) multiplier() float64 {
+	if p.Multiplier <= 0 {
+		return 1
+	}
+	return p.Multiplier
+}
+
+// MarketValue returns the value of the position at the last price
+func (p *PortfolioPosition) MarketValue() float64 {
+	return p.Quantity * p.LastPrice * p.multiplier()
+}
+
+// UnrealizedPnL returns the profit of the position if it was closed at the
+// last price
+func (p *PortfolioPosition) UnrealizedPnL() float64 {
+	return (p.LastPrice - p.AvgCost) * p.Quantity * p.multiplier()
+}
+
+// addFill updates the position with a fill of a signed quantity
+func (pos *PortfolioPosition) addFill(quantity, price, commission float64) {
+	pos.LastPrice = price
+	pos.Commission += commission
+	pos.RealizedPnL -= commission
+
+	if pos.Quantity == 0 || (pos.Quantity > 0) == (quantity > 0) {
+		// opening or increasing the position
+		total := pos.Quantity + quantity
+		pos.AvgCost = (pos.AvgCost*pos.Quantity + price*quantity) / total
+		pos.Quantity = total
+		return
+	}
+
+	closed := math.Min(math.Abs(quantity), math.Abs(pos.Quantity))
+	if pos.Quantity > 0 {
+		pos.RealizedPnL += (price - pos.AvgCost) * closed * pos.multiplier()
+	} else {
+		pos.RealizedPnL += (pos.AvgCost - price) * closed * pos.multiplier()
+	}
+	pos.Quantity += quantity
+	if math.Abs(pos.Quantity) < positionEpsilon {
+		pos.Quantity = 0
+		pos.AvgCost = 0
+	} else if math.Abs(quantity) > closed {
+		// the position was reversed, the rest is opened at the fill price
+		pos.AvgCost = price
+	}
+}
+
+// Portfolio keeps track of the holdings of a broker. Positions are marked to
+// the latest bar of the data feed.
+type Portfolio interface {
+	GetCash() float64
+	GetEquity() float64
+	GetRealizedPnL() float64
+	GetUnrealizedPnL() float64
+	GetCommissions() float64
+	// GetBaseCurrency returns the currency of the values of the portfolio,
+	// an empty string if they are not converted
+	GetBaseCurrency() string
+
+	// GetPosition returns a copy of the position of instrument, or nil if
+	// the instrument was never traded.
+	GetPosition(instrument string) *PortfolioPosition
+	// GetPositions returns a copy of the open positions
+	GetPositions() map[string]*PortfolioPosition
+	// GetLastPrice returns the last price of instrument in the base currency,
+	// false if no bar or fx rate of instrument has been seen yet
+	GetLastPrice(instrument string) (float64, bool)
+
+	// GetEquityDataSeries returns the equity of the portfolio, a float64
+	// value is appended after each new bar.
+	GetEquityDataSeries() SequenceDataSeries
+}
+
+type portfolio struct {
+	mu        sync.Mutex
+	broker    Broker
+	positions map[string]*PortfolioPosition
+	equity    SequenceDataSeries
+	// instruments gives the multipliers of the positions, it is nil if the
+	// broker does not know its instruments
+	instruments InstrumentProvider
+	// fx converts the prices to the base currency, it is nil if the broker
+	// does not convert them
+	fx         CurrencyConverter
+	lastQuotes map[string]float64 // last prices in the quote currencies
+
+	// same as the backtest broker, only the finest bars of each instrument
+	// are used to mark positions.
+	barFrequency map[string]Frequency
+}
+
+// NewPortfolio creates a portfolio which follows the fills of broker and
+// marks positions with the bars of feed. It should be created before the
+// strategy controller so that the strategy sees an updated portfolio.
+// maxLen limits the length of the equity data series, 0 means no limit.
+func NewPortfolio(broker Broker, feed DataFeed, maxLen int) Portfolio {
+	p := &portfolio{
+		broker:       broker,
+		positions:    map[string]*PortfolioPosition{},
+		equity:       NewSequenceDataSeries(maxLen),
+		barFrequency: map[string]Frequency{},
+		lastQuotes:   map[string]float64{},
+	}
+	if instruments, ok := broker.(InstrumentProvider); ok {
+		p.instruments = instruments
+	}
+	if fx, ok := broker.(CurrencyConverter); ok && fx.GetBaseCurrency() != "" {
+		p.fx = fx
+	}
+	if history, ok := broker.(fillHistory); ok {
+		for _, fill := range history.getHistoricalFills() {
+			p.addFill(fill.Instrument, fill.Action, &fill.Info)
+		}
+		for k, v := range history.getHistoricalPrices() {
+			p.lastQuotes[k] = v
+		}
+		p.markPositions()
+	}
+	broker.GetOrderUpdatedEvent().Subscribe(p.onOrderEvent)
+	if actions, ok := broker.(CorporateActionHandler); ok {
+		actions.GetCorporateActionEvent().Subscribe(p.onCorporateAction)
+	}
+	feed.GetNewValueEvent().Subscribe(p.onBars)
+	return p
+}
+
+// GetCash implements Portfolio
+func (p *portfolio) GetCash() float64 {
+	return p.broker.GetCash()
+}
+
+// GetBaseCurrency implements Portfolio
+func (p *portfolio) GetBaseCurrency() string {
+	if p.fx == nil {
+		return ""
+	}
+	return p.fx.GetBaseCurrency()
+}
+
+// GetEquity implements Portfolio
+func (p *portfolio) GetEquity() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.equityLocked()
+}
+
+func (p *portfolio) equityLocked() float64 {
+	res := p.broker.GetCash()
+	for _, pos := range p.positions {
+		res += pos.MarketValue()
+	}
+	return res
+}
+
+// GetRealizedPnL implements Portfolio
+func (p *portfolio) GetRealizedPnL() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := 0.0
+	for _, pos := range p.positions {
+		res += pos.RealizedPnL
+	}
+	return res
+}
+
+// GetUnrealizedPnL implements Portfolio
+func (p *portfolio) GetUnrealizedPnL() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := 0.0
+	for _, pos := range p.positions {
+		res += pos.UnrealizedPnL()
+	}
+	return res
+}
+
+// GetCommissions implements Portfolio
+func (p *portfolio) GetCommissions() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := 0.0
+	for _, pos := range p.positions {
+		res += pos.Commission
+	}
+	return res
+}
+
+// GetPosition implements Portfolio
+func (p *portfolio) GetPosition(instrument string) *PortfolioPosition {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pos, ok := p.positions[instrument]; ok {
+		res := *pos
+		return &res
+	}
+	return nil
+}
+
+// GetPositions implements Portfolio
+func (p *portfolio) GetPositions() map[string]*PortfolioPosition {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := map[string]*PortfolioPosition{}
+	for k, pos := range p.positions {
+		if pos.Quantity != 0 {
+			v := *pos
+			res[k] = &v
+		}
+	}
+	return res
+}
+
+// GetLastPrice implements Portfolio
+func (p *portfolio) GetLastPrice(instrument string) (float64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	quote, ok := p.lastQuotes[instrument]
+	if !ok {
+		return 0, false
+	}
+	if p.fx == nil {
+		return quote, true
+	}
+	currency := ""
+	if pos, ok := p.positions[instrument]; ok {
+		currency = pos.Currency
+	} else if p.instruments != nil {
+		currency = p.instruments.GetInstrument(instrument).Currency
+	}
+	rate, ok := p.fx.GetFXRate(currency)
+	return quote * rate, ok
+}
+
+// GetEquityDataSeries implements Portfolio
+func (p *portfolio) GetEquityDataSeries() SequenceDataSeries {
+	return p.equity
+}
+
+func (p *portfolio) onOrderEvent(args ...interface{}) error {
+	if len(args) != 2 {
+		return fmt.Errorf("onOrderEvent args length should be 2")
+	}
+
+	orderEvent := args[1].(OrderEvent)
+	info, ok := orderEvent.GetEventInfo().(*OrderExecutionInfo)
+	if !ok {
+		return nil
+	}
+	order := orderEvent.GetOrder()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.addFill(order.GetInstrument(), order.GetAction(), info)
+	return nil
+}
+
+func (p *portfolio) addFill(instrument string, action OrderAction, info *OrderExecutionInfo) {
+	quantity := info.Quantity
+	if !action.IsBuy() {
+		quantity = -quantity
+	}
+	pos, ok := p.positions[instrument]
+	if !ok {
+		pos = &PortfolioPosition{
+			Instrument: instrument,
+		}
+		if p.instruments != nil {
+			i := p.instruments.GetInstrument(instrument)
+			pos.Multiplier = i.GetMultiplier()
+			pos.Currency = i.Currency
+		}
+		p.positions[instrument] = pos
+	}
+	pos.addFill(quantity, info.basePrice(), info.Commission)
+	p.lastQuotes[instrument] = info.Price
+}
+
+func (p *portfolio) onCorporateAction(args ...interface{}) error {
+	if len(args) != 2 {
+		return fmt.Errorf("onCorporateAction args length should be 2")
+	}
+	event := args[1].(CorporateActionEvent)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	instrument := event.Action.Instrument
+	pos, ok := p.positions[instrument]
+	if !ok {
+		return nil
+	}
+	switch event.Action.Type {
+	case CorporateActionSplit:
+		ratio := event.Action.Ratio
+		pos.Quantity *= ratio
+		pos.AvgCost /= ratio
+		pos.LastPrice /= ratio
+		if quote, ok := p.lastQuotes[instrument]; ok {
+			p.lastQuotes[instrument] = quote / ratio
+		}
+	case CorporateActionDividend:
+		pos.Dividends += event.Cash
+		pos.RealizedPnL += event.Cash
+	}
+	return nil
+}
+
+func (p *portfolio) onBars(args ...interface{}) error {
+	if len(args) != 2 {
+		return fmt.Errorf("onBars args length should be 2")
+	}
+
+	currentTime := args[0].(time.Time)
+	data := args[1].(map[string]interface{})
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	marked := false
+	for k, v := range data {
+		bar := v.(Bar)
+		if freq, ok := p.barFrequency[k]; ok && bar.Frequency() > freq {
+			continue
+		}
+		p.barFrequency[k] = bar.Frequency()
+		marked = true
+		p.lastQuotes[k] = bar.Close()
+	}
+	if !marked {
+		return nil
+	}
+	p.markPositions()
+	return p.equity.AppendWithDateTime(currentTime, p.equityLocked())
+}
+
+// markPositions sets the last prices of the positions from the last quotes,
+// the positions quoted in other currencies move with the fx rates too
+func (p *portfolio) markPositions() {
+	for k, pos := range p.positions {
+		quote, ok := p.lastQuotes[k]
+		if !ok {
+			continue
+		}
+		rate := 1.0
+		if p.fx != nil {
+			if rate, ok = p.fx.GetFXRate(pos.Currency); !ok {
+				continue
+			}
+		}
+		pos.LastPrice = quote * rate
+	}
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPortfolioPositionFills(t *testing.T) {
+	pos := &PortfolioPosition{Instrument: "GLD"}
+	pos.addFill(10, 100, 1)
+	pos.addFill(10, 110, 1)
+	if !almostEqual(pos.Quantity, 20) || !almostEqual(pos.AvgCost, 105) {
+		t.Fatal("unexpected position", pos)
+	}
+	pos.addFill(-5, 120, 1)
+	if !almostEqual(pos.Quantity, 15) || !almostEqual(pos.RealizedPnL, 72) {
+		t.Fatal("unexpected realized pnl", pos)
+	}
+	pos.addFill(-20, 100, 0)
+	if !almostEqual(pos.Quantity, -5) || !almostEqual(pos.AvgCost, 100) ||
+		!almostEqual(pos.RealizedPnL, -3) {
+		t.Fatal("position should be reversed", pos)
+	}
+	pos.LastPrice = 90
+	if !almostEqual(pos.UnrealizedPnL(), 50) {
+		t.Fatal("unexpected unrealized pnl", pos.UnrealizedPnL())
+	}
+}
+
+func TestPortfolioEquity(t *testing.T) {
+	broker, _ := newTestBacktestBroker(1000)
+	portfolio := NewPortfolio(broker, broker.datafeed, 0)
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	broker.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 5, false))
+	pushTestBar(broker.datafeed, tm, 100, 110, 90, 105)
+	if !almostEqual(portfolio.GetEquity(), 1025) || !almostEqual(portfolio.GetUnrealizedPnL(), 25) {
+		t.Fatal("unexpected equity", portfolio.GetEquity(), portfolio.GetUnrealizedPnL())
+	}
+
+	broker.SubmitOrder(NewMarketOrder(OrderActionSell, "GLD", 5, true))
+	pushTestBar(broker.datafeed, tm.AddDate(0, 0, 1), 100, 110, 90, 108)
+	if !almostEqual(portfolio.GetRealizedPnL(), 40) || len(portfolio.GetPositions()) != 0 {
+		t.Fatal("position should be closed with profit", portfolio.GetRealizedPnL())
+	}
+
+	equity := portfolio.GetEquityDataSeries()
+	if equity.Len() != 2 {
+		t.Fatal("unexpected equity series length", equity.Len())
+	}
+	if dt, v, _ := equity.At(1); !dt.Equal(tm.AddDate(0, 0, 1)) || !almostEqual(v.(float64), 1040) {
+		t.Fatal("unexpected equity value", dt, v)
+	}
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"goat/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// CommissionEstimator is implemented by the brokers which can tell the
+// commission of an order before it is filled
+type CommissionEstimator interface {
+	// EstimateCommission returns the commission of filling the whole order at
+	// price in the base currency
+	EstimateCommission(order Order, price float64) float64
+}
+
+// RebalanceOptions are the thresholds of a rebalance, the trades below any
+// of them are skipped
+type RebalanceOptions struct {
+	MinTradeValue  float64 `json:"minTradeValue"`  // in the base currency
+	MinTradeWeight float64 `json:"minTradeWeight"` // fraction of the equity
+	// DryRun computes the orders without submitting them
+	DryRun bool `json:"dryRun"`
+}
+
+// RebalanceResult reports the orders of a rebalance. The values are
+// estimated at the last prices of the portfolio.
+type RebalanceResult struct {
+	Orders      []Order
+	Equity      float64
+	TradedValue float64
+	Turnover    float64 // traded value over the equity
+	Cost        float64 // estimated commissions
+	// Skipped are the instruments whose trade is below the thresholds or
+	// rounded to zero by the lot size
+	Skipped []string
+}
+
+type rebalanceTrade struct {
+	instrument string
+	quantity   float64 // signed
+	price      float64
+	value      float64
+}
+
+// Rebalance submits the market orders which move the holdings of broker to
+// the target weights of the equity of portfolio. The positions which are not
+// in targets are closed, a negative weight is a short position. The sells are
+// submitted first so that the buys can use their cash. The active orders are
+// not taken into account.
+func Rebalance(portfolio Portfolio, broker Broker, targets map[string]float64,
+	opts RebalanceOptions,
+) (*RebalanceResult, error) {
+	equity := portfolio.GetEquity()
+	if equity <= 0 {
+		return nil, fmt.Errorf("cannot rebalance an equity of %g", equity)
+	}
+	weights := map[string]float64{}
+	for instrument := range broker.GetPositions() {
+		weights[instrument] = 0
+	}
+	for instrument, w := range targets {
+		if math.IsNaN(w) || math.IsInf(w, 0) {
+			return nil, fmt.Errorf("invalid weight %g of %s", w, instrument)
+		}
+		weights[instrument] = w
+	}
+	instruments, _ := broker.(InstrumentProvider)
+
+	res := &RebalanceResult{Equity: equity}
+	trades := []rebalanceTrade{}
+	for instrument, w := range weights {
+		current := broker.GetPosition(instrument)
+		if w == 0 && current == 0 {
+			continue
+		}
+		price, ok := portfolio.GetLastPrice(instrument)
+		if !ok || price <= 0 {
+			return nil, fmt.Errorf("no price of %s", instrument)
+		}
+		inst := defaultInstrument(instrument)
+		if instruments != nil {
+			inst = instruments.GetInstrument(instrument)
+		}
+		unitValue := price * inst.GetMultiplier()
+
+		delta := -current
+		if w != 0 {
+			delta = w*equity/unitValue - current
+			delta = math.Copysign(inst.RoundQuantity(math.Abs(delta)), delta)
+		}
+		value := math.Abs(delta) * unitValue
+		if delta == 0 || math.Abs(delta) < positionEpsilon || value < opts.MinTradeValue ||
+			value/equity < opts.MinTradeWeight {
+			res.Skipped = append(res.Skipped, instrument)
+			continue
+		}
+		trades = append(trades, rebalanceTrade{
+			instrument: instrument,
+			quantity:   delta,
+			price:      price,
+			value:      value,
+		})
+	}
+	sort.Strings(res.Skipped)
+	sort.Slice(trades, func(i, j int) bool {
+		if (trades[i].quantity < 0) != (trades[j].quantity < 0) {
+			return trades[i].quantity < 0
+		}
+		return trades[i].instrument < trades[j].instrument
+	})
+
+	estimator, _ := broker.(CommissionEstimator)
+	for _, t := range trades {
+		action := OrderActionBuy
+		if t.quantity < 0 {
+			action = OrderActionSell
+		}
+		order := NewMarketOrder(action, t.instrument, math.Abs(t.quantity), false)
+		if !opts.DryRun {
+			if err := broker.SubmitOrder(order); err != nil {
+				logger.Logger.Warn("rebalance order rejected", zap.String("instrument", t.instrument),
+					zap.Float64("quantity", t.quantity), zap.Error(err))
+				continue
+			}
+		}
+		res.Orders = append(res.Orders, order)
+		res.TradedValue += t.value
+		if estimator != nil {
+			res.Cost += estimator.EstimateCommission(order, t.price)
+		}
+	}
+	res.Turnover = res.TradedValue / equity
+	return res, nil
+}
+
+// EstimateCommission implements CommissionEstimator
+func (b *backtestBroker) EstimateCommission(order Order, price float64) float64 {
+	return b.commission.Calculate(order, price, order.GetQuantity())
+}
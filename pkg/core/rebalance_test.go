@@ -0,0 +1,56 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+)
+
+func TestRebalance(t *testing.T) {
+	cfg := &config.Config{
+		Instruments: map[string]config.InstrumentConfig{"GLD": {LotSize: 10}},
+	}
+	cfg.Broker.Cash = 10000
+	cfg.Broker.Commission = config.CommissionConfig{Type: "percentage", Amount: 0.001}
+	gen := NewBarFeedGenerator([]Frequency{REALTIME, DAY}, 100)
+	feed := NewGenericDataFeed(context.TODO(), cfg, gen, nil, 100, "")
+	broker := newTestBroker(cfg, feed)
+	portfolio := NewPortfolio(broker, feed, 0)
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	if _, err := Rebalance(portfolio, broker, map[string]float64{"GLD": 0.5}, RebalanceOptions{}); err == nil {
+		t.Fatal("rebalance without prices should fail")
+	}
+	pushTestBars(feed, tm, map[string]float64{"GLD": 100, "SLV": 20})
+
+	res, err := Rebalance(portfolio, broker, map[string]float64{"GLD": 0.55, "SLV": 0.4}, RebalanceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Orders) != 2 || res.Orders[0].GetQuantity() != 50 || res.Orders[1].GetQuantity() != 200 {
+		t.Fatal("quantities should be rounded to the lot size", res.Orders)
+	}
+	if !almostEqual(res.TradedValue, 9000) || !almostEqual(res.Turnover, 0.9) || !almostEqual(res.Cost, 9) {
+		t.Fatal("unexpected result", res)
+	}
+	pushTestBars(feed, tm.AddDate(0, 0, 1), map[string]float64{"GLD": 100, "SLV": 20})
+	if broker.GetPosition("GLD") != 50 || broker.GetPosition("SLV") != 200 || !almostEqual(broker.GetCash(), 991) {
+		t.Fatal("orders should be filled", broker.GetPositions(), broker.GetCash())
+	}
+
+	pushTestBars(feed, tm.AddDate(0, 0, 2), map[string]float64{"GLD": 110, "SLV": 20})
+	opts := RebalanceOptions{MinTradeValue: 100, DryRun: true}
+	res, err = Rebalance(portfolio, broker, map[string]float64{"GLD": 0.55}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Orders) != 1 || res.Orders[0].GetAction() != OrderActionSell || res.Orders[0].GetQuantity() != 200 ||
+		len(res.Skipped) != 1 || res.Skipped[0] != "GLD" {
+		t.Fatal("missing positions should be closed and small trades skipped", res.Orders, res.Skipped)
+	}
+	if len(broker.GetActiveOrders("")) != 0 {
+		t.Fatal("dry run should not submit orders")
+	}
+}
@@ -0,0 +1,291 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"goat/pkg/config"
+	"goat/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// LiveResampleFrequencies are the frequencies resampled from the live bars
+// if cfg.Resample is not set
+var LiveResampleFrequencies = []Frequency{MINUTE, HOUR, HOUR_4, DAY, WEEK, MONTH}
+
+var resampleFrequencies = map[string]Frequency{
+	"minute": MINUTE,
+	"hour":   HOUR,
+	"hour_4": HOUR_4,
+	"day":    DAY,
+	"week":   WEEK,
+	"month":  MONTH,
+}
+
+// ParseResampleFrequencies parses the frequency names of cfg.Resample, e.g.
+// "hour_4"
+func ParseResampleFrequencies(names []string) ([]Frequency, error) {
+	res := make([]Frequency, 0, len(names))
+	for _, name := range names {
+		freq, ok := resampleFrequencies[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("invalid resample frequency %s, expected one of minute, hour, hour_4, day, week or month", name)
+		}
+		res = append(res, freq)
+	}
+	return res, nil
+}
+
+// NewResampleHooksControl returns the hooks resampling the bars of a feed to
+// freqs with the trading calendar of cfg. The frequencies of cfg.Resample
+// are used instead if it is set.
+func NewResampleHooksControl(cfg *config.Config, freqs []Frequency) (DataFeedHooksControl, error) {
+	if len(cfg.Resample) != 0 {
+		var err error
+		if freqs, err = ParseResampleFrequencies(cfg.Resample); err != nil {
+			return nil, err
+		}
+	}
+	calendar, err := NewTradingCalendarFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ctrl := NewDataFeedValueHookControl()
+	for _, freq := range freqs {
+		hook, err := NewResampleHook(freq, calendar)
+		if err != nil {
+			return nil, err
+		}
+		ctrl.AddNewHook(hook)
+	}
+	return ctrl, nil
+}
+
+type resampledBar struct {
+	open, high, low, close, adjClose float64
+	volume                           int64
+}
+
+type resamplePeriod struct {
+	label time.Time // time of the resampled bars
+	end   time.Time // the bars are generated once the clock passes it
+}
+
+type resampleHook struct {
+	freq     Frequency
+	calendar TradingCalendar
+	// the finest frequency of the feed, the coarser bars, e.g. the ones of
+	// the other hooks, are not resampled
+	source            Frequency
+	period            *resamplePeriod
+	bars              map[string]*resampledBar
+	ready             []*PendingDataFeedValue
+	lastGeneratedTime *time.Time
+	clock             Clock
+}
+
+// NewResampleHook generates the bars of freq, one of MINUTE, HOUR, HOUR_4,
+// DAY, WEEK or MONTH, from the finer bars of the feed. The periods follow
+// the sessions of calendar, the intraday periods start at the open of the
+// session. The days are from midnight UTC if calendar is nil.
+func NewResampleHook(freq Frequency, calendar TradingCalendar) (DataFeedHook, error) {
+	switch freq {
+	case MINUTE, HOUR, HOUR_4, DAY, WEEK, MONTH:
+	default:
+		return nil, fmt.Errorf("frequency %d cannot be resampled", freq)
+	}
+	if calendar == nil {
+		calendar, _ = GetTradingCalendar("24/7")
+	}
+	return &resampleHook{
+		freq:     freq,
+		calendar: calendar,
+		source:   UNKNOWN,
+		bars:     map[string]*resampledBar{},
+	}, nil
+}
+
+// SetClock implements ClockUser, the bars are generated once the clock
+// passes the end of their period
+func (h *resampleHook) SetClock(clock Clock) {
+	h.clock = clock
+}
+
+// periodKey returns the label of the DAY, WEEK or MONTH period of a trading
+// day
+func (h *resampleHook) periodKey(date time.Time) time.Time {
+	switch h.freq {
+	case WEEK:
+		// weeks start on monday
+		return date.AddDate(0, 0, -((int(date.Weekday()) + 6) % 7))
+	case MONTH:
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return date
+}
+
+// periodOf returns the period of t, false if t is outside of the sessions
+func (h *resampleHook) periodOf(t time.Time) (resamplePeriod, bool) {
+	session, ok := h.calendar.SessionAt(t)
+	if !ok {
+		return resamplePeriod{}, false
+	}
+	if h.freq < DAY {
+		d := time.Duration(h.freq) * time.Second
+		start := session.Open.Add(t.Sub(session.Open) / d * d)
+		end := start.Add(d)
+		if end.After(session.Close) {
+			end = session.Close
+		}
+		return resamplePeriod{label: start.UTC(), end: end}, true
+	}
+	key := h.periodKey(session.Date)
+	if h.period != nil && h.period.label.Equal(key) {
+		return *h.period, true
+	}
+	// the period ends with the close of its last session
+	last := session
+	for {
+		next := h.calendar.NextSession(last.Close)
+		if next.IsZero() || !h.periodKey(next.Date).Equal(key) {
+			break
+		}
+		last = next
+	}
+	return resamplePeriod{label: key, end: last.Close}, true
+}
+
+// currentPeriod returns the period of t, or the one of the next session if
+// t is outside of the sessions
+func (h *resampleHook) currentPeriod(t time.Time) (resamplePeriod, bool) {
+	if s := h.calendar.NextSession(t); !s.IsZero() && t.Before(s.Open) {
+		t = s.Open
+	}
+	return h.periodOf(t)
+}
+
+// finish moves the bars of the current period to the generated values
+func (h *resampleHook) finish() {
+	value := &PendingDataFeedValue{
+		t: h.period.label,
+		f: h.freq,
+		v: map[string]interface{}{},
+	}
+	for k, b := range h.bars {
+		value.v[k] = NewBasicBar(value.t, b.open, b.high, b.low, b.close,
+			b.adjClose, b.volume, h.freq)
+	}
+	end := h.period.end
+	h.period = nil
+	h.bars = map[string]*resampledBar{}
+	// do not generate bar if there is already a bar generated for that period
+	if h.lastGeneratedTime != nil && !h.lastGeneratedTime.Before(value.t) {
+		return
+	}
+	h.lastGeneratedTime = &value.t
+	if h.freq >= DAY {
+		logger.Logger.Info("new bar generated", zap.Int64("frequency", int64(h.freq)),
+			zap.Time("time", value.t), zap.Time("end", end))
+	} else {
+		logger.Logger.Debug("new bar generated", zap.Int64("frequency", int64(h.freq)),
+			zap.Time("time", value.t), zap.Time("end", end))
+	}
+	h.ready = append(h.ready, value)
+}
+
+// NextWakeupTime implements WakeupTimer, the bars are generated at the end
+// of the period
+func (h *resampleHook) NextWakeupTime() *time.Time {
+	if len(h.ready) != 0 {
+		now := clockNow(h.clock)
+		return &now
+	}
+	if h.period == nil {
+		return nil
+	}
+	end := h.period.end
+	return &end
+}
+
+// MayHaveNewValue implements DataFeedHook
+func (h *resampleHook) MayHaveNewValue() *PendingDataFeedValue {
+	if h.period != nil && !clockNow(h.clock).Before(h.period.end) {
+		h.finish()
+	}
+	if len(h.ready) == 0 {
+		return nil
+	}
+	value := h.ready[0]
+	h.ready = h.ready[1:]
+	return value
+}
+
+// Invoke implements DataFeedHook
+func (h *resampleHook) Invoke(value *PendingDataFeedValue, isRecovery bool) {
+	if value.f < REALTIME || value.f >= h.freq {
+		// we don't care about other data frequencies
+		return
+	}
+	if h.source == UNKNOWN || value.f < h.source {
+		h.source = value.f
+	}
+	if value.f != h.source {
+		return
+	}
+	period, ok := h.periodOf(value.t)
+	if !ok {
+		// the bars outside of the sessions are not part of a period
+		return
+	}
+	if isRecovery {
+		// the bars of the past periods are already generated
+		current, ok := h.currentPeriod(clockNow(h.clock))
+		if !ok || !current.label.Equal(period.label) {
+			return
+		}
+	}
+	if h.period != nil && !h.period.label.Equal(period.label) {
+		if period.label.Before(h.period.label) {
+			return
+		}
+		// a bar of the next period arrives before the clock passes the end
+		// of the current one
+		h.finish()
+	}
+	if h.period == nil {
+		h.period = &period
+	}
+
+	for k, v := range value.v {
+		bar := v.(Bar)
+		open, high, low := bar.Open(), bar.High(), bar.Low()
+		if value.f == REALTIME {
+			// the realtime values are price snapshots, their open, high and
+			// low may be the ones of the day
+			open, high, low = bar.Close(), bar.Close(), bar.Close()
+		}
+		b, ok := h.bars[k]
+		if !ok {
+			h.bars[k] = &resampledBar{
+				open:     open,
+				high:     high,
+				low:      low,
+				close:    bar.Close(),
+				adjClose: bar.AdjClose(),
+				volume:   bar.Volume(),
+			}
+			continue
+		}
+		if high > b.high {
+			b.high = high
+		}
+		if low < b.low {
+			b.low = low
+		}
+		b.close = bar.Close()
+		b.adjClose = bar.AdjClose()
+		b.volume += bar.Volume()
+	}
+}
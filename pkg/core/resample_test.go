@@ -0,0 +1,165 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+)
+
+func TestResampleFeed(t *testing.T) {
+	cfg := &config.Config{Resample: []string{"hour_4", "DAY"}}
+	gen := NewBarFeedGenerator([]Frequency{MINUTE}, 2000)
+	feed := NewGenericDataFeed(context.TODO(), cfg, gen, nil, 100, "")
+	start := time.Date(2023, time.March, 6, 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= 24*60+10; i++ {
+		tm := start.Add(time.Duration(i) * time.Minute)
+		p := float64(i)
+		gen.AppendNewValueToBuffer(tm, map[string]interface{}{
+			"X": NewBasicBar(tm, p, p+0.5, p-0.5, p+0.25, p+0.25, 10, MINUTE),
+		}, MINUTE)
+	}
+	gen.Finish()
+
+	events := []string{}
+	generated := map[string]Bar{}
+	feed.GetNewValueEvent().Subscribe(func(args ...interface{}) error {
+		bar := args[1].(map[string]interface{})["X"].(Bar)
+		if bar.Frequency() == MINUTE {
+			if bar.DateTime().Minute() == 0 && bar.DateTime().Hour()%4 == 0 {
+				events = append(events, "minute "+bar.DateTime().Format("01-02 15:04"))
+			}
+			return nil
+		}
+		key := fmt.Sprintf("%d %s", bar.Frequency(), bar.DateTime().Format("01-02 15:04"))
+		events = append(events, key)
+		generated[key] = bar
+		return nil
+	})
+	d := NewDispatcher(context.TODO())
+	d.AddSubject(feed)
+	d.Run()
+
+	expected := []string{"minute 03-06 00:00"}
+	for h := 4; h <= 24; h += 4 {
+		tm := start.Add(time.Duration(h) * time.Hour)
+		// the bars are generated once their period ends, before the bar
+		// of the next period
+		expected = append(expected, fmt.Sprintf("%d %s", HOUR_4, tm.Add(-4*time.Hour).Format("01-02 15:04")))
+		if h == 24 {
+			expected = append(expected, fmt.Sprintf("%d %s", DAY, start.Format("01-02 15:04")))
+		}
+		expected = append(expected, "minute "+tm.Format("01-02 15:04"))
+	}
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Error("unexpected events", events)
+	}
+
+	for _, c := range []struct {
+		key                    string
+		open, high, low, close float64
+		volume                 int64
+	}{
+		{fmt.Sprintf("%d 03-06 04:00", HOUR_4), 240, 479.5, 239.5, 479.25, 2400},
+		{fmt.Sprintf("%d 03-06 00:00", DAY), 0, 1439.5, -0.5, 1439.25, 14400},
+	} {
+		bar, ok := generated[c.key]
+		if !ok {
+			t.Error("missing bar", c.key)
+			continue
+		}
+		if bar.Open() != c.open || bar.High() != c.high || bar.Low() != c.low ||
+			bar.Close() != c.close || bar.AdjClose() != c.close || bar.Volume() != c.volume {
+			t.Error("unexpected bar", c.key, bar)
+		}
+	}
+
+	ds, err := feed.GetDataSeries("X", HOUR_4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, v, err := ds.At(ds.Len() - 1); err != nil || v.(Bar).Close() != 1439.25 {
+		t.Error("unexpected last HOUR_4 bar", v, err)
+	}
+}
+
+func TestResampleSessions(t *testing.T) {
+	nyse, _ := GetTradingCalendar("nyse")
+	ny := nyse.Location()
+	clock := NewSimulatedClock()
+	ctrl := NewDataFeedValueHookControl()
+	for _, freq := range []Frequency{HOUR, WEEK, MONTH} {
+		hook, err := NewResampleHook(freq, nyse)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctrl.AddNewHook(hook)
+	}
+	ctrl.(ClockUser).SetClock(clock)
+
+	generated := map[Frequency][]Bar{}
+	push := func(tm time.Time, f Frequency, price float64) {
+		clock.Advance(tm)
+		for v := ctrl.PossibleOneNewValue(); v != nil; v = ctrl.PossibleOneNewValue() {
+			generated[v.f] = append(generated[v.f], v.v["X"].(Bar))
+		}
+		ctrl.FilterNewValue(&PendingDataFeedValue{
+			t: tm,
+			f: f,
+			v: map[string]interface{}{
+				"X": NewBasicBar(tm, price, price, price, price, price, 1, f),
+			},
+		}, false)
+	}
+	// 30 minute bars from monday 2024-01-29 to monday 2024-02-05
+	for day := 29; day <= 36; day++ {
+		for m := 0; m < 13; m++ {
+			tm := time.Date(2024, time.January, day, 9, 30+30*m, 0, 0, ny)
+			push(tm, 30*MINUTE, float64(day*100+m))
+			// the coarser bars are not resampled
+			push(tm, HOUR, 1e6)
+		}
+		// the bars outside of the session are ignored
+		push(time.Date(2024, time.January, day, 18, 0, 0, 0, ny), 30*MINUTE, 1e6)
+	}
+
+	hours := generated[HOUR]
+	if len(hours) == 0 || !hours[0].DateTime().Equal(time.Date(2024, time.January, 29, 9, 30, 0, 0, ny)) ||
+		hours[0].Open() != 2900 || hours[0].Close() != 2901 || hours[0].Volume() != 2 {
+		t.Fatal("unexpected first HOUR bar", hours)
+	}
+	// the last hour of the session is from 15:30 to 16:00
+	if last := hours[6]; !last.DateTime().Equal(time.Date(2024, time.January, 29, 15, 30, 0, 0, ny)) ||
+		last.Open() != 2912 || last.Volume() != 1 {
+		t.Error("unexpected last HOUR bar of the session", last)
+	}
+
+	weeks := generated[WEEK]
+	if len(weeks) != 1 || !weeks[0].DateTime().Equal(time.Date(2024, time.January, 29, 0, 0, 0, 0, time.UTC)) ||
+		weeks[0].Open() != 2900 || weeks[0].Close() != 3312 || weeks[0].Volume() != 65 {
+		t.Error("unexpected WEEK bars", weeks)
+	}
+	months := generated[MONTH]
+	if len(months) != 1 || !months[0].DateTime().Equal(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)) ||
+		months[0].Open() != 2900 || months[0].Close() != 3112 || months[0].High() != 3112 || months[0].Volume() != 39 {
+		t.Error("unexpected MONTH bars", months)
+	}
+}
+
+func TestResampleConfig(t *testing.T) {
+	if _, err := NewResampleHook(YEAR, nil); err == nil {
+		t.Error("YEAR should not be resampled")
+	}
+	if _, err := ParseResampleFrequencies([]string{"hour", "hour_2"}); err == nil {
+		t.Error("invalid frequency should be rejected")
+	}
+	if _, err := NewResampleHooksControl(&config.Config{Resample: []string{"second"}}, nil); err == nil {
+		t.Error("invalid resample config should be rejected")
+	}
+	freqs, err := ParseResampleFrequencies([]string{"Minute", "hour_4", "week", "month"})
+	if err != nil || fmt.Sprint(freqs) != fmt.Sprint([]Frequency{MINUTE, HOUR_4, WEEK, MONTH}) {
+		t.Error("unexpected frequencies", freqs, err)
+	}
+}
@@ -0,0 +1,393 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"goat/pkg/config"
+	"goat/pkg/logger"
+	"goat/pkg/notify"
+
+	"go.uber.org/zap"
+)
+
+// RiskManager is a broker which checks the orders of the strategy against
+// the limits of config.RiskConfig before they reach the wrapped broker.
+// Refused orders are canceled with an OrderEventRejected event carrying the
+// reason.
+type RiskManager interface {
+	Broker
+	// TripKillSwitch cancels the active orders, flattens the positions,
+	// sends an alert and rejects every new order
+	TripKillSwitch(reason string)
+	IsKillSwitchTripped() bool
+}
+
+type riskManager struct {
+	Broker
+	mu        sync.Mutex
+	cfg       config.RiskConfig
+	portfolio Portfolio
+	notifiers []notify.Notifier
+
+	lastPrices  map[string]float64
+	currentTime time.Time
+	clock       Clock
+	submitTimes []time.Time
+	// same as the backtest broker, only the finest bars of each instrument
+	// are used, the coarser ones are resampled from them
+	barFrequency map[string]Frequency
+
+	day            time.Time
+	dayStartEquity float64
+	lastEquity     float64
+	peakEquity     float64
+	drawdown       float64
+
+	killed        bool
+	pendingEvents []OrderEvent
+}
+
+// NewRiskManager wraps broker with the limits of cfg.Risk. The equity used
+// by the daily loss and drawdown limits is the equity of portfolio, which
+// should follow broker. notifiers receive the kill switch alert.
+func NewRiskManager(cfg *config.Config, broker Broker, portfolio Portfolio, feed DataFeed,
+	notifiers []notify.Notifier,
+) RiskManager {
+	r := &riskManager{
+		Broker:       broker,
+		cfg:          cfg.Risk,
+		portfolio:    portfolio,
+		notifiers:    notifiers,
+		lastPrices:   map[string]float64{},
+		barFrequency: map[string]Frequency{},
+	}
+	// subscribed after the broker and the portfolio, the equity is marked
+	// with the new bars when onBars is called
+	feed.GetNewValueEvent().Subscribe(r.onBars)
+	return r
+}
+
+// SetWakeupFunc implements Waker if the wrapped broker does
+func (r *riskManager) SetWakeupFunc(wakeup func()) {
+	if waker, ok := r.Broker.(Waker); ok {
+		waker.SetWakeupFunc(wakeup)
+	}
+}
+
+// SetClock implements ClockUser, the clock is passed to the wrapped broker
+func (r *riskManager) SetClock(clock Clock) {
+	r.clock = clock
+	if user, ok := r.Broker.(ClockUser); ok {
+		user.SetClock(clock)
+	}
+}
+
+// Eof implements Subject
+func (r *riskManager) Eof() bool {
+	r.mu.Lock()
+	pending := len(r.pendingEvents)
+	r.mu.Unlock()
+	return pending == 0 && r.Broker.Eof()
+}
+
+// Dispatch implements Subject
+func (r *riskManager) Dispatch() bool {
+	emitted := false
+	for {
+		r.mu.Lock()
+		if len(r.pendingEvents) == 0 {
+			r.mu.Unlock()
+			break
+		}
+		event := r.pendingEvents[0]
+		r.pendingEvents = r.pendingEvents[1:]
+		r.mu.Unlock()
+
+		r.GetOrderUpdatedEvent().Emit(r, event)
+		emitted = true
+	}
+	return r.Broker.Dispatch() || emitted
+}
+
+// SubmitOrder implements Broker
+func (r *riskManager) SubmitOrder(order Order) error {
+	if err := r.check(order); err != nil {
+		return err
+	}
+	return r.Broker.SubmitOrder(order)
+}
+
+// SubmitBracketOrder implements Broker, the limits are checked with the
+// entry order since the legs only close its position
+func (r *riskManager) SubmitBracketOrder(entry Order, takeProfit Order, stopLoss Order) error {
+	if err := r.check(entry); err != nil {
+		for _, leg := range []Order{takeProfit, stopLoss} {
+			if leg != nil {
+				r.reject(leg, err.Error())
+			}
+		}
+		return err
+	}
+	return r.Broker.SubmitBracketOrder(entry, takeProfit, stopLoss)
+}
+
+// SubmitOCOOrders implements Broker
+func (r *riskManager) SubmitOCOOrders(orders ...Order) error {
+	for i, order := range orders {
+		if err := r.check(order); err != nil {
+			for j, other := range orders {
+				if j != i {
+					r.reject(other, err.Error())
+				}
+			}
+			return err
+		}
+	}
+	return r.Broker.SubmitOCOOrders(orders...)
+}
+
+// ReplaceOrder changes an active order if the wrapped broker supports it
+func (r *riskManager) ReplaceOrder(order Order, quantity, limitPrice, stopPrice float64) error {
+	replacer, ok := r.Broker.(interface {
+		ReplaceOrder(order Order, quantity, limitPrice, stopPrice float64) error
+	})
+	if !ok {
+		return fmt.Errorf("broker does not support replacing orders")
+	}
+	if r.IsKillSwitchTripped() {
+		return fmt.Errorf("kill switch is tripped")
+	}
+	return replacer.ReplaceOrder(order, quantity, limitPrice, stopPrice)
+}
+
+// GetInstrument implements InstrumentProvider, unknown instruments are
+// returned if the wrapped broker does not know its instruments
+func (r *riskManager) GetInstrument(symbol string) *Instrument {
+	if instruments, ok := r.Broker.(InstrumentProvider); ok {
+		return instruments.GetInstrument(symbol)
+	}
+	return defaultInstrument(symbol)
+}
+
+// EstimateCommission implements CommissionEstimator, it is 0 if the wrapped
+// broker does not estimate commissions
+func (r *riskManager) EstimateCommission(order Order, price float64) float64 {
+	if estimator, ok := r.Broker.(CommissionEstimator); ok {
+		return estimator.EstimateCommission(order, price)
+	}
+	return 0
+}
+
+// IsKillSwitchTripped implements RiskManager
+func (r *riskManager) IsKillSwitchTripped() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.killed
+}
+
+// check returns an error and queues a rejection if order breaks a limit
+func (r *riskManager) check(order Order) error {
+	r.mu.Lock()
+	reason := r.checkLocked(order)
+	if reason == "" {
+		r.submitTimes = append(r.submitTimes, r.now())
+	}
+	r.mu.Unlock()
+
+	if reason != "" {
+		r.reject(order, reason)
+		logger.Logger.Warn("order rejected by the risk manager", zap.String("order", order.String()),
+			zap.String("reason", reason))
+		return fmt.Errorf("order rejected: %s", reason)
+	}
+	return nil
+}
+
+func (r *riskManager) checkLocked(order Order) string {
+	if r.killed {
+		return "kill switch is tripped"
+	}
+
+	instrument := order.GetInstrument()
+	quantity := order.GetQuantity()
+	if !order.GetAction().IsBuy() {
+		quantity = -quantity
+	}
+	current := r.Broker.GetPosition(instrument)
+	projected := current + quantity
+	for _, active := range r.Broker.GetActiveOrders(instrument) {
+		if active.GetAction().IsBuy() {
+			projected += active.GetRemaining()
+		} else {
+			projected -= active.GetRemaining()
+		}
+	}
+
+	if r.cfg.MaxPosition > 0 && math.Abs(projected) > r.cfg.MaxPosition+1e-9 {
+		return fmt.Sprintf("position %g of %s exceeds the max position %g", projected, instrument,
+			r.cfg.MaxPosition)
+	}
+	if r.cfg.MaxNotional > 0 {
+		// market and trailing stop orders are valued at the last close
+		price := 0.0
+		switch order.GetType() {
+		case OrderTypeLimit, OrderTypeStopLimit:
+			price = order.GetLimitPrice()
+		case OrderTypeStop:
+			price = order.GetStopPrice()
+		}
+		if price == 0 {
+			price = r.lastPrices[instrument]
+		}
+		notional := price * order.GetQuantity()
+		if instruments, ok := r.Broker.(InstrumentProvider); ok {
+			notional *= instruments.GetInstrument(instrument).GetMultiplier()
+			// the limit is in the base currency
+			if fx, ok := r.Broker.(CurrencyConverter); ok {
+				if rate, ok := fx.GetFXRate(instruments.GetInstrument(instrument).Currency); ok {
+					notional *= rate
+				}
+			}
+		}
+		if notional > r.cfg.MaxNotional+1e-9 {
+			return fmt.Sprintf("notional %g exceeds the max notional %g", notional, r.cfg.MaxNotional)
+		}
+	}
+	if r.cfg.MaxOrdersPerMinute > 0 {
+		since := r.now().Add(-time.Minute)
+		recent := r.submitTimes[:0]
+		for _, t := range r.submitTimes {
+			if t.After(since) {
+				recent = append(recent, t)
+			}
+		}
+		r.submitTimes = recent
+		if len(recent) >= r.cfg.MaxOrdersPerMinute {
+			return fmt.Sprintf("more than %d orders per minute", r.cfg.MaxOrdersPerMinute)
+		}
+	}
+	if r.cfg.MaxDrawdown > 0 && r.drawdown >= r.cfg.MaxDrawdown && math.Abs(projected) > math.Abs(current) {
+		return fmt.Sprintf("drawdown %.2f%% exceeds the max drawdown %.2f%%", r.drawdown*100,
+			r.cfg.MaxDrawdown*100)
+	}
+	return ""
+}
+
+// now returns the time of the clock of the dispatcher, or the time of the
+// last bar without a dispatcher, the orders of a backtest are limited in
+// the time of the feed
+func (r *riskManager) now() time.Time {
+	if r.clock != nil || r.currentTime.IsZero() {
+		return clockNow(r.clock)
+	}
+	return r.currentTime
+}
+
+func (r *riskManager) reject(order Order, reason string) {
+	if o, ok := order.(*BasicOrder); ok {
+		o.State = OrderStateCanceled
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pendingEvents = append(r.pendingEvents, NewOrderEvent(order, OrderEventRejected, reason))
+}
+
+func (r *riskManager) onBars(args ...interface{}) error {
+	if len(args) != 2 {
+		return fmt.Errorf("onBars args length should be 2")
+	}
+	currentTime := args[0].(time.Time)
+	bars := args[1].(map[string]interface{})
+
+	r.mu.Lock()
+	marked := false
+	for instrument, v := range bars {
+		bar, ok := v.(Bar)
+		if !ok {
+			continue
+		}
+		if freq, ok := r.barFrequency[instrument]; ok && bar.Frequency() > freq {
+			continue
+		}
+		r.barFrequency[instrument] = bar.Frequency()
+		r.lastPrices[instrument] = bar.Close()
+		marked = true
+	}
+	if !marked {
+		// the time of the resampled bars is the start of their period
+		r.mu.Unlock()
+		return nil
+	}
+	r.currentTime = currentTime
+
+	equity := r.portfolio.GetEquity()
+	day := time.Date(currentTime.Year(), currentTime.Month(), currentTime.Day(), 0, 0, 0, 0,
+		currentTime.Location())
+	if !day.Equal(r.day) {
+		// the day starts with the equity of the last bar of the previous day
+		r.day = day
+		r.dayStartEquity = equity
+		if r.lastEquity != 0 {
+			r.dayStartEquity = r.lastEquity
+		}
+	}
+	r.lastEquity = equity
+	if equity > r.peakEquity {
+		r.peakEquity = equity
+	}
+	r.drawdown = 0
+	if r.peakEquity > 0 {
+		r.drawdown = (r.peakEquity - equity) / r.peakEquity
+	}
+	loss := r.dayStartEquity - equity
+	trip := !r.killed && r.cfg.MaxDailyLoss > 0 && loss >= r.cfg.MaxDailyLoss
+	r.mu.Unlock()
+
+	if trip {
+		r.TripKillSwitch(fmt.Sprintf("daily loss %.2f exceeds the max daily loss %.2f",
+			loss, r.cfg.MaxDailyLoss))
+	}
+	return nil
+}
+
+// TripKillSwitch implements RiskManager
+func (r *riskManager) TripKillSwitch(reason string) {
+	r.mu.Lock()
+	if r.killed {
+		r.mu.Unlock()
+		return
+	}
+	r.killed = true
+	r.mu.Unlock()
+
+	logger.Logger.Error("kill switch is tripped", zap.String("reason", reason))
+	for _, order := range r.Broker.GetActiveOrders("") {
+		if err := r.Broker.CancelOrder(order); err != nil {
+			logger.Logger.Error("failed to cancel order", zap.Uint64("id", order.GetID()), zap.Error(err))
+		}
+	}
+	for instrument, quantity := range r.Broker.GetPositions() {
+		action := OrderActionSell
+		if quantity < 0 {
+			action = OrderActionBuy
+		}
+		order := NewMarketOrder(action, instrument, math.Abs(quantity), false)
+		if err := r.Broker.SubmitOrder(order); err != nil {
+			logger.Logger.Error("failed to flatten position", zap.String("instrument", instrument),
+				zap.Error(err))
+		}
+	}
+
+	for _, n := range r.notifiers {
+		if n.Level() <= config.ErrorLevel {
+			n.SetSubject("goat kill switch is tripped")
+			n.SetContent(reason)
+			if err := n.Send(); err != nil {
+				logger.Logger.Error("failed to send notification", zap.Error(err))
+			}
+		}
+	}
+}
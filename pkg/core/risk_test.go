@@ -0,0 +1,177 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+	"goat/pkg/notify"
+)
+
+type testNotifier struct {
+	subjects []string
+}
+
+func (n *testNotifier) SetSubject(s string) error {
+	n.subjects = append(n.subjects, s)
+	return nil
+}
+func (n *testNotifier) SetRecipients([]string) error { return nil }
+func (n *testNotifier) SetContent(string) error      { return nil }
+func (n *testNotifier) Send() error                  { return nil }
+func (n *testNotifier) Level() int                   { return config.InfoLevel }
+func (n *testNotifier) FeatureFlags() uint64         { return config.NotifyIsEmailFlag }
+
+func newTestRiskManager(risk config.RiskConfig) (*riskManager, *backtestBroker, *[]OrderEvent, *testNotifier) {
+	broker, events := newTestBacktestBroker(10000)
+	portfolio := NewPortfolio(broker, broker.datafeed, 0)
+	cfg := &config.Config{Risk: risk}
+	notifier := &testNotifier{}
+	r := NewRiskManager(cfg, broker, portfolio, broker.datafeed, []notify.Notifier{notifier})
+	return r.(*riskManager), broker, events, notifier
+}
+
+func countEvents(events []OrderEvent, eventType OrderEventType) int {
+	res := 0
+	for _, e := range events {
+		if e.GetEventType() == eventType {
+			res++
+		}
+	}
+	return res
+}
+
+func TestRiskManagerLimits(t *testing.T) {
+	r, broker, events, _ := newTestRiskManager(config.RiskConfig{
+		MaxPosition:        10,
+		MaxNotional:        2000,
+		MaxOrdersPerMinute: 3,
+	})
+	tm := time.Date(2022, time.January, 3, 10, 0, 0, 0, time.UTC)
+	pushTestBar(broker.datafeed, tm, 100, 100, 100, 100)
+
+	big := NewMarketOrder(OrderActionBuy, "GLD", 11, false)
+	if err := r.SubmitOrder(big); err == nil || big.GetState() != OrderStateCanceled {
+		t.Fatal("order above the max position should be rejected", err)
+	}
+	if err := r.SubmitOrder(NewLimitOrder(OrderActionBuy, "GLD", 500, 5)); err == nil {
+		t.Fatal("order above the max notional should be rejected")
+	}
+	// the active orders count toward the position
+	for i := 0; i < 2; i++ {
+		if err := r.SubmitOrder(NewLimitOrder(OrderActionBuy, "GLD", 90, 5)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.SubmitOrder(NewLimitOrder(OrderActionBuy, "GLD", 90, 1)); err == nil {
+		t.Fatal("order above the max position with active orders should be rejected")
+	}
+	if err := r.SubmitOrder(NewLimitOrder(OrderActionSell, "GLD", 110, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SubmitOrder(NewLimitOrder(OrderActionSell, "GLD", 110, 1)); err == nil {
+		t.Fatal("fourth order of the minute should be rejected")
+	}
+	pushTestBar(broker.datafeed, tm.Add(time.Minute), 100, 100, 100, 100)
+	if err := r.SubmitOrder(NewLimitOrder(OrderActionSell, "GLD", 110, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Eof() {
+		t.Fatal("rejections should be pending")
+	}
+	r.Dispatch()
+	if n := countEvents(*events, OrderEventRejected); n != 4 {
+		t.Fatal("unexpected rejected events", n)
+	}
+	if len(broker.GetActiveOrders("GLD")) != 4 {
+		t.Fatal("unexpected active orders", broker.GetActiveOrders("GLD"))
+	}
+}
+
+func TestRiskManagerKillSwitch(t *testing.T) {
+	r, broker, events, notifier := newTestRiskManager(config.RiskConfig{MaxDailyLoss: 100})
+	day := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	pushTestBar(broker.datafeed, day, 100, 100, 100, 100)
+	if err := r.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 10, false)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SubmitOrder(NewLimitOrder(OrderActionBuy, "GLD", 50, 1)); err != nil {
+		t.Fatal(err)
+	}
+	pushTestBar(broker.datafeed, day.Add(time.Hour), 100, 100, 95, 95)
+	if r.IsKillSwitchTripped() {
+		t.Fatal("a loss of 50 should not trip the kill switch")
+	}
+
+	// the day starts at the equity of the last bar of the previous day
+	pushTestBar(broker.datafeed, day.AddDate(0, 0, 1), 90, 90, 80, 84)
+	if !r.IsKillSwitchTripped() || len(notifier.subjects) != 1 {
+		t.Fatal("a loss of 110 should trip the kill switch")
+	}
+	if active := broker.GetActiveOrders("GLD"); len(active) != 1 || active[0].GetType() != OrderTypeMarket ||
+		active[0].GetAction() != OrderActionSell {
+		t.Fatal("the limit order should be canceled and the position flattened", active)
+	}
+	if err := r.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 1, false)); err == nil {
+		t.Fatal("orders should be rejected after the kill switch")
+	}
+	pushTestBar(broker.datafeed, day.AddDate(0, 0, 1).Add(time.Hour), 84, 84, 84, 84)
+	if broker.GetPosition("GLD") != 0 {
+		t.Fatal("position should be flat", broker.GetPosition("GLD"))
+	}
+	r.Dispatch()
+	if countEvents(*events, OrderEventRejected) != 1 || countEvents(*events, OrderEventCanceled) != 1 {
+		t.Fatal("unexpected events", *events)
+	}
+}
+
+func TestRiskManagerDrawdown(t *testing.T) {
+	r, broker, _, _ := newTestRiskManager(config.RiskConfig{MaxDrawdown: 0.1})
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	pushTestBar(broker.datafeed, tm, 100, 100, 100, 100)
+	if err := r.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 80, false)); err != nil {
+		t.Fatal(err)
+	}
+	pushTestBar(broker.datafeed, tm.AddDate(0, 0, 1), 100, 100, 85, 85)
+	if err := r.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 1, false)); err == nil {
+		t.Fatal("orders increasing the position should be rejected past the max drawdown")
+	}
+	if err := r.SubmitOrder(NewMarketOrder(OrderActionSell, "GLD", 40, false)); err != nil {
+		t.Fatal("orders reducing the position should be accepted", err)
+	}
+}
+
+func TestRiskManagerResampledBars(t *testing.T) {
+	r, broker, _, _ := newTestRiskManager(config.RiskConfig{MaxDailyLoss: 100})
+	day := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	push := func(tm time.Time, freq Frequency, price float64) {
+		broker.datafeed.GetNewValueEvent().Emit(tm, map[string]interface{}{
+			"GLD": NewBasicBar(tm, price, price, price, price, price, 1000, freq),
+		})
+	}
+
+	push(day.Add(10*time.Hour), MINUTE, 100)
+	if err := r.SubmitOrder(NewMarketOrder(OrderActionBuy, "GLD", 10, false)); err != nil {
+		t.Fatal(err)
+	}
+	push(day.Add(10*time.Hour+time.Minute), MINUTE, 100)
+	push(day.AddDate(0, 0, 1), MINUTE, 98)
+	// the day bar of the previous day is generated at the start of the next
+	// one with the time of its period
+	push(day, DAY, 50)
+	if r.lastPrices["GLD"] != 98 || !r.currentTime.Equal(day.AddDate(0, 0, 1)) ||
+		!r.day.Equal(day.AddDate(0, 0, 1)) {
+		t.Fatal("the day bar should be ignored", r.lastPrices, r.currentTime, r.day)
+	}
+	push(day.AddDate(0, 0, 1).Add(time.Minute), MINUTE, 92)
+	if r.IsKillSwitchTripped() {
+		t.Fatal("a loss of 80 should not trip the kill switch")
+	}
+	push(day.AddDate(0, 0, 1).Add(2*time.Minute), MINUTE, 89)
+	if !r.IsKillSwitchTripped() {
+		t.Fatal("a loss of 110 should trip the kill switch")
+	}
+}
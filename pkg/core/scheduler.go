@@ -0,0 +1,180 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// Scheduler calls functions at the times of the clock of the dispatcher.
+// The functions are called by the dispatcher in order with the values of
+// its subjects, the timers of a backtest fire at the times of the bars.
+type Scheduler interface {
+	// AddTimer calls fn after delay, and then every delay if repeat is set.
+	// The delay of a backtest starts at the first bar if the timer is added
+	// before it.
+	AddTimer(delay time.Duration, repeat bool, fn func()) uint64
+	// AddCronJob calls fn at every time of spec
+	AddCronJob(spec CronSpec, fn func()) uint64
+	// RemoveTimer removes a timer or a cron job, it returns false if it is
+	// not found, e.g. a timer which is already fired
+	RemoveTimer(id uint64) bool
+}
+
+// SchedulerUser is implemented by the components which add timers, the
+// strategy controller sets the scheduler of its dispatcher on its listener
+type SchedulerUser interface {
+	SetScheduler(scheduler Scheduler)
+}
+
+type schedulerTimer struct {
+	id     uint64
+	next   time.Time // zero until the scheduler is started
+	delay  time.Duration
+	repeat bool
+	spec   CronSpec
+	fn     func()
+}
+
+type scheduler struct {
+	mu      sync.Mutex
+	clock   Clock
+	started bool
+	nextID  uint64
+	timers  map[uint64]*schedulerTimer
+	wakeup  func()
+}
+
+func newScheduler(clock Clock) *scheduler {
+	return &scheduler{
+		clock:  clock,
+		nextID: 1,
+		timers: map[uint64]*schedulerTimer{},
+	}
+}
+
+// SetWakeupFunc implements Waker, the dispatcher is woken up when a timer
+// is added
+func (s *scheduler) SetWakeupFunc(wakeup func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wakeup = wakeup
+}
+
+// AddTimer implements Scheduler
+func (s *scheduler) AddTimer(delay time.Duration, repeat bool, fn func()) uint64 {
+	if repeat && delay < time.Millisecond {
+		delay = time.Millisecond
+	}
+	return s.add(&schedulerTimer{delay: delay, repeat: repeat, fn: fn})
+}
+
+// AddCronJob implements Scheduler
+func (s *scheduler) AddCronJob(spec CronSpec, fn func()) uint64 {
+	return s.add(&schedulerTimer{spec: spec, repeat: true, fn: fn})
+}
+
+func (s *scheduler) add(t *schedulerTimer) uint64 {
+	s.mu.Lock()
+	t.id = s.nextID
+	s.nextID++
+	if s.started {
+		s.scheduleLocked(t, s.clock.Now(), false)
+	}
+	// a cron job without a next time never fires
+	if !s.started || !t.next.IsZero() {
+		s.timers[t.id] = t
+	}
+	wakeup := s.wakeup
+	s.mu.Unlock()
+	if wakeup != nil {
+		wakeup()
+	}
+	return t.id
+}
+
+// RemoveTimer implements Scheduler
+func (s *scheduler) RemoveTimer(id uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.timers[id]; !ok {
+		return false
+	}
+	delete(s.timers, id)
+	return true
+}
+
+// scheduleLocked sets the next time of t after from, a cron job can fire at
+// from itself when the scheduler is started
+func (s *scheduler) scheduleLocked(t *schedulerTimer, from time.Time, inclusive bool) {
+	if t.spec == nil {
+		t.next = from.Add(t.delay)
+		return
+	}
+	if inclusive {
+		from = from.Add(-time.Nanosecond)
+	}
+	t.next = t.spec.Next(from)
+	if t.next.IsZero() {
+		delete(s.timers, t.id)
+	}
+}
+
+// start schedules the timers added before the first time of the clock
+func (s *scheduler) start(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	for _, t := range s.timers {
+		s.scheduleLocked(t, now, true)
+	}
+}
+
+// nextDue returns the time of the first timer, false if there is none or
+// the scheduler is not started
+func (s *scheduler) nextDue() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res time.Time
+	if !s.started {
+		return res, false
+	}
+	for _, t := range s.timers {
+		if res.IsZero() || t.next.Before(res) {
+			res = t.next
+		}
+	}
+	return res, !res.IsZero()
+}
+
+// popDue returns the first timer which is due at now and schedules it again
+// if it repeats, the timers due at the same time are returned in the order
+// they are added
+func (s *scheduler) popDue(now time.Time) (time.Time, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		return time.Time{}, nil
+	}
+	var due *schedulerTimer
+	for _, t := range s.timers {
+		if t.next.After(now) {
+			continue
+		}
+		if due == nil || t.next.Before(due.next) || (t.next.Equal(due.next) && t.id < due.id) {
+			due = t
+		}
+	}
+	if due == nil {
+		return time.Time{}, nil
+	}
+	next := due.next
+	if due.repeat {
+		s.scheduleLocked(due, next, false)
+	} else {
+		delete(s.timers, due.id)
+	}
+	return next, due.fn
+}
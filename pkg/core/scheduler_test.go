@@ -0,0 +1,146 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+)
+
+func TestCronSpec(t *testing.T) {
+	from := time.Date(2022, time.January, 7, 15, 30, 0, 0, time.UTC) // friday
+	cases := []struct {
+		spec string
+		next time.Time
+	}{
+		{"0 16 * * 1-5", time.Date(2022, time.January, 7, 16, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2022, time.January, 10, 9, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2022, time.January, 7, 15, 45, 0, 0, time.UTC)},
+		{"30 15 * * *", time.Date(2022, time.January, 8, 15, 30, 0, 0, time.UTC)},
+		{"0 0 1 */3 *", time.Date(2022, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2022, time.January, 9, 0, 0, 0, 0, time.UTC)},
+		// a stepped wildcard does not restrict the day, the odd mondays
+		{"0 9 */2 * 1", time.Date(2022, time.January, 17, 9, 0, 0, 0, time.UTC)},
+		{"0 9 1 * */2", time.Date(2022, time.February, 1, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		spec, err := ParseCronSpec(c.spec)
+		if err != nil {
+			t.Fatal(c.spec, err)
+		}
+		if next := spec.Next(from); !next.Equal(c.next) {
+			t.Error(c.spec, "unexpected next time", next)
+		}
+	}
+	for _, spec := range []string{"0 16 * *", "60 * * * *", "* * * * 1-8", "a * * * *", "*/0 * * * *"} {
+		if _, err := ParseCronSpec(spec); err == nil {
+			t.Error("invalid spec should be rejected", spec)
+		}
+	}
+}
+
+func TestSchedulerBacktest(t *testing.T) {
+	gen := NewBarFeedGenerator([]Frequency{DAY}, 100)
+	feed := NewGenericDataFeed(context.TODO(), &config.Config{}, gen, nil, 100, "")
+	start := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC) // monday
+	for i := 0; i < 5; i++ {
+		tm := start.AddDate(0, 0, i)
+		gen.AppendNewValueToBuffer(tm, map[string]interface{}{
+			"X": NewBasicBar(tm, 1, 1, 1, 1, 1, 1, DAY),
+		}, DAY)
+	}
+	gen.Finish()
+
+	d := NewDispatcher(context.TODO())
+	d.AddSubject(feed)
+	events := []string{}
+	feed.GetNewValueEvent().Subscribe(func(args ...interface{}) error {
+		events = append(events, "bar "+args[0].(time.Time).Format("01-02 15:04"))
+		return nil
+	})
+	scheduler := d.GetScheduler()
+	log := func(name string) func() {
+		return func() {
+			events = append(events, name+" "+d.GetClock().Now().Format("01-02 15:04"))
+		}
+	}
+	var interval uint64
+	interval = scheduler.AddTimer(36*time.Hour, true, func() {
+		log("interval")()
+		if d.GetClock().Now().Day() == 6 {
+			scheduler.RemoveTimer(interval)
+		}
+	})
+	scheduler.AddTimer(12*time.Hour, false, log("timeout"))
+	spec, _ := ParseCronSpec("0 16 * * 2,4")
+	scheduler.AddCronJob(spec, log("cron"))
+	d.Run()
+
+	expected := []string{
+		"bar 01-03 00:00",
+		"timeout 01-03 12:00",
+		"bar 01-04 00:00",
+		"interval 01-04 12:00",
+		"cron 01-04 16:00",
+		"bar 01-05 00:00",
+		// the timers due at the time of a bar fire before it
+		"interval 01-06 00:00",
+		"bar 01-06 00:00",
+		"cron 01-06 16:00",
+		"bar 01-07 00:00",
+	}
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Error("unexpected events", events)
+	}
+}
+
+func TestSchedulerCronWithoutNextTime(t *testing.T) {
+	clock := NewSimulatedClock()
+	now := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	clock.Advance(now)
+	s := newScheduler(clock)
+	// the 31st of february never comes
+	spec, err := ParseCronSpec("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fired := 0
+	before := s.AddCronJob(spec, func() { fired++ })
+	s.start(now)
+	after := s.AddCronJob(spec, func() { fired++ })
+	if s.RemoveTimer(before) || s.RemoveTimer(after) {
+		t.Error("the cron jobs without a next time should be dropped")
+	}
+	if _, fn := s.popDue(now.AddDate(10, 0, 0)); fn != nil || fired != 0 {
+		t.Error("the cron jobs without a next time should never fire", fired)
+	}
+}
+
+func TestSchedulerLive(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gen := NewBarFeedGenerator([]Frequency{DAY}, 100)
+	feed := NewGenericDataFeed(ctx, &config.Config{}, gen, nil, 100, "")
+	d := NewDispatcher(ctx)
+	d.SetClock(NewWallClock())
+	d.AddSubject(feed)
+	fired := make(chan time.Time, 1)
+	start := time.Now()
+	d.GetScheduler().AddTimer(100*time.Millisecond, false, func() {
+		fired <- time.Now()
+	})
+	go d.Run()
+	defer d.Stop()
+
+	select {
+	case tm := <-fired:
+		if tm.Sub(start) < 100*time.Millisecond {
+			t.Error("the timer fired too early", tm.Sub(start))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the timer should fire without bars")
+	}
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Slippage adjusts the price of simulated fills
+type Slippage interface {
+	// AdjustPrice returns the price at which quantity of the order is filled
+	// when the fill strategy would fill it at price.
+	AdjustPrice(order Order, price float64, quantity float64, bar Bar) float64
+}
+
+type noSlippage struct{}
+
+// NewNoSlippage fills orders at the price chosen by the fill strategy
+func NewNoSlippage() Slippage {
+	return &noSlippage{}
+}
+
+// AdjustPrice implements Slippage
+func (s *noSlippage) AdjustPrice(order Order, price float64, quantity float64, bar Bar) float64 {
+	return price
+}
+
+type fixedBpsSlippage struct {
+	bps float64
+}
+
+// NewFixedBpsSlippage moves the fill price against the order by a fixed
+// amount of basis points.
+func NewFixedBpsSlippage(bps float64) Slippage {
+	return &fixedBpsSlippage{
+		bps: bps,
+	}
+}
+
+// AdjustPrice implements Slippage
+func (s *fixedBpsSlippage) AdjustPrice(order Order, price float64, quantity float64, bar Bar) float64 {
+	return slipPrice(order, price, price*s.bps/10000)
+}
+
+type volumeShareSlippage struct {
+	priceImpact float64
+}
+
+// NewVolumeShareSlippage is the slippage model of PyAlgoTrade and zipline.
+// The price moves by priceImpact * (quantity / bar volume) ^ 2 of the price.
+// Bars without volume do not slip.
+func NewVolumeShareSlippage(priceImpact float64) Slippage {
+	return &volumeShareSlippage{
+		priceImpact: priceImpact,
+	}
+}
+
+// AdjustPrice implements Slippage
+func (s *volumeShareSlippage) AdjustPrice(order Order, price float64, quantity float64, bar Bar) float64 {
+	if bar.Volume() <= 0 {
+		return price
+	}
+	volumeShare := math.Min(quantity/float64(bar.Volume()), 1)
+	return slipPrice(order, price, price*volumeShare*volumeShare*s.priceImpact)
+}
+
+type halfSpreadSlippage struct {
+	spread float64
+}
+
+// NewHalfSpreadSlippage treats bar prices as mid prices. Buys pay half of
+// the spread above them and sells receive half of the spread below them.
+func NewHalfSpreadSlippage(spread float64) Slippage {
+	return &halfSpreadSlippage{
+		spread: spread,
+	}
+}
+
+// AdjustPrice implements Slippage
+func (s *halfSpreadSlippage) AdjustPrice(order Order, price float64, quantity float64, bar Bar) float64 {
+	return slipPrice(order, price, s.spread/2)
+}
+
+func slipPrice(order Order, price, amount float64) float64 {
+	if order.GetAction().IsBuy() {
+		return price + amount
+	}
+	return price - amount
+}
+
+func newSlippage(slippageType string, amount float64) (Slippage, error) {
+	switch strings.ToLower(slippageType) {
+	case "", "none":
+		return NewNoSlippage(), nil
+	case "fixedbps":
+		return NewFixedBpsSlippage(amount), nil
+	case "volumeshare":
+		return NewVolumeShareSlippage(amount), nil
+	case "halfspread":
+		return NewHalfSpreadSlippage(amount), nil
+	default:
+		return nil, fmt.Errorf("unknown slippage type %s", slippageType)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"sync"
 	"time"
 
-	"goat/pkg/common"
 	"goat/pkg/config"
 	"goat/pkg/db"
 	"goat/pkg/logger"
@@ -16,14 +15,6 @@ import (
 	"go.uber.org/zap"
 )
 
-type Order interface{}
-
-type OrderEvent interface {
-	GetOrder() Order
-	GetEventType()
-	GetEventInfo()
-}
-
 type StrategyEventListener interface {
 	OnStart(args ...interface{}) error
 	OnIdle() error
@@ -36,6 +27,12 @@ type StrategyEventListener interface {
 type StrategyController interface {
 	Run()
 	Stop()
+	// AttachAnalyzer attaches an analyzer, it must be called before Run
+	AttachAnalyzer(analyzer Analyzer)
+	GetAnalyzers() []Analyzer
+	// SetClock replaces the simulated clock of backtests, e.g. with the
+	// wall clock in live trading. It must be called before Run
+	SetClock(clock Clock)
 }
 
 type strategyEventListener struct{}
@@ -90,7 +87,9 @@ type strategyController struct {
 
 	dispatcher Dispatcher
 
-	barProcessedEvent Event
+	barProcessedEvent   Event
+	orderProcessedEvent Event
+	analyzers           []Analyzer
 
 	barDataDumpC chan *db.BarData
 	closeC       chan struct{}
@@ -104,7 +103,6 @@ func (s *strategyController) onStart(args ...interface{}) error {
 
 func (s *strategyController) onIdle(args ...interface{}) error {
 	// logger.Logger.Info("onIdle")
-	time.Sleep(common.IdleSleepDuration)
 	return s.listener.OnIdle()
 }
 
@@ -207,17 +205,16 @@ func (s *strategyController) onBars(args ...interface{}) error {
 }
 
 func (s *strategyController) onOrderEvent(args ...interface{}) error {
-	logger.Logger.Info("onOrderEvent")
 	if len(args) != 2 {
 		return fmt.Errorf("onOrderEvent args length should be 2")
 	}
 
-	broker := args[0].(Broker)
 	orderEvent := args[1].(OrderEvent)
 
 	logger.Logger.Info("onOrderEvent",
-		zap.Any("broker", broker),
-		zap.Any("orderEvent", orderEvent))
+		zap.String("type", orderEvent.GetEventType().String()),
+		zap.String("order", orderEvent.GetOrder().String()),
+		zap.Any("info", orderEvent.GetEventInfo()))
 
 	s.listener.OnOrderUpdated(orderEvent.GetOrder())
 
@@ -234,11 +231,32 @@ func (s *strategyController) onOrderEvent(args ...interface{}) error {
 	*/
 
 	s.listener.OnOrderEvent(orderEvent)
+	s.orderProcessedEvent.Emit(orderEvent)
 
 	return nil
 }
 
+func (s *strategyController) AttachAnalyzer(analyzer Analyzer) {
+	s.analyzers = append(s.analyzers, analyzer)
+	s.barProcessedEvent.Subscribe(func(args ...interface{}) error {
+		return analyzer.OnBars(args[0].(Bars))
+	})
+	s.orderProcessedEvent.Subscribe(func(args ...interface{}) error {
+		return analyzer.OnOrderEvent(args[0].(OrderEvent))
+	})
+}
+
+func (s *strategyController) GetAnalyzers() []Analyzer {
+	return s.analyzers
+}
+
 func (s *strategyController) Run() {
+	if user, ok := s.listener.(ClockUser); ok {
+		user.SetClock(s.dispatcher.GetClock())
+	}
+	if user, ok := s.listener.(SchedulerUser); ok {
+		user.SetScheduler(s.dispatcher.GetScheduler())
+	}
 	s.dispatcher.Run()
 	s.listener.OnFinish()
 	s.closeC <- struct{}{}
@@ -246,6 +264,11 @@ func (s *strategyController) Run() {
 	s.dumpWg.Wait()
 }
 
+// SetClock implements StrategyController
+func (s *strategyController) SetClock(clock Clock) {
+	s.dispatcher.SetClock(clock)
+}
+
 func (s *strategyController) Stop() {
 	s.dispatcher.Stop()
 }
@@ -254,17 +277,18 @@ func NewStrategyController(ctx context.Context, cfg *config.Config, strategyEven
 	broker Broker, dataFeed DataFeed,
 ) StrategyController {
 	controller := &strategyController{
-		ctx:               ctx,
-		cfg:               cfg,
-		dumpDB:            nil,
-		listener:          strategyEventListener,
-		broker:            broker,
-		dataFeed:          dataFeed,
-		dispatcher:        NewDispatcher(ctx),
-		barProcessedEvent: NewEvent(),
-		barDataDumpC:      make(chan *db.BarData, 1000),
-		closeC:            make(chan struct{}, 1),
-		dumpWg:            sync.WaitGroup{},
+		ctx:                 ctx,
+		cfg:                 cfg,
+		dumpDB:              nil,
+		listener:            strategyEventListener,
+		broker:              broker,
+		dataFeed:            dataFeed,
+		dispatcher:          NewDispatcher(ctx),
+		barProcessedEvent:   NewEvent(),
+		orderProcessedEvent: NewEvent(),
+		barDataDumpC:        make(chan *db.BarData, 1000),
+		closeC:              make(chan struct{}, 1),
+		dumpWg:              sync.WaitGroup{},
 	}
 
 	var err error
@@ -30,3 +30,61 @@ func TestDBOpen(t *testing.T) {
 	}
 	assert.NotNil(t, db2)
 }
+
+func TestPaperBook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goat-paper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := NewSQLiteDataBase(dir+"/paper.db", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book, err := db.LoadPaperBook()
+	assert.Nil(t, err)
+	assert.Nil(t, book)
+
+	err = db.SavePaperBook(&PaperBook{
+		Account:   PaperAccount{Cash: 900, NextOrderID: 3, LastBarTime: 10, LastFinancingDay: 5, FinancingCost: 1},
+		Positions: []PaperPosition{{Instrument: "GLD", Quantity: 1}},
+		Prices:    []PaperPrice{{Instrument: "EURUSD", Price: 1.1}, {Instrument: "GLD", Price: 100}},
+		Orders: []PaperOrder{
+			{ID: 1, Instrument: "GLD", State: "FILLED", Data: "{}"},
+			{ID: 2, Instrument: "GLD", State: "SUBMITTED", Data: "{}"},
+		},
+		Fills: []PaperFill{{OrderID: 1, Instrument: "GLD", Action: "BUY", Price: 100, Quantity: 1}},
+	}, true)
+	assert.Nil(t, err)
+
+	book, err = db.LoadPaperBook()
+	assert.Nil(t, err)
+	assert.Equal(t, PaperAccount{ID: 1, Cash: 900, NextOrderID: 3, LastBarTime: 10, LastFinancingDay: 5, FinancingCost: 1},
+		book.Account)
+	assert.Equal(t, []PaperPrice{{Instrument: "EURUSD", Price: 1.1}, {Instrument: "GLD", Price: 100}}, book.Prices)
+
+	// incremental save
+	err = db.SavePaperBook(&PaperBook{
+		Account: PaperAccount{Cash: 1000, NextOrderID: 3, LastBarTime: 20},
+		Orders:  []PaperOrder{{ID: 2, Instrument: "GLD", State: "CANCELED", Data: "{}"}},
+	}, false)
+	assert.Nil(t, err)
+
+	book, err = db.LoadPaperBook()
+	assert.Nil(t, err)
+	assert.Equal(t, PaperAccount{ID: 1, Cash: 1000, NextOrderID: 3, LastBarTime: 20}, book.Account)
+	assert.Empty(t, book.Positions)
+	assert.Empty(t, book.Prices)
+	assert.Len(t, book.Orders, 2)
+	assert.Equal(t, "CANCELED", book.Orders[1].State)
+	assert.Len(t, book.Fills, 1)
+
+	// replacing drops the previous orders and fills
+	err = db.SavePaperBook(&PaperBook{Account: PaperAccount{Cash: 5}}, true)
+	assert.Nil(t, err)
+	book, err = db.LoadPaperBook()
+	assert.Nil(t, err)
+	assert.Empty(t, book.Orders)
+	assert.Empty(t, book.Fills)
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PaperAccount is the account of the paper broker, the table has one row
+type PaperAccount struct {
+	ID          uint    `gorm:"primaryKey" json:"id"`
+	Cash        float64 `json:"cash"`
+	NextOrderID uint64  `json:"nextOrderId"`
+	LastBarTime int64   `json:"lastBarTime"` // unix nano of the last processed bar
+	// unix nano of the last day the margin financing was charged
+	LastFinancingDay int64   `json:"lastFinancingDay"`
+	FinancingCost    float64 `json:"financingCost"` // total financing charged
+}
+
+// PaperPosition is the position of one instrument of the paper broker
+type PaperPosition struct {
+	Instrument string  `gorm:"primaryKey" json:"instrument"`
+	Quantity   float64 `json:"quantity"`
+}
+
+// PaperPrice is the last price of an instrument of the paper broker, the
+// positions are marked with it until the next bar
+type PaperPrice struct {
+	Instrument string  `gorm:"primaryKey" json:"instrument"`
+	Price      float64 `json:"price"`
+}
+
+// PaperOrder is an order of the paper broker, Data is the json encoded order
+type PaperOrder struct {
+	ID         uint64 `gorm:"primaryKey;autoIncrement:false" json:"id"`
+	Instrument string `json:"instrument"`
+	State      string `json:"state"`
+	Data       string `json:"data"`
+}
+
+// PaperFill is one execution of an order of the paper broker
+type PaperFill struct {
+	ID         uint    `gorm:"primaryKey" json:"id"`
+	OrderID    uint64  `gorm:"index" json:"orderId"`
+	Instrument string  `json:"instrument"`
+	Action     string  `json:"action"`
+	Price      float64 `json:"price"`
+	Quantity   float64 `json:"quantity"`
+	Commission float64 `json:"commission"`
+	DateTime   int64   `json:"dateTime"` // unix nano
+	FXRate     float64 `json:"fxRate"`   // rate of the fill price to the base currency
+}
+
+// PaperBook is the persisted state of the paper broker
+type PaperBook struct {
+	Account   PaperAccount
+	Positions []PaperPosition
+	Prices    []PaperPrice
+	Orders    []PaperOrder
+	Fills     []PaperFill
+}
+
+func (db *DB) migratePaperBook() error {
+	return db.AutoMigrate(&PaperAccount{}, &PaperPosition{}, &PaperPrice{}, &PaperOrder{}, &PaperFill{})
+}
+
+// LoadPaperBook reads the book of the paper broker, it returns nil if the
+// database has no book
+func (db *DB) LoadPaperBook() (*PaperBook, error) {
+	if !db.Migrator().HasTable(&PaperAccount{}) {
+		return nil, nil
+	}
+	if err := db.migratePaperBook(); err != nil {
+		return nil, err
+	}
+	accounts := []PaperAccount{}
+	if err := db.Limit(1).Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		return nil, nil
+	}
+	book := &PaperBook{Account: accounts[0]}
+	if err := db.Order("instrument").Find(&book.Positions).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Order("instrument").Find(&book.Prices).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Order("id").Find(&book.Orders).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Order("id").Find(&book.Fills).Error; err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+// SavePaperBook writes the book of the paper broker in one transaction. The
+// account, the positions and the prices are replaced, the orders are upserted and the
+// fills are appended, so only the changed orders and the new fills need to
+// be passed. With replace, the previous book is deleted first.
+func (db *DB) SavePaperBook(book *PaperBook, replace bool) error {
+	if err := db.migratePaperBook(); err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		models := []interface{}{&PaperAccount{}, &PaperPosition{}, &PaperPrice{}}
+		if replace {
+			models = append(models, &PaperOrder{}, &PaperFill{})
+		}
+		for _, model := range models {
+			if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		account := book.Account
+		account.ID = 1
+		if err := tx.Create(&account).Error; err != nil {
+			return err
+		}
+		if len(book.Positions) > 0 {
+			if err := tx.Create(&book.Positions).Error; err != nil {
+				return err
+			}
+		}
+		if len(book.Prices) > 0 {
+			if err := tx.Create(&book.Prices).Error; err != nil {
+				return err
+			}
+		}
+		if len(book.Orders) > 0 {
+			if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&book.Orders).Error; err != nil {
+				return err
+			}
+		}
+		if len(book.Fills) > 0 {
+			if err := tx.Create(&book.Fills).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
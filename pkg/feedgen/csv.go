@@ -64,6 +64,13 @@ func (c *CSVFeedGenerator) Finish() {
 	c.barfeed.Finish()
 }
 
+// SetWakeupFunc implements core.Waker
+func (c *CSVFeedGenerator) SetWakeupFunc(wakeup func()) {
+	if waker, ok := c.barfeed.(core.Waker); ok {
+		waker.SetWakeupFunc(wakeup)
+	}
+}
+
 // PeekNextTime implements core.FeedGenerator
 func (c *CSVFeedGenerator) PeekNextTime() *time.Time {
 	return c.barfeed.PeekNextTime()
@@ -259,10 +266,8 @@ func (c *CSVFeedGenerator) parseRawToBar(dict map[string]string) (string,
 	if err != nil {
 		adjClose = .0
 	}
+	// the adjusted values are used if the feed is in adjusted mode
 	bar := core.NewBasicBar(dateTime, open, high, low, closeVal, adjClose,
 		int64(volume), frequency)
-	if c.haveAdjClose {
-		bar.SetUseAdjustedValue(true)
-	}
 	return symbol, bar, nil
 }
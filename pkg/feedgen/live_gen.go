@@ -57,6 +57,13 @@ func (l *LiveBarFeedGenerator) Finish() {
 	l.bfg.Finish()
 }
 
+// SetWakeupFunc implements core.Waker
+func (l *LiveBarFeedGenerator) SetWakeupFunc(wakeup func()) {
+	if waker, ok := l.bfg.(core.Waker); ok {
+		waker.SetWakeupFunc(wakeup)
+	}
+}
+
 func (l *LiveBarFeedGenerator) IsComplete() bool {
 	return l.bfg.IsComplete()
 }
@@ -51,6 +51,13 @@ func (l *MultiLiveBarFeedGenerator) Finish() {
 	l.bfg.Finish()
 }
 
+// SetWakeupFunc implements core.Waker
+func (l *MultiLiveBarFeedGenerator) SetWakeupFunc(wakeup func()) {
+	if waker, ok := l.bfg.(core.Waker); ok {
+		waker.SetWakeupFunc(wakeup)
+	}
+}
+
 func (l *MultiLiveBarFeedGenerator) IsComplete() bool {
 	return l.bfg.IsComplete()
 }
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"goat/pkg/core"
@@ -15,7 +16,8 @@ import (
 	"go.uber.org/zap"
 )
 
-var goldPriceOrgSupportedSymbols []string = []string{"XAUUSD", "XAGUSD"}
+// the symbols are a metal followed by a quote currency, e.g. XAUUSD or XAGEUR
+var goldPriceOrgSupportedMetals []string = []string{"XAU", "XAG"}
 
 type GoldPriceOrgBar struct {
 	Timestamp  uint64 `json:"ts"`
@@ -42,7 +44,8 @@ type goldPriceOrgDataProvider struct {
 
 func (f *goldPriceOrgDataProvider) getOneBar(instrument string) (core.Bar, error) {
 	barRaw := GoldPriceOrgBar{}
-	reqUrl := "https://data-asg.goldprice.org/dbXRates/USD"
+	currency := instrument[3:]
+	reqUrl := "https://data-asg.goldprice.org/dbXRates/" + currency
 	if resp, err := f.sendRequest(reqUrl); err != nil {
 		log.Printf("error sending request: %v", err)
 		return nil, err
@@ -56,15 +59,15 @@ func (f *goldPriceOrgDataProvider) getOneBar(instrument string) (core.Bar, error
 			return nil, fmt.Errorf("unexpected number of items in response: %d", len(barRaw.Items))
 		}
 
-		if barRaw.Items[0].Currency != "USD" {
+		if barRaw.Items[0].Currency != currency {
 			return nil, fmt.Errorf("unexpected currency in response: %s", barRaw.Items[0].Currency)
 		}
 
 		t := time.Unix(int64(barRaw.Timestamp2/1000), 0)
 
-		if instrument == "XAUUSD" {
+		if instrument[:3] == "XAU" {
 			return core.NewBasicBar(t, barRaw.Items[0].XauPrice, barRaw.Items[0].XauPrice, barRaw.Items[0].XauPrice, barRaw.Items[0].XauPrice, barRaw.Items[0].XauPrice, 0, core.REALTIME), nil
-		} else if instrument == "XAGUSD" {
+		} else if instrument[:3] == "XAG" {
 			return core.NewBasicBar(t, barRaw.Items[0].XagPrice, barRaw.Items[0].XagPrice, barRaw.Items[0].XagPrice, barRaw.Items[0].XagPrice, barRaw.Items[0].XagPrice, 0, core.REALTIME), nil
 		} else {
 			return nil, fmt.Errorf("unexpected instrument: %s", instrument)
@@ -98,8 +101,8 @@ func (f *goldPriceOrgDataProvider) sendRequest(reqUrl string) (string, error) {
 func (f *goldPriceOrgDataProvider) init(instrument string, freqList []core.Frequency) error {
 	found := false
 
-	for _, sym := range goldPriceOrgSupportedSymbols {
-		if sym == instrument {
+	for _, metal := range goldPriceOrgSupportedMetals {
+		if len(instrument) == 6 && strings.HasPrefix(instrument, metal) {
 			found = true
 			break
 		}
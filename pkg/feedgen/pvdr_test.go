@@ -157,7 +157,9 @@ func TestMultiProviders(t *testing.T) {
 
 	feed := core.NewGenericDataFeed(context.TODO(), &config.Config{}, gen, nil, 100, "")
 
-	rt := js.NewStrategyRuntime(context.TODO(), &cfg, feed, startLive)
+	broker := core.NewDummyBroker(feed)
+	portfolio := core.NewPortfolio(broker, feed, 0)
+	rt := js.NewStrategyRuntime(context.TODO(), &cfg, feed, broker, portfolio, startLive)
 	script, err := ioutil.ReadFile("../../samples/strategies/simple.js")
 	if err != nil {
 		logger.Logger.Error("failed to read script file", zap.Error(err))
@@ -168,8 +170,8 @@ func TestMultiProviders(t *testing.T) {
 		os.Exit(1)
 	} else {
 		sel := js.NewJSStrategyEventListener(rt)
-		broker := core.NewDummyBroker(feed)
 		strategy := core.NewStrategyController(context.TODO(), &cfg, sel, broker, feed)
+		strategy.SetClock(core.NewWallClock())
 
 		if val, err := rt.Execute(compiledScript); err != nil {
 			fmt.Println(err)
@@ -0,0 +1,102 @@
+package feedgen
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"goat/pkg/common"
+	"goat/pkg/core"
+)
+
+// FeedValue is one batch of values popped from a feed generator
+type FeedValue struct {
+	DateTime  time.Time
+	Values    map[string]interface{}
+	Frequency core.Frequency
+}
+
+// ReadAllValues pops every value of gen until it is complete. It is used to
+// load a data source once and replay it in many backtests.
+func ReadAllValues(ctx context.Context, gen core.FeedGenerator) ([]FeedValue, error) {
+	res := []FeedValue{}
+	for {
+		t, v, f, err := gen.PopNextValues()
+		if err != nil {
+			if gen.IsComplete() {
+				return res, nil
+			}
+			return nil, err
+		}
+		if v == nil {
+			if gen.IsComplete() {
+				return res, nil
+			}
+			// the generator is still loading its data
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(common.IdleSleepDuration):
+			}
+			continue
+		}
+		res = append(res, FeedValue{DateTime: t, Values: v, Frequency: f})
+	}
+}
+
+type ReplayFeedGenerator struct {
+	values []FeedValue
+	next   int
+}
+
+// IsComplete implements core.FeedGenerator
+func (r *ReplayFeedGenerator) IsComplete() bool {
+	return r.next >= len(r.values)
+}
+
+// AppendNewValueToBuffer implements core.FeedGenerator
+func (r *ReplayFeedGenerator) AppendNewValueToBuffer(time.Time, map[string]interface{},
+	core.Frequency,
+) error {
+	return fmt.Errorf("replay feed generator is read only")
+}
+
+// CreateDataSeries implements core.FeedGenerator
+func (r *ReplayFeedGenerator) CreateDataSeries(key string, maxLen int) core.DataSeries {
+	return core.NewBarDataSeries(maxLen, false)
+}
+
+// Finish implements core.FeedGenerator
+func (r *ReplayFeedGenerator) Finish() {
+	r.next = len(r.values)
+}
+
+// PeekNextTime implements core.FeedGenerator
+func (r *ReplayFeedGenerator) PeekNextTime() *time.Time {
+	if r.IsComplete() {
+		return nil
+	}
+	t := r.values[r.next].DateTime
+	return &t
+}
+
+// PopNextValues implements core.FeedGenerator
+func (r *ReplayFeedGenerator) PopNextValues() (time.Time, map[string]interface{},
+	core.Frequency, error,
+) {
+	if r.IsComplete() {
+		return time.Time{}, nil, 0, fmt.Errorf("feed generator is EOF")
+	}
+	v := r.values[r.next]
+	r.next++
+	return v.DateTime, v.Values, v.Frequency, nil
+}
+
+// NewReplayFeedGenerator creates a feed generator which replays values. The
+// values are not copied, so several generators can replay the same values
+// in parallel as long as nobody modifies them.
+func NewReplayFeedGenerator(values []FeedValue) core.FeedGenerator {
+	return &ReplayFeedGenerator{
+		values: values,
+	}
+}
@@ -0,0 +1,43 @@
+package feedgen
+
+import (
+	"context"
+	"testing"
+
+	"goat/pkg/core"
+)
+
+func TestReplayFeedGenerator(t *testing.T) {
+	gen := NewCSVBarFeedGenerator(
+		"../../samples/data/DBC-2007-yahoofinance.csv", "Symbol",
+		core.UNKNOWN)
+	values, err := ReadAllValues(context.TODO(), gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 251 {
+		t.Fatalf("expected 251 values, got %d", len(values))
+	}
+
+	// generators replaying the same values do not affect each other
+	gen1 := NewReplayFeedGenerator(values[:10])
+	gen2 := NewReplayFeedGenerator(values[:10])
+	for i := 0; i < 10; i++ {
+		if tm := gen1.PeekNextTime(); tm == nil || !tm.Equal(values[i].DateTime) {
+			t.Fatalf("unexpected next time %v", tm)
+		}
+		tm, v, _, err := gen1.PopNextValues()
+		if err != nil || !tm.Equal(values[i].DateTime) || v == nil {
+			t.Fatalf("unexpected value %v %v %v", tm, v, err)
+		}
+	}
+	if !gen1.IsComplete() || gen1.PeekNextTime() != nil {
+		t.Error("generator should be complete")
+	}
+	if _, _, _, err := gen1.PopNextValues(); err == nil {
+		t.Error("expected EOF error")
+	}
+	if gen2.IsComplete() {
+		t.Error("second generator should not be complete")
+	}
+}
@@ -12,6 +12,9 @@ import (
 	"go.uber.org/zap"
 )
 
+// yahooHistoryYears is the history loaded from yahoo
+const yahooHistoryYears = 5
+
 type YahooFeedGenerator struct {
 	barfeed      core.FeedGenerator
 	haveAdjClose bool
@@ -47,6 +50,13 @@ func (y *YahooFeedGenerator) Finish() {
 	y.barfeed.Finish()
 }
 
+// SetWakeupFunc implements core.Waker
+func (y *YahooFeedGenerator) SetWakeupFunc(wakeup func()) {
+	if waker, ok := y.barfeed.(core.Waker); ok {
+		waker.SetWakeupFunc(wakeup)
+	}
+}
+
 // PeekNextTime implements core.FeedGenerator
 func (y *YahooFeedGenerator) PeekNextTime() *time.Time {
 	return y.barfeed.PeekNextTime()
@@ -67,7 +77,7 @@ func NewYahooBarFeedGenerator(instrument string, freq core.Frequency) core.FeedG
 
 	params := &chart.Params{
 		Symbol:   instrument,
-		Start:    datetime.FromUnix(int(time.Now().AddDate(-5, 0, 0).Unix())),
+		Start:    datetime.FromUnix(int(time.Now().AddDate(-yahooHistoryYears, 0, 0).Unix())),
 		End:      datetime.FromUnix(int(time.Now().Unix())),
 		Interval: freqMapping[freq],
 	}
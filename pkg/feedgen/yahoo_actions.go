@@ -0,0 +1,101 @@
+package feedgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"goat/pkg/core"
+)
+
+const yahooChartEventsURL = "https://query1.finance.yahoo.com/v8/finance/chart/%s" +
+	"?period1=%d&period2=%d&interval=1d&events=div%%7Csplit"
+
+type yahooChartEvents struct {
+	Chart struct {
+		Result []struct {
+			Events struct {
+				Dividends map[string]struct {
+					Amount float64 `json:"amount"`
+					Date   int64   `json:"date"`
+				} `json:"dividends"`
+				Splits map[string]struct {
+					Date        int64   `json:"date"`
+					Numerator   float64 `json:"numerator"`
+					Denominator float64 `json:"denominator"`
+				} `json:"splits"`
+			} `json:"events"`
+		} `json:"result"`
+		Error *struct {
+			Code        string `json:"code"`
+			Description string `json:"description"`
+		} `json:"error"`
+	} `json:"chart"`
+}
+
+// LoadYahooCorporateActions fetches the splits and dividends of symbol over
+// the period loaded by the yahoo feed generator
+func LoadYahooCorporateActions(symbol string) ([]core.CorporateAction, error) {
+	end := time.Now()
+	start := end.AddDate(-yahooHistoryYears, 0, 0)
+	req, err := http.NewRequest("GET", fmt.Sprintf(yahooChartEventsURL, symbol, start.Unix(), end.Unix()), nil)
+	if err != nil {
+		return nil, err
+	}
+	// yahoo refuses the requests without a browser user agent
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+
+	client := &http.Client{
+		Timeout: RequestTimeoutDuration,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseYahooCorporateActions(symbol, body)
+}
+
+func parseYahooCorporateActions(symbol string, data []byte) ([]core.CorporateAction, error) {
+	events := yahooChartEvents{}
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, err
+	}
+	if e := events.Chart.Error; e != nil {
+		return nil, fmt.Errorf("yahoo error %s: %s", e.Code, e.Description)
+	}
+
+	res := []core.CorporateAction{}
+	for _, result := range events.Chart.Result {
+		for _, d := range result.Events.Dividends {
+			res = append(res, core.CorporateAction{
+				Instrument: symbol,
+				Type:       core.CorporateActionDividend,
+				DateTime:   time.Unix(d.Date, 0).UTC(),
+				Amount:     d.Amount,
+			})
+		}
+		for _, s := range result.Events.Splits {
+			if s.Numerator <= 0 || s.Denominator <= 0 {
+				return nil, fmt.Errorf("invalid split %g:%g of %s", s.Numerator, s.Denominator, symbol)
+			}
+			res = append(res, core.CorporateAction{
+				Instrument: symbol,
+				Type:       core.CorporateActionSplit,
+				DateTime:   time.Unix(s.Date, 0).UTC(),
+				Ratio:      s.Numerator / s.Denominator,
+			})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].DateTime.Before(res[j].DateTime)
+	})
+	return res, nil
+}
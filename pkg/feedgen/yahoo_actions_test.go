@@ -0,0 +1,28 @@
+package feedgen
+
+import (
+	"testing"
+
+	"goat/pkg/core"
+)
+
+func TestParseYahooCorporateActions(t *testing.T) {
+	data := `{"chart": {"result": [{"events": {
+		"dividends": {"1644849000": {"amount": 0.22, "date": 1644849000}},
+		"splits": {"1598880600": {"date": 1598880600, "numerator": 4, "denominator": 1, "splitRatio": "4:1"}}
+	}}], "error": null}}`
+	actions, err := parseYahooCorporateActions("AAPL", []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 || actions[0].Type != core.CorporateActionSplit || actions[0].Ratio != 4 ||
+		actions[1].Type != core.CorporateActionDividend || actions[1].Amount != 0.22 ||
+		actions[1].Instrument != "AAPL" || actions[1].DateTime.Unix() != 1644849000 {
+		t.Fatal("unexpected actions", actions)
+	}
+
+	data = `{"chart": {"result": null, "error": {"code": "Not Found", "description": "No data found"}}}`
+	if _, err := parseYahooCorporateActions("NONE", []byte(data)); err == nil {
+		t.Fatal("yahoo error should fail")
+	}
+}
@@ -0,0 +1,594 @@
+package fix
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"goat/pkg/config"
+	"goat/pkg/core"
+	"goat/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Broker routes orders to a FIX 4.4 counterparty
+type Broker interface {
+	core.Broker
+	// ReplaceOrder sends an OrderCancelReplaceRequest to change the quantity
+	// and the prices of an active order. The order is updated when the
+	// counterparty confirms the replacement.
+	ReplaceOrder(order core.Order, quantity, limitPrice, stopPrice float64) error
+	// IsLoggedOn returns true if the FIX session is logged on
+	IsLoggedOn() bool
+}
+
+// replaceRequest is an OrderCancelReplaceRequest waiting for its
+// execution report
+type replaceRequest struct {
+	orderID    uint64
+	quantity   float64
+	limitPrice float64
+	stopPrice  float64
+}
+
+type fixBroker struct {
+	mu                sync.Mutex
+	cfg               *config.Config
+	ctx               context.Context
+	initiator         *Initiator
+	orderUpdatedEvent core.Event
+
+	cash         float64
+	positions    map[string]float64
+	orders       map[uint64]*core.BasicOrder
+	activeOrders map[uint64]*core.BasicOrder
+	nextOrderID  uint64
+
+	// ClOrdIDs are unique across restarts, they start with the time the
+	// broker is created
+	clOrdIDPrefix string
+	clOrdIDs      map[string]uint64 // every ClOrdID sent to its order
+	lastClOrdID   map[uint64]string // ClOrdID of the last accepted request of an order
+	revisions     map[uint64]int
+	replaces      map[string]*replaceRequest
+	execIDs       map[string]bool
+
+	pendingEvents []core.OrderEvent
+	// wakeup tells the dispatcher that the session queued order events
+	wakeup func()
+	clock  core.Clock
+}
+
+// NewBroker creates a broker which sends the orders over the FIX session of
+// cfg.Broker.FIX. The session is started by Start.
+func NewBroker(ctx context.Context, cfg *config.Config) (Broker, error) {
+	fixCfg := cfg.Broker.FIX
+	if fixCfg.Addr == "" || fixCfg.SenderCompID == "" || fixCfg.TargetCompID == "" {
+		return nil, fmt.Errorf("fix broker needs addr, sendercompid and targetcompid")
+	}
+	store := NewMemoryStore()
+	if fixCfg.StoreDir != "" {
+		var err error
+		store, err = NewFileStore(fixCfg.StoreDir, fixCfg.SenderCompID, fixCfg.TargetCompID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b := &fixBroker{
+		cfg:               cfg,
+		ctx:               ctx,
+		orderUpdatedEvent: core.NewEvent(),
+		cash:              cfg.Broker.Cash,
+		positions:         map[string]float64{},
+		orders:            map[uint64]*core.BasicOrder{},
+		activeOrders:      map[uint64]*core.BasicOrder{},
+		nextOrderID:       1,
+		clOrdIDPrefix:     strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 36),
+		clOrdIDs:          map[string]uint64{},
+		lastClOrdID:       map[uint64]string{},
+		revisions:         map[uint64]int{},
+		replaces:          map[string]*replaceRequest{},
+		execIDs:           map[string]bool{},
+	}
+	settings := SessionSettings{
+		SenderCompID: fixCfg.SenderCompID,
+		TargetCompID: fixCfg.TargetCompID,
+		HeartBtInt:   time.Duration(fixCfg.HeartBtInt) * time.Second,
+		ResetOnLogon: fixCfg.ResetOnLogon,
+	}
+	b.initiator = NewInitiator(fixCfg.Addr, settings, store, b, 0)
+	return b, nil
+}
+
+// Start implements core.Subject
+func (b *fixBroker) Start() error {
+	b.initiator.Start(b.ctx)
+	return nil
+}
+
+// Stop implements core.Subject
+func (b *fixBroker) Stop() error {
+	b.initiator.Stop()
+	return b.initiator.Session().Store().Close()
+}
+
+// Join implements core.Subject
+func (b *fixBroker) Join() error {
+	return nil
+}
+
+// SetWakeupFunc implements core.Waker
+func (b *fixBroker) SetWakeupFunc(wakeup func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.wakeup = wakeup
+}
+
+// SetClock implements core.ClockUser
+func (b *fixBroker) SetClock(clock core.Clock) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clock = clock
+}
+
+// now returns the time of the clock, the wall time without a clock. b.mu
+// should be locked.
+func (b *fixBroker) now() time.Time {
+	if b.clock == nil {
+		return time.Now().UTC()
+	}
+	return b.clock.Now()
+}
+
+// Eof implements core.Subject
+func (b *fixBroker) Eof() bool {
+	// the broker only needs to be dispatched when there are order events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pendingEvents) == 0
+}
+
+// Dispatch implements core.Subject
+func (b *fixBroker) Dispatch() bool {
+	emitted := false
+	for {
+		b.mu.Lock()
+		if len(b.pendingEvents) == 0 {
+			b.mu.Unlock()
+			return emitted
+		}
+		event := b.pendingEvents[0]
+		b.pendingEvents = b.pendingEvents[1:]
+		b.mu.Unlock()
+
+		b.orderUpdatedEvent.Emit(b, event)
+		emitted = true
+	}
+}
+
+// PeekDateTime implements core.Subject
+func (b *fixBroker) PeekDateTime() *time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.now()
+	return &t
+}
+
+// IsLoggedOn implements Broker
+func (b *fixBroker) IsLoggedOn() bool {
+	return b.initiator.Session().IsLoggedOn()
+}
+
+// GetOrderUpdatedEvent implements core.Broker
+func (b *fixBroker) GetOrderUpdatedEvent() core.Event {
+	return b.orderUpdatedEvent
+}
+
+// GetCash implements core.Broker. The cash is the initial cash of the
+// config adjusted by the fills of the session.
+func (b *fixBroker) GetCash() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cash
+}
+
+// GetPositions implements core.Broker
+func (b *fixBroker) GetPositions() map[string]float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	res := make(map[string]float64, len(b.positions))
+	for k, v := range b.positions {
+		res[k] = v
+	}
+	return res
+}
+
+// GetPosition implements core.Broker
+func (b *fixBroker) GetPosition(instrument string) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.positions[instrument]
+}
+
+// GetOrder implements core.Broker
+func (b *fixBroker) GetOrder(id uint64) core.Order {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if o, ok := b.orders[id]; ok {
+		return o
+	}
+	return nil
+}
+
+// GetActiveOrders implements core.Broker
+func (b *fixBroker) GetActiveOrders(instrument string) []core.Order {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ids := make([]uint64, 0, len(b.activeOrders))
+	for id, o := range b.activeOrders {
+		if instrument == "" || o.Instrument == instrument {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	res := make([]core.Order, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, b.activeOrders[id])
+	}
+	return res
+}
+
+// SubmitOrder implements core.Broker, it sends a NewOrderSingle
+func (b *fixBroker) SubmitOrder(order core.Order) error {
+	o, ok := order.(*core.BasicOrder)
+	if !ok {
+		return fmt.Errorf("unsupported order implementation %T", order)
+	}
+	if o.State != core.OrderStateInitial {
+		return fmt.Errorf("order %d is already submitted", o.ID)
+	}
+	if o.Quantity <= 0 {
+		return fmt.Errorf("invalid order quantity %f", o.Quantity)
+	}
+	ordType, err := fixOrdType(o.Type)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o.ID = b.nextOrderID
+	clOrdID := b.newClOrdID(o.ID)
+	msg := NewMessage(MsgTypeNewOrderSingle)
+	msg.Set(TagClOrdID, clOrdID)
+	if b.cfg.Broker.FIX.Account != "" {
+		msg.Set(TagAccount, b.cfg.Broker.FIX.Account)
+	}
+	msg.Set(TagSymbol, o.Instrument)
+	msg.Set(TagSide, fixSide(o.Action))
+	msg.SetTime(TagTransactTime, b.now())
+	msg.SetFloat(TagOrderQty, o.Quantity)
+	msg.Set(TagOrdType, ordType)
+	setOrderPrices(msg, o.Type, o.LimitPrice, o.StopPrice)
+	if o.FillOnClose {
+		// at the close
+		msg.Set(TagTimeInForce, "7")
+	} else {
+		msg.Set(TagTimeInForce, "0")
+	}
+	if err := b.initiator.Session().Send(msg); err != nil {
+		o.ID = 0
+		return err
+	}
+
+	b.nextOrderID++
+	o.State = core.OrderStateSubmitted
+	o.SubmitDateTime = b.now()
+	b.orders[o.ID] = o
+	b.activeOrders[o.ID] = o
+	b.clOrdIDs[clOrdID] = o.ID
+	b.lastClOrdID[o.ID] = clOrdID
+	b.queueEvent(o, core.OrderEventSubmitted, nil)
+	return nil
+}
+
+// SubmitBracketOrder implements core.Broker
+func (b *fixBroker) SubmitBracketOrder(entry core.Order, takeProfit core.Order, stopLoss core.Order) error {
+	return fmt.Errorf("bracket orders are not supported by the fix broker")
+}
+
+// SubmitOCOOrders implements core.Broker
+func (b *fixBroker) SubmitOCOOrders(orders ...core.Order) error {
+	return fmt.Errorf("oco orders are not supported by the fix broker")
+}
+
+// CancelOrder implements core.Broker, it sends an OrderCancelRequest. The
+// order is canceled when the counterparty confirms it.
+func (b *fixBroker) CancelOrder(order core.Order) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o, ok := b.activeOrders[order.GetID()]
+	if !ok {
+		return fmt.Errorf("order %d is not active", order.GetID())
+	}
+	clOrdID := b.newClOrdID(o.ID)
+	msg := NewMessage(MsgTypeOrderCancelRequest)
+	msg.Set(TagOrigClOrdID, b.lastClOrdID[o.ID])
+	msg.Set(TagClOrdID, clOrdID)
+	msg.Set(TagSymbol, o.Instrument)
+	msg.Set(TagSide, fixSide(o.Action))
+	msg.SetTime(TagTransactTime, b.now())
+	msg.SetFloat(TagOrderQty, o.Quantity)
+	if err := b.initiator.Session().Send(msg); err != nil {
+		return err
+	}
+	b.clOrdIDs[clOrdID] = o.ID
+	return nil
+}
+
+// ReplaceOrder implements Broker
+func (b *fixBroker) ReplaceOrder(order core.Order, quantity, limitPrice, stopPrice float64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o, ok := b.activeOrders[order.GetID()]
+	if !ok {
+		return fmt.Errorf("order %d is not active", order.GetID())
+	}
+	if quantity <= o.Filled {
+		return fmt.Errorf("quantity %f should be greater than the filled quantity %f", quantity, o.Filled)
+	}
+	ordType, err := fixOrdType(o.Type)
+	if err != nil {
+		return err
+	}
+	clOrdID := b.newClOrdID(o.ID)
+	msg := NewMessage(MsgTypeOrderCancelReplaceRequest)
+	msg.Set(TagOrigClOrdID, b.lastClOrdID[o.ID])
+	msg.Set(TagClOrdID, clOrdID)
+	if b.cfg.Broker.FIX.Account != "" {
+		msg.Set(TagAccount, b.cfg.Broker.FIX.Account)
+	}
+	msg.Set(TagSymbol, o.Instrument)
+	msg.Set(TagSide, fixSide(o.Action))
+	msg.SetTime(TagTransactTime, b.now())
+	msg.SetFloat(TagOrderQty, quantity)
+	msg.Set(TagOrdType, ordType)
+	setOrderPrices(msg, o.Type, limitPrice, stopPrice)
+	if err := b.initiator.Session().Send(msg); err != nil {
+		return err
+	}
+	b.clOrdIDs[clOrdID] = o.ID
+	b.replaces[clOrdID] = &replaceRequest{
+		orderID:    o.ID,
+		quantity:   quantity,
+		limitPrice: limitPrice,
+		stopPrice:  stopPrice,
+	}
+	return nil
+}
+
+func (b *fixBroker) newClOrdID(id uint64) string {
+	rev := b.revisions[id]
+	b.revisions[id] = rev + 1
+	if rev == 0 {
+		return fmt.Sprintf("%s-%d", b.clOrdIDPrefix, id)
+	}
+	return fmt.Sprintf("%s-%d.%d", b.clOrdIDPrefix, id, rev)
+}
+
+func (b *fixBroker) queueEvent(o *core.BasicOrder, eventType core.OrderEventType, eventInfo interface{}) {
+	// the event keeps a copy of the order as it was when the event happened
+	c := *o
+	if o.ExecutionInfo != nil {
+		info := *o.ExecutionInfo
+		c.ExecutionInfo = &info
+	}
+	b.pendingEvents = append(b.pendingEvents, core.NewOrderEvent(&c, eventType, eventInfo))
+	if b.wakeup != nil {
+		b.wakeup()
+	}
+}
+
+// OnLogon implements Application
+func (b *fixBroker) OnLogon(s *Session) {}
+
+// OnLogout implements Application
+func (b *fixBroker) OnLogout(s *Session) {
+	logger.Logger.Warn("fix broker is logged out")
+}
+
+// FromApp implements Application
+func (b *fixBroker) FromApp(s *Session, msg *Message) {
+	switch msg.MsgType() {
+	case MsgTypeExecutionReport:
+		if err := b.onExecutionReport(msg); err != nil {
+			logger.Logger.Error("invalid execution report", zap.String("msg", msg.String()),
+				zap.Error(err))
+		}
+	case MsgTypeOrderCancelReject:
+		b.onOrderCancelReject(msg)
+	default:
+		logger.Logger.Debug("unhandled fix message", zap.String("msg", msg.String()))
+	}
+}
+
+func (b *fixBroker) findOrder(msg *Message) *core.BasicOrder {
+	for _, tag := range []int{TagClOrdID, TagOrigClOrdID} {
+		if clOrdID, ok := msg.Get(tag); ok {
+			if id, ok := b.clOrdIDs[clOrdID]; ok {
+				return b.orders[id]
+			}
+		}
+	}
+	return nil
+}
+
+func (b *fixBroker) onExecutionReport(msg *Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	execID, _ := msg.Get(TagExecID)
+	if execID != "" {
+		if b.execIDs[execID] {
+			// resent execution reports are only processed once
+			return nil
+		}
+		b.execIDs[execID] = true
+	}
+	o := b.findOrder(msg)
+	if o == nil {
+		return fmt.Errorf("unknown order")
+	}
+	execType, _ := msg.Get(TagExecType)
+	text, _ := msg.Get(TagText)
+
+	switch execType {
+	case "0": // new
+		if o.State == core.OrderStateSubmitted {
+			o.State = core.OrderStateAccepted
+			b.queueEvent(o, core.OrderEventAccepted, nil)
+		}
+	case "F": // trade
+		return b.onTrade(o, msg)
+	case "4", "C": // canceled, expired
+		if !o.IsActive() {
+			return nil
+		}
+		reason := map[string]string{"4": "canceled", "C": "expired"}[execType]
+		if text != "" {
+			reason += ": " + text
+		}
+		o.State = core.OrderStateCanceled
+		delete(b.activeOrders, o.ID)
+		b.queueEvent(o, core.OrderEventCanceled, reason)
+	case "8": // rejected, the reason is the text of the counterparty
+		if !o.IsActive() {
+			return nil
+		}
+		reason := text
+		if reason == "" {
+			reason = "rejected"
+		}
+		o.State = core.OrderStateCanceled
+		delete(b.activeOrders, o.ID)
+		b.queueEvent(o, core.OrderEventRejected, reason)
+	case "5": // replaced
+		clOrdID, _ := msg.Get(TagClOrdID)
+		req, ok := b.replaces[clOrdID]
+		if !ok {
+			return fmt.Errorf("unknown replace request %s", clOrdID)
+		}
+		delete(b.replaces, clOrdID)
+		o.Quantity = req.quantity
+		o.LimitPrice = req.limitPrice
+		o.StopPrice = req.stopPrice
+		b.lastClOrdID[o.ID] = clOrdID
+		b.queueEvent(o, core.OrderEventReplaced, nil)
+	default:
+		logger.Logger.Debug("ignored execution report", zap.String("execType", execType),
+			zap.Uint64("order", o.ID))
+	}
+	return nil
+}
+
+func (b *fixBroker) onTrade(o *core.BasicOrder, msg *Message) error {
+	quantity, err := msg.GetFloat(TagLastQty)
+	if err != nil {
+		return err
+	}
+	price, err := msg.GetFloat(TagLastPx)
+	if err != nil {
+		return err
+	}
+	commission, _ := msg.GetFloat(TagCommission)
+	if quantity <= 0 {
+		return fmt.Errorf("invalid LastQty %f", quantity)
+	}
+
+	info := &core.OrderExecutionInfo{
+		Price:      price,
+		Quantity:   quantity,
+		Commission: commission,
+		DateTime:   b.now(),
+	}
+	if t, ok := msg.Get(TagTransactTime); ok {
+		if tt, err := time.Parse(timestampFormat, t); err == nil {
+			info.DateTime = tt
+		}
+	}
+
+	total := o.Filled + quantity
+	o.AvgFillPrice = (o.AvgFillPrice*o.Filled + price*quantity) / total
+	o.Filled = total
+	o.Commission += commission
+	o.ExecutionInfo = info
+	if o.Action.IsBuy() {
+		b.cash -= price * quantity
+		b.positions[o.Instrument] += quantity
+	} else {
+		b.cash += price * quantity
+		b.positions[o.Instrument] -= quantity
+	}
+	b.cash -= commission
+	if math.Abs(b.positions[o.Instrument]) < 1e-9 {
+		delete(b.positions, o.Instrument)
+	}
+
+	ordStatus, _ := msg.Get(TagOrdStatus)
+	if ordStatus == "2" || o.Filled >= o.Quantity {
+		o.State = core.OrderStateFilled
+		delete(b.activeOrders, o.ID)
+		b.queueEvent(o, core.OrderEventFilled, info)
+	} else {
+		o.State = core.OrderStatePartiallyFilled
+		b.queueEvent(o, core.OrderEventPartiallyFilled, info)
+	}
+	return nil
+}
+
+func (b *fixBroker) onOrderCancelReject(msg *Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	clOrdID, _ := msg.Get(TagClOrdID)
+	delete(b.replaces, clOrdID)
+	text, _ := msg.Get(TagText)
+	logger.Logger.Warn("fix order cancel rejected", zap.String("clOrdID", clOrdID),
+		zap.String("text", text))
+}
+
+func fixSide(action core.OrderAction) string {
+	if action.IsBuy() {
+		return "1"
+	}
+	return "2"
+}
+
+func fixOrdType(t core.OrderType) (string, error) {
+	switch t {
+	case core.OrderTypeMarket:
+		return "1", nil
+	case core.OrderTypeLimit:
+		return "2", nil
+	case core.OrderTypeStop:
+		return "3", nil
+	case core.OrderTypeStopLimit:
+		return "4", nil
+	default:
+		return "", fmt.Errorf("order type %s is not supported by the fix broker", t)
+	}
+}
+
+func setOrderPrices(msg *Message, t core.OrderType, limitPrice, stopPrice float64) {
+	if t == core.OrderTypeLimit || t == core.OrderTypeStopLimit {
+		msg.SetFloat(TagPrice, limitPrice)
+	}
+	if t == core.OrderTypeStop || t == core.OrderTypeStopLimit {
+		msg.SetFloat(TagStopPx, stopPrice)
+	}
+}
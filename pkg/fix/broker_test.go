@@ -0,0 +1,211 @@
+package fix
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+	"goat/pkg/core"
+)
+
+// venueApp simulates an exchange: market orders are filled in two trades at
+// 100, other orders rest until they are canceled or replaced. Orders on the
+// REJECT symbol are rejected.
+type venueApp struct {
+	mu     sync.Mutex
+	execID int
+	orders map[string]*Message // ClOrdID to the last request
+}
+
+func (v *venueApp) OnLogon(s *Session)  {}
+func (v *venueApp) OnLogout(s *Session) {}
+
+func (v *venueApp) report(s *Session, req *Message, execType, ordStatus string) *Message {
+	v.execID++
+	msg := NewMessage(MsgTypeExecutionReport)
+	msg.Set(TagOrderID, "venue-"+valueOf(req, TagClOrdID))
+	msg.Set(TagExecID, fmt.Sprintf("exec-%d", v.execID))
+	msg.Set(TagClOrdID, valueOf(req, TagClOrdID))
+	if orig, ok := req.Get(TagOrigClOrdID); ok {
+		msg.Set(TagOrigClOrdID, orig)
+	}
+	msg.Set(TagExecType, execType)
+	msg.Set(TagOrdStatus, ordStatus)
+	msg.Set(TagSymbol, valueOf(req, TagSymbol))
+	msg.Set(TagSide, valueOf(req, TagSide))
+	return msg
+}
+
+func (v *venueApp) FromApp(s *Session, req *Message) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	clOrdID := valueOf(req, TagClOrdID)
+	switch req.MsgType() {
+	case MsgTypeNewOrderSingle:
+		if valueOf(req, TagSymbol) == "REJECT" {
+			s.Send(v.report(s, req, "8", "8").Set(TagText, "unknown symbol"))
+			return
+		}
+		v.orders[clOrdID] = req
+		s.Send(v.report(s, req, "0", "0"))
+		if valueOf(req, TagOrdType) != "1" {
+			return
+		}
+		quantity, _ := req.GetFloat(TagOrderQty)
+		s.Send(v.report(s, req, "F", "1").SetFloat(TagLastQty, quantity/2).
+			SetFloat(TagLastPx, 100).SetFloat(TagCommission, 1))
+		s.Send(v.report(s, req, "F", "2").SetFloat(TagLastQty, quantity/2).
+			SetFloat(TagLastPx, 102).SetFloat(TagCommission, 1))
+	case MsgTypeOrderCancelRequest:
+		if _, ok := v.orders[valueOf(req, TagOrigClOrdID)]; !ok {
+			s.Send(NewMessage(MsgTypeOrderCancelReject).Set(TagClOrdID, clOrdID).
+				Set(TagCxlRejResponseTo, "1").Set(TagText, "unknown order"))
+			return
+		}
+		delete(v.orders, valueOf(req, TagOrigClOrdID))
+		s.Send(v.report(s, req, "4", "4"))
+	case MsgTypeOrderCancelReplaceRequest:
+		delete(v.orders, valueOf(req, TagOrigClOrdID))
+		v.orders[clOrdID] = req
+		s.Send(v.report(s, req, "5", "0"))
+	}
+}
+
+type testBrokerEvents struct {
+	mu     sync.Mutex
+	events []string
+	infos  []interface{}
+}
+
+func (e *testBrokerEvents) onOrderEvent(args ...interface{}) error {
+	event := args[1].(core.OrderEvent)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, fmt.Sprintf("%d %s", event.GetOrder().GetID(), event.GetEventType()))
+	e.infos = append(e.infos, event.GetEventInfo())
+	return nil
+}
+
+func (e *testBrokerEvents) get() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string{}, e.events...)
+}
+
+func TestBrokerOrderRouting(t *testing.T) {
+	venue := &venueApp{orders: map[string]*Message{}}
+	acceptor := startTestAcceptor(t, venue, NewMemoryStore())
+	defer acceptor.Stop()
+
+	cfg := &config.Config{}
+	cfg.Broker.Cash = 10000
+	cfg.Broker.FIX = config.FIXConfig{
+		Addr:         acceptor.Addr(),
+		SenderCompID: "GOAT",
+		TargetCompID: "VENUE",
+		Account:      "ACC1",
+		HeartBtInt:   1,
+	}
+	broker, err := NewBroker(context.TODO(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := &testBrokerEvents{}
+	broker.GetOrderUpdatedEvent().Subscribe(events.onOrderEvent)
+	clock := core.NewSimulatedClock()
+	now := time.Date(2022, time.January, 3, 15, 0, 0, 0, time.UTC)
+	clock.Advance(now)
+	broker.(core.ClockUser).SetClock(clock)
+	if tm := broker.PeekDateTime(); tm == nil || !tm.Equal(now) {
+		t.Errorf("broker time is %v, expected the clock time", tm)
+	}
+
+	if err := broker.SubmitOrder(core.NewMarketOrder(core.OrderActionBuy, "GLD", 10, false)); err != ErrNotLoggedOn {
+		t.Errorf("submit before logon returned %v", err)
+	}
+	broker.Start()
+	defer broker.Stop()
+	waitFor(t, "logon", broker.IsLoggedOn)
+
+	dispatchUntil := func(n int) []string {
+		waitFor(t, fmt.Sprintf("%d order events", n), func() bool {
+			broker.Dispatch()
+			return len(events.get()) >= n
+		})
+		if !broker.Eof() {
+			t.Errorf("broker should be eof without pending events")
+		}
+		return events.get()
+	}
+	expectEvents := func(got []string, expected ...string) {
+		t.Helper()
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("events are %v, expected %v", got, expected)
+		}
+	}
+
+	market := core.NewMarketOrder(core.OrderActionBuy, "GLD", 10, false)
+	if err := broker.SubmitOrder(market); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(dispatchUntil(4), "1 SUBMITTED", "1 ACCEPTED", "1 PARTIALLY_FILLED", "1 FILLED")
+	if !market.GetSubmitDateTime().Equal(now) {
+		t.Errorf("order is submitted at %v, expected the clock time", market.GetSubmitDateTime())
+	}
+	filled := broker.GetOrder(1)
+	if !filled.IsFilled() || filled.GetAvgFillPrice() != 101 || filled.GetCommission() != 2 {
+		t.Errorf("unexpected filled order %s", filled)
+	}
+	if pos := broker.GetPosition("GLD"); pos != 10 {
+		t.Errorf("position is %f", pos)
+	}
+	if cash := broker.GetCash(); cash != 10000-500-510-2 {
+		t.Errorf("cash is %f", cash)
+	}
+
+	limit := core.NewLimitOrder(core.OrderActionSell, "GLD", 110, 10)
+	if err := broker.SubmitOrder(limit); err != nil {
+		t.Fatal(err)
+	}
+	dispatchUntil(6)
+	if err := broker.ReplaceOrder(limit, 5, 111, 0); err != nil {
+		t.Fatal(err)
+	}
+	dispatchUntil(7)
+	if limit.GetQuantity() != 5 || limit.GetLimitPrice() != 111 {
+		t.Errorf("order is not replaced %s", limit)
+	}
+	if active := broker.GetActiveOrders("GLD"); len(active) != 1 || active[0].GetID() != 2 {
+		t.Errorf("active orders are %v", active)
+	}
+	if err := broker.CancelOrder(limit); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(dispatchUntil(8)[4:], "2 SUBMITTED", "2 ACCEPTED", "2 REPLACED", "2 CANCELED")
+	if len(broker.GetActiveOrders("")) != 0 {
+		t.Errorf("canceled order is still active")
+	}
+	if err := broker.CancelOrder(limit); err == nil {
+		t.Errorf("inactive order should not be canceled")
+	}
+
+	if err := broker.SubmitOrder(core.NewMarketOrder(core.OrderActionBuy, "REJECT", 1, false)); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(dispatchUntil(10)[8:], "3 SUBMITTED", "3 REJECTED")
+	events.mu.Lock()
+	if reason := events.infos[9]; reason != "unknown symbol" {
+		t.Errorf("rejection reason is %v", reason)
+	}
+	events.mu.Unlock()
+
+	if err := broker.SubmitOrder(core.NewTrailingStopOrder(core.OrderActionSell, "GLD", 1, 1)); err == nil {
+		t.Errorf("trailing stops should not be supported")
+	}
+	if err := broker.SubmitOCOOrders(core.NewLimitOrder(core.OrderActionSell, "GLD", 110, 1)); err == nil {
+		t.Errorf("oco orders should not be supported")
+	}
+}
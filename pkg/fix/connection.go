@@ -0,0 +1,179 @@
+package fix
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"goat/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Initiator connects a session to a counterparty and reconnects it when the
+// connection is lost
+type Initiator struct {
+	addr              string
+	session           *Session
+	reconnectInterval time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	conn   net.Conn
+}
+
+// NewInitiator creates an initiator of the session to addr
+func NewInitiator(addr string, settings SessionSettings, store MessageStore, app Application,
+	reconnectInterval time.Duration,
+) *Initiator {
+	if reconnectInterval <= 0 {
+		reconnectInterval = 5 * time.Second
+	}
+	return &Initiator{
+		addr:              addr,
+		session:           newSession(settings, store, app, true),
+		reconnectInterval: reconnectInterval,
+	}
+}
+
+// Session returns the session of the initiator
+func (i *Initiator) Session() *Session {
+	return i.session
+}
+
+// Start connects in the background until Stop is called
+func (i *Initiator) Start(ctx context.Context) {
+	i.ctx, i.cancel = context.WithCancel(ctx)
+	i.wg.Add(1)
+	go func() {
+		defer i.wg.Done()
+		for {
+			conn, err := (&net.Dialer{}).DialContext(i.ctx, "tcp", i.addr)
+			if err == nil {
+				i.mu.Lock()
+				i.conn = conn
+				i.mu.Unlock()
+				err = i.session.run(conn)
+			}
+			if i.ctx.Err() != nil {
+				return
+			}
+			logger.Logger.Warn("fix connection is closed", zap.String("addr", i.addr), zap.Error(err))
+			select {
+			case <-i.ctx.Done():
+				return
+			case <-time.After(i.reconnectInterval):
+			}
+		}
+	}()
+	go func() {
+		// the connection is closed to unblock the session when ctx is done
+		<-i.ctx.Done()
+		i.mu.Lock()
+		if i.conn != nil {
+			i.conn.Close()
+		}
+		i.mu.Unlock()
+	}()
+}
+
+// Stop logs out and closes the connection
+func (i *Initiator) Stop() {
+	if i.cancel == nil {
+		return
+	}
+	if i.session.Logout("") == nil {
+		// give the counterparty a moment to reply
+		deadline := time.Now().Add(time.Second)
+		for i.session.IsLoggedOn() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	i.cancel()
+	i.wg.Wait()
+}
+
+// Acceptor accepts the connections of one counterparty, only one connection
+// is served at a time. It is used to test initiators without a real venue.
+type Acceptor struct {
+	listener net.Listener
+	session  *Session
+
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewAcceptor listens on addr, e.g. "127.0.0.1:0"
+func NewAcceptor(addr string, settings SessionSettings, store MessageStore, app Application) (*Acceptor, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Acceptor{
+		listener: listener,
+		session:  newSession(settings, store, app, false),
+	}, nil
+}
+
+// Addr returns the address the acceptor listens on
+func (a *Acceptor) Addr() string {
+	return a.listener.Addr().String()
+}
+
+// Session returns the session of the acceptor
+func (a *Acceptor) Session() *Session {
+	return a.session
+}
+
+// Start accepts connections in the background
+func (a *Acceptor) Start() {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		for {
+			conn, err := a.listener.Accept()
+			if err != nil {
+				return
+			}
+			a.mu.Lock()
+			if a.conn != nil {
+				a.mu.Unlock()
+				conn.Close()
+				continue
+			}
+			a.conn = conn
+			a.mu.Unlock()
+
+			a.wg.Add(1)
+			go func() {
+				defer a.wg.Done()
+				if err := a.session.run(conn); err != nil {
+					logger.Logger.Debug("fix acceptor connection is closed", zap.Error(err))
+				}
+				a.mu.Lock()
+				a.conn = nil
+				a.mu.Unlock()
+			}()
+		}
+	}()
+}
+
+// Disconnect drops the current connection without logging out
+func (a *Acceptor) Disconnect() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.conn != nil {
+		a.conn.Close()
+	}
+}
+
+// Stop closes the listener and the current connection
+func (a *Acceptor) Stop() {
+	a.listener.Close()
+	a.Disconnect()
+	a.wg.Wait()
+}
@@ -0,0 +1,284 @@
+package fix
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// BeginString of the supported protocol version
+	BeginString = "FIX.4.4"
+
+	soh = '\x01'
+
+	// SendingTime format
+	timestampFormat = "20060102-15:04:05.000"
+)
+
+// tags used by the session and the broker
+const (
+	TagAccount          = 1
+	TagAvgPx            = 6
+	TagBeginSeqNo       = 7
+	TagBeginString      = 8
+	TagBodyLength       = 9
+	TagCheckSum         = 10
+	TagClOrdID          = 11
+	TagCommission       = 12
+	TagCumQty           = 14
+	TagEndSeqNo         = 16
+	TagExecID           = 17
+	TagLastPx           = 31
+	TagLastQty          = 32
+	TagMsgSeqNum        = 34
+	TagMsgType          = 35
+	TagNewSeqNo         = 36
+	TagOrderID          = 37
+	TagOrderQty         = 38
+	TagOrdStatus        = 39
+	TagOrdType          = 40
+	TagOrigClOrdID      = 41
+	TagPossDupFlag      = 43
+	TagPrice            = 44
+	TagRefSeqNum        = 45
+	TagSenderCompID     = 49
+	TagSendingTime      = 52
+	TagSide             = 54
+	TagSymbol           = 55
+	TagTargetCompID     = 56
+	TagText             = 58
+	TagTimeInForce      = 59
+	TagTransactTime     = 60
+	TagEncryptMethod    = 98
+	TagStopPx           = 99
+	TagHeartBtInt       = 108
+	TagTestReqID        = 112
+	TagOrigSendingTime  = 122
+	TagGapFillFlag      = 123
+	TagResetSeqNumFlag  = 141
+	TagExecType         = 150
+	TagLeavesQty        = 151
+	TagCxlRejResponseTo = 434
+)
+
+// message types
+const (
+	MsgTypeHeartbeat                 = "0"
+	MsgTypeTestRequest               = "1"
+	MsgTypeResendRequest             = "2"
+	MsgTypeReject                    = "3"
+	MsgTypeSequenceReset             = "4"
+	MsgTypeLogout                    = "5"
+	MsgTypeExecutionReport           = "8"
+	MsgTypeOrderCancelReject         = "9"
+	MsgTypeLogon                     = "A"
+	MsgTypeNewOrderSingle            = "D"
+	MsgTypeOrderCancelRequest        = "F"
+	MsgTypeOrderCancelReplaceRequest = "G"
+)
+
+// isAdminMsgType returns true for the session level messages
+func isAdminMsgType(msgType string) bool {
+	switch msgType {
+	case MsgTypeHeartbeat, MsgTypeTestRequest, MsgTypeResendRequest, MsgTypeReject,
+		MsgTypeSequenceReset, MsgTypeLogout, MsgTypeLogon:
+		return true
+	default:
+		return false
+	}
+}
+
+// Field is a tag=value pair of a message
+type Field struct {
+	Tag   int
+	Value string
+}
+
+// Message is a FIX message. The fields are kept in order, the header fields
+// BeginString, BodyLength and CheckSum are added by Bytes.
+type Message struct {
+	Fields []Field
+}
+
+// NewMessage creates a message of msgType
+func NewMessage(msgType string) *Message {
+	m := &Message{}
+	m.Set(TagMsgType, msgType)
+	return m
+}
+
+// MsgType returns the type of the message
+func (m *Message) MsgType() string {
+	v, _ := m.Get(TagMsgType)
+	return v
+}
+
+// Get returns the value of the first field with tag
+func (m *Message) Get(tag int) (string, bool) {
+	for _, f := range m.Fields {
+		if f.Tag == tag {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// GetInt returns the value of tag as an integer
+func (m *Message) GetInt(tag int) (int, error) {
+	v, ok := m.Get(tag)
+	if !ok {
+		return 0, fmt.Errorf("tag %d is missing", tag)
+	}
+	return strconv.Atoi(v)
+}
+
+// GetFloat returns the value of tag as a float
+func (m *Message) GetFloat(tag int) (float64, error) {
+	v, ok := m.Get(tag)
+	if !ok {
+		return 0, fmt.Errorf("tag %d is missing", tag)
+	}
+	return strconv.ParseFloat(v, 64)
+}
+
+// GetBool returns true if the value of tag is Y
+func (m *Message) GetBool(tag int) bool {
+	v, _ := m.Get(tag)
+	return v == "Y"
+}
+
+// Set replaces the value of tag, the field is appended if it is missing
+func (m *Message) Set(tag int, value string) *Message {
+	for i := range m.Fields {
+		if m.Fields[i].Tag == tag {
+			m.Fields[i].Value = value
+			return m
+		}
+	}
+	m.Fields = append(m.Fields, Field{Tag: tag, Value: value})
+	return m
+}
+
+// SetInt sets tag to an integer value
+func (m *Message) SetInt(tag int, value int) *Message {
+	return m.Set(tag, strconv.Itoa(value))
+}
+
+// SetFloat sets tag to a float value
+func (m *Message) SetFloat(tag int, value float64) *Message {
+	return m.Set(tag, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// SetTime sets tag to a UTC timestamp
+func (m *Message) SetTime(tag int, t time.Time) *Message {
+	return m.Set(tag, t.UTC().Format(timestampFormat))
+}
+
+// Remove removes all the fields with tag
+func (m *Message) Remove(tag int) {
+	res := m.Fields[:0]
+	for _, f := range m.Fields {
+		if f.Tag != tag {
+			res = append(res, f)
+		}
+	}
+	m.Fields = res
+}
+
+// Bytes encodes the message, BodyLength and CheckSum are computed. MsgType
+// is always the first field of the body.
+func (m *Message) Bytes() []byte {
+	body := bytes.Buffer{}
+	msgType := m.MsgType()
+	body.WriteString(fmt.Sprintf("%d=%s%c", TagMsgType, msgType, soh))
+	for _, f := range m.Fields {
+		switch f.Tag {
+		case TagBeginString, TagBodyLength, TagCheckSum, TagMsgType:
+			continue
+		}
+		body.WriteString(fmt.Sprintf("%d=%s%c", f.Tag, f.Value, soh))
+	}
+
+	res := bytes.Buffer{}
+	res.WriteString(fmt.Sprintf("%d=%s%c%d=%d%c", TagBeginString, BeginString, soh,
+		TagBodyLength, body.Len(), soh))
+	res.Write(body.Bytes())
+	res.WriteString(fmt.Sprintf("%d=%03d%c", TagCheckSum, checksum(res.Bytes()), soh))
+	return res.Bytes()
+}
+
+// String returns the message with | as the field separator
+func (m *Message) String() string {
+	return strings.ReplaceAll(string(m.Bytes()), string(soh), "|")
+}
+
+func checksum(data []byte) int {
+	sum := 0
+	for _, b := range data {
+		sum += int(b)
+	}
+	return sum % 256
+}
+
+// ParseMessage decodes one message and validates its BeginString,
+// BodyLength and CheckSum
+func ParseMessage(data []byte) (*Message, error) {
+	m := &Message{}
+	rest := data
+	for len(rest) > 0 {
+		end := bytes.IndexByte(rest, soh)
+		if end < 0 {
+			return nil, fmt.Errorf("field is not terminated")
+		}
+		field := rest[:end]
+		rest = rest[end+1:]
+		eq := bytes.IndexByte(field, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid field %q", field)
+		}
+		tag, err := strconv.Atoi(string(field[:eq]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag %q", field[:eq])
+		}
+		m.Fields = append(m.Fields, Field{Tag: tag, Value: string(field[eq+1:])})
+	}
+
+	if len(m.Fields) < 4 || m.Fields[0].Tag != TagBeginString || m.Fields[1].Tag != TagBodyLength ||
+		m.Fields[2].Tag != TagMsgType || m.Fields[len(m.Fields)-1].Tag != TagCheckSum {
+		return nil, fmt.Errorf("invalid message header or trailer")
+	}
+	if m.Fields[0].Value != BeginString {
+		return nil, fmt.Errorf("unsupported begin string %s", m.Fields[0].Value)
+	}
+	bodyStart := len(fmt.Sprintf("%d=%s%c%d=%s%c", TagBeginString, m.Fields[0].Value, soh,
+		TagBodyLength, m.Fields[1].Value, soh))
+	trailerStart := bytes.LastIndex(data, []byte(fmt.Sprintf("%c%d=", soh, TagCheckSum))) + 1
+	if bodyLength, err := strconv.Atoi(m.Fields[1].Value); err != nil || bodyLength != trailerStart-bodyStart {
+		return nil, fmt.Errorf("invalid body length %s", m.Fields[1].Value)
+	}
+	if sum, err := strconv.Atoi(m.Fields[len(m.Fields)-1].Value); err != nil ||
+		sum != checksum(data[:trailerStart]) {
+		return nil, fmt.Errorf("invalid checksum %s", m.Fields[len(m.Fields)-1].Value)
+	}
+	return m, nil
+}
+
+// readMessage reads the raw bytes of the next message, which ends with the
+// CheckSum field
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	res := []byte{}
+	for {
+		field, err := r.ReadBytes(soh)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, field...)
+		if bytes.HasPrefix(field, []byte(fmt.Sprintf("%d=", TagCheckSum))) {
+			return res, nil
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package fix
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	msg := NewMessage(MsgTypeNewOrderSingle)
+	msg.Set(TagSenderCompID, "GOAT").Set(TagTargetCompID, "VENUE").SetInt(TagMsgSeqNum, 7)
+	msg.Set(TagClOrdID, "abc-1").Set(TagSymbol, "GLD").SetFloat(TagOrderQty, 10.5)
+
+	data := msg.Bytes()
+	if !strings.HasPrefix(string(data), "8=FIX.4.4\x019=") {
+		t.Fatalf("unexpected header %q", data)
+	}
+	parsed, err := ParseMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.MsgType() != MsgTypeNewOrderSingle {
+		t.Errorf("msg type is %s", parsed.MsgType())
+	}
+	if v, _ := parsed.Get(TagClOrdID); v != "abc-1" {
+		t.Errorf("ClOrdID is %s", v)
+	}
+	if v, err := parsed.GetFloat(TagOrderQty); err != nil || v != 10.5 {
+		t.Errorf("OrderQty is %f, %v", v, err)
+	}
+	if v, err := parsed.GetInt(TagMsgSeqNum); err != nil || v != 7 {
+		t.Errorf("MsgSeqNum is %d, %v", v, err)
+	}
+
+	// two messages on the same stream
+	r := bufio.NewReader(bytes.NewReader(append(data, data...)))
+	for i := 0; i < 2; i++ {
+		raw, err := readMessage(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(raw, data) {
+			t.Errorf("read %q, expected %q", raw, data)
+		}
+	}
+}
+
+func TestParseMessageErrors(t *testing.T) {
+	data := NewMessage(MsgTypeHeartbeat).Set(TagSenderCompID, "A").Bytes()
+
+	badChecksum := append([]byte{}, data...)
+	badChecksum[len(badChecksum)-2]++
+	badLength := bytes.Replace(data, []byte("9="), []byte("9=1"), 1)
+	badVersion := bytes.Replace(data, []byte("FIX.4.4"), []byte("FIX.4.2"), 1)
+
+	for name, d := range map[string][]byte{
+		"checksum":  badChecksum,
+		"length":    badLength,
+		"version":   badVersion,
+		"truncated": data[:len(data)-1],
+	} {
+		if _, err := ParseMessage(d); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,512 @@
+package fix
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"goat/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// SessionSettings identifies a session and its timers
+type SessionSettings struct {
+	SenderCompID string
+	TargetCompID string
+	// HeartBtInt is sent in the Logon message in seconds
+	HeartBtInt time.Duration
+	// ResetOnLogon starts the session from sequence number 1
+	ResetOnLogon bool
+	// LogonTimeout is how long to wait for the Logon reply
+	LogonTimeout time.Duration
+}
+
+func (s SessionSettings) heartBtInt() time.Duration {
+	if s.HeartBtInt < time.Second {
+		return 30 * time.Second
+	}
+	return s.HeartBtInt
+}
+
+func (s SessionSettings) logonTimeout() time.Duration {
+	if s.LogonTimeout <= 0 {
+		return 10 * time.Second
+	}
+	return s.LogonTimeout
+}
+
+// Application receives the events of a session. The callbacks are called
+// from the goroutine reading the connection, they may call Session.Send.
+type Application interface {
+	OnLogon(s *Session)
+	OnLogout(s *Session)
+	FromApp(s *Session, msg *Message)
+}
+
+// timers of the session are checked at this resolution
+const timerResolution = 100 * time.Millisecond
+
+// ErrNotLoggedOn is returned when sending an application message without a
+// logged on session
+var ErrNotLoggedOn = errors.New("fix session is not logged on")
+
+// Session implements the FIX session protocol over one connection at a
+// time: logon, heartbeats, test requests, sequence number checks, resend
+// requests, sequence resets and logout.
+type Session struct {
+	settings  SessionSettings
+	store     MessageStore
+	app       Application
+	initiator bool
+
+	mu         sync.Mutex
+	conn       net.Conn
+	loggedOn   bool
+	loggingOut bool
+	lastSent   time.Time
+	lastRecv   time.Time
+	testReqID  string
+	// the messages up to resendEnd have been requested by a resend request
+	resendEnd int
+}
+
+func newSession(settings SessionSettings, store MessageStore, app Application, initiator bool) *Session {
+	return &Session{
+		settings:  settings,
+		store:     store,
+		app:       app,
+		initiator: initiator,
+	}
+}
+
+// IsLoggedOn returns true if the session is logged on
+func (s *Session) IsLoggedOn() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loggedOn
+}
+
+// Store returns the message store of the session
+func (s *Session) Store() MessageStore {
+	return s.store
+}
+
+// Send sends an application message
+func (s *Session) Send(msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loggedOn || s.loggingOut {
+		return ErrNotLoggedOn
+	}
+	return s.sendLocked(msg)
+}
+
+// Logout sends a Logout message, the connection is closed when the reply is
+// received or after the logon timeout
+func (s *Session) Logout(text string) error {
+	s.mu.Lock()
+	if !s.loggedOn || s.loggingOut {
+		s.mu.Unlock()
+		return ErrNotLoggedOn
+	}
+	s.loggingOut = true
+	msg := NewMessage(MsgTypeLogout)
+	if text != "" {
+		msg.Set(TagText, text)
+	}
+	err := s.sendLocked(msg)
+	conn := s.conn
+	s.mu.Unlock()
+
+	if conn != nil {
+		time.AfterFunc(s.settings.logonTimeout(), func() { conn.Close() })
+	}
+	return err
+}
+
+// sendLocked fills the header of msg, saves it and writes it
+func (s *Session) sendLocked(msg *Message) error {
+	if s.conn == nil {
+		return fmt.Errorf("fix session is not connected")
+	}
+	seq := s.store.NextSenderSeqNum()
+	msg.Set(TagSenderCompID, s.settings.SenderCompID)
+	msg.Set(TagTargetCompID, s.settings.TargetCompID)
+	msg.SetInt(TagMsgSeqNum, seq)
+	msg.SetTime(TagSendingTime, time.Now())
+	data := msg.Bytes()
+
+	if !isAdminMsgType(msg.MsgType()) {
+		if err := s.store.SaveMessage(seq, data); err != nil {
+			return fmt.Errorf("failed to save message: %v", err)
+		}
+	}
+	if err := s.store.SetNextSenderSeqNum(seq + 1); err != nil {
+		return fmt.Errorf("failed to save sequence number: %v", err)
+	}
+	return s.writeLocked(data)
+}
+
+func (s *Session) writeLocked(data []byte) error {
+	if _, err := s.conn.Write(data); err != nil {
+		return err
+	}
+	s.lastSent = time.Now()
+	return nil
+}
+
+func (s *Session) send(msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sendLocked(msg)
+}
+
+func (s *Session) newLogon() *Message {
+	msg := NewMessage(MsgTypeLogon)
+	msg.SetInt(TagEncryptMethod, 0)
+	msg.SetInt(TagHeartBtInt, int(s.settings.heartBtInt()/time.Second))
+	if s.settings.ResetOnLogon {
+		msg.Set(TagResetSeqNumFlag, "Y")
+	}
+	return msg
+}
+
+// run runs the session over conn until the connection is closed
+func (s *Session) run(conn net.Conn) error {
+	s.mu.Lock()
+	s.conn = conn
+	s.loggedOn = false
+	s.loggingOut = false
+	s.testReqID = ""
+	s.resendEnd = 0
+	s.lastRecv = time.Now()
+	s.lastSent = time.Now()
+	s.mu.Unlock()
+
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		wasLoggedOn := s.loggedOn
+		s.loggedOn = false
+		s.conn = nil
+		s.mu.Unlock()
+		if wasLoggedOn {
+			s.app.OnLogout(s)
+		}
+	}()
+
+	if s.initiator {
+		if s.settings.ResetOnLogon {
+			if err := s.store.Reset(); err != nil {
+				return err
+			}
+		}
+		if err := s.send(s.newLogon()); err != nil {
+			return err
+		}
+	}
+
+	msgC := make(chan []byte)
+	errC := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		r := bufio.NewReader(conn)
+		for {
+			data, err := readMessage(r)
+			if err != nil {
+				errC <- err
+				return
+			}
+			select {
+			case msgC <- data:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(timerResolution)
+	defer ticker.Stop()
+	for {
+		select {
+		case data := <-msgC:
+			msg, err := ParseMessage(data)
+			if err != nil {
+				// garbled messages are ignored, they will be resent
+				logger.Logger.Warn("invalid fix message", zap.String("data", string(data)), zap.Error(err))
+				continue
+			}
+			s.mu.Lock()
+			s.lastRecv = time.Now()
+			s.testReqID = ""
+			s.mu.Unlock()
+			if err := s.onMessage(msg); err != nil {
+				return err
+			}
+		case err := <-errC:
+			return err
+		case now := <-ticker.C:
+			if err := s.onTimer(now); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Session) onTimer(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	heartBtInt := s.settings.heartBtInt()
+	if !s.loggedOn {
+		if now.Sub(s.lastRecv) > s.settings.logonTimeout() {
+			return fmt.Errorf("logon timeout")
+		}
+		return nil
+	}
+	sinceRecv := now.Sub(s.lastRecv)
+	if s.testReqID != "" && sinceRecv > 2*heartBtInt+heartBtInt/5 {
+		return fmt.Errorf("heartbeat timeout")
+	}
+	if s.testReqID == "" && sinceRecv > heartBtInt+heartBtInt/5 {
+		s.testReqID = strconv.FormatInt(now.UnixNano(), 10)
+		return s.sendLocked(NewMessage(MsgTypeTestRequest).Set(TagTestReqID, s.testReqID))
+	}
+	if now.Sub(s.lastSent) >= heartBtInt {
+		return s.sendLocked(NewMessage(MsgTypeHeartbeat))
+	}
+	return nil
+}
+
+func (s *Session) onMessage(msg *Message) error {
+	sender, _ := msg.Get(TagSenderCompID)
+	target, _ := msg.Get(TagTargetCompID)
+	if sender != s.settings.TargetCompID || target != s.settings.SenderCompID {
+		return fmt.Errorf("unexpected comp ids %s -> %s", sender, target)
+	}
+	seq, err := msg.GetInt(TagMsgSeqNum)
+	if err != nil {
+		return fmt.Errorf("invalid MsgSeqNum: %v", err)
+	}
+	msgType := msg.MsgType()
+
+	if !s.IsLoggedOn() {
+		if msgType != MsgTypeLogon {
+			return fmt.Errorf("first message is not a logon: %s", msgType)
+		}
+		return s.onLogon(msg, seq)
+	}
+
+	expected := s.store.NextTargetSeqNum()
+	switch {
+	case msgType == MsgTypeSequenceReset && !msg.GetBool(TagGapFillFlag):
+		// reset mode ignores the sequence number of the message
+		newSeq, err := msg.GetInt(TagNewSeqNo)
+		if err != nil {
+			return err
+		}
+		return s.store.SetNextTargetSeqNum(newSeq)
+	case msgType == MsgTypeResendRequest && seq > expected:
+		// the admin messages are not resent, the request is answered before
+		// asking for the gap or both sides would wait for each other
+		if err := s.onResendRequest(msg); err != nil {
+			return err
+		}
+		return s.requestResend(expected, seq)
+	case msgType == MsgTypeSequenceReset && seq > expected:
+		// the gap fill can not be applied before the gap is filled, the
+		// counterparty sends it again with the resent messages
+		return s.requestResend(expected, seq)
+	}
+
+	if seq > expected {
+		if msgType == MsgTypeLogout {
+			return s.onLogout(msg)
+		}
+		return s.requestResend(expected, seq)
+	}
+	if seq < expected {
+		if msg.GetBool(TagPossDupFlag) {
+			return nil
+		}
+		text := fmt.Sprintf("MsgSeqNum too low, expecting %d but received %d", expected, seq)
+		s.Logout(text)
+		return errors.New(text)
+	}
+	if err := s.store.SetNextTargetSeqNum(seq + 1); err != nil {
+		return err
+	}
+
+	switch msgType {
+	case MsgTypeHeartbeat, MsgTypeLogon:
+	case MsgTypeTestRequest:
+		reqID, _ := msg.Get(TagTestReqID)
+		return s.send(NewMessage(MsgTypeHeartbeat).Set(TagTestReqID, reqID))
+	case MsgTypeResendRequest:
+		return s.onResendRequest(msg)
+	case MsgTypeSequenceReset:
+		newSeq, err := msg.GetInt(TagNewSeqNo)
+		if err != nil {
+			return err
+		}
+		if newSeq > seq {
+			return s.store.SetNextTargetSeqNum(newSeq)
+		}
+	case MsgTypeReject:
+		text, _ := msg.Get(TagText)
+		logger.Logger.Warn("fix session reject", zap.String("text", text),
+			zap.String("refSeqNum", valueOf(msg, TagRefSeqNum)))
+	case MsgTypeLogout:
+		return s.onLogout(msg)
+	default:
+		s.app.FromApp(s, msg)
+	}
+	return nil
+}
+
+func (s *Session) onLogon(msg *Message, seq int) error {
+	if msg.GetBool(TagResetSeqNumFlag) && !s.initiator {
+		if err := s.store.Reset(); err != nil {
+			return err
+		}
+	}
+	expected := s.store.NextTargetSeqNum()
+	if seq < expected {
+		return fmt.Errorf("logon MsgSeqNum too low, expecting %d but received %d", expected, seq)
+	}
+	if !s.initiator {
+		if heartBtInt, err := msg.GetInt(TagHeartBtInt); err == nil && heartBtInt > 0 {
+			// the acceptor uses the interval of the initiator
+			s.mu.Lock()
+			s.settings.HeartBtInt = time.Duration(heartBtInt) * time.Second
+			s.mu.Unlock()
+		}
+		reply := s.newLogon()
+		if msg.GetBool(TagResetSeqNumFlag) {
+			reply.Set(TagResetSeqNumFlag, "Y")
+		}
+		if err := s.send(reply); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.loggedOn = true
+	s.mu.Unlock()
+	logger.Logger.Info("fix session is logged on",
+		zap.String("sender", s.settings.SenderCompID),
+		zap.String("target", s.settings.TargetCompID))
+	s.app.OnLogon(s)
+
+	if seq > expected {
+		return s.requestResend(expected, seq)
+	}
+	return s.store.SetNextTargetSeqNum(seq + 1)
+}
+
+func (s *Session) onLogout(msg *Message) error {
+	s.mu.Lock()
+	loggingOut := s.loggingOut
+	s.mu.Unlock()
+	if !loggingOut {
+		s.send(NewMessage(MsgTypeLogout))
+	}
+	text, _ := msg.Get(TagText)
+	return fmt.Errorf("logout: %s", text)
+}
+
+// requestResend asks for the messages from begin, the messages received
+// until the gap is filled are dropped since they will be resent too
+func (s *Session) requestResend(begin, received int) error {
+	s.mu.Lock()
+	if received <= s.resendEnd {
+		s.mu.Unlock()
+		return nil
+	}
+	s.resendEnd = received
+	s.mu.Unlock()
+
+	logger.Logger.Info("fix sequence gap detected, requesting resend",
+		zap.Int("begin", begin), zap.Int("received", received))
+	msg := NewMessage(MsgTypeResendRequest)
+	msg.SetInt(TagBeginSeqNo, begin)
+	msg.SetInt(TagEndSeqNo, 0)
+	return s.send(msg)
+}
+
+// onResendRequest resends the saved application messages with PossDupFlag,
+// the other messages are skipped with gap fills
+func (s *Session) onResendRequest(msg *Message) error {
+	begin, err := msg.GetInt(TagBeginSeqNo)
+	if err != nil {
+		return err
+	}
+	end, err := msg.GetInt(TagEndSeqNo)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := s.store.NextSenderSeqNum()
+	if end == 0 || end >= next {
+		end = next - 1
+	}
+	saved, err := s.store.GetMessages(begin, end)
+	if err != nil {
+		return err
+	}
+
+	gapStart := 0
+	gapFill := func(newSeq int) error {
+		if gapStart == 0 {
+			return nil
+		}
+		reset := NewMessage(MsgTypeSequenceReset)
+		reset.Set(TagSenderCompID, s.settings.SenderCompID)
+		reset.Set(TagTargetCompID, s.settings.TargetCompID)
+		reset.SetInt(TagMsgSeqNum, gapStart)
+		reset.Set(TagPossDupFlag, "Y")
+		reset.SetTime(TagSendingTime, time.Now())
+		reset.Set(TagGapFillFlag, "Y")
+		reset.SetInt(TagNewSeqNo, newSeq)
+		gapStart = 0
+		return s.writeLocked(reset.Bytes())
+	}
+	for seq := begin; seq <= end; seq++ {
+		data, ok := saved[seq]
+		if !ok {
+			if gapStart == 0 {
+				gapStart = seq
+			}
+			continue
+		}
+		if err := gapFill(seq); err != nil {
+			return err
+		}
+		resend, err := ParseMessage(data)
+		if err != nil {
+			return err
+		}
+		resend.Remove(TagBeginString)
+		resend.Remove(TagBodyLength)
+		resend.Remove(TagCheckSum)
+		resend.Set(TagPossDupFlag, "Y")
+		resend.Set(TagOrigSendingTime, valueOf(resend, TagSendingTime))
+		resend.SetTime(TagSendingTime, time.Now())
+		if err := s.writeLocked(resend.Bytes()); err != nil {
+			return err
+		}
+	}
+	return gapFill(end + 1)
+}
+
+func valueOf(msg *Message, tag int) string {
+	v, _ := msg.Get(tag)
+	return v
+}
@@ -0,0 +1,237 @@
+package fix
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingApp keeps the application messages it receives
+type recordingApp struct {
+	mu       sync.Mutex
+	messages []*Message
+	logons   int
+}
+
+func (a *recordingApp) OnLogon(s *Session) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.logons++
+}
+
+func (a *recordingApp) OnLogout(s *Session) {}
+
+func (a *recordingApp) FromApp(s *Session, msg *Message) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.messages = append(a.messages, msg)
+}
+
+func (a *recordingApp) logonCount() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.logons
+}
+
+func (a *recordingApp) count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.messages)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func startTestAcceptor(t *testing.T, app Application, store MessageStore) *Acceptor {
+	acceptor, err := NewAcceptor("127.0.0.1:0", SessionSettings{
+		SenderCompID: "VENUE",
+		TargetCompID: "GOAT",
+	}, store, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acceptor.Start()
+	return acceptor
+}
+
+func newTestInitiator(addr string, store MessageStore, app Application) *Initiator {
+	return NewInitiator(addr, SessionSettings{
+		SenderCompID: "GOAT",
+		TargetCompID: "VENUE",
+		HeartBtInt:   time.Second,
+	}, store, app, 100*time.Millisecond)
+}
+
+func newOrderMessage(id string) *Message {
+	return NewMessage(MsgTypeNewOrderSingle).Set(TagClOrdID, id)
+}
+
+func TestSessionLogonAndHeartbeat(t *testing.T) {
+	venue := &recordingApp{}
+	acceptor := startTestAcceptor(t, venue, NewMemoryStore())
+	defer acceptor.Stop()
+
+	app := &recordingApp{}
+	initiator := newTestInitiator(acceptor.Addr(), NewMemoryStore(), app)
+	if err := initiator.Session().Send(newOrderMessage("1")); err != ErrNotLoggedOn {
+		t.Errorf("send before logon returned %v", err)
+	}
+	initiator.Start(context.TODO())
+	defer initiator.Stop()
+	waitFor(t, "logon", func() bool {
+		return app.logonCount() == 1 && venue.logonCount() == 1
+	})
+
+	// the acceptor uses the heartbeat interval of the logon
+	seq := acceptor.Session().Store().NextTargetSeqNum()
+	time.Sleep(1500 * time.Millisecond)
+	if next := acceptor.Session().Store().NextTargetSeqNum(); next <= seq {
+		t.Errorf("no heartbeat received in 1.5s, next seq %d", next)
+	}
+	if next := initiator.Session().Store().NextTargetSeqNum(); next < 3 {
+		t.Errorf("no heartbeat sent by the acceptor, next seq %d", next)
+	}
+
+	if err := initiator.Session().Send(newOrderMessage("1")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "application message", func() bool { return venue.count() == 1 })
+}
+
+func TestSessionSequenceNumbersPersisted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goat-fix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	venue := &recordingApp{}
+	acceptor := startTestAcceptor(t, venue, NewMemoryStore())
+	defer acceptor.Stop()
+
+	for run := 1; run <= 2; run++ {
+		store, err := NewFileStore(dir, "GOAT", "VENUE")
+		if err != nil {
+			t.Fatal(err)
+		}
+		initiator := newTestInitiator(acceptor.Addr(), store, &recordingApp{})
+		initiator.Start(context.TODO())
+		waitFor(t, "logon", initiator.Session().IsLoggedOn)
+		if err := initiator.Session().Send(newOrderMessage("x")); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, "application message", func() bool { return venue.count() == run })
+		initiator.Stop()
+		waitFor(t, "acceptor logout", func() bool { return !acceptor.Session().IsLoggedOn() })
+		store.Close()
+	}
+
+	// logon, order and logout of each run
+	store, err := NewFileStore(dir, "GOAT", "VENUE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if seq := store.NextSenderSeqNum(); seq != 7 {
+		t.Errorf("next sender seq is %d, expected 7", seq)
+	}
+	if seq := acceptor.Session().Store().NextTargetSeqNum(); seq != 7 {
+		t.Errorf("next acceptor target seq is %d, expected 7", seq)
+	}
+	messages, err := store.GetMessages(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := messages[2]; !ok || len(messages) != 2 {
+		t.Errorf("stored messages are %v", messages)
+	}
+}
+
+func TestSessionResendRequest(t *testing.T) {
+	acceptor := startTestAcceptor(t, &recordingApp{}, NewMemoryStore())
+	defer acceptor.Stop()
+	app := &recordingApp{}
+	initiator := newTestInitiator(acceptor.Addr(), NewMemoryStore(), app)
+	initiator.Start(context.TODO())
+	defer initiator.Stop()
+	waitFor(t, "logon", initiator.Session().IsLoggedOn)
+
+	// the initiator misses an application message and two admin messages
+	acceptorStore := acceptor.Session().Store()
+	if err := acceptor.Session().Send(newOrderMessage("missed")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "first message", func() bool { return app.count() == 1 })
+	seq := acceptorStore.NextSenderSeqNum()
+	initiator.Session().Store().SetNextTargetSeqNum(seq - 1)
+	acceptorStore.SetNextSenderSeqNum(seq + 2)
+	if err := acceptor.Session().Send(newOrderMessage("last")); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "resent messages", func() bool { return app.count() == 3 })
+	waitFor(t, "gap fill", func() bool {
+		return initiator.Session().Store().NextTargetSeqNum() == acceptorStore.NextSenderSeqNum()
+	})
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	resent := app.messages[1]
+	if id, _ := resent.Get(TagClOrdID); id != "missed" || !resent.GetBool(TagPossDupFlag) {
+		t.Errorf("unexpected resent message %s", resent)
+	}
+	if _, ok := resent.Get(TagOrigSendingTime); !ok {
+		t.Errorf("resent message has no OrigSendingTime")
+	}
+	if id, _ := app.messages[2].Get(TagClOrdID); id != "last" {
+		t.Errorf("unexpected last message %s", app.messages[2])
+	}
+}
+
+func TestSessionResendRequestWithGap(t *testing.T) {
+	venue := &recordingApp{}
+	acceptor := startTestAcceptor(t, venue, NewMemoryStore())
+	defer acceptor.Stop()
+	initiator := newTestInitiator(acceptor.Addr(), NewMemoryStore(), &recordingApp{})
+	initiator.Start(context.TODO())
+	defer initiator.Stop()
+	waitFor(t, "logon", initiator.Session().IsLoggedOn)
+
+	if err := initiator.Session().Send(newOrderMessage("first")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "first message", func() bool { return venue.count() == 1 })
+
+	// both sides miss messages, the resend request of the acceptor has a
+	// sequence number too high for the initiator
+	acceptorStore := acceptor.Session().Store()
+	acceptorStore.SetNextTargetSeqNum(acceptorStore.NextTargetSeqNum() - 1)
+	acceptorStore.SetNextSenderSeqNum(acceptorStore.NextSenderSeqNum() + 2)
+	if err := initiator.Session().Send(newOrderMessage("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "resent messages", func() bool { return venue.count() == 3 })
+	waitFor(t, "gap fill", func() bool {
+		return initiator.Session().Store().NextTargetSeqNum() == acceptorStore.NextSenderSeqNum() &&
+			acceptorStore.NextTargetSeqNum() == initiator.Session().Store().NextSenderSeqNum()
+	})
+	venue.mu.Lock()
+	defer venue.mu.Unlock()
+	if id, _ := venue.messages[1].Get(TagClOrdID); id != "first" || !venue.messages[1].GetBool(TagPossDupFlag) {
+		t.Errorf("unexpected resent message %s", venue.messages[1])
+	}
+	if id, _ := venue.messages[2].Get(TagClOrdID); id != "second" {
+		t.Errorf("unexpected last message %s", venue.messages[2])
+	}
+}
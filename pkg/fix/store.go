@@ -0,0 +1,224 @@
+package fix
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// MessageStore keeps the sequence numbers of a session and the messages
+// sent, which are needed to answer resend requests
+type MessageStore interface {
+	NextSenderSeqNum() int
+	NextTargetSeqNum() int
+	SetNextSenderSeqNum(seq int) error
+	SetNextTargetSeqNum(seq int) error
+	// SaveMessage saves an outgoing message with its sequence number
+	SaveMessage(seq int, msg []byte) error
+	// GetMessages returns the saved messages from begin to end inclusive,
+	// keyed by sequence number
+	GetMessages(begin, end int) (map[int][]byte, error)
+	// Reset sets both sequence numbers to 1 and drops the saved messages
+	Reset() error
+	Close() error
+}
+
+type memoryStore struct {
+	mu        sync.Mutex
+	senderSeq int
+	targetSeq int
+	messages  map[int][]byte
+}
+
+// NewMemoryStore creates a store which is lost when the process exits
+func NewMemoryStore() MessageStore {
+	return &memoryStore{
+		senderSeq: 1,
+		targetSeq: 1,
+		messages:  map[int][]byte{},
+	}
+}
+
+func (s *memoryStore) NextSenderSeqNum() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.senderSeq
+}
+
+func (s *memoryStore) NextTargetSeqNum() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.targetSeq
+}
+
+func (s *memoryStore) SetNextSenderSeqNum(seq int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.senderSeq = seq
+	return nil
+}
+
+func (s *memoryStore) SetNextTargetSeqNum(seq int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.targetSeq = seq
+	return nil
+}
+
+func (s *memoryStore) SaveMessage(seq int, msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages[seq] = msg
+	return nil
+}
+
+func (s *memoryStore) GetMessages(begin, end int) (map[int][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := map[int][]byte{}
+	for seq, msg := range s.messages {
+		if seq >= begin && seq <= end {
+			res[seq] = msg
+		}
+	}
+	return res, nil
+}
+
+func (s *memoryStore) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.senderSeq = 1
+	s.targetSeq = 1
+	s.messages = map[int][]byte{}
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// fileStore persists the sequence numbers in <name>.seqnums and appends the
+// outgoing messages to <name>.body, one json record per line
+type fileStore struct {
+	memoryStore
+	seqPath  string
+	bodyPath string
+	body     *os.File
+}
+
+type storedMessage struct {
+	Seq int    `json:"seq"`
+	Msg string `json:"msg"`
+}
+
+// NewFileStore creates a store in dir for the session between senderCompID
+// and targetCompID. The sequence numbers and messages of a previous run are
+// loaded.
+func NewFileStore(dir, senderCompID, targetCompID string) (MessageStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	name := filepath.Join(dir, fmt.Sprintf("%s-%s", senderCompID, targetCompID))
+	s := &fileStore{
+		memoryStore: memoryStore{
+			senderSeq: 1,
+			targetSeq: 1,
+			messages:  map[int][]byte{},
+		},
+		seqPath:  name + ".seqnums",
+		bodyPath: name + ".body",
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	body, err := os.OpenFile(s.bodyPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.body = body
+	return s, nil
+}
+
+func (s *fileStore) load() error {
+	if data, err := ioutil.ReadFile(s.seqPath); err == nil {
+		if _, err := fmt.Sscanf(string(data), "%d %d", &s.senderSeq, &s.targetSeq); err != nil {
+			return fmt.Errorf("invalid sequence numbers file %s: %v", s.seqPath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.Open(s.bodyPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		record := storedMessage{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// the last record may be truncated by a crash
+			continue
+		}
+		s.messages[record.Seq] = []byte(record.Msg)
+	}
+	return scanner.Err()
+}
+
+func (s *fileStore) saveSeqNums() error {
+	data := fmt.Sprintf("%d %d", s.senderSeq, s.targetSeq)
+	tmp := s.seqPath + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(data), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.seqPath)
+}
+
+func (s *fileStore) SetNextSenderSeqNum(seq int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.senderSeq = seq
+	return s.saveSeqNums()
+}
+
+func (s *fileStore) SetNextTargetSeqNum(seq int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.targetSeq = seq
+	return s.saveSeqNums()
+}
+
+func (s *fileStore) SaveMessage(seq int, msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages[seq] = msg
+	data, err := json.Marshal(storedMessage{Seq: seq, Msg: string(msg)})
+	if err != nil {
+		return err
+	}
+	_, err = s.body.Write(append(data, '\n'))
+	return err
+}
+
+func (s *fileStore) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.senderSeq = 1
+	s.targetSeq = 1
+	s.messages = map[int][]byte{}
+	if err := s.body.Truncate(0); err != nil {
+		return err
+	}
+	return s.saveSeqNums()
+}
+
+func (s *fileStore) Close() error {
+	return s.body.Close()
+}
@@ -37,17 +37,7 @@ func NewAlertObject(cfg *config.Config, vm *goja.Runtime) (*AlertObject, error)
 		return nil, err
 	}
 
-	if cfg.Notification.Pushover.Enabled {
-		alert.notifiers = append(alert.notifiers, notify.NewPushoverNotifier(cfg))
-	}
-
-	if cfg.Notification.Email.Enabled {
-		alert.notifiers = append(alert.notifiers, notify.NewEmailNotifier(cfg))
-	}
-
-	if cfg.Notification.Twilio.Enabled {
-		alert.notifiers = append(alert.notifiers, notify.NewTwilioNotifier(cfg))
-	}
+	alert.notifiers = notify.NewNotifiers(cfg)
 
 	return alert, nil
 }
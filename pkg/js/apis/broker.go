@@ -0,0 +1,555 @@
+package apis
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"goat/pkg/config"
+	"goat/pkg/core"
+	"goat/pkg/logger"
+
+	"github.com/dop251/goja"
+	"go.uber.org/zap"
+)
+
+type BrokerObject struct {
+	cfg    *config.Config
+	broker core.Broker
+	VM     *goja.Runtime
+}
+
+func NewBrokerObject(cfg *config.Config, vm *goja.Runtime, b core.Broker) (*BrokerObject, error) {
+	if cfg == nil || vm == nil {
+		return nil, fmt.Errorf("invalid config or vm")
+	}
+
+	broker := &BrokerObject{
+		cfg:    cfg,
+		broker: b,
+		VM:     vm,
+	}
+
+	brokerObj := broker.VM.NewObject()
+	brokerObj.Set("marketOrder", broker.MarketOrderCmd)
+	brokerObj.Set("limitOrder", broker.LimitOrderCmd)
+	brokerObj.Set("stopOrder", broker.StopOrderCmd)
+	brokerObj.Set("stopLimitOrder", broker.StopLimitOrderCmd)
+	brokerObj.Set("trailingStopOrder", broker.TrailingStopOrderCmd)
+	brokerObj.Set("atrTrailingStopOrder", broker.ATRTrailingStopOrderCmd)
+	brokerObj.Set("ocoOrder", broker.OCOOrderCmd)
+	brokerObj.Set("bracketOrder", broker.BracketOrderCmd)
+	brokerObj.Set("algoOrder", broker.AlgoOrderCmd)
+	brokerObj.Set("cancel", broker.CancelCmd)
+	brokerObj.Set("replace", broker.ReplaceCmd)
+	brokerObj.Set("getOrder", broker.GetOrderCmd)
+	brokerObj.Set("openOrders", broker.OpenOrdersCmd)
+	brokerObj.Set("position", broker.PositionCmd)
+	brokerObj.Set("cash", broker.CashCmd)
+	if err := broker.VM.Set("broker", brokerObj); err != nil {
+		logger.Logger.Fatal("failed to set broker object", zap.Error(err))
+		return nil, err
+	}
+
+	return broker, nil
+}
+
+// OrderToObject converts an order to a plain object that can be passed to scripts
+func OrderToObject(order core.Order) map[string]interface{} {
+	if order == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"id":             order.GetID(),
+		"type":           order.GetType().String(),
+		"action":         order.GetAction().String(),
+		"state":          order.GetState().String(),
+		"instrument":     order.GetInstrument(),
+		"quantity":       order.GetQuantity(),
+		"filled":         order.GetFilled(),
+		"remaining":      order.GetRemaining(),
+		"avgFillPrice":   order.GetAvgFillPrice(),
+		"commission":     order.GetCommission(),
+		"limitPrice":     order.GetLimitPrice(),
+		"stopPrice":      order.GetStopPrice(),
+		"parentId":       order.GetParentID(),
+		"ocoGroup":       order.GetOCOGroup(),
+		"active":         order.IsActive(),
+		"submitDateTime": order.GetSubmitDateTime().Format(time.RFC3339),
+	}
+}
+
+// OrderEventToObject converts an order event to a plain object that can be
+// passed to scripts
+func OrderEventToObject(orderEvent core.OrderEvent) map[string]interface{} {
+	res := map[string]interface{}{
+		"type":  orderEvent.GetEventType().String(),
+		"order": OrderToObject(orderEvent.GetOrder()),
+		"info":  nil,
+	}
+	switch info := orderEvent.GetEventInfo().(type) {
+	case *core.OrderExecutionInfo:
+		res["info"] = map[string]interface{}{
+			"price":      info.Price,
+			"quantity":   info.Quantity,
+			"commission": info.Commission,
+			"dateTime":   info.DateTime.Format(time.RFC3339),
+		}
+	case string:
+		res["info"] = info
+	}
+	return res
+}
+
+func parseOrderAction(v goja.Value) (core.OrderAction, error) {
+	switch strings.ToLower(v.String()) {
+	case "buy":
+		return core.OrderActionBuy, nil
+	case "sell":
+		return core.OrderActionSell, nil
+	default:
+		return 0, fmt.Errorf("invalid order action %s", v.String())
+	}
+}
+
+func (b *BrokerObject) submit(order core.Order) goja.Value {
+	if b.broker == nil {
+		logger.Logger.Error("broker is nil")
+		return goja.Null()
+	}
+	if err := b.broker.SubmitOrder(order); err != nil {
+		logger.Logger.Info("failed to submit order", zap.String("order", order.String()),
+			zap.Error(err))
+		return goja.Null()
+	}
+	return b.VM.ToValue(OrderToObject(order))
+}
+
+// MarketOrderCmd submits a market order: marketOrder(action, symbol, quantity[, onClose])
+func (b *BrokerObject) MarketOrderCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 3 && len(call.Arguments) != 4 {
+		logger.Logger.Debug("marketOrderCmd needs 3 or 4 arguments")
+		return goja.Null()
+	}
+	action, err := parseOrderAction(call.Argument(0))
+	if err != nil {
+		logger.Logger.Debug("marketOrderCmd", zap.Error(err))
+		return goja.Null()
+	}
+	onClose := false
+	if len(call.Arguments) == 4 {
+		onClose = call.Argument(3).ToBoolean()
+	}
+	return b.submit(core.NewMarketOrder(action, call.Argument(1).String(),
+		call.Argument(2).ToFloat(), onClose))
+}
+
+// LimitOrderCmd submits a limit order: limitOrder(action, symbol, limitPrice, quantity)
+func (b *BrokerObject) LimitOrderCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 4 {
+		logger.Logger.Debug("limitOrderCmd needs 4 arguments")
+		return goja.Null()
+	}
+	action, err := parseOrderAction(call.Argument(0))
+	if err != nil {
+		logger.Logger.Debug("limitOrderCmd", zap.Error(err))
+		return goja.Null()
+	}
+	return b.submit(core.NewLimitOrder(action, call.Argument(1).String(),
+		call.Argument(2).ToFloat(), call.Argument(3).ToFloat()))
+}
+
+// StopOrderCmd submits a stop order: stopOrder(action, symbol, stopPrice, quantity)
+func (b *BrokerObject) StopOrderCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 4 {
+		logger.Logger.Debug("stopOrderCmd needs 4 arguments")
+		return goja.Null()
+	}
+	action, err := parseOrderAction(call.Argument(0))
+	if err != nil {
+		logger.Logger.Debug("stopOrderCmd", zap.Error(err))
+		return goja.Null()
+	}
+	return b.submit(core.NewStopOrder(action, call.Argument(1).String(),
+		call.Argument(2).ToFloat(), call.Argument(3).ToFloat()))
+}
+
+// StopLimitOrderCmd submits a stop limit order:
+// stopLimitOrder(action, symbol, stopPrice, limitPrice, quantity)
+func (b *BrokerObject) StopLimitOrderCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 5 {
+		logger.Logger.Debug("stopLimitOrderCmd needs 5 arguments")
+		return goja.Null()
+	}
+	action, err := parseOrderAction(call.Argument(0))
+	if err != nil {
+		logger.Logger.Debug("stopLimitOrderCmd", zap.Error(err))
+		return goja.Null()
+	}
+	return b.submit(core.NewStopLimitOrder(action, call.Argument(1).String(),
+		call.Argument(2).ToFloat(), call.Argument(3).ToFloat(), call.Argument(4).ToFloat()))
+}
+
+// TrailingStopOrderCmd submits a trailing stop order:
+// trailingStopOrder(action, symbol, trailAmount, quantity)
+func (b *BrokerObject) TrailingStopOrderCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 4 {
+		logger.Logger.Debug("trailingStopOrderCmd needs 4 arguments")
+		return goja.Null()
+	}
+	action, err := parseOrderAction(call.Argument(0))
+	if err != nil {
+		logger.Logger.Debug("trailingStopOrderCmd", zap.Error(err))
+		return goja.Null()
+	}
+	return b.submit(core.NewTrailingStopOrder(action, call.Argument(1).String(),
+		call.Argument(2).ToFloat(), call.Argument(3).ToFloat()))
+}
+
+// ATRTrailingStopOrderCmd submits a trailing stop order which trails by a
+// multiple of the average true range:
+// atrTrailingStopOrder(action, symbol, multiple, period, quantity)
+func (b *BrokerObject) ATRTrailingStopOrderCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 5 {
+		logger.Logger.Debug("atrTrailingStopOrderCmd needs 5 arguments")
+		return goja.Null()
+	}
+	action, err := parseOrderAction(call.Argument(0))
+	if err != nil {
+		logger.Logger.Debug("atrTrailingStopOrderCmd", zap.Error(err))
+		return goja.Null()
+	}
+	return b.submit(core.NewATRTrailingStopOrder(action, call.Argument(1).String(),
+		call.Argument(2).ToFloat(), int(call.Argument(3).ToInteger()), call.Argument(4).ToFloat()))
+}
+
+// orderSpec is an order described by an object in scripts, e.g.
+// {type: "limit", action: "sell", symbol: "GLD", quantity: 10, limitPrice: 110}
+type orderSpec struct {
+	Type        string  `json:"type"`
+	Action      string  `json:"action"`
+	Symbol      string  `json:"symbol"`
+	Quantity    float64 `json:"quantity"`
+	LimitPrice  float64 `json:"limitPrice"`
+	StopPrice   float64 `json:"stopPrice"`
+	TrailAmount float64 `json:"trailAmount"`
+	ATRMultiple float64 `json:"atrMultiple"`
+	ATRPeriod   int     `json:"atrPeriod"`
+	OnClose     bool    `json:"onClose"`
+}
+
+// exportJSON exports v to res through json, so the json tags of res are used
+func exportJSON(v goja.Value, res interface{}) error {
+	data, err := json.Marshal(v.Export())
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, res)
+}
+
+func (b *BrokerObject) parseOrderSpec(v goja.Value) (core.Order, error) {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil, fmt.Errorf("order is missing")
+	}
+	spec := orderSpec{}
+	if err := exportJSON(v, &spec); err != nil {
+		return nil, fmt.Errorf("invalid order: %v", err)
+	}
+	action, err := parseOrderAction(b.VM.ToValue(spec.Action))
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(spec.Type) {
+	case "market":
+		return core.NewMarketOrder(action, spec.Symbol, spec.Quantity, spec.OnClose), nil
+	case "limit":
+		return core.NewLimitOrder(action, spec.Symbol, spec.LimitPrice, spec.Quantity), nil
+	case "stop":
+		return core.NewStopOrder(action, spec.Symbol, spec.StopPrice, spec.Quantity), nil
+	case "stoplimit", "stop_limit":
+		return core.NewStopLimitOrder(action, spec.Symbol, spec.StopPrice, spec.LimitPrice,
+			spec.Quantity), nil
+	case "trailingstop", "trailing_stop":
+		if spec.ATRMultiple > 0 {
+			return core.NewATRTrailingStopOrder(action, spec.Symbol, spec.ATRMultiple,
+				spec.ATRPeriod, spec.Quantity), nil
+		}
+		return core.NewTrailingStopOrder(action, spec.Symbol, spec.TrailAmount, spec.Quantity), nil
+	default:
+		return nil, fmt.Errorf("invalid order type %s", spec.Type)
+	}
+}
+
+// OCOOrderCmd submits one-cancels-other orders, filling or canceling one of
+// them cancels the others: ocoOrder(order1, order2, ...). Each order is an
+// object like {type: "limit", action: "sell", symbol: "GLD", quantity: 10,
+// limitPrice: 110}. It returns the submitted orders.
+func (b *BrokerObject) OCOOrderCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 2 {
+		logger.Logger.Debug("ocoOrderCmd needs at least 2 arguments")
+		return goja.Null()
+	}
+	if b.broker == nil {
+		logger.Logger.Error("broker is nil")
+		return goja.Null()
+	}
+	orders := make([]core.Order, 0, len(call.Arguments))
+	for _, arg := range call.Arguments {
+		order, err := b.parseOrderSpec(arg)
+		if err != nil {
+			logger.Logger.Debug("ocoOrderCmd", zap.Error(err))
+			return goja.Null()
+		}
+		orders = append(orders, order)
+	}
+	if err := b.broker.SubmitOCOOrders(orders...); err != nil {
+		logger.Logger.Info("failed to submit oco orders", zap.Error(err))
+		return goja.Null()
+	}
+	res := make([]interface{}, 0, len(orders))
+	for _, order := range orders {
+		res = append(res, OrderToObject(order))
+	}
+	return b.VM.ToValue(res)
+}
+
+// BracketOrderCmd submits an entry order with a take profit and/or a stop
+// loss that are active once the entry order is filled:
+// bracketOrder(entry, {takeProfit, stopLoss, trailAmount, atrMultiple, atrPeriod}).
+// The entry is an order object as in ocoOrder. takeProfit is a limit price,
+// the stop loss is a stop price, or a trailing stop with trailAmount or
+// atrMultiple. It returns {entry, takeProfit, stopLoss}.
+func (b *BrokerObject) BracketOrderCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 2 {
+		logger.Logger.Debug("bracketOrderCmd needs 2 arguments")
+		return goja.Null()
+	}
+	if b.broker == nil {
+		logger.Logger.Error("broker is nil")
+		return goja.Null()
+	}
+	entry, err := b.parseOrderSpec(call.Argument(0))
+	if err != nil {
+		logger.Logger.Debug("bracketOrderCmd", zap.Error(err))
+		return goja.Null()
+	}
+	exits := struct {
+		TakeProfit  float64 `json:"takeProfit"`
+		StopLoss    float64 `json:"stopLoss"`
+		TrailAmount float64 `json:"trailAmount"`
+		ATRMultiple float64 `json:"atrMultiple"`
+		ATRPeriod   int     `json:"atrPeriod"`
+	}{}
+	if err := exportJSON(call.Argument(1), &exits); err != nil {
+		logger.Logger.Debug("bracketOrderCmd", zap.Error(err))
+		return goja.Null()
+	}
+
+	action := core.OrderActionSell
+	if entry.GetAction() == core.OrderActionSell {
+		action = core.OrderActionBuy
+	}
+	var takeProfit, stopLoss core.Order
+	if exits.TakeProfit > 0 {
+		takeProfit = core.NewLimitOrder(action, entry.GetInstrument(), exits.TakeProfit,
+			entry.GetQuantity())
+	}
+	switch {
+	case exits.StopLoss > 0:
+		stopLoss = core.NewStopOrder(action, entry.GetInstrument(), exits.StopLoss,
+			entry.GetQuantity())
+	case exits.TrailAmount > 0:
+		stopLoss = core.NewTrailingStopOrder(action, entry.GetInstrument(), exits.TrailAmount,
+			entry.GetQuantity())
+	case exits.ATRMultiple > 0:
+		stopLoss = core.NewATRTrailingStopOrder(action, entry.GetInstrument(), exits.ATRMultiple,
+			exits.ATRPeriod, entry.GetQuantity())
+	}
+	if err := b.broker.SubmitBracketOrder(entry, takeProfit, stopLoss); err != nil {
+		logger.Logger.Info("failed to submit bracket order", zap.String("order", entry.String()),
+			zap.Error(err))
+		return goja.Null()
+	}
+	return b.VM.ToValue(map[string]interface{}{
+		"entry":      OrderToObject(entry),
+		"takeProfit": OrderToObject(takeProfit),
+		"stopLoss":   OrderToObject(stopLoss),
+	})
+}
+
+// AlgoOrderCmd works a parent order with an execution algorithm:
+// algoOrder(order, {algo: "twap", duration: "2h", slices: 8}). The order is
+// a market or limit order object as in ocoOrder. The algo is "twap" or
+// "vwap" with a duration, a number of slices and an optional RFC3339 start,
+// or "iceberg" with a displayQuantity. It returns the parent order, whose
+// events roll up the fills of its child orders.
+func (b *BrokerObject) AlgoOrderCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 2 {
+		logger.Logger.Debug("algoOrderCmd needs 2 arguments")
+		return goja.Null()
+	}
+	algoBroker, ok := b.broker.(core.AlgoBroker)
+	if !ok {
+		logger.Logger.Error("broker does not support algo orders")
+		return goja.Null()
+	}
+	parent, err := b.parseOrderSpec(call.Argument(0))
+	if err != nil {
+		logger.Logger.Debug("algoOrderCmd", zap.Error(err))
+		return goja.Null()
+	}
+	spec := struct {
+		Algo            string  `json:"algo"`
+		Start           string  `json:"start"`
+		Duration        string  `json:"duration"`
+		Slices          int     `json:"slices"`
+		DisplayQuantity float64 `json:"displayQuantity"`
+	}{}
+	if err := exportJSON(call.Argument(1), &spec); err != nil {
+		logger.Logger.Debug("algoOrderCmd", zap.Error(err))
+		return goja.Null()
+	}
+	params := core.AlgoParams{
+		Algo:            core.ExecutionAlgo(spec.Algo),
+		Slices:          spec.Slices,
+		DisplayQuantity: spec.DisplayQuantity,
+	}
+	if spec.Duration != "" {
+		if params.Duration, err = time.ParseDuration(spec.Duration); err != nil {
+			logger.Logger.Debug("algoOrderCmd invalid duration", zap.Error(err))
+			return goja.Null()
+		}
+	}
+	if spec.Start != "" {
+		if params.Start, err = time.Parse(time.RFC3339, spec.Start); err != nil {
+			logger.Logger.Debug("algoOrderCmd invalid start", zap.Error(err))
+			return goja.Null()
+		}
+	}
+	if err := algoBroker.SubmitAlgoOrder(parent, params); err != nil {
+		logger.Logger.Info("failed to submit algo order", zap.String("order", parent.String()),
+			zap.Error(err))
+		return goja.Null()
+	}
+	return b.VM.ToValue(OrderToObject(parent))
+}
+
+func (b *BrokerObject) CancelCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 1 {
+		logger.Logger.Debug("cancelCmd needs 1 argument")
+		return b.VM.ToValue(false)
+	}
+	if b.broker == nil {
+		logger.Logger.Error("broker is nil")
+		return b.VM.ToValue(false)
+	}
+	order := b.broker.GetOrder(uint64(call.Argument(0).ToInteger()))
+	if order == nil {
+		logger.Logger.Debug("cancelCmd order not found", zap.Int64("id", call.Argument(0).ToInteger()))
+		return b.VM.ToValue(false)
+	}
+	if err := b.broker.CancelOrder(order); err != nil {
+		logger.Logger.Debug("failed to cancel order", zap.Error(err))
+		return b.VM.ToValue(false)
+	}
+	return b.VM.ToValue(true)
+}
+
+// orderReplacer is implemented by the brokers which can change active orders
+type orderReplacer interface {
+	ReplaceOrder(order core.Order, quantity, limitPrice, stopPrice float64) error
+}
+
+// ReplaceCmd changes the quantity and the prices of an active order:
+// replace(id, quantity, limitPrice, stopPrice)
+func (b *BrokerObject) ReplaceCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 2 {
+		logger.Logger.Debug("replaceCmd needs at least 2 arguments")
+		return b.VM.ToValue(false)
+	}
+	replacer, ok := b.broker.(orderReplacer)
+	if !ok {
+		logger.Logger.Debug("broker does not support replacing orders")
+		return b.VM.ToValue(false)
+	}
+	order := b.broker.GetOrder(uint64(call.Argument(0).ToInteger()))
+	if order == nil {
+		logger.Logger.Debug("replaceCmd order not found", zap.Int64("id", call.Argument(0).ToInteger()))
+		return b.VM.ToValue(false)
+	}
+	limitPrice := order.GetLimitPrice()
+	if len(call.Arguments) > 2 {
+		limitPrice = call.Argument(2).ToFloat()
+	}
+	stopPrice := order.GetStopPrice()
+	if len(call.Arguments) > 3 {
+		stopPrice = call.Argument(3).ToFloat()
+	}
+	if err := replacer.ReplaceOrder(order, call.Argument(1).ToFloat(), limitPrice, stopPrice); err != nil {
+		logger.Logger.Debug("failed to replace order", zap.Error(err))
+		return b.VM.ToValue(false)
+	}
+	return b.VM.ToValue(true)
+}
+
+func (b *BrokerObject) GetOrderCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 1 {
+		logger.Logger.Debug("getOrderCmd needs 1 argument")
+		return goja.Null()
+	}
+	if b.broker == nil {
+		logger.Logger.Error("broker is nil")
+		return goja.Null()
+	}
+	order := b.broker.GetOrder(uint64(call.Argument(0).ToInteger()))
+	if order == nil {
+		return goja.Null()
+	}
+	return b.VM.ToValue(OrderToObject(order))
+}
+
+// OpenOrdersCmd returns the active orders: openOrders([symbol])
+func (b *BrokerObject) OpenOrdersCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) > 1 {
+		logger.Logger.Debug("openOrdersCmd needs 0 or 1 argument")
+		return goja.Null()
+	}
+	if b.broker == nil {
+		logger.Logger.Error("broker is nil")
+		return goja.Null()
+	}
+	symbol := ""
+	if len(call.Arguments) == 1 {
+		symbol = call.Argument(0).String()
+	}
+	res := []interface{}{}
+	for _, order := range b.broker.GetActiveOrders(symbol) {
+		res = append(res, OrderToObject(order))
+	}
+	return b.VM.ToValue(res)
+}
+
+func (b *BrokerObject) PositionCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 1 {
+		logger.Logger.Debug("positionCmd needs 1 argument")
+		return goja.Null()
+	}
+	if b.broker == nil {
+		logger.Logger.Error("broker is nil")
+		return goja.Null()
+	}
+	return b.VM.ToValue(b.broker.GetPosition(call.Argument(0).String()))
+}
+
+func (b *BrokerObject) CashCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 0 {
+		logger.Logger.Debug("cashCmd needs 0 argument")
+		return goja.Null()
+	}
+	if b.broker == nil {
+		logger.Logger.Error("broker is nil")
+		return goja.Null()
+	}
+	return b.VM.ToValue(b.broker.GetCash())
+}
@@ -0,0 +1,149 @@
+package apis
+
+import (
+	"context"
+	"testing"
+
+	"goat/pkg/config"
+	"goat/pkg/core"
+
+	"github.com/dop251/goja"
+)
+
+func TestBrokerObjectSimple(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Broker.Cash = 1000
+	gen := core.NewBarFeedGenerator([]core.Frequency{core.DAY}, 100)
+	feed := core.NewGenericDataFeed(context.TODO(), cfg, gen, nil, 100, "")
+	broker, err := core.NewBacktestBroker(cfg, feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if obj, err := NewBrokerObject(nil, nil, broker); obj != nil || err == nil {
+		t.Error("expected nil, got", obj)
+	}
+
+	vm := goja.New()
+	if _, err := NewBrokerObject(cfg, vm, broker); err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := vm.RunString(`
+	var o = broker.marketOrder("buy", "GLD", 2);
+	var l = broker.limitOrder("BUY", "GLD", 10, 1);
+	var bad = broker.marketOrder("hold", "GLD", 2);
+	broker.cancel(l.id);
+	[o.id, o.state, broker.openOrders().length, broker.getOrder(l.id).state, bad, broker.cash(),
+		broker.position("GLD")];
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := val.Export().([]interface{})
+	if res[0].(int64) != 1 || res[1].(string) != "SUBMITTED" || res[2].(int64) != 1 ||
+		res[3].(string) != "CANCELED" || res[4] != nil || res[5].(int64) != 1000 ||
+		res[6].(int64) != 0 {
+		t.Error("unexpected result", res)
+	}
+	if len(broker.GetActiveOrders("GLD")) != 1 {
+		t.Error("expected one active order")
+	}
+}
+
+func TestBrokerObjectNilBroker(t *testing.T) {
+	vm := goja.New()
+	if _, err := NewBrokerObject(&config.Config{}, vm, nil); err != nil {
+		t.Fatal(err)
+	}
+	val, err := vm.RunString(`broker.marketOrder("buy", "GLD", 1) == null && broker.cash() == null &&
+		broker.replace(1, 2) === false`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !val.ToBoolean() {
+		t.Error("expected null results without broker")
+	}
+}
+
+func TestBrokerObjectConditionalOrders(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Broker.Cash = 10000
+	gen := core.NewBarFeedGenerator([]core.Frequency{core.DAY}, 100)
+	feed := core.NewGenericDataFeed(context.TODO(), cfg, gen, nil, 100, "")
+	broker, err := core.NewBacktestBroker(cfg, feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := goja.New()
+	if _, err := NewBrokerObject(cfg, vm, broker); err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := vm.RunString(`
+	var b = broker.bracketOrder({type: "market", action: "buy", symbol: "GLD", quantity: 10},
+		{takeProfit: 110, trailAmount: 5});
+	var oco = broker.ocoOrder(
+		{type: "limit", action: "buy", symbol: "SPY", quantity: 1, limitPrice: 90},
+		{type: "stop", action: "buy", symbol: "SPY", quantity: 1, stopPrice: 120});
+	var t = broker.atrTrailingStopOrder("sell", "SPY", 2, 14, 1);
+	var bad = broker.ocoOrder({type: "limit", action: "buy", symbol: "SPY", quantity: 1, limitPrice: 90},
+		{type: "unknown", action: "buy", symbol: "SPY", quantity: 1});
+	var noExit = broker.bracketOrder({type: "market", action: "buy", symbol: "GLD", quantity: 10}, {});
+	broker.cancel(oco[1].id);
+	[b.stopLoss.type, b.stopLoss.parentId == b.entry.id, b.takeProfit.ocoGroup == b.stopLoss.ocoGroup,
+		b.takeProfit.action, broker.getOrder(oco[0].id).state, t.type, bad, noExit,
+		broker.trailingStopOrder("sell", "GLD", 1, 1).type];
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := val.Export().([]interface{})
+	if res[0].(string) != "TRAILING_STOP" || !res[1].(bool) || !res[2].(bool) ||
+		res[3].(string) != "SELL" || res[4].(string) != "CANCELED" ||
+		res[5].(string) != "TRAILING_STOP" || res[6] != nil || res[7] != nil ||
+		res[8].(string) != "TRAILING_STOP" {
+		t.Error("unexpected result", res)
+	}
+}
+
+func TestBrokerObjectAlgoOrder(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Broker.Cash = 10000
+	gen := core.NewBarFeedGenerator([]core.Frequency{core.DAY}, 100)
+	feed := core.NewGenericDataFeed(context.TODO(), cfg, gen, nil, 100, "")
+	broker, err := core.NewBacktestBroker(cfg, feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := goja.New()
+	if _, err := NewBrokerObject(cfg, vm, core.NewAlgoBroker(broker, feed)); err != nil {
+		t.Fatal(err)
+	}
+	val, err := vm.RunString(`
+	var twap = broker.algoOrder({type: "market", action: "buy", symbol: "GLD", quantity: 10},
+		{algo: "twap", duration: "48h", slices: 2});
+	var iceberg = broker.algoOrder({type: "limit", action: "sell", symbol: "GLD", quantity: 10, limitPrice: 110},
+		{algo: "iceberg", displayQuantity: 2});
+	var bad = broker.algoOrder({type: "market", action: "buy", symbol: "GLD", quantity: 10},
+		{algo: "twap", duration: "2 days", slices: 2});
+	broker.cancel(iceberg.id);
+	[twap.state, broker.openOrders().length, broker.getOrder(iceberg.id).state, bad];
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := val.Export().([]interface{})
+	if res[0].(string) != "SUBMITTED" || res[1].(int64) != 1 || res[2].(string) != "CANCELED" || res[3] != nil {
+		t.Error("unexpected result", res)
+	}
+
+	vm = goja.New()
+	NewBrokerObject(cfg, vm, broker)
+	if val, err := vm.RunString(`broker.algoOrder({type: "market", action: "buy", symbol: "GLD", quantity: 1},
+		{algo: "iceberg", displayQuantity: 1})`); err != nil || !goja.IsNull(val) {
+		t.Error("algo orders need an algo broker", val, err)
+	}
+}
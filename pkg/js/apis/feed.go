@@ -2,6 +2,7 @@ package apis
 
 import (
 	"fmt"
+	"time"
 
 	"goat/pkg/config"
 	"goat/pkg/core"
@@ -12,9 +13,10 @@ import (
 )
 
 type FeedObject struct {
-	cfg  *config.Config
-	feed core.DataFeed
-	VM   *goja.Runtime
+	cfg         *config.Config
+	feed        core.DataFeed
+	instruments core.InstrumentRegistry
+	VM          *goja.Runtime
 }
 
 func NewFeedObject(cfg *config.Config, vm *goja.Runtime, f core.DataFeed) (*FeedObject, error) {
@@ -22,14 +24,20 @@ func NewFeedObject(cfg *config.Config, vm *goja.Runtime, f core.DataFeed) (*Feed
 		return nil, fmt.Errorf("invalid config or vm")
 	}
 
+	instruments, err := core.NewInstrumentRegistryFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
 	feed := &FeedObject{
-		cfg:  cfg,
-		feed: f,
-		VM:   vm,
+		cfg:         cfg,
+		feed:        f,
+		instruments: instruments,
+		VM:          vm,
 	}
 
 	feedObj := feed.VM.NewObject()
 	feedObj.Set("dataseries", feed.DataSeriesCmd)
+	feedObj.Set("instrument", feed.InstrumentCmd)
 	if err := feed.VM.Set("feed", feedObj); err != nil {
 		logger.Logger.Fatal("failed to set feed object", zap.Error(err))
 		return nil, err
@@ -94,3 +102,37 @@ func (f *FeedObject) DataSeriesCmd(call goja.FunctionCall) goja.Value {
 		return goja.Null()
 	}
 }
+
+// InstrumentCmd returns the metadata of a symbol, or null if the symbol is
+// not registered
+func (f *FeedObject) InstrumentCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 1 {
+		logger.Logger.Debug("InstrumentCmd needs 1 argument")
+		return goja.Null()
+	}
+	instrument := f.instruments.GetInstrument(call.Argument(0).String())
+	if instrument == nil {
+		return goja.Null()
+	}
+	return f.VM.ToValue(map[string]interface{}{
+		"symbol":       instrument.Symbol,
+		"assetClass":   instrument.AssetClass,
+		"currency":     instrument.Currency,
+		"tickSize":     instrument.TickSize,
+		"lotSize":      instrument.LotSize,
+		"multiplier":   instrument.Multiplier,
+		"tradingHours": instrument.TradingHours,
+		"timezone":     instrument.Timezone,
+	})
+}
+
+// SessionToObject converts a trading session to a plain object that can be
+// passed to scripts
+func SessionToObject(calendar core.TradingCalendar, session core.Session) map[string]interface{} {
+	return map[string]interface{}{
+		"calendar": calendar.Name(),
+		"date":     session.Date.Format("2006-01-02"),
+		"open":     session.Open.Format(time.RFC3339),
+		"close":    session.Close.Format(time.RFC3339),
+	}
+}
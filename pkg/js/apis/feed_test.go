@@ -0,0 +1,83 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+	"goat/pkg/core"
+
+	"github.com/dop251/goja"
+)
+
+func TestFeedObjectInstrument(t *testing.T) {
+	cfg := &config.Config{
+		Instruments: map[string]config.InstrumentConfig{
+			"ES": {AssetClass: "future", Currency: "USD", TickSize: 0.25, Multiplier: 50},
+		},
+	}
+	vm := goja.New()
+	if _, err := NewFeedObject(cfg, vm, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := vm.RunString(`
+	var es = feed.instrument("ES");
+	[es.assetClass, es.currency, es.tickSize, es.multiplier, feed.instrument("GLD"), feed.instrument()];
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := val.Export().([]interface{})
+	if res[0] != "future" || res[1] != "USD" || res[2].(float64) != 0.25 || res[3].(int64) != 50 ||
+		res[4] != nil || res[5] != nil {
+		t.Error("unexpected result", res)
+	}
+
+	cfg.Instruments["ES"] = config.InstrumentConfig{LotSize: -1}
+	if _, err := NewFeedObject(cfg, goja.New(), nil); err == nil {
+		t.Error("invalid instruments should fail")
+	}
+}
+
+func TestFeedObjectResampledDataSeries(t *testing.T) {
+	cfg := &config.Config{}
+	hooks, err := core.NewResampleHooksControl(cfg, core.LiveResampleFrequencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := core.NewBarFeedGenerator([]core.Frequency{core.REALTIME}, 1000)
+	feed := core.NewGenericDataFeed(context.TODO(), cfg, gen, hooks, 100, "")
+	start := time.Date(2023, time.March, 6, 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= 24*2; i++ {
+		tm := start.Add(time.Duration(i) * 30 * time.Minute)
+		p := float64(i)
+		gen.AppendNewValueToBuffer(tm, map[string]interface{}{
+			"X": core.NewBasicBar(tm, 0, 100, 0, p, p, 1, core.REALTIME),
+		}, core.REALTIME)
+	}
+	gen.Finish()
+	d := core.NewDispatcher(context.TODO())
+	d.AddSubject(feed)
+	d.Run()
+
+	vm := goja.New()
+	if _, err := NewFeedObject(cfg, vm, feed); err != nil {
+		t.Fatal(err)
+	}
+	val, err := vm.RunString(`
+	var bars = feed.dataseries("X", frequency.HOUR_4, 10).data;
+	var last = bars[bars.length - 1];
+	[last.open, last.high, last.low, last.close, last.volume, feed.dataseries("X", frequency.WEEK, 10)];
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the realtime values are aggregated from their prices
+	res := val.Export().([]interface{})
+	if fmt.Sprint(res) != "[40 47 40 47 8 <nil>]" {
+		t.Error("unexpected HOUR_4 bar", res)
+	}
+}
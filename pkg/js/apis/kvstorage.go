@@ -65,6 +65,14 @@ func NewKVObject(ctx context.Context, cfg *config.Config, vm *goja.Runtime, kvdb
 	return kv, nil
 }
 
+// Close closes the kvdb file
+func (kv *KVObject) Close() error {
+	if kv.KVDB == nil {
+		return nil
+	}
+	return kv.KVDB.Close()
+}
+
 func (kv *KVObject) DBLoadState(key []byte) ([]byte, error) {
 	var data []byte
 	err := kv.KVDB.View(func(txn *bolt.Tx) error {
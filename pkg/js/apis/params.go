@@ -0,0 +1,208 @@
+package apis
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// supported parameter types of a parameter schema
+const (
+	ParamTypeNumber  = "number"
+	ParamTypeInteger = "integer"
+	ParamTypeString  = "string"
+	ParamTypeBoolean = "boolean"
+)
+
+// ParamSpec describes one strategy parameter declared by the script with
+// system.declareParams
+type ParamSpec struct {
+	Type        string        `json:"type"`
+	Default     interface{}   `json:"default"`
+	Min         *float64      `json:"min"`
+	Max         *float64      `json:"max"`
+	Values      []interface{} `json:"values"`
+	Required    bool          `json:"required"`
+	Description string        `json:"description"`
+}
+
+// ParseParamSchema parses the schema object exported from js
+func ParseParamSchema(v interface{}) (map[string]ParamSpec, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	schema := map[string]ParamSpec{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid parameter schema: %v", err)
+	}
+	return schema, nil
+}
+
+// CoerceParams converts the raw parameters, which come from the config file
+// or the command line, to the types of the schema and applies the defaults.
+// Parameter names are matched case insensitively since viper lowercases the
+// keys of the config file. All the problems found are returned in one error.
+func CoerceParams(schema map[string]ParamSpec, raw map[string]interface{}) (map[string]interface{}, error) {
+	rawByName := make(map[string]interface{}, len(raw))
+	rawNames := make(map[string]string, len(raw))
+	for k, v := range raw {
+		rawByName[strings.ToLower(k)] = v
+		rawNames[strings.ToLower(k)] = k
+	}
+
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := make(map[string]interface{}, len(schema))
+	errs := []string{}
+	for _, name := range names {
+		spec := schema[name]
+		if spec.Type == "" {
+			spec.Type = inferParamType(spec.Default)
+		}
+		v, ok := rawByName[strings.ToLower(name)]
+		delete(rawNames, strings.ToLower(name))
+		if !ok {
+			if spec.Default == nil {
+				if spec.Required {
+					errs = append(errs, fmt.Sprintf("parameter %s is required", name))
+				}
+				continue
+			}
+			v = spec.Default
+		}
+		value, err := spec.coerce(v)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("parameter %s: %v", name, err))
+			continue
+		}
+		res[name] = value
+	}
+
+	unknown := make([]string, 0, len(rawNames))
+	for _, k := range rawNames {
+		unknown = append(unknown, k)
+	}
+	sort.Strings(unknown)
+	for _, k := range unknown {
+		errs = append(errs, fmt.Sprintf("parameter %s is not declared", k))
+	}
+
+	if len(errs) > 0 {
+		return res, fmt.Errorf("invalid strategy parameters: %s", strings.Join(errs, "; "))
+	}
+	return res, nil
+}
+
+func inferParamType(v interface{}) string {
+	switch v.(type) {
+	case bool:
+		return ParamTypeBoolean
+	case string:
+		return ParamTypeString
+	case float64, int64, int:
+		return ParamTypeNumber
+	default:
+		return ""
+	}
+}
+
+// coerce converts v to the type of the parameter and checks its range
+func (p ParamSpec) coerce(v interface{}) (interface{}, error) {
+	value, err := p.convert(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if f, ok := toFloat(value); ok {
+		if p.Min != nil && f < *p.Min {
+			return nil, fmt.Errorf("%v is less than %v", value, *p.Min)
+		}
+		if p.Max != nil && f > *p.Max {
+			return nil, fmt.Errorf("%v is greater than %v", value, *p.Max)
+		}
+	}
+
+	if len(p.Values) > 0 {
+		found := false
+		for _, allowed := range p.Values {
+			if a, err := p.convert(allowed); err == nil && reflect.DeepEqual(a, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%v is not one of %v", value, p.Values)
+		}
+	}
+	return value, nil
+}
+
+func (p ParamSpec) convert(v interface{}) (interface{}, error) {
+	switch p.Type {
+	case "":
+		return v, nil
+	case ParamTypeNumber:
+		if f, ok := toFloat(v); ok {
+			return f, nil
+		}
+		if s, ok := v.(string); ok {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+				return f, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a number", v)
+	case ParamTypeInteger:
+		if f, ok := toFloat(v); ok && f == math.Trunc(f) {
+			return int64(f), nil
+		}
+		if s, ok := v.(string); ok {
+			if i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil {
+				return i, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not an integer", v)
+	case ParamTypeString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return fmt.Sprint(v), nil
+	case ParamTypeBoolean:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		if s, ok := v.(string); ok {
+			if b, err := strconv.ParseBool(strings.TrimSpace(s)); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a boolean", v)
+	default:
+		return nil, fmt.Errorf("unknown parameter type %s", p.Type)
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
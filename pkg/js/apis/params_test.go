@@ -0,0 +1,150 @@
+package apis
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"goat/pkg/config"
+
+	"github.com/dop251/goja"
+)
+
+func TestCoerceParams(t *testing.T) {
+	schema, err := ParseParamSchema(map[string]interface{}{
+		"period":   map[string]interface{}{"type": "integer", "default": 20, "min": 2},
+		"ratio":    map[string]interface{}{"type": "number", "max": 1},
+		"enabled":  map[string]interface{}{"default": true},
+		"mode":     map[string]interface{}{"type": "string", "values": []interface{}{"long", "short"}},
+		"stopLoss": map[string]interface{}{"type": "number", "required": true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// config keys are lowercased by viper, command line values are strings
+	params, err := CoerceParams(schema, map[string]interface{}{
+		"ratio":    "0.5",
+		"enabled":  "false",
+		"mode":     "short",
+		"stoploss": 0.02,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"period":   int64(20),
+		"ratio":    0.5,
+		"enabled":  false,
+		"mode":     "short",
+		"stopLoss": 0.02,
+	}
+	for k, v := range expected {
+		if params[k] != v {
+			t.Errorf("parameter %s should be %v(%T), got %v(%T)", k, v, v, params[k], params[k])
+		}
+	}
+
+	_, err = CoerceParams(schema, map[string]interface{}{
+		"period":  "1",
+		"ratio":   "abc",
+		"enabled": "maybe",
+		"mode":    "both",
+		"unknown": 1,
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, s := range []string{
+		"period: 1 is less than 2", "ratio: abc is not a number", "enabled: maybe is not a boolean",
+		"mode: both is not one of", "stopLoss is required", "unknown is not declared",
+	} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("error should contain %q: %v", s, err)
+		}
+	}
+
+	if _, err := CoerceParams(map[string]ParamSpec{"period": {Type: "integer"}},
+		map[string]interface{}{"period": 1.5}); err == nil {
+		t.Error("expected error for fractional integer")
+	}
+	if _, err := CoerceParams(map[string]ParamSpec{"period": {Type: "date"}},
+		map[string]interface{}{"period": 1}); err == nil {
+		t.Error("expected error for unknown type")
+	}
+}
+
+func TestSysObjectParams(t *testing.T) {
+	cfg := &config.Config{
+		Params: map[string]interface{}{"period": "30", "symbol": "GLD"},
+	}
+	vm := goja.New()
+	sys, err := NewSysObject(cfg, vm, &sync.Mutex{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without a schema the values are not converted
+	val, err := vm.RunString(`system.params.period`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.Export() != "30" {
+		t.Errorf("unexpected period %v", val.Export())
+	}
+
+	prg, err := goja.Compile("", `
+	var params = system.declareParams({
+		period: { type: "integer", default: 20 },
+		symbol: { type: "string" },
+	});
+	[params.period, system.params.period, system.params.symbol];
+	`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, err = vm.RunProgram(prg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := val.Export().([]interface{})
+	if res[0] != int64(30) || res[1] != int64(30) || res[2] != "GLD" {
+		t.Errorf("unexpected params %v", res)
+	}
+	if err := sys.ValidateParams(); err != nil {
+		t.Error(err)
+	}
+
+	// params are read only in strict mode
+	for _, script := range []string{`system.params.period = 10;`, `system.params = {};`} {
+		prg, err := goja.Compile("", script, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := vm.RunProgram(prg); err == nil {
+			t.Errorf("%s should fail", script)
+		}
+	}
+
+	vm.RunString(`system.declareParams({ period: { type: "integer" } });`)
+	if err := sys.ValidateParams(); err == nil {
+		t.Error("expected error for declaring params twice")
+	}
+}
+
+func TestSysObjectInvalidParams(t *testing.T) {
+	cfg := &config.Config{
+		Params: map[string]interface{}{"period": "abc"},
+	}
+	vm := goja.New()
+	sys, err := NewSysObject(cfg, vm, &sync.Mutex{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.RunString(`system.declareParams({ period: { type: "integer", default: 20 } });`); err != nil {
+		t.Fatal(err)
+	}
+	if err := sys.ValidateParams(); err == nil || !strings.Contains(err.Error(), "abc is not an integer") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,238 @@
+package apis
+
+import (
+	"fmt"
+	"time"
+
+	"goat/pkg/config"
+	"goat/pkg/core"
+	"goat/pkg/logger"
+
+	"github.com/dop251/goja"
+	"go.uber.org/zap"
+)
+
+type PortfolioObject struct {
+	cfg       *config.Config
+	portfolio core.Portfolio
+	// broker submits the rebalance orders, it is the broker of the strategy
+	// so that the orders go through its risk checks
+	broker core.Broker
+	VM     *goja.Runtime
+}
+
+func NewPortfolioObject(cfg *config.Config, vm *goja.Runtime, p core.Portfolio,
+	b core.Broker,
+) (*PortfolioObject, error) {
+	if cfg == nil || vm == nil {
+		return nil, fmt.Errorf("invalid config or vm")
+	}
+
+	portfolio := &PortfolioObject{
+		cfg:       cfg,
+		portfolio: p,
+		broker:    b,
+		VM:        vm,
+	}
+
+	portfolioObj := portfolio.VM.NewObject()
+	portfolioObj.Set("cash", portfolio.CashCmd)
+	portfolioObj.Set("equity", portfolio.EquityCmd)
+	portfolioObj.Set("realizedPnL", portfolio.RealizedPnLCmd)
+	portfolioObj.Set("unrealizedPnL", portfolio.UnrealizedPnLCmd)
+	portfolioObj.Set("position", portfolio.PositionCmd)
+	portfolioObj.Set("positions", portfolio.PositionsCmd)
+	portfolioObj.Set("equitySeries", portfolio.EquitySeriesCmd)
+	portfolioObj.Set("baseCurrency", portfolio.BaseCurrencyCmd)
+	portfolioObj.Set("rebalance", portfolio.RebalanceCmd)
+	if err := portfolio.VM.Set("portfolio", portfolioObj); err != nil {
+		logger.Logger.Fatal("failed to set portfolio object", zap.Error(err))
+		return nil, err
+	}
+
+	return portfolio, nil
+}
+
+// PositionToObject converts a portfolio position to a plain object that can
+// be passed to scripts
+func PositionToObject(pos *core.PortfolioPosition) map[string]interface{} {
+	if pos == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"instrument":    pos.Instrument,
+		"quantity":      pos.Quantity,
+		"avgCost":       pos.AvgCost,
+		"lastPrice":     pos.LastPrice,
+		"marketValue":   pos.MarketValue(),
+		"realizedPnL":   pos.RealizedPnL,
+		"unrealizedPnL": pos.UnrealizedPnL(),
+		"commission":    pos.Commission,
+		"multiplier":    pos.Multiplier,
+		"currency":      pos.Currency,
+		"dividends":     pos.Dividends,
+	}
+}
+
+func (p *PortfolioObject) valueCmd(name string, call goja.FunctionCall,
+	fn func() float64,
+) goja.Value {
+	if len(call.Arguments) != 0 {
+		logger.Logger.Debug(name + " needs 0 argument")
+		return goja.Null()
+	}
+	if p.portfolio == nil {
+		logger.Logger.Error("portfolio is nil")
+		return goja.Null()
+	}
+	return p.VM.ToValue(fn())
+}
+
+// BaseCurrencyCmd returns the currency of the values of the portfolio, an
+// empty string if they are not converted
+func (p *PortfolioObject) BaseCurrencyCmd(call goja.FunctionCall) goja.Value {
+	if p.portfolio == nil {
+		logger.Logger.Error("portfolio is nil")
+		return goja.Null()
+	}
+	return p.VM.ToValue(p.portfolio.GetBaseCurrency())
+}
+
+func (p *PortfolioObject) CashCmd(call goja.FunctionCall) goja.Value {
+	return p.valueCmd("cashCmd", call, func() float64 {
+		return p.portfolio.GetCash()
+	})
+}
+
+func (p *PortfolioObject) EquityCmd(call goja.FunctionCall) goja.Value {
+	return p.valueCmd("equityCmd", call, func() float64 {
+		return p.portfolio.GetEquity()
+	})
+}
+
+func (p *PortfolioObject) RealizedPnLCmd(call goja.FunctionCall) goja.Value {
+	return p.valueCmd("realizedPnLCmd", call, func() float64 {
+		return p.portfolio.GetRealizedPnL()
+	})
+}
+
+func (p *PortfolioObject) UnrealizedPnLCmd(call goja.FunctionCall) goja.Value {
+	return p.valueCmd("unrealizedPnLCmd", call, func() float64 {
+		return p.portfolio.GetUnrealizedPnL()
+	})
+}
+
+func (p *PortfolioObject) PositionCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 1 {
+		logger.Logger.Debug("positionCmd needs 1 argument")
+		return goja.Null()
+	}
+	if p.portfolio == nil {
+		logger.Logger.Error("portfolio is nil")
+		return goja.Null()
+	}
+	pos := p.portfolio.GetPosition(call.Argument(0).String())
+	if pos == nil {
+		return goja.Null()
+	}
+	return p.VM.ToValue(PositionToObject(pos))
+}
+
+func (p *PortfolioObject) PositionsCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 0 {
+		logger.Logger.Debug("positionsCmd needs 0 argument")
+		return goja.Null()
+	}
+	if p.portfolio == nil {
+		logger.Logger.Error("portfolio is nil")
+		return goja.Null()
+	}
+	res := map[string]interface{}{}
+	for k, pos := range p.portfolio.GetPositions() {
+		res[k] = PositionToObject(pos)
+	}
+	return p.VM.ToValue(res)
+}
+
+// EquitySeriesCmd returns the last values of the equity curve:
+// equitySeries(length) returns {data: [...], dateTimes: [...]}
+func (p *PortfolioObject) EquitySeriesCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 1 {
+		logger.Logger.Debug("equitySeriesCmd needs 1 argument")
+		return goja.Null()
+	}
+	if p.portfolio == nil {
+		logger.Logger.Error("portfolio is nil")
+		return goja.Null()
+	}
+	ds := p.portfolio.GetEquityDataSeries()
+	length := int(call.Argument(0).ToInteger())
+	if length <= 0 || length > ds.Len() {
+		length = ds.Len()
+	}
+	data := make([]interface{}, 0, length)
+	dateTimes := make([]interface{}, 0, length)
+	for i := ds.Len() - length; i < ds.Len(); i++ {
+		t, v, err := ds.At(i)
+		if err != nil {
+			logger.Logger.Debug("equitySeriesCmd", zap.Error(err))
+			return goja.Null()
+		}
+		data = append(data, v)
+		dateTimes = append(dateTimes, t.Format(time.RFC3339))
+	}
+	return p.VM.ToValue(map[string]interface{}{
+		"data":      data,
+		"dateTimes": dateTimes,
+	})
+}
+
+// RebalanceCmd submits the orders which move the holdings to target weights of
+// the equity: rebalance({GLD: 0.6, SLV: 0.4}, {minTradeValue: 100,
+// minTradeWeight: 0.01, dryRun: false}). The positions which are not in the
+// targets are closed. It returns {orders: [...], skipped: [...], equity,
+// tradedValue, turnover, cost}.
+func (p *PortfolioObject) RebalanceCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 1 || len(call.Arguments) > 2 {
+		logger.Logger.Debug("rebalanceCmd needs 1 or 2 arguments")
+		return goja.Null()
+	}
+	if p.portfolio == nil || p.broker == nil {
+		logger.Logger.Error("portfolio or broker is nil")
+		return goja.Null()
+	}
+	targets := map[string]float64{}
+	if err := exportJSON(call.Argument(0), &targets); err != nil {
+		logger.Logger.Debug("rebalanceCmd invalid targets", zap.Error(err))
+		return goja.Null()
+	}
+	opts := core.RebalanceOptions{}
+	if v := call.Argument(1); !goja.IsUndefined(v) && !goja.IsNull(v) {
+		if err := exportJSON(v, &opts); err != nil {
+			logger.Logger.Debug("rebalanceCmd invalid options", zap.Error(err))
+			return goja.Null()
+		}
+	}
+
+	res, err := core.Rebalance(p.portfolio, p.broker, targets, opts)
+	if err != nil {
+		logger.Logger.Debug("rebalanceCmd", zap.Error(err))
+		return goja.Null()
+	}
+	orders := make([]interface{}, 0, len(res.Orders))
+	for _, o := range res.Orders {
+		orders = append(orders, OrderToObject(o))
+	}
+	skipped := make([]interface{}, 0, len(res.Skipped))
+	for _, s := range res.Skipped {
+		skipped = append(skipped, s)
+	}
+	return p.VM.ToValue(map[string]interface{}{
+		"orders":      orders,
+		"skipped":     skipped,
+		"equity":      res.Equity,
+		"tradedValue": res.TradedValue,
+		"turnover":    res.Turnover,
+		"cost":        res.Cost,
+	})
+}
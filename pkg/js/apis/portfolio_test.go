@@ -0,0 +1,82 @@
+package apis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+	"goat/pkg/core"
+
+	"github.com/dop251/goja"
+)
+
+func TestPortfolioObjectSimple(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Broker.Cash = 1000
+	gen := core.NewBarFeedGenerator([]core.Frequency{core.DAY}, 100)
+	feed := core.NewGenericDataFeed(context.TODO(), cfg, gen, nil, 100, "")
+	broker, err := core.NewBacktestBroker(cfg, feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	portfolio := core.NewPortfolio(broker, feed, 0)
+
+	if obj, err := NewPortfolioObject(nil, nil, portfolio, broker); obj != nil || err == nil {
+		t.Error("expected nil, got", obj)
+	}
+
+	vm := goja.New()
+	if _, err := NewPortfolioObject(cfg, vm, portfolio, broker); err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := vm.RunString(`
+	[portfolio.cash(), portfolio.equity(), portfolio.position("GLD"),
+		Object.keys(portfolio.positions()).length, portfolio.equitySeries(10).data.length];
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := val.Export().([]interface{})
+	if res[0].(int64) != 1000 || res[1].(int64) != 1000 || res[2] != nil ||
+		res[3].(int64) != 0 || res[4].(int64) != 0 {
+		t.Error("unexpected result", res)
+	}
+}
+
+func TestPortfolioObjectRebalance(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Broker.Cash = 1000
+	gen := core.NewBarFeedGenerator([]core.Frequency{core.DAY}, 100)
+	feed := core.NewGenericDataFeed(context.TODO(), cfg, gen, nil, 100, "")
+	broker, err := core.NewBacktestBroker(cfg, feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	portfolio := core.NewPortfolio(broker, feed, 0)
+	vm := goja.New()
+	if _, err := NewPortfolioObject(cfg, vm, portfolio, broker); err != nil {
+		t.Fatal(err)
+	}
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	feed.GetNewValueEvent().Emit(tm, map[string]interface{}{
+		"GLD": core.NewBasicBar(tm, 10, 10, 10, 10, 10, 1000, core.DAY),
+	})
+
+	val, err := vm.RunString(`
+	var res = portfolio.rebalance({GLD: 0.5}, {minTradeValue: 10});
+	[res.orders.length, res.orders[0].quantity, res.turnover, portfolio.rebalance({SLV: 0.5}),
+		portfolio.rebalance("GLD")];
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := val.Export().([]interface{})
+	if res[0].(int64) != 1 || res[1].(int64) != 50 || res[2].(float64) != 0.5 || res[3] != nil || res[4] != nil {
+		t.Error("unexpected result", res)
+	}
+	if len(broker.GetActiveOrders("GLD")) != 1 {
+		t.Error("the order should be submitted")
+	}
+}
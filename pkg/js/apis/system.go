@@ -6,11 +6,11 @@ import (
 	"time"
 
 	"goat/pkg/config"
+	"goat/pkg/core"
 	"goat/pkg/logger"
 
 	"github.com/dop251/goja"
 	"github.com/dop251/goja_nodejs/require"
-	"go.uber.org/zap"
 )
 
 type StartCallback func() error
@@ -21,6 +21,20 @@ type SysObject struct {
 	Mu             *sync.Mutex
 	Cb             StartCallback
 	StrategyStatus string
+	// Clock is the clock of the dispatcher, system.now() is the wall time
+	// without it
+	Clock core.Clock
+
+	params      *goja.Object
+	paramsErr   error
+	paramSchema map[string]ParamSpec
+
+	// timers maps the ids of the script timers to the ones of the
+	// scheduler, the timers are pending until the scheduler is set
+	scheduler     core.Scheduler
+	nextTimerID   int64
+	timers        map[int64]uint64
+	pendingTimers []*jsTimer
 }
 
 func NewSysObject(cfg *config.Config, vm *goja.Runtime, runMu *sync.Mutex, startCb StartCallback) (*SysObject, error) {
@@ -33,6 +47,8 @@ func NewSysObject(cfg *config.Config, vm *goja.Runtime, runMu *sync.Mutex, start
 		VM:  vm,
 		Mu:  runMu,
 		Cb:  startCb,
+
+		timers: map[int64]uint64{},
 	}
 
 	sysObj := sys.VM.NewObject()
@@ -40,18 +56,80 @@ func NewSysObject(cfg *config.Config, vm *goja.Runtime, runMu *sync.Mutex, start
 	sysObj.Set("now", sys.TimeCmd)
 	sysObj.Set("strftime", sys.StrftimeCmd)
 	sysObj.Set("reportStatus", sys.ReportStatusCmd)
+	sysObj.Set("declareParams", sys.DeclareParamsCmd)
+	sysObj.Set("schedule", sys.ScheduleCmd)
+	// params is read only, scripts run in strict mode so that assigning it
+	// throws a TypeError
+	sys.params = sys.newParamsObject(cfg.Params)
+	sysObj.DefineAccessorProperty("params", sys.VM.ToValue(func(goja.FunctionCall) goja.Value {
+		return sys.params
+	}), nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
 	sys.VM.Set("system", sysObj)
 
 	consoleObj := sys.VM.NewObject()
 	consoleObj.Set("log", sys.LogCmd)
 	sys.VM.Set("console", consoleObj)
 
+	sys.VM.Set("setTimeout", sys.SetTimeoutCmd)
 	sys.VM.Set("setInterval", sys.SetIntervalCmd)
+	sys.VM.Set("clearTimeout", sys.ClearTimerCmd)
+	sys.VM.Set("clearInterval", sys.ClearTimerCmd)
 	sys.registerRequire()
 
 	return sys, nil
 }
 
+// newParamsObject returns a frozen object of the strategy parameters
+func (sys *SysObject) newParamsObject(params map[string]interface{}) *goja.Object {
+	paramsObj := sys.VM.NewObject()
+	for k, v := range params {
+		paramsObj.Set(k, v)
+	}
+	if freeze, ok := goja.AssertFunction(sys.VM.Get("Object").ToObject(sys.VM).Get("freeze")); ok {
+		freeze(goja.Undefined(), paramsObj)
+	}
+	return paramsObj
+}
+
+// DeclareParamsCmd declares the parameter schema of the strategy, e.g.
+//
+//	system.declareParams({
+//	  period: { type: "integer", default: 20, min: 1 },
+//	  mode: { type: "string", values: ["long", "short"], required: true },
+//	});
+//
+// The parameters are converted to the declared types and system.params is
+// replaced with them. Validation errors are kept and reported by
+// ValidateParams before the strategy starts, so that all of them are shown
+// at once.
+func (sys *SysObject) DeclareParamsCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 1 {
+		logger.Logger.Debug("declareParamsCmd needs 1 argument")
+		return goja.Null()
+	}
+	if sys.paramSchema != nil {
+		sys.paramsErr = fmt.Errorf("strategy parameters are declared more than once")
+		return sys.params
+	}
+
+	schema, err := ParseParamSchema(call.Argument(0).Export())
+	if err != nil {
+		sys.paramsErr = err
+		return sys.params
+	}
+	params, err := CoerceParams(schema, sys.cfg.Params)
+	sys.paramSchema = schema
+	sys.paramsErr = err
+	sys.params = sys.newParamsObject(params)
+	return sys.params
+}
+
+// ValidateParams returns the errors found in the strategy parameters when
+// the script declared them
+func (sys *SysObject) ValidateParams() error {
+	return sys.paramsErr
+}
+
 func (sys *SysObject) registerRequire() {
 	registry := require.Registry{}
 	registry.Enable(sys.VM)
@@ -68,28 +146,6 @@ func (sys *SysObject) ReportStatusCmd(call goja.FunctionCall) goja.Value {
 	return sys.VM.ToValue(true)
 }
 
-func (sys *SysObject) SetIntervalCmd(call goja.FunctionCall) goja.Value {
-	logger.Logger.Debug("setIntervalCmd")
-	if len(call.Arguments) != 2 {
-		logger.Logger.Debug("setIntervalCmd needs 2 argument")
-		return sys.VM.ToValue(false)
-	}
-	if cb, ok := goja.AssertFunction(call.Argument(0)); ok {
-		interval := call.Argument(1).ToInteger()
-		go func(cb goja.Callable, interval int64, mu *sync.Mutex) {
-			for {
-				time.Sleep(time.Duration(interval) * time.Millisecond)
-				mu.Lock()
-				if _, err := cb(goja.Undefined()); err != nil {
-					logger.Logger.Error("setIntervalCmd callback error", zap.Error(err))
-				}
-				mu.Unlock()
-			}
-		}(cb, interval, sys.Mu)
-	}
-	return sys.VM.ToValue(true)
-}
-
 func (sys *SysObject) StrftimeCmd(call goja.FunctionCall) goja.Value {
 	if len(call.Arguments) != 2 {
 		logger.Logger.Debug("strftimeCmd needs 2 argument")
@@ -136,6 +192,9 @@ func (sys *SysObject) TimeCmd(call goja.FunctionCall) goja.Value {
 	}
 
 	tm := time.Now().Unix()
+	if sys.Clock != nil {
+		tm = sys.Clock.Now().Unix()
+	}
 
 	return sys.VM.ToValue(tm)
 }
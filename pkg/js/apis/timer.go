@@ -0,0 +1,135 @@
+package apis
+
+import (
+	"time"
+
+	"goat/pkg/core"
+	"goat/pkg/logger"
+
+	"github.com/dop251/goja"
+	"go.uber.org/zap"
+)
+
+// jsTimer is a timer of the script, it is added to the scheduler once the
+// strategy controller runs
+type jsTimer struct {
+	id     int64
+	delay  time.Duration
+	repeat bool
+	spec   core.CronSpec
+	fn     func()
+}
+
+func (t *jsTimer) addTo(scheduler core.Scheduler) uint64 {
+	if t.spec != nil {
+		return scheduler.AddCronJob(t.spec, t.fn)
+	}
+	return scheduler.AddTimer(t.delay, t.repeat, t.fn)
+}
+
+// SetScheduler sets the scheduler of the timers, the timers added before
+// are scheduled in order. The runtime lock must be held.
+func (sys *SysObject) SetScheduler(scheduler core.Scheduler) {
+	sys.scheduler = scheduler
+	for _, t := range sys.pendingTimers {
+		sys.timers[t.id] = t.addTo(scheduler)
+	}
+	sys.pendingTimers = nil
+}
+
+func (sys *SysObject) addTimer(t *jsTimer, cb goja.Callable) goja.Value {
+	sys.nextTimerID++
+	t.id = sys.nextTimerID
+	t.fn = func() {
+		sys.Mu.Lock()
+		defer sys.Mu.Unlock()
+		if !t.repeat {
+			delete(sys.timers, t.id)
+		}
+		if _, err := cb(goja.Undefined()); err != nil {
+			logger.Logger.Error("timer callback error", zap.Int64("id", t.id), zap.Error(err))
+		}
+	}
+	if sys.scheduler == nil {
+		sys.pendingTimers = append(sys.pendingTimers, t)
+	} else {
+		sys.timers[t.id] = t.addTo(sys.scheduler)
+	}
+	return sys.VM.ToValue(t.id)
+}
+
+func (sys *SysObject) newTimerCmd(name string, repeat bool) func(call goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 1 {
+			logger.Logger.Debug(name + " needs a callback")
+			return sys.VM.ToValue(false)
+		}
+		cb, ok := goja.AssertFunction(call.Argument(0))
+		if !ok {
+			logger.Logger.Debug(name + " needs a callback")
+			return sys.VM.ToValue(false)
+		}
+		delay := time.Duration(call.Argument(1).ToInteger()) * time.Millisecond
+		if delay < 0 {
+			delay = 0
+		}
+		return sys.addTimer(&jsTimer{delay: delay, repeat: repeat}, cb)
+	}
+}
+
+// SetTimeoutCmd calls a function once after a delay in milliseconds of the
+// clock of the strategy, e.g. setTimeout(fn, 1000). It returns the id of
+// the timer.
+func (sys *SysObject) SetTimeoutCmd(call goja.FunctionCall) goja.Value {
+	return sys.newTimerCmd("setTimeout", false)(call)
+}
+
+// SetIntervalCmd calls a function every interval in milliseconds of the
+// clock of the strategy, e.g. setInterval(fn, 1000). It returns the id of
+// the timer.
+func (sys *SysObject) SetIntervalCmd(call goja.FunctionCall) goja.Value {
+	return sys.newTimerCmd("setInterval", true)(call)
+}
+
+// ClearTimerCmd removes a timer of setTimeout, setInterval or
+// system.schedule
+func (sys *SysObject) ClearTimerCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 1 {
+		logger.Logger.Debug("clearTimer needs 1 argument")
+		return sys.VM.ToValue(false)
+	}
+	id := call.Argument(0).ToInteger()
+	for i, t := range sys.pendingTimers {
+		if t.id == id {
+			sys.pendingTimers = append(sys.pendingTimers[:i], sys.pendingTimers[i+1:]...)
+			return sys.VM.ToValue(true)
+		}
+	}
+	schedulerID, ok := sys.timers[id]
+	if !ok {
+		return sys.VM.ToValue(false)
+	}
+	delete(sys.timers, id)
+	return sys.VM.ToValue(sys.scheduler.RemoveTimer(schedulerID))
+}
+
+// ScheduleCmd calls a function at the times of a cron spec in UTC, e.g.
+// system.schedule("0 16 * * 1-5", fn) at 16:00 on weekdays. It returns the
+// id of the timer.
+func (sys *SysObject) ScheduleCmd(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) != 2 {
+		logger.Logger.Debug("scheduleCmd needs 2 arguments")
+		return sys.VM.ToValue(false)
+	}
+	spec, err := core.ParseCronSpec(call.Argument(0).String())
+	if err != nil {
+		logger.Logger.Error("invalid schedule", zap.Error(err))
+		return sys.VM.ToValue(false)
+	}
+	cb, ok := goja.AssertFunction(call.Argument(1))
+	if !ok {
+		logger.Logger.Debug("scheduleCmd needs a callback")
+		return sys.VM.ToValue(false)
+	}
+	return sys.addTimer(&jsTimer{spec: spec, repeat: true}, cb)
+}
@@ -0,0 +1,86 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+	"goat/pkg/core"
+
+	"github.com/dop251/goja"
+)
+
+func TestSysObjectTimers(t *testing.T) {
+	cfg := &config.Config{}
+	vm := goja.New()
+	mu := &sync.Mutex{}
+	sys, err := NewSysObject(cfg, vm, mu, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.RunString(`
+	var events = [];
+	function log(name) {
+		events.push(name + " " + system.now());
+	}
+	var n = 0;
+	var interval = setInterval(function() {
+		log("interval");
+		if (++n == 2) {
+			clearInterval(interval);
+		}
+	}, 24 * 3600 * 1000);
+	setTimeout(function() { log("timeout"); }, 3600 * 1000);
+	clearTimeout(setTimeout(function() { log("cleared"); }, 1000));
+	system.schedule("30 9 * * *", function() { log("cron"); });
+	var invalid = system.schedule("30 9 * *", function() {});
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if vm.Get("invalid").ToBoolean() {
+		t.Error("an invalid schedule should be rejected")
+	}
+
+	gen := core.NewBarFeedGenerator([]core.Frequency{core.DAY}, 100)
+	feed := core.NewGenericDataFeed(context.TODO(), cfg, gen, nil, 100, "")
+	start := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		tm := start.AddDate(0, 0, i)
+		gen.AppendNewValueToBuffer(tm, map[string]interface{}{
+			"X": core.NewBasicBar(tm, 1, 1, 1, 1, 1, 1, core.DAY),
+		}, core.DAY)
+	}
+	gen.Finish()
+	d := core.NewDispatcher(context.TODO())
+	d.AddSubject(feed)
+	mu.Lock()
+	sys.Clock = d.GetClock()
+	sys.SetScheduler(d.GetScheduler())
+	mu.Unlock()
+	d.Run()
+
+	var events []string
+	if err := vm.ExportTo(vm.Get("events"), &events); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{}
+	for _, e := range []struct {
+		name string
+		tm   time.Time
+	}{
+		{"timeout", start.Add(time.Hour)},
+		{"cron", start.Add(9*time.Hour + 30*time.Minute)},
+		{"interval", start.AddDate(0, 0, 1)},
+		{"cron", start.AddDate(0, 0, 1).Add(9*time.Hour + 30*time.Minute)},
+		{"interval", start.AddDate(0, 0, 2)},
+		{"cron", start.AddDate(0, 0, 2).Add(9*time.Hour + 30*time.Minute)},
+	} {
+		expected = append(expected, fmt.Sprintf("%s %d", e.name, e.tm.Unix()))
+	}
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Error("unexpected events", events)
+	}
+}
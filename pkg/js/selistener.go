@@ -6,6 +6,7 @@ import (
 	"goat/pkg/metrics"
 
 	"goat/pkg/core"
+	"goat/pkg/js/apis"
 	"goat/pkg/logger"
 
 	"go.uber.org/zap"
@@ -50,12 +51,22 @@ func (j *JSStrategyEventListener) OnIdle() error {
 
 // OnOrderEvent implements core.StrategyEventListener
 func (j *JSStrategyEventListener) OnOrderEvent(orderEvent core.OrderEvent) error {
-	return j.rt.NotifyEvent("onorderevent", orderEvent)
+	return j.rt.NotifyEvent("onorderevent", apis.OrderEventToObject(orderEvent))
 }
 
 // OnOrderUpdated implements core.StrategyEventListener
 func (j *JSStrategyEventListener) OnOrderUpdated(order core.Order) error {
-	return j.rt.NotifyEvent("onorderupdated", order)
+	return j.rt.NotifyEvent("onorderupdated", apis.OrderToObject(order))
+}
+
+// SetClock implements core.ClockUser
+func (j *JSStrategyEventListener) SetClock(clock core.Clock) {
+	j.rt.SetClock(clock)
+}
+
+// SetScheduler implements core.SchedulerUser
+func (j *JSStrategyEventListener) SetScheduler(scheduler core.Scheduler) {
+	j.rt.SetScheduler(scheduler)
 }
 
 // OnStart implements core.StrategyEventListener
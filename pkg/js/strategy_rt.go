@@ -22,6 +22,10 @@ var supportedEvents []string = []string{
 	"onstart",
 	"onfinish",
 	"onidle",
+	"onorderupdated",
+	"onorderevent",
+	"onsessionopen",
+	"onsessionclose",
 }
 
 type RuntimeFunc func(call goja.FunctionCall) goja.Value
@@ -31,6 +35,14 @@ type StrategyRuntime interface {
 	Execute(script *goja.Program) (goja.Value, error)
 	RegisterHostCall(name string, fn RuntimeFunc) error
 	NotifyEvent(eventName string, args ...interface{}) error
+	// ValidateParams returns the errors of the strategy parameters, it
+	// should be called after the script is executed
+	ValidateParams() error
+	// SetClock sets the clock of system.now()
+	SetClock(clock core.Clock)
+	// SetScheduler sets the scheduler of the timers of the script
+	SetScheduler(scheduler core.Scheduler)
+	Close() error
 }
 
 type strategyRuntime struct {
@@ -43,9 +55,12 @@ type strategyRuntime struct {
 	sysApi         *apis.SysObject
 	alertApi       *apis.AlertObject
 	feedApi        *apis.FeedObject
+	brokerApi      *apis.BrokerObject
+	portfolioApi   *apis.PortfolioObject
 	eventListeners map[string]goja.Value
 	apiHandlers    map[string]RuntimeFunc
 	talib          *talib.TALib
+	calendar       core.TradingCalendar
 }
 
 // NotifyEvent implements StrategyRuntime
@@ -63,6 +78,49 @@ func (r *strategyRuntime) NotifyEvent(eventName string, args ...interface{}) err
 	return nil
 }
 
+// SetClock implements StrategyRuntime
+func (r *strategyRuntime) SetClock(clock core.Clock) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sysApi.Clock = clock
+}
+
+// SetScheduler implements StrategyRuntime
+func (r *strategyRuntime) SetScheduler(scheduler core.Scheduler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sysApi.SetScheduler(scheduler)
+
+	// the session events are only scheduled for the scripts listening to
+	// them
+	var onOpen, onClose func(core.Session)
+	if _, ok := r.eventListeners["onsessionopen"]; ok {
+		onOpen = func(session core.Session) {
+			r.NotifyEvent("onsessionopen", apis.SessionToObject(r.calendar, session))
+		}
+	}
+	if _, ok := r.eventListeners["onsessionclose"]; ok {
+		onClose = func(session core.Session) {
+			r.NotifyEvent("onsessionclose", apis.SessionToObject(r.calendar, session))
+		}
+	}
+	core.AddSessionJobs(scheduler, r.sysApi.Clock, r.calendar, onOpen, onClose)
+}
+
+// ValidateParams implements StrategyRuntime
+func (r *strategyRuntime) ValidateParams() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sysApi.ValidateParams()
+}
+
+// Close implements StrategyRuntime
+func (r *strategyRuntime) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.kvApi.Close()
+}
+
 // RegisterHostCall implements StrategyRuntime
 func (r *strategyRuntime) RegisterHostCall(name string, fn RuntimeFunc) error {
 	return r.vm.Set(name, func(call goja.FunctionCall) goja.Value {
@@ -94,7 +152,9 @@ func (r *strategyRuntime) Compile(source string) (*goja.Program, error) {
 	return compiled, nil
 }
 
-func NewStrategyRuntime(ctx context.Context, cfg *config.Config, feed core.DataFeed, cb apis.StartCallback) StrategyRuntime {
+func NewStrategyRuntime(ctx context.Context, cfg *config.Config, feed core.DataFeed, broker core.Broker,
+	portfolio core.Portfolio, cb apis.StartCallback,
+) StrategyRuntime {
 	var err error
 
 	res := &strategyRuntime{
@@ -108,6 +168,11 @@ func NewStrategyRuntime(ctx context.Context, cfg *config.Config, feed core.DataF
 
 	logger.Logger.Debug("using kvdb file.", zap.String("kvdb", cfg.KVDB))
 
+	res.calendar, err = core.NewTradingCalendarFromConfig(cfg)
+	if err != nil {
+		logger.Logger.Error("failed to create trading calendar", zap.Error(err))
+		panic(err)
+	}
 	res.kvApi, err = apis.NewKVObject(ctx, cfg, res.vm, cfg.KVDB)
 	if err != nil {
 		logger.Logger.Error("failed to create kv object", zap.Error(err))
@@ -133,6 +198,16 @@ func NewStrategyRuntime(ctx context.Context, cfg *config.Config, feed core.DataF
 		logger.Logger.Error("failed to create feed object", zap.Error(err))
 		panic(err)
 	}
+	res.brokerApi, err = apis.NewBrokerObject(cfg, res.vm, broker)
+	if err != nil {
+		logger.Logger.Error("failed to create broker object", zap.Error(err))
+		panic(err)
+	}
+	res.portfolioApi, err = apis.NewPortfolioObject(cfg, res.vm, portfolio, broker)
+	if err != nil {
+		logger.Logger.Error("failed to create portfolio object", zap.Error(err))
+		panic(err)
+	}
 
 	res.apiHandlers["addEventListener"] = res.addEventListener
 	res.setupStrategyAPIs()
@@ -4,8 +4,10 @@ import (
 	"context"
 	"os"
 	"testing"
+	"time"
 
 	"goat/pkg/config"
+	"goat/pkg/core"
 	"goat/pkg/logger"
 
 	"github.com/dop251/goja"
@@ -18,7 +20,7 @@ func TestRuntimeSimple(t *testing.T) {
 	cfg := &config.Config{
 		KVDB: "default.boltdb",
 	}
-	rt := NewStrategyRuntime(context.TODO(), cfg, nil, nil)
+	rt := NewStrategyRuntime(context.TODO(), cfg, nil, nil, nil, nil)
 	err := rt.RegisterHostCall("test_print", func(call goja.FunctionCall) goja.Value {
 		logger.Logger.Info("test_print is called")
 		return goja.Null()
@@ -43,7 +45,7 @@ func TestRuntimeSimple2(t *testing.T) {
 	cfg := &config.Config{
 		KVDB: "default.boltdb",
 	}
-	rt := NewStrategyRuntime(context.TODO(), cfg, nil, nil)
+	rt := NewStrategyRuntime(context.TODO(), cfg, nil, nil, nil, nil)
 	script, err := rt.Compile(`
 	addEventListener("onbars", function(e) {
 		console.log("onbars", e);
@@ -67,7 +69,7 @@ func TestRuntimeKV(t *testing.T) {
 	cfg := &config.Config{
 		KVDB: "default.boltdb",
 	}
-	rt := NewStrategyRuntime(context.TODO(), cfg, nil, nil)
+	rt := NewStrategyRuntime(context.TODO(), cfg, nil, nil, nil, nil)
 	script, err := rt.Compile(`
 	addEventListener("onbars", function(e) {
 		kvstorage.save("foo", "bar");
@@ -92,7 +94,7 @@ func TestRuntimeTALibSimple(t *testing.T) {
 	cfg := &config.Config{
 		KVDB: "default.boltdb",
 	}
-	rt := NewStrategyRuntime(context.TODO(), cfg, nil, nil)
+	rt := NewStrategyRuntime(context.TODO(), cfg, nil, nil, nil, nil)
 	script, err := rt.Compile(`
 	addEventListener("onbars", function(e) {
 		var res = talib.Ema([.1,.2,.3,.4,.5,.6,.7,.8], 4);
@@ -117,7 +119,7 @@ func TestRuntimeRequire(t *testing.T) {
 	cfg := &config.Config{
 		KVDB: "default.boltdb",
 	}
-	rt := NewStrategyRuntime(context.TODO(), cfg, nil, nil)
+	rt := NewStrategyRuntime(context.TODO(), cfg, nil, nil, nil, nil)
 	script, err := rt.Compile(`
 	var m = require("../../samples/misc/require-test.js");
 	m.test();
@@ -133,3 +135,107 @@ func TestRuntimeRequire(t *testing.T) {
 
 	rt.NotifyEvent("onbars", "foo")
 }
+
+func TestRuntimeOrderEvents(t *testing.T) {
+	os.RemoveAll("default.boltdb")
+	defer os.RemoveAll("default.boltdb")
+	cfg := &config.Config{
+		KVDB: "default.boltdb",
+	}
+	rt := NewStrategyRuntime(context.TODO(), cfg, nil, nil, nil, nil)
+	script, err := rt.Compile(`
+	var updated = addEventListener("onOrderUpdated", function(order) {
+		console.log("onOrderUpdated", order);
+	});
+	var event = addEventListener("onOrderEvent", function(e) {
+		console.log("onOrderEvent", e);
+	});
+	updated && event;
+`)
+	if err != nil {
+		t.Error(err)
+	}
+	val, err := rt.Execute(script)
+	if err != nil {
+		t.Error(err)
+	}
+	if !val.ToBoolean() {
+		t.Error("order event listeners should be supported")
+	}
+}
+
+func TestRuntimeClock(t *testing.T) {
+	os.RemoveAll("default.boltdb")
+	defer os.RemoveAll("default.boltdb")
+	cfg := &config.Config{
+		KVDB: "default.boltdb",
+	}
+	rt := NewStrategyRuntime(context.TODO(), cfg, nil, nil, nil, nil)
+	clock := core.NewSimulatedClock()
+	tm := time.Date(2022, time.January, 3, 10, 0, 0, 0, time.UTC)
+	clock.Advance(tm)
+	rt.SetClock(clock)
+	script, err := rt.Compile(`system.now();`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, err := rt.Execute(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.ToInteger() != tm.Unix() {
+		t.Error("system.now() should be the time of the clock", val)
+	}
+}
+
+func TestRuntimeSessionEvents(t *testing.T) {
+	os.RemoveAll("default.boltdb")
+	defer os.RemoveAll("default.boltdb")
+	cfg := &config.Config{
+		KVDB:     "default.boltdb",
+		Calendar: config.CalendarConfig{Name: "nyse"},
+	}
+	rt := NewStrategyRuntime(context.TODO(), cfg, nil, nil, nil, nil)
+	script, err := rt.Compile(`
+	var events = [];
+	addEventListener("onSessionOpen", function(args) {
+		var s = args[0];
+		events.push("open " + s.date + " " + s.open);
+	});
+	addEventListener("onSessionClose", function(args) {
+		var s = args[0];
+		events.push("close " + s.date + " " + s.close);
+	});
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.Execute(script); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := core.NewBarFeedGenerator([]core.Frequency{core.HOUR}, 100)
+	feed := core.NewGenericDataFeed(context.TODO(), cfg, gen, nil, 100, "")
+	// the session of friday closes at 13:00 New York time
+	for tm := time.Date(2023, time.November, 24, 12, 0, 0, 0, time.UTC); tm.Before(time.Date(2023, time.November, 25, 0, 0, 0, 0, time.UTC)); tm = tm.Add(time.Hour) {
+		gen.AppendNewValueToBuffer(tm, map[string]interface{}{
+			"X": core.NewBasicBar(tm, 1, 1, 1, 1, 1, 1, core.HOUR),
+		}, core.HOUR)
+	}
+	gen.Finish()
+	d := core.NewDispatcher(context.TODO())
+	d.AddSubject(feed)
+	rt.SetClock(d.GetClock())
+	rt.SetScheduler(d.GetScheduler())
+	d.Run()
+
+	script, _ = rt.Compile("events.join(',')")
+	val, err := rt.Execute(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "open 2023-11-24 2023-11-24T09:30:00-05:00,close 2023-11-24 2023-11-24T13:00:00-05:00"
+	if val.String() != expected {
+		t.Error("unexpected session events", val.String())
+	}
+}
@@ -1,5 +1,7 @@
 package notify
 
+import "goat/pkg/config"
+
 type Notifier interface {
 	SetSubject(string) error
 	SetRecipients([]string) error
@@ -8,3 +10,18 @@ type Notifier interface {
 	Level() int
 	FeatureFlags() uint64
 }
+
+// NewNotifiers creates the notifiers enabled in cfg
+func NewNotifiers(cfg *config.Config) []Notifier {
+	res := []Notifier{}
+	if cfg.Notification.Pushover.Enabled {
+		res = append(res, NewPushoverNotifier(cfg))
+	}
+	if cfg.Notification.Email.Enabled {
+		res = append(res, NewEmailNotifier(cfg))
+	}
+	if cfg.Notification.Twilio.Enabled {
+		res = append(res, NewTwilioNotifier(cfg))
+	}
+	return res
+}
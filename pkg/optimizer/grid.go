@@ -0,0 +1,158 @@
+package optimizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParamGrid maps each strategy parameter to the values it should be tested
+// with
+type ParamGrid map[string][]interface{}
+
+// paramRange is the alternative form of a grid entry:
+// {"start": 10, "stop": 50, "step": 10} expands to 10, 20, 30, 40, 50.
+type paramRange struct {
+	Start float64 `json:"start" yaml:"start"`
+	Stop  float64 `json:"stop" yaml:"stop"`
+	Step  float64 `json:"step" yaml:"step"`
+}
+
+// maxRangeValues guards against ranges with a tiny step
+const maxRangeValues = 100000
+
+// LoadParamGrid reads a parameter grid from a JSON or YAML file. Each key is
+// a parameter name and its value is either a list of values or a range
+// object with start, stop and step.
+func LoadParamGrid(path string) (ParamGrid, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported parameter grid file type %s", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewParamGrid(raw)
+}
+
+// NewParamGrid creates a parameter grid from decoded JSON or YAML values
+func NewParamGrid(raw map[string]interface{}) (ParamGrid, error) {
+	grid := ParamGrid{}
+	for name, v := range raw {
+		switch values := v.(type) {
+		case []interface{}:
+			if len(values) == 0 {
+				return nil, fmt.Errorf("parameter %s has no values", name)
+			}
+			grid[name] = values
+		case map[string]interface{}:
+			r, err := parseRange(values)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %s: %v", name, err)
+			}
+			grid[name] = r.values()
+		default:
+			// a single value, the parameter is fixed
+			grid[name] = []interface{}{v}
+		}
+	}
+	return grid, nil
+}
+
+func parseRange(values map[string]interface{}) (*paramRange, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	r := &paramRange{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	if r.Step <= 0 {
+		return nil, fmt.Errorf("range step should be greater than 0")
+	}
+	if r.Stop < r.Start {
+		return nil, fmt.Errorf("range stop should not be less than start")
+	}
+	if (r.Stop-r.Start)/r.Step > maxRangeValues {
+		return nil, fmt.Errorf("range has too many values")
+	}
+	return r, nil
+}
+
+func (r *paramRange) values() []interface{} {
+	res := []interface{}{}
+	// the epsilon keeps the stop value despite floating point errors
+	for i := 0; r.Start+float64(i)*r.Step <= r.Stop+r.Step*1e-9; i++ {
+		v := r.Start + float64(i)*r.Step
+		res = append(res, math.Round(v*1e9)/1e9)
+	}
+	return res
+}
+
+// Names returns the sorted parameter names
+func (g ParamGrid) Names() []string {
+	names := make([]string, 0, len(g))
+	for k := range g {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Size returns the number of parameter combinations
+func (g ParamGrid) Size() int {
+	if len(g) == 0 {
+		return 0
+	}
+	size := 1
+	for _, values := range g {
+		size *= len(values)
+	}
+	return size
+}
+
+// Combinations returns every combination of the parameter values. The last
+// parameter in name order changes first.
+func (g ParamGrid) Combinations() []map[string]interface{} {
+	names := g.Names()
+	res := make([]map[string]interface{}, 0, g.Size())
+	if len(names) == 0 {
+		return res
+	}
+	indexes := make([]int, len(names))
+	for {
+		params := make(map[string]interface{}, len(names))
+		for i, name := range names {
+			params[name] = g[name][indexes[i]]
+		}
+		res = append(res, params)
+
+		i := len(names) - 1
+		for ; i >= 0; i-- {
+			indexes[i]++
+			if indexes[i] < len(g[names[i]]) {
+				break
+			}
+			indexes[i] = 0
+		}
+		if i < 0 {
+			return res
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package optimizer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewParamGrid(t *testing.T) {
+	grid, err := NewParamGrid(map[string]interface{}{
+		"period":   map[string]interface{}{"start": 10.0, "stop": 30.0, "step": 10.0},
+		"ratio":    map[string]interface{}{"start": 0.1, "stop": 0.3, "step": 0.1},
+		"symbol":   []interface{}{"GLD", "SPY"},
+		"quantity": 100.0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(grid["period"], []interface{}{10.0, 20.0, 30.0}) {
+		t.Errorf("unexpected period values %v", grid["period"])
+	}
+	if !reflect.DeepEqual(grid["ratio"], []interface{}{0.1, 0.2, 0.3}) {
+		t.Errorf("unexpected ratio values %v", grid["ratio"])
+	}
+	if !reflect.DeepEqual(grid.Names(), []string{"period", "quantity", "ratio", "symbol"}) {
+		t.Errorf("unexpected names %v", grid.Names())
+	}
+	if grid.Size() != 18 {
+		t.Errorf("size should be 18, got %d", grid.Size())
+	}
+
+	combinations := grid.Combinations()
+	if len(combinations) != 18 {
+		t.Fatalf("expected 18 combinations, got %d", len(combinations))
+	}
+	first := map[string]interface{}{"period": 10.0, "quantity": 100.0, "ratio": 0.1, "symbol": "GLD"}
+	if !reflect.DeepEqual(combinations[0], first) {
+		t.Errorf("unexpected first combination %v", combinations[0])
+	}
+	last := map[string]interface{}{"period": 30.0, "quantity": 100.0, "ratio": 0.3, "symbol": "SPY"}
+	if !reflect.DeepEqual(combinations[17], last) {
+		t.Errorf("unexpected last combination %v", combinations[17])
+	}
+
+	for _, raw := range []map[string]interface{}{
+		{"period": []interface{}{}},
+		{"period": map[string]interface{}{"start": 10.0, "stop": 30.0, "step": 0.0}},
+		{"period": map[string]interface{}{"start": 30.0, "stop": 10.0, "step": 1.0}},
+		{"period": map[string]interface{}{"start": 0.0, "stop": 1.0, "step": 1e-9}},
+	} {
+		if _, err := NewParamGrid(raw); err == nil {
+			t.Errorf("expected error for %v", raw)
+		}
+	}
+}
+
+func TestLoadParamGrid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goat-grid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"grid.json": `{"period": {"start": 10, "stop": 20, "step": 5}, "quantity": [100, 200]}`,
+		"grid.yaml": "period:\n  start: 10\n  stop: 20\n  step: 5\nquantity: [100, 200]\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		grid, err := LoadParamGrid(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if grid.Size() != 6 {
+			t.Errorf("%s: size should be 6, got %d", name, grid.Size())
+		}
+		if !reflect.DeepEqual(grid["period"], []interface{}{10.0, 15.0, 20.0}) {
+			t.Errorf("%s: unexpected period values %v", name, grid["period"])
+		}
+	}
+
+	if _, err := LoadParamGrid(filepath.Join(dir, "grid.txt")); err == nil {
+		t.Error("expected error for unsupported file type")
+	}
+}
@@ -0,0 +1,169 @@
+package optimizer
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Result is the outcome of one backtest of a parameter combination
+type Result struct {
+	Params  map[string]interface{}
+	Metrics map[string]float64 // keyed by "analyzer.metric"
+	Err     error
+}
+
+// RunFunc runs one backtest with params and returns its metrics. worker is
+// the index of the worker running it, starting from 0.
+type RunFunc func(ctx context.Context, worker int, params map[string]interface{}) (map[string]float64, error)
+
+// Run runs fn for each parameter combination with workers goroutines. The
+// results are in the same order as combinations.
+func Run(ctx context.Context, combinations []map[string]interface{}, workers int,
+	fn RunFunc,
+) []*Result {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]*Result, len(combinations))
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := range jobs {
+				res := &Result{Params: combinations[i]}
+				res.Metrics, res.Err = fn(ctx, worker, combinations[i])
+				results[i] = res
+			}
+		}(w)
+	}
+
+feed:
+	for i := range combinations {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i := range results {
+		if results[i] == nil {
+			results[i] = &Result{Params: combinations[i], Err: ctx.Err()}
+		}
+	}
+	return results
+}
+
+// Rank sorts results by metric, best first. Failed runs and runs without
+// the metric are put last.
+func Rank(results []*Result, metric string, minimize bool) {
+	value := func(r *Result) (float64, bool) {
+		if r.Err != nil {
+			return 0, false
+		}
+		v, ok := r.Metrics[metric]
+		if !ok || math.IsNaN(v) {
+			return 0, false
+		}
+		return v, true
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		vi, oki := value(results[i])
+		vj, okj := value(results[j])
+		if !oki || !okj {
+			return oki && !okj
+		}
+		if minimize {
+			return vi < vj
+		}
+		return vi > vj
+	})
+}
+
+// MetricNames returns the sorted metric names found in results
+func MetricNames(results []*Result) []string {
+	set := map[string]bool{}
+	for _, r := range results {
+		for k := range r.Metrics {
+			set[k] = true
+		}
+	}
+	names := make([]string, 0, len(set))
+	for k := range set {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WriteCSV writes results as a CSV leaderboard with one row per result
+func WriteCSV(w io.Writer, results []*Result, paramNames []string) error {
+	metricNames := MetricNames(results)
+	cw := csv.NewWriter(w)
+	header := append([]string{"rank"}, paramNames...)
+	header = append(header, metricNames...)
+	header = append(header, "error")
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for i, r := range results {
+		row := []string{strconv.Itoa(i + 1)}
+		for _, name := range paramNames {
+			row = append(row, fmt.Sprint(r.Params[name]))
+		}
+		for _, name := range metricNames {
+			if v, ok := r.Metrics[name]; ok && !math.IsNaN(v) && !math.IsInf(v, 0) {
+				row = append(row, strconv.FormatFloat(v, 'g', -1, 64))
+			} else {
+				row = append(row, "")
+			}
+		}
+		if r.Err != nil {
+			row = append(row, r.Err.Error())
+		} else {
+			row = append(row, "")
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type jsonResult struct {
+	Rank    int                    `json:"rank"`
+	Params  map[string]interface{} `json:"params"`
+	Metrics map[string]interface{} `json:"metrics"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// WriteJSON writes results as a JSON leaderboard
+func WriteJSON(w io.Writer, results []*Result) error {
+	res := make([]jsonResult, 0, len(results))
+	for i, r := range results {
+		item := jsonResult{
+			Rank:    i + 1,
+			Params:  r.Params,
+			Metrics: jsonMetrics(r.Metrics),
+		}
+		if r.Err != nil {
+			item.Error = r.Err.Error()
+		}
+		res = append(res, item)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
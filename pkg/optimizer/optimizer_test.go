@@ -0,0 +1,134 @@
+package optimizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestRunAndRank(t *testing.T) {
+	grid := ParamGrid{"period": {10.0, 20.0, 30.0, 40.0, 50.0}}
+	combinations := grid.Combinations()
+
+	mu := sync.Mutex{}
+	workers := map[int]bool{}
+	results := Run(context.Background(), combinations, 3,
+		func(ctx context.Context, worker int, params map[string]interface{}) (map[string]float64, error) {
+			mu.Lock()
+			workers[worker] = true
+			mu.Unlock()
+			period := params["period"].(float64)
+			switch period {
+			case 30:
+				return nil, fmt.Errorf("failed")
+			case 40:
+				return map[string]float64{"returns.cumulativeReturn": math.NaN()}, nil
+			}
+			return map[string]float64{"returns.cumulativeReturn": -math.Abs(period - 20)}, nil
+		})
+	if len(results) != 5 {
+		t.Fatalf("expected 5 results, got %d", len(results))
+	}
+	for i, r := range results {
+		if r.Params["period"] != combinations[i]["period"] {
+			t.Errorf("result %d is out of order", i)
+		}
+	}
+	for w := range workers {
+		if w < 0 || w >= 3 {
+			t.Errorf("unexpected worker index %d", w)
+		}
+	}
+
+	Rank(results, "returns.cumulativeReturn", false)
+	order := []float64{}
+	for _, r := range results {
+		order = append(order, r.Params["period"].(float64))
+	}
+	expected := []float64{20, 10, 50, 30, 40}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("unexpected rank order %v", order)
+		}
+	}
+
+	Rank(results, "returns.cumulativeReturn", true)
+	if results[0].Params["period"] != 50.0 || results[2].Params["period"] != 20.0 {
+		t.Errorf("unexpected minimized rank order")
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	combinations := ParamGrid{"period": {10.0, 20.0}}.Combinations()
+	results := Run(ctx, combinations, 1,
+		func(ctx context.Context, worker int, params map[string]interface{}) (map[string]float64, error) {
+			return map[string]float64{}, nil
+		})
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	for _, r := range results {
+		if r == nil {
+			t.Fatal("result should not be nil")
+		}
+	}
+}
+
+func TestWriteLeaderboard(t *testing.T) {
+	results := []*Result{
+		{
+			Params:  map[string]interface{}{"period": 20.0},
+			Metrics: map[string]float64{"sharpe.sharpeRatio": 1.5, "trades.profitFactor": math.Inf(1)},
+		},
+		{
+			Params: map[string]interface{}{"period": 10.0},
+			Err:    fmt.Errorf("failed"),
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteCSV(buf, results, []string{"period"}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+	header := []string{"rank", "period", "sharpe.sharpeRatio", "trades.profitFactor", "error"}
+	for i := range header {
+		if rows[0][i] != header[i] {
+			t.Fatalf("unexpected header %v", rows[0])
+		}
+	}
+	if rows[1][2] != "1.5" || rows[1][3] != "" {
+		t.Errorf("unexpected first row %v", rows[1])
+	}
+	if rows[2][1] != "10" || rows[2][4] != "failed" {
+		t.Errorf("unexpected second row %v", rows[2])
+	}
+
+	buf.Reset()
+	if err := WriteJSON(buf, results); err != nil {
+		t.Fatal(err)
+	}
+	decoded := []map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 || decoded[1]["error"] != "failed" {
+		t.Errorf("unexpected json leaderboard %v", decoded)
+	}
+	if decoded[0]["metrics"].(map[string]interface{})["trades.profitFactor"] != nil {
+		t.Errorf("infinite metric should be null")
+	}
+}
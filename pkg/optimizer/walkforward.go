@@ -0,0 +1,144 @@
+package optimizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Window is one walk-forward step. The ranges are half-open indexes into
+// the values of the data source.
+type Window struct {
+	InSampleStart  int
+	InSampleEnd    int
+	OutSampleStart int
+	OutSampleEnd   int
+}
+
+// SplitWindows splits n values into rolling walk-forward windows. Each
+// in-sample window has inSample values and is followed by an out-of-sample
+// window of outSample values, the next window starts outSample values
+// later. With anchored, every in-sample window starts from the first value.
+// The last out-of-sample window may be shorter.
+func SplitWindows(n, inSample, outSample int, anchored bool) ([]Window, error) {
+	if inSample <= 0 || outSample <= 0 {
+		return nil, fmt.Errorf("in-sample and out-of-sample sizes should be greater than 0")
+	}
+	if n <= inSample {
+		return nil, fmt.Errorf("%d values are not enough for an in-sample window of %d", n, inSample)
+	}
+	res := []Window{}
+	for start := 0; start+inSample < n; start += outSample {
+		w := Window{
+			InSampleStart:  start,
+			InSampleEnd:    start + inSample,
+			OutSampleStart: start + inSample,
+			OutSampleEnd:   start + inSample + outSample,
+		}
+		if anchored {
+			w.InSampleStart = 0
+		}
+		if w.OutSampleEnd > n {
+			w.OutSampleEnd = n
+		}
+		res = append(res, w)
+	}
+	return res, nil
+}
+
+// EquityPoint is the equity of a portfolio at a time
+type EquityPoint struct {
+	DateTime time.Time `json:"dateTime"`
+	Equity   float64   `json:"equity"`
+}
+
+// StitchEquity joins the out-of-sample equity curves of the walk-forward
+// windows. Every window starts with cash, so each curve is scaled by the
+// equity the previous windows ended with, as if the whole equity was
+// carried over to the next window.
+func StitchEquity(curves [][]EquityPoint, cash float64) []EquityPoint {
+	res := []EquityPoint{}
+	if cash <= 0 {
+		return res
+	}
+	scale := 1.0
+	for _, curve := range curves {
+		for _, p := range curve {
+			res = append(res, EquityPoint{DateTime: p.DateTime, Equity: p.Equity * scale})
+		}
+		if len(curve) > 0 {
+			scale = res[len(res)-1].Equity / cash
+		}
+	}
+	return res
+}
+
+// WalkForwardStep is the result of one walk-forward window
+type WalkForwardStep struct {
+	Window         Window
+	InSampleFrom   time.Time
+	InSampleTo     time.Time
+	OutSampleFrom  time.Time
+	OutSampleTo    time.Time
+	Params         map[string]interface{}
+	InSample       map[string]float64
+	OutSample      map[string]float64
+	OutSampleCurve []EquityPoint
+	Err            error
+}
+
+type jsonWalkForwardStep struct {
+	InSampleFrom  time.Time              `json:"inSampleFrom"`
+	InSampleTo    time.Time              `json:"inSampleTo"`
+	OutSampleFrom time.Time              `json:"outSampleFrom"`
+	OutSampleTo   time.Time              `json:"outSampleTo"`
+	Params        map[string]interface{} `json:"params"`
+	InSample      map[string]interface{} `json:"inSample"`
+	OutSample     map[string]interface{} `json:"outSample"`
+	Error         string                 `json:"error,omitempty"`
+}
+
+// WriteWalkForwardJSON writes the walk-forward steps and the stitched
+// out-of-sample equity curve as JSON
+func WriteWalkForwardJSON(w io.Writer, steps []*WalkForwardStep, equity []EquityPoint) error {
+	res := struct {
+		Steps  []jsonWalkForwardStep `json:"steps"`
+		Equity []EquityPoint         `json:"equity"`
+	}{
+		Steps:  make([]jsonWalkForwardStep, 0, len(steps)),
+		Equity: equity,
+	}
+	for _, s := range steps {
+		item := jsonWalkForwardStep{
+			InSampleFrom:  s.InSampleFrom,
+			InSampleTo:    s.InSampleTo,
+			OutSampleFrom: s.OutSampleFrom,
+			OutSampleTo:   s.OutSampleTo,
+			Params:        s.Params,
+			InSample:      jsonMetrics(s.InSample),
+			OutSample:     jsonMetrics(s.OutSample),
+		}
+		if s.Err != nil {
+			item.Error = s.Err.Error()
+		}
+		res.Steps = append(res.Steps, item)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
+
+// jsonMetrics replaces the values JSON cannot encode with nil
+func jsonMetrics(metrics map[string]float64) map[string]interface{} {
+	res := make(map[string]interface{}, len(metrics))
+	for k, v := range metrics {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			res[k] = nil
+		} else {
+			res[k] = v
+		}
+	}
+	return res
+}
@@ -0,0 +1,109 @@
+package optimizer
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSplitWindows(t *testing.T) {
+	windows, err := SplitWindows(10, 4, 3, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Window{
+		{0, 4, 4, 7},
+		{3, 7, 7, 10},
+	}
+	if len(windows) != len(expected) {
+		t.Fatalf("expected %d windows, got %v", len(expected), windows)
+	}
+	for i := range expected {
+		if windows[i] != expected[i] {
+			t.Errorf("window %d should be %v, got %v", i, expected[i], windows[i])
+		}
+	}
+
+	// the last out-of-sample window is shorter
+	windows, err = SplitWindows(11, 4, 3, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []Window{
+		{0, 4, 4, 7},
+		{0, 7, 7, 10},
+		{0, 10, 10, 11},
+	}
+	if len(windows) != len(expected) {
+		t.Fatalf("expected %d windows, got %v", len(expected), windows)
+	}
+	for i := range expected {
+		if windows[i] != expected[i] {
+			t.Errorf("anchored window %d should be %v, got %v", i, expected[i], windows[i])
+		}
+	}
+
+	if _, err := SplitWindows(4, 4, 2, false); err == nil {
+		t.Error("expected error when there is no out-of-sample value")
+	}
+	if _, err := SplitWindows(10, 4, 0, false); err == nil {
+		t.Error("expected error for empty out-of-sample window")
+	}
+}
+
+func TestStitchEquity(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2022, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	curves := [][]EquityPoint{
+		{{day(1), 100}, {day(2), 110}},
+		{},
+		{{day(3), 90}, {day(4), 120}},
+	}
+	equity := StitchEquity(curves, 100)
+	expected := []float64{100, 110, 99, 132}
+	if len(equity) != len(expected) {
+		t.Fatalf("expected %d points, got %v", len(expected), equity)
+	}
+	for i, v := range expected {
+		if math.Abs(equity[i].Equity-v) > 1e-9 {
+			t.Errorf("point %d should be %f, got %f", i, v, equity[i].Equity)
+		}
+	}
+	if !equity[3].DateTime.Equal(day(4)) {
+		t.Errorf("unexpected time %v", equity[3].DateTime)
+	}
+}
+
+func TestWriteWalkForwardJSON(t *testing.T) {
+	steps := []*WalkForwardStep{
+		{
+			Params:    map[string]interface{}{"period": 20.0},
+			InSample:  map[string]float64{"sharpe.sharpeRatio": 1.2},
+			OutSample: map[string]float64{"sharpe.sharpeRatio": math.NaN()},
+		},
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteWalkForwardJSON(buf, steps, []EquityPoint{{time.Now(), 100}}); err != nil {
+		t.Fatal(err)
+	}
+	decoded := struct {
+		Steps []struct {
+			InSample  map[string]interface{} `json:"inSample"`
+			OutSample map[string]interface{} `json:"outSample"`
+		} `json:"steps"`
+		Equity []EquityPoint `json:"equity"`
+	}{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Steps) != 1 || len(decoded.Equity) != 1 {
+		t.Fatalf("unexpected json %s", buf.String())
+	}
+	if decoded.Steps[0].InSample["sharpe.sharpeRatio"] != 1.2 ||
+		decoded.Steps[0].OutSample["sharpe.sharpeRatio"] != nil {
+		t.Errorf("unexpected metrics %s", buf.String())
+	}
+}
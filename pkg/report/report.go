@@ -0,0 +1,402 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"goat/pkg/core"
+)
+
+const (
+	chartWidth  = 1000.0
+	chartHeight = 320.0
+	chartPad    = 50.0
+)
+
+// Report collects the trades of a backtest and writes them together with
+// the price, equity and drawdown charts and the analyzer results to a
+// self-contained HTML file.
+type Report interface {
+	Write(w io.Writer, analyzers []core.Analyzer) error
+	WriteFile(path string, analyzers []core.Analyzer) error
+}
+
+type fill struct {
+	DateTime   time.Time
+	Instrument string
+	Action     core.OrderAction
+	Price      float64
+	Quantity   float64
+	Commission float64
+}
+
+type report struct {
+	mu        sync.Mutex
+	feed      core.DataFeed
+	portfolio core.Portfolio
+	fills     []fill
+
+	// finest bar frequency of each instrument, it is used to pick the data
+	// series of the price chart.
+	barFrequency map[string]core.Frequency
+}
+
+// NewReport creates a report of the fills of broker, the bars of feed and
+// the equity of portfolio. It must be created before the strategy runs and
+// the feed should keep all its bars, i.e. be created with maxLen 0.
+func NewReport(feed core.DataFeed, broker core.Broker, portfolio core.Portfolio) Report {
+	r := &report{
+		feed:         feed,
+		portfolio:    portfolio,
+		barFrequency: map[string]core.Frequency{},
+	}
+	broker.GetOrderUpdatedEvent().Subscribe(r.onOrderEvent)
+	feed.GetNewValueEvent().Subscribe(r.onBars)
+	return r
+}
+
+func (r *report) onOrderEvent(args ...interface{}) error {
+	if len(args) != 2 {
+		return fmt.Errorf("onOrderEvent args length should be 2")
+	}
+	orderEvent := args[1].(core.OrderEvent)
+	info, ok := orderEvent.GetEventInfo().(*core.OrderExecutionInfo)
+	if !ok {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fills = append(r.fills, fill{
+		DateTime:   info.DateTime,
+		Instrument: orderEvent.GetOrder().GetInstrument(),
+		Action:     orderEvent.GetOrder().GetAction(),
+		Price:      info.Price,
+		Quantity:   info.Quantity,
+		Commission: info.Commission,
+	})
+	return nil
+}
+
+func (r *report) onBars(args ...interface{}) error {
+	if len(args) != 2 {
+		return fmt.Errorf("onBars args length should be 2")
+	}
+	data := args[1].(map[string]interface{})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, v := range data {
+		bar := v.(core.Bar)
+		if freq, ok := r.barFrequency[k]; !ok || bar.Frequency() < freq {
+			r.barFrequency[k] = bar.Frequency()
+		}
+	}
+	return nil
+}
+
+// WriteFile implements Report
+func (r *report) WriteFile(path string, analyzers []core.Analyzer) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.Write(f, analyzers); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write implements Report
+func (r *report) Write(w io.Writer, analyzers []core.Analyzer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := &reportData{
+		Generated: time.Now().Format(time.RFC1123),
+		Symbol:    r.tradedSymbol(),
+	}
+	for _, f := range r.fills {
+		data.Fills = append(data.Fills, fillRow{
+			DateTime:   f.DateTime.Format("2006-01-02 15:04:05"),
+			Instrument: f.Instrument,
+			Action:     f.Action.String(),
+			Price:      fmt.Sprintf("%.4f", f.Price),
+			Quantity:   fmt.Sprintf("%.4f", f.Quantity),
+			Commission: fmt.Sprintf("%.4f", f.Commission),
+			Buy:        f.Action.IsBuy(),
+		})
+	}
+	for _, a := range analyzers {
+		table := analyzerTable{Name: a.GetName()}
+		for _, m := range a.GetMetrics() {
+			table.Metrics = append(table.Metrics, metricRow{Name: m.Name, Value: m.String()})
+		}
+		data.Analyzers = append(data.Analyzers, table)
+	}
+
+	if data.Symbol != "" {
+		// the price chart is skipped if the feed did not keep the bars
+		if ds, err := r.feed.GetDataSeries(data.Symbol, r.barFrequency[data.Symbol]); err == nil {
+			data.Price = r.priceChart(ds, data.Symbol)
+			if ds.Len() > 0 {
+				data.Start = ds.DateTimes()[0].Format("2006-01-02")
+				data.End = ds.DateTimes()[ds.Len()-1].Format("2006-01-02")
+			}
+		}
+	}
+	equity, drawDown := equityCharts(r.portfolio.GetEquityDataSeries())
+	data.Equity = equity
+	data.DrawDown = drawDown
+
+	return reportTemplate.Execute(w, data)
+}
+
+// tradedSymbol returns the most traded instrument, or the first instrument
+// of the feed if there was no trade.
+func (r *report) tradedSymbol() string {
+	counts := map[string]int{}
+	for _, f := range r.fills {
+		counts[f.Instrument]++
+	}
+	symbols := []string{}
+	for k := range r.barFrequency {
+		symbols = append(symbols, k)
+	}
+	sort.Strings(symbols)
+	res := ""
+	for _, s := range symbols {
+		if res == "" || counts[s] > counts[res] {
+			res = s
+		}
+	}
+	return res
+}
+
+func (r *report) priceChart(ds core.DataSeries, symbol string) *chart {
+	bars := make([]core.Bar, 0, ds.Len())
+	for i := 0; i < ds.Len(); i++ {
+		if _, v, err := ds.At(i); err == nil {
+			if bar, ok := v.(core.Bar); ok {
+				bars = append(bars, bar)
+			}
+		}
+	}
+	if len(bars) == 0 {
+		return nil
+	}
+
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, bar := range bars {
+		low = math.Min(low, bar.Low())
+		high = math.Max(high, bar.High())
+	}
+	c := newChart(low, high, len(bars))
+	c.Start = bars[0].DateTime().Format("2006-01-02")
+	c.End = bars[len(bars)-1].DateTime().Format("2006-01-02")
+
+	bodyWidth := round2(math.Max(c.step*0.7, 0.5))
+	for i, bar := range bars {
+		x := c.x(i)
+		top, bottom := c.y(math.Max(bar.Open(), bar.Close())), c.y(math.Min(bar.Open(), bar.Close()))
+		color := "#26a69a"
+		if bar.Close() < bar.Open() {
+			color = "#ef5350"
+		}
+		c.Candles = append(c.Candles, candle{
+			X:     x,
+			High:  c.y(bar.High()),
+			Low:   c.y(bar.Low()),
+			BodyX: x - bodyWidth/2,
+			BodyY: top,
+			BodyW: bodyWidth,
+			BodyH: math.Max(bottom-top, 0.5),
+			Color: color,
+			Title: candleTitle(bar),
+		})
+	}
+
+	// fills happen at the time of the bar they are filled against
+	for _, f := range r.fills {
+		if f.Instrument != symbol {
+			continue
+		}
+		i := sort.Search(len(bars), func(i int) bool {
+			return !bars[i].DateTime().Before(f.DateTime)
+		})
+		if i == len(bars) {
+			i = len(bars) - 1
+		}
+		x := c.x(i)
+		m := marker{
+			Title: fmt.Sprintf("%s %.4f @ %.4f", f.Action, f.Quantity, f.Price),
+		}
+		if f.Action.IsBuy() {
+			y := c.y(bars[i].Low()) + 4
+			m.Points = fmt.Sprintf("%.2f,%.2f %.2f,%.2f %.2f,%.2f", x, y, x-5, y+9, x+5, y+9)
+			m.Color = "#1565c0"
+		} else {
+			y := c.y(bars[i].High()) - 4
+			m.Points = fmt.Sprintf("%.2f,%.2f %.2f,%.2f %.2f,%.2f", x, y, x-5, y-9, x+5, y-9)
+			m.Color = "#e65100"
+		}
+		c.Markers = append(c.Markers, m)
+	}
+	return c
+}
+
+func candleTitle(bar core.Bar) string {
+	return fmt.Sprintf("%s O %.4f H %.4f L %.4f C %.4f V %d",
+		bar.DateTime().Format("2006-01-02 15:04"), bar.Open(), bar.High(), bar.Low(),
+		bar.Close(), bar.Volume())
+}
+
+// equityCharts returns the equity curve and the drawdown curve in percent
+func equityCharts(ds core.SequenceDataSeries) (*chart, *chart) {
+	if ds.Len() == 0 {
+		return nil, nil
+	}
+	equity := make([]float64, 0, ds.Len())
+	drawDown := make([]float64, 0, ds.Len())
+	highWaterMark := math.Inf(-1)
+	for i := 0; i < ds.Len(); i++ {
+		_, v, err := ds.At(i)
+		if err != nil {
+			continue
+		}
+		value := v.(float64)
+		highWaterMark = math.Max(highWaterMark, value)
+		equity = append(equity, value)
+		if highWaterMark > 0 {
+			drawDown = append(drawDown, (value/highWaterMark-1)*100)
+		} else {
+			drawDown = append(drawDown, 0)
+		}
+	}
+	start := ds.DateTimes()[0].Format("2006-01-02")
+	end := ds.DateTimes()[ds.Len()-1].Format("2006-01-02")
+	equityChart := lineChart(equity, "%.2f")
+	drawDownChart := lineChart(drawDown, "%.2f%%")
+	equityChart.Start, equityChart.End = start, end
+	drawDownChart.Start, drawDownChart.End = start, end
+	return equityChart, drawDownChart
+}
+
+func lineChart(values []float64, labelFormat string) *chart {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		low = math.Min(low, v)
+		high = math.Max(high, v)
+	}
+	c := newChart(low, high, len(values))
+	c.MinLabel = fmt.Sprintf(labelFormat, low)
+	c.MaxLabel = fmt.Sprintf(labelFormat, high)
+	points := make([]string, len(values))
+	for i, v := range values {
+		points[i] = fmt.Sprintf("%.2f,%.2f", c.x(i), c.y(v))
+	}
+	c.Line = strings.Join(points, " ")
+	return c
+}
+
+type chart struct {
+	Width, Height float64
+	Top, Bottom   float64
+	Left, Right   float64
+	MinLabel      string
+	MaxLabel      string
+	Start, End    string
+	Candles       []candle
+	Markers       []marker
+	Line          string
+
+	low, high float64
+	step      float64
+}
+
+func newChart(low, high float64, n int) *chart {
+	if high <= low {
+		// flat series, center them in the chart
+		low, high = low-1, high+1
+	}
+	c := &chart{
+		Width:    chartWidth,
+		Height:   chartHeight,
+		Top:      chartPad / 2,
+		Bottom:   chartHeight - chartPad/2,
+		Left:     chartPad,
+		Right:    chartWidth - chartPad/2,
+		MinLabel: fmt.Sprintf("%.4f", low),
+		MaxLabel: fmt.Sprintf("%.4f", high),
+		low:      low,
+		high:     high,
+	}
+	c.step = (c.Right - c.Left) / math.Max(float64(n), 1)
+	return c
+}
+
+func (c *chart) x(i int) float64 {
+	return round2(c.Left + (float64(i)+0.5)*c.step)
+}
+
+func (c *chart) y(v float64) float64 {
+	return round2(c.Top + (c.high-v)/(c.high-c.low)*(c.Bottom-c.Top))
+}
+
+// round2 keeps the generated svg small
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+type candle struct {
+	X, High, Low               float64
+	BodyX, BodyY, BodyW, BodyH float64
+	Color                      string
+	Title                      string
+}
+
+type marker struct {
+	Points string
+	Color  string
+	Title  string
+}
+
+type metricRow struct {
+	Name  string
+	Value string
+}
+
+type analyzerTable struct {
+	Name    string
+	Metrics []metricRow
+}
+
+type fillRow struct {
+	DateTime   string
+	Instrument string
+	Action     string
+	Price      string
+	Quantity   string
+	Commission string
+	Buy        bool
+}
+
+type reportData struct {
+	Generated string
+	Symbol    string
+	Start     string
+	End       string
+	Price     *chart
+	Equity    *chart
+	DrawDown  *chart
+	Analyzers []analyzerTable
+	Fills     []fillRow
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(reportHTML))
@@ -0,0 +1,56 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"goat/pkg/config"
+	"goat/pkg/core"
+)
+
+func TestReportWrite(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Broker.Cash = 1000
+	gen := core.NewBarFeedGenerator([]core.Frequency{core.DAY}, 100)
+	feed := core.NewGenericDataFeed(context.TODO(), cfg, gen, nil, 0, "")
+	broker, err := core.NewBacktestBroker(cfg, feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	portfolio := core.NewPortfolio(broker, feed, 0)
+	rpt := NewReport(feed, broker, portfolio)
+	analyzers := core.NewDefaultAnalyzers(portfolio)
+
+	tm := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		bt := tm.AddDate(0, 0, i)
+		price := 100 + float64(i)
+		gen.AppendNewValueToBuffer(bt, map[string]interface{}{
+			"GLD": core.NewBasicBar(bt, price, price+2, price-2, price+1, price+1, 1000, core.DAY),
+		}, core.DAY)
+	}
+	gen.Finish()
+
+	broker.SubmitOrder(core.NewMarketOrder(core.OrderActionBuy, "GLD", 2, false))
+	broker.Dispatch()
+	for !feed.Eof() {
+		feed.Dispatch()
+	}
+
+	buf := &bytes.Buffer{}
+	if err := rpt.Write(buf, analyzers); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	for _, s := range []string{
+		"Backtest report: GLD", "<polygon", "<polyline", "cumulativeReturn",
+		"<td>BUY</td>",
+	} {
+		if !strings.Contains(html, s) {
+			t.Error("report should contain", s)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package report
+
+const reportHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>GoAT backtest report{{if .Symbol}} - {{.Symbol}}{{end}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 24px; color: #212121; }
+h1 { font-size: 22px; margin-bottom: 4px; }
+h2 { font-size: 17px; margin-top: 28px; border-bottom: 1px solid #e0e0e0; padding-bottom: 4px; }
+.meta { color: #757575; font-size: 13px; }
+svg { width: 100%; height: auto; background: #fafafa; border: 1px solid #eeeeee; }
+svg text { font-size: 11px; fill: #616161; }
+.tables { display: flex; flex-wrap: wrap; gap: 16px; }
+table { border-collapse: collapse; font-size: 13px; }
+th, td { padding: 4px 10px; border-bottom: 1px solid #eeeeee; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+caption { text-align: left; font-weight: bold; padding: 4px 0; }
+.buy { color: #1565c0; }
+.sell { color: #e65100; }
+</style>
+</head>
+<body>
+<h1>Backtest report{{if .Symbol}}: {{.Symbol}}{{end}}</h1>
+<div class="meta">{{if .Start}}{{.Start}} to {{.End}} &middot; {{end}}generated {{.Generated}}</div>
+
+{{define "axes"}}
+<line x1="{{.Left}}" y1="{{.Top}}" x2="{{.Left}}" y2="{{.Bottom}}" stroke="#bdbdbd"/>
+<line x1="{{.Left}}" y1="{{.Bottom}}" x2="{{.Right}}" y2="{{.Bottom}}" stroke="#bdbdbd"/>
+<text x="{{.Left}}" y="{{.Top}}" text-anchor="end" dx="-4" dy="4">{{.MaxLabel}}</text>
+<text x="{{.Left}}" y="{{.Bottom}}" text-anchor="end" dx="-4">{{.MinLabel}}</text>
+<text x="{{.Left}}" y="{{.Bottom}}" dy="16">{{.Start}}</text>
+<text x="{{.Right}}" y="{{.Bottom}}" dy="16" text-anchor="end">{{.End}}</text>
+{{end}}
+
+{{with .Price}}
+<h2>Price</h2>
+<svg viewBox="0 0 {{.Width}} {{.Height}}" xmlns="http://www.w3.org/2000/svg">
+{{template "axes" .}}
+{{range .Candles}}<g><title>{{.Title}}</title><line x1="{{.X}}" y1="{{.High}}" x2="{{.X}}" y2="{{.Low}}" stroke="{{.Color}}" stroke-width="0.8"/><rect x="{{.BodyX}}" y="{{.BodyY}}" width="{{.BodyW}}" height="{{.BodyH}}" fill="{{.Color}}"/></g>
+{{end}}
+{{range .Markers}}<polygon points="{{.Points}}" fill="{{.Color}}"><title>{{.Title}}</title></polygon>
+{{end}}
+</svg>
+{{end}}
+
+{{with .Equity}}
+<h2>Equity</h2>
+<svg viewBox="0 0 {{.Width}} {{.Height}}" xmlns="http://www.w3.org/2000/svg">
+{{template "axes" .}}
+<polyline points="{{.Line}}" fill="none" stroke="#1565c0" stroke-width="1.5"/>
+</svg>
+{{end}}
+
+{{with .DrawDown}}
+<h2>Drawdown</h2>
+<svg viewBox="0 0 {{.Width}} {{.Height}}" xmlns="http://www.w3.org/2000/svg">
+{{template "axes" .}}
+<polyline points="{{.Line}}" fill="none" stroke="#c62828" stroke-width="1.5"/>
+</svg>
+{{end}}
+
+{{if .Analyzers}}
+<h2>Analyzers</h2>
+<div class="tables">
+{{range .Analyzers}}
+<table>
+<caption>{{.Name}}</caption>
+{{range .Metrics}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>
+{{end}}
+</table>
+{{end}}
+</div>
+{{end}}
+
+<h2>Fills</h2>
+{{if .Fills}}
+<table>
+<tr><th>Time</th><th>Instrument</th><th>Action</th><th>Quantity</th><th>Price</th><th>Commission</th></tr>
+{{range .Fills}}<tr class="{{if .Buy}}buy{{else}}sell{{end}}"><td>{{.DateTime}}</td><td>{{.Instrument}}</td><td>{{.Action}}</td><td>{{.Quantity}}</td><td>{{.Price}}</td><td>{{.Commission}}</td></tr>
+{{end}}
+</table>
+{{else}}
+<p class="meta">No fills.</p>
+{{end}}
+</body>
+</html>
+`
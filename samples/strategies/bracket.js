@@ -0,0 +1,67 @@
+// breakout strategy protected by bracket orders, every entry has a take
+// profit and an ATR trailing stop which are active once the entry is filled
+var params = system.declareParams({
+  lookback: { type: "integer", default: 20, min: 2 },
+  quantity: { type: "number", default: 100, min: 0 },
+  takeProfit: { type: "number", default: 0.1, min: 0 },
+  atrMultiple: { type: "number", default: 2, min: 0 },
+});
+var highs = {};
+
+addEventListener("onBars", function (bars) {
+  var bar = bars[0];
+  for (var symbol in bar) {
+    if (!(symbol in highs)) {
+      highs[symbol] = [];
+    }
+    var prevHighs = highs[symbol].slice();
+    highs[symbol].push(bar[symbol].high);
+    if (highs[symbol].length > params.lookback) {
+      highs[symbol].shift();
+    }
+    if (prevHighs.length < params.lookback) {
+      continue;
+    }
+    if (broker.position(symbol) != 0 || broker.openOrders(symbol).length > 0) {
+      continue;
+    }
+    var close = bar[symbol].close;
+    if (close > Math.max.apply(null, prevHighs)) {
+      broker.bracketOrder(
+        { type: "market", action: "buy", symbol: symbol, quantity: params.quantity },
+        {
+          takeProfit: close * (1 + params.takeProfit),
+          atrMultiple: params.atrMultiple,
+          atrPeriod: 14,
+        }
+      );
+    }
+  }
+});
+
+addEventListener("onOrderUpdated", function (args) {
+  var order = args[0];
+  console.log(
+    "order " +
+      order.id +
+      " " +
+      order.type +
+      " " +
+      order.action +
+      " " +
+      order.instrument +
+      " " +
+      order.state +
+      " filled " +
+      order.filled +
+      " @ " +
+      order.avgFillPrice.toFixed(2)
+  );
+});
+
+addEventListener("onFinish", function () {
+  console.log("cash: " + broker.cash().toFixed(2));
+  console.log("equity: " + portfolio.equity().toFixed(2));
+});
+
+system.start();
@@ -0,0 +1,63 @@
+// simple moving average crossover strategy using the simulated broker
+// period and quantity can be set with --param or tuned with goat optimize
+var params = system.declareParams({
+  period: { type: "integer", default: 20, min: 2 },
+  quantity: { type: "number", default: 100, min: 0 },
+});
+var period = params.period;
+var quantity = params.quantity;
+var closes = {};
+
+addEventListener("onBars", function (bars) {
+  var bar = bars[0];
+  for (var symbol in bar) {
+    if (!(symbol in closes)) {
+      closes[symbol] = [];
+    }
+    closes[symbol].push(bar[symbol].close);
+    if (closes[symbol].length > period + 1) {
+      closes[symbol].shift();
+    }
+    if (closes[symbol].length <= period) {
+      continue;
+    }
+
+    var sma = talib.Sma(closes[symbol], period);
+    var latestSma = sma[sma.length - 1];
+    var position = broker.position(symbol);
+    if (broker.openOrders(symbol).length > 0) {
+      continue;
+    }
+    if (bar[symbol].close > latestSma && position == 0) {
+      broker.marketOrder("buy", symbol, quantity);
+    } else if (bar[symbol].close < latestSma && position > 0) {
+      broker.marketOrder("sell", symbol, position);
+    }
+  }
+});
+
+addEventListener("onOrderUpdated", function (args) {
+  var order = args[0];
+  console.log(
+    "order " +
+      order.id +
+      " " +
+      order.action +
+      " " +
+      order.instrument +
+      " " +
+      order.state +
+      " filled " +
+      order.filled +
+      " @ " +
+      order.avgFillPrice.toFixed(2)
+  );
+});
+
+addEventListener("onFinish", function () {
+  console.log("cash: " + broker.cash().toFixed(2));
+  console.log("equity: " + portfolio.equity().toFixed(2));
+  console.log("realized pnl: " + portfolio.realizedPnL().toFixed(2));
+});
+
+system.start();